@@ -18,9 +18,12 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os/exec"
+	"strings"
 
 	"golang.org/x/oauth2/google"
 )
@@ -52,3 +55,36 @@ func HttpClientWithDefaultCredentials(ctx context.Context) (*http.Client, error)
 	}
 	return client, nil
 }
+
+// AccountFromFile returns the email of the service account whose key is in credsFile.
+func AccountFromFile(credsFile string) (string, error) {
+	jsonKey, err := ioutil.ReadFile(credsFile)
+	if err != nil {
+		return "", fmt.Errorf("error getting json key: %v", err)
+	}
+
+	var key struct {
+		ClientEmail string `json:"client_email"`
+	}
+	if err := json.Unmarshal(jsonKey, &key); err != nil {
+		return "", fmt.Errorf("error unmarshalling json key: %v", err)
+	}
+	if key.ClientEmail == "" {
+		return "", fmt.Errorf("json key %s has no client_email", credsFile)
+	}
+	return key.ClientEmail, nil
+}
+
+// DefaultAccount returns the account of the currently logged in gcloud user.
+func DefaultAccount(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "gcloud", "config", "get-value", "account").Output()
+	if err != nil {
+		return "", fmt.Errorf("error getting gcloud account: %v", err)
+	}
+
+	account := strings.TrimSpace(string(out))
+	if account == "" {
+		return "", fmt.Errorf("no gcloud account is set, run `gcloud auth login` first")
+	}
+	return account, nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBasicProvider tests that requests carry the basic auth credentials and that the broker's
+// certificate is verified against the CA bundle.
+func TestBasicProvider(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	testProvider(t, server, Config{Type: TypeBasic, Username: "user", Password: "secret", CAFile: writeCABundle(t, server)})
+}
+
+// TestBearerProvider tests that requests carry the bearer token.
+func TestBearerProvider(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	testProvider(t, server, Config{Type: TypeBearer, Token: "token", CAFile: writeCABundle(t, server)})
+}
+
+// TestMTLSProvider tests that the client certificate is presented to a broker which requires one,
+// and that the account is the common name of the certificate.
+func TestMTLSProvider(t *testing.T) {
+	certFile, keyFile, cert := writeClientCert(t, "broker-cli-test")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	config := Config{Type: TypeMTLS, CertFile: certFile, KeyFile: keyFile, CAFile: writeCABundle(t, server)}
+	testProvider(t, server, config)
+
+	provider, err := NewProvider(config)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewProvider: %v", err)
+	}
+	account, err := provider.Account(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error from Account: %v", err)
+	}
+	if account != "broker-cli-test" {
+		t.Fatalf("Account got %q, want %q", account, "broker-cli-test")
+	}
+}
+
+// TestProviderWithoutCABundle tests that the broker's self-signed certificate is rejected unless it
+// is in the CA bundle.
+func TestProviderWithoutCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	provider, err := NewProvider(Config{Type: TypeBearer, Token: "token"})
+	if err != nil {
+		t.Fatalf("Unexpected error from NewProvider: %v", err)
+	}
+	client, err := provider.HttpClient(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error from HttpClient: %v", err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("Got no error but want one for an untrusted certificate")
+	}
+}
+
+// TestNewProviderInvalidConfig tests that incomplete configs are rejected.
+func TestNewProviderInvalidConfig(t *testing.T) {
+	testCases := []Config{
+		{Type: "kerberos"},
+		{Type: TypeBasic, Username: "user"},
+		{Type: TypeBearer},
+		{Type: TypeMTLS, CertFile: "cert.pem"},
+	}
+
+	for _, tc := range testCases {
+		if _, err := NewProvider(tc); err == nil {
+			t.Errorf("NewProvider(%+v) got no error but want one", tc)
+		}
+	}
+}
+
+// testProvider checks that a client of the provider in config gets a successful response from
+// server.
+func testProvider(t *testing.T, server *httptest.Server, config Config) {
+	provider, err := NewProvider(config)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewProvider: %v", err)
+	}
+	client, err := provider.HttpClient(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error from HttpClient: %v", err)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error from Get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status code got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// writeCABundle writes the certificate of the TLS server to a temporary file and returns its path.
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	return writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+}
+
+// writeClientCert writes a self-signed client certificate with the given common name and its key
+// to temporary files. It returns the paths of the files and the parsed certificate.
+func writeClientCert(t *testing.T, commonName string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error marshalling key: %v", err)
+	}
+
+	return writePEM(t, "cert.pem", "CERTIFICATE", der), writePEM(t, "key.pem", "EC PRIVATE KEY", keyDER), cert
+}
+
+// writePEM writes a PEM block to a temporary file and returns its path.
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	dir, err := ioutil.TempDir("", "auth-test")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+	return path
+}
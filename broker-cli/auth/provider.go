@@ -0,0 +1,266 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// Supported authentication types.
+const (
+	TypeGoogle = "google"
+	TypeBasic  = "basic"
+	TypeBearer = "bearer"
+	TypeMTLS   = "mtls"
+	TypeNone   = "none"
+)
+
+// Provider authenticates requests to a service broker.
+type Provider interface {
+	// HttpClient returns an http client which authenticates every request it sends.
+	HttpClient(ctx context.Context) (*http.Client, error)
+	// Account returns the name of the account the requests are authenticated as.
+	Account(ctx context.Context) (string, error)
+}
+
+// Config holds the settings of all the authentication types. Only the fields used by Type need to
+// be set.
+type Config struct {
+	// Type is one of TypeGoogle, TypeBasic, TypeBearer, TypeMTLS and TypeNone.
+	Type string
+	// CredsFile is the service account key file for TypeGoogle. If empty, the gcloud credentials of
+	// the currently logged in user are used.
+	CredsFile string
+	// Username and Password are the credentials for TypeBasic.
+	Username string
+	Password string
+	// Token is the bearer token for TypeBearer.
+	Token string
+	// CertFile and KeyFile are the PEM encoded client certificate and key for TypeMTLS.
+	CertFile string
+	KeyFile  string
+	// CAFile is a PEM encoded bundle of certificate authorities used to verify the broker's
+	// certificate instead of the system roots. Optional for every type.
+	CAFile string
+}
+
+// NewProvider returns the Provider for the authentication type of the config.
+func NewProvider(config Config) (Provider, error) {
+	switch config.Type {
+	case TypeGoogle, "":
+		return &googleProvider{credsFile: config.CredsFile, caFile: config.CAFile}, nil
+	case TypeBasic:
+		if config.Username == "" || config.Password == "" {
+			return nil, fmt.Errorf("basic authentication requires a username and a password")
+		}
+		return &basicProvider{username: config.Username, password: config.Password, caFile: config.CAFile}, nil
+	case TypeBearer:
+		if config.Token == "" {
+			return nil, fmt.Errorf("bearer authentication requires a token")
+		}
+		return &bearerProvider{token: config.Token, caFile: config.CAFile}, nil
+	case TypeMTLS:
+		if config.CertFile == "" || config.KeyFile == "" {
+			return nil, fmt.Errorf("mTLS authentication requires a client certificate and key")
+		}
+		return &mtlsProvider{certFile: config.CertFile, keyFile: config.KeyFile, caFile: config.CAFile}, nil
+	case TypeNone:
+		return &noneProvider{caFile: config.CAFile}, nil
+	default:
+		return nil, fmt.Errorf("unknown authentication type %q, want one of %s, %s, %s, %s or %s", config.Type, TypeGoogle, TypeBasic, TypeBearer, TypeMTLS, TypeNone)
+	}
+}
+
+// googleProvider authenticates requests with Google OAuth tokens.
+type googleProvider struct {
+	credsFile string
+	caFile    string
+}
+
+// HttpClient is the method inherited from the Provider interface.
+func (p *googleProvider) HttpClient(ctx context.Context) (*http.Client, error) {
+	if p.caFile != "" {
+		transport, err := newTransport(p.caFile, nil)
+		if err != nil {
+			return nil, err
+		}
+		// The oauth2 package sends both token and API requests through the client in the context.
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+	}
+	if p.credsFile != "" {
+		return HttpClientFromFile(ctx, p.credsFile)
+	}
+	return HttpClientWithDefaultCredentials(ctx)
+}
+
+// Account is the method inherited from the Provider interface.
+func (p *googleProvider) Account(ctx context.Context) (string, error) {
+	if p.credsFile != "" {
+		return AccountFromFile(p.credsFile)
+	}
+	return DefaultAccount(ctx)
+}
+
+// basicProvider authenticates requests with HTTP basic authentication.
+type basicProvider struct {
+	username string
+	password string
+	caFile   string
+}
+
+// HttpClient is the method inherited from the Provider interface.
+func (p *basicProvider) HttpClient(ctx context.Context) (*http.Client, error) {
+	transport, err := newTransport(p.caFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.SetBasicAuth(p.username, p.password)
+			return transport.RoundTrip(req)
+		}),
+	}, nil
+}
+
+// Account is the method inherited from the Provider interface.
+func (p *basicProvider) Account(ctx context.Context) (string, error) {
+	return p.username, nil
+}
+
+// bearerProvider authenticates requests with a static bearer token.
+type bearerProvider struct {
+	token  string
+	caFile string
+}
+
+// HttpClient is the method inherited from the Provider interface.
+func (p *bearerProvider) HttpClient(ctx context.Context) (*http.Client, error) {
+	transport, err := newTransport(p.caFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: p.token}),
+			Base:   transport,
+		},
+	}, nil
+}
+
+// Account is the method inherited from the Provider interface. A bearer token is opaque, so the
+// account is unknown.
+func (p *bearerProvider) Account(ctx context.Context) (string, error) {
+	return "", fmt.Errorf("the account of a bearer token is unknown")
+}
+
+// mtlsProvider authenticates requests with a TLS client certificate.
+type mtlsProvider struct {
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+// HttpClient is the method inherited from the Provider interface.
+func (p *mtlsProvider) HttpClient(ctx context.Context) (*http.Client, error) {
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading client certificate %s and key %s: %v", p.certFile, p.keyFile, err)
+	}
+	transport, err := newTransport(p.caFile, &cert)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// Account is the method inherited from the Provider interface. It returns the common name of the
+// client certificate.
+func (p *mtlsProvider) Account(ctx context.Context) (string, error) {
+	cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return "", fmt.Errorf("error loading client certificate %s and key %s: %v", p.certFile, p.keyFile, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return "", fmt.Errorf("error parsing client certificate %s: %v", p.certFile, err)
+	}
+	if leaf.Subject.CommonName == "" {
+		return "", fmt.Errorf("client certificate %s has no common name", p.certFile)
+	}
+	return leaf.Subject.CommonName, nil
+}
+
+// noneProvider sends unauthenticated requests, e.g. to a local fake broker.
+type noneProvider struct {
+	caFile string
+}
+
+// HttpClient is the method inherited from the Provider interface.
+func (p *noneProvider) HttpClient(ctx context.Context) (*http.Client, error) {
+	transport, err := newTransport(p.caFile, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// Account is the method inherited from the Provider interface.
+func (p *noneProvider) Account(ctx context.Context) (string, error) {
+	return "", fmt.Errorf("requests are not authenticated")
+}
+
+// newTransport returns a clone of the default transport which trusts the certificate authorities
+// in caFile instead of the system roots if caFile is set, and presents cert to the server if cert
+// is set.
+func newTransport(caFile string, cert *tls.Certificate) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile == "" && cert == nil {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s contains no PEM encoded certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip is the method inherited from the http.RoundTripper interface.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -17,30 +17,38 @@
 package adapter
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
 )
 
 // Adapter is the interface to connect to service brokers and the admin service.
+// Every method takes a context which bounds the lifetime of the underlying requests; cancelling it
+// aborts any request in flight.
 type Adapter interface {
 	// Admin methods.
-	CreateBroker(params *CreateBrokerParams) (*osb.Broker, error)
-	DeleteBroker(params *DeleteBrokerParams) error
-	ListInstances(params *ListInstancesParams) (*ListInstancesResult, error)
-	ListBindings(params *ListBindingsParams) (*ListBindingsResult, error)
-	ListBrokers(params *ListBrokersParams) (*ListBrokersResult, error)
+	CreateBroker(ctx context.Context, params *CreateBrokerParams) (*osb.Broker, error)
+	DeleteBroker(ctx context.Context, params *DeleteBrokerParams) error
+	ListInstances(ctx context.Context, params *ListInstancesParams) (*ListInstancesResult, error)
+	ListBindings(ctx context.Context, params *ListBindingsParams) (*ListBindingsResult, error)
+	ListBrokers(ctx context.Context, params *ListBrokersParams) (*ListBrokersResult, error)
 
 	// OSB APIs.
-	GetCatalog(params *GetCatalogParams) (*GetCatalogResult, error)
-	CreateInstance(params *CreateInstanceParams) (*CreateInstanceResult, error)
-	DeleteInstance(params *DeleteInstanceParams) (*DeleteInstanceResult, error)
-	UpdateInstance(params *UpdateInstanceParams) (*UpdateInstanceResult, error)
-	InstanceLastOperation(params *InstanceLastOperationParams) (*Operation, error)
-	CreateBinding(params *CreateBindingParams) (*CreateBindingResult, error)
-	DeleteBinding(params *DeleteBindingParams) (*DeleteBindingResult, error)
-	BindingLastOperation(params *BindingLastOperationParams) (*Operation, error)
+	GetCatalog(ctx context.Context, params *GetCatalogParams) (*GetCatalogResult, error)
+	CreateInstance(ctx context.Context, params *CreateInstanceParams) (*CreateInstanceResult, error)
+	DeleteInstance(ctx context.Context, params *DeleteInstanceParams) (*DeleteInstanceResult, error)
+	UpdateInstance(ctx context.Context, params *UpdateInstanceParams) (*UpdateInstanceResult, error)
+	GetInstance(ctx context.Context, params *GetInstanceParams) (*GetInstanceResult, error)
+	InstanceLastOperation(ctx context.Context, params *InstanceLastOperationParams) (*Operation, error)
+	CreateBinding(ctx context.Context, params *CreateBindingParams) (*CreateBindingResult, error)
+	DeleteBinding(ctx context.Context, params *DeleteBindingParams) (*DeleteBindingResult, error)
+	GetBinding(ctx context.Context, params *GetBindingParams) (*GetBindingResult, error)
+	BindingLastOperation(ctx context.Context, params *BindingLastOperationParams) (*Operation, error)
 }
 
 // CreateBrokerParams is used as input to CreateBroker.
@@ -95,7 +103,17 @@ type GetCatalogParams struct {
 
 // GetCatalogResult is output of successful GetCatalog request.
 type GetCatalogResult struct {
-	Services []osb.Service
+	Services []osb.Service `json:"services"`
+}
+
+// OriginatingIdentity is the identity of the platform user on whose behalf an OSB request is made.
+type OriginatingIdentity struct {
+	// Platform is the name of the platform the user belongs to, e.g. "kubernetes" or
+	// "cloudfoundry".
+	Platform string
+	// Value is the platform-specific identity of the user, e.g. {"username": "jane@example.com"}
+	// for Kubernetes.
+	Value map[string]interface{}
 }
 
 // CreateInstanceParams stores the parameters used to create an instance.
@@ -128,41 +146,60 @@ type CreateInstanceParams struct {
 	SpaceGUID string
 	// Parameters is a set of configuration options for the service instance. Optional.
 	Parameters map[string]interface{}
+	// OriginatingIdentity identifies the user of the platform on whose behalf the request is made.
+	// It is sent in the X-Broker-API-Originating-Identity header. Optional.
+	OriginatingIdentity *OriginatingIdentity
+	// RequestIdentity is a correlation ID for the request, typically a UUID, sent in the
+	// X-Broker-API-Request-Identity header so that the request can be traced in the broker's logs.
+	// Optional.
+	RequestIdentity string
 }
 
 // CreateInstanceResult is the result of a successful instance creation request.
 type CreateInstanceResult struct {
 	// Async indicates whether the broker is handling the provision request asynchronously.
-	Async bool
+	Async bool `json:"async"`
 	// DashboardURL is the URL of a web-based management user interface for the service instance.
-	DashboardURL string
+	DashboardURL string `json:"dashboard_url,omitempty"`
 	// OperationID is an extra identifier supplied by the broker to identify asynchronous operations.
 	// It should be an empty string if the request is completed synchronously.
-	OperationID string
+	OperationID string `json:"operation,omitempty"`
 }
 
-// ListInstancesParams stores the parameters used to list instances in a broker.
+// ListInstancesParams stores the parameters used to list a page of the instances in a broker.
 type ListInstancesParams struct {
 	// Server is the URL for the broker.
 	Server string
+	// PageSize is the maximum number of instances in the page. 0 lets the broker decide.
+	PageSize int
+	// PageToken is the NextPageToken of the previous page, or empty for the first page.
+	PageToken string
 }
 
 // ListInstancesResult is the output from ListInstances.
 type ListInstancesResult struct {
 	Instances []*osb.Instance `json:"instances"`
+	// NextPageToken requests the next page, and is empty for the last page.
+	NextPageToken string `json:"nextPageToken,omitempty"`
 }
 
-// ListBindingsParams stores the parameters used to list bindings to an instance.
+// ListBindingsParams stores the parameters used to list a page of the bindings to an instance.
 type ListBindingsParams struct {
 	// Server is the URL for the broker.
 	Server string
 	// UUID representing the instance.
 	InstanceID string
+	// PageSize is the maximum number of bindings in the page. 0 lets the broker decide.
+	PageSize int
+	// PageToken is the NextPageToken of the previous page, or empty for the first page.
+	PageToken string
 }
 
 // ListBindingsResult is the output from ListBindings.
 type ListBindingsResult struct {
 	Bindings []*osb.Binding `json:"bindings"`
+	// NextPageToken requests the next page, and is empty for the last page.
+	NextPageToken string `json:"nextPageToken,omitempty"`
 }
 
 // DeleteInstanceParams stores the parameters used to delete an instance.
@@ -183,15 +220,22 @@ type DeleteInstanceParams struct {
 	ServiceID string
 	// PlanID is the ID of the plan to use for the service instance.
 	PlanID string
+	// OriginatingIdentity identifies the user of the platform on whose behalf the request is made.
+	// It is sent in the X-Broker-API-Originating-Identity header. Optional.
+	OriginatingIdentity *OriginatingIdentity
+	// RequestIdentity is a correlation ID for the request, typically a UUID, sent in the
+	// X-Broker-API-Request-Identity header so that the request can be traced in the broker's logs.
+	// Optional.
+	RequestIdentity string
 }
 
 // DeleteInstanceResult is the result of a successful instance deletion request.
 type DeleteInstanceResult struct {
 	// Async indicates whether the broker is handling the deprovision request asynchronously.
-	Async bool
+	Async bool `json:"async"`
 	// OperationID is an extra identifier supplied by the broker to identify asynchronous operations.
 	// It should be an empty string if the request is completed synchronously.
-	OperationID string
+	OperationID string `json:"operation,omitempty"`
 }
 
 // UpdateInstanceParams stores the parameters used to update an instance.
@@ -223,15 +267,51 @@ type UpdateInstanceParams struct {
 	PreviousOrganizationID string
 	// PreviousSpaceID is the ID of the space specified for the service instance.
 	PreviousSpaceID string
+	// OriginatingIdentity identifies the user of the platform on whose behalf the request is made.
+	// It is sent in the X-Broker-API-Originating-Identity header. Optional.
+	OriginatingIdentity *OriginatingIdentity
+	// RequestIdentity is a correlation ID for the request, typically a UUID, sent in the
+	// X-Broker-API-Request-Identity header so that the request can be traced in the broker's logs.
+	// Optional.
+	RequestIdentity string
 }
 
 // UpdateInstanceResult is the result of a successful instance update request.
 type UpdateInstanceResult struct {
 	// Async indicates whether the broker is handling the update request asynchronously.
-	Async bool
+	Async bool `json:"async"`
 	// OperationID is an extra identifier supplied by the broker to identify asynchronous operations.
 	// It should be an empty string if the request is completed synchronously.
-	OperationID string
+	OperationID string `json:"operation,omitempty"`
+}
+
+// GetInstanceParams stores the parameters used to fetch an instance.
+type GetInstanceParams struct {
+	// Server is the URL for the broker.
+	Server string
+	// APIVersion is the header value associated with the version of the Open Service Broker API used
+	// by the request.
+	APIVersion string
+	// InstanceID is the ID of the service instance to fetch.
+	InstanceID string
+	// ServiceID is the ID of the service used by the service instance. Optional.
+	ServiceID string
+	// PlanID is the ID of the plan used by the service instance. Optional.
+	PlanID string
+}
+
+// GetInstanceResult is the result of a successful instance fetch request.
+type GetInstanceResult struct {
+	// ServiceID is the ID of the service used by the service instance.
+	ServiceID string `json:"service_id"`
+	// PlanID is the ID of the plan used by the service instance.
+	PlanID string `json:"plan_id"`
+	// DashboardURL is the URL of a web-based management user interface for the service instance.
+	DashboardURL string `json:"dashboard_url,omitempty"`
+	// Parameters is the set of configuration options of the service instance.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	// MaintenanceInfo is the maintenance info currently applied to the service instance.
+	MaintenanceInfo *osb.MaintenanceInfo `json:"maintenance_info,omitempty"`
 }
 
 // CreateBindingParams stores the parameters used to create a binding.
@@ -263,28 +343,35 @@ type CreateBindingParams struct {
 	BindResource map[string]interface{}
 	// Parameters is a set of configuration options for the service binding. Optional.
 	Parameters map[string]interface{}
+	// OriginatingIdentity identifies the user of the platform on whose behalf the request is made.
+	// It is sent in the X-Broker-API-Originating-Identity header. Optional.
+	OriginatingIdentity *OriginatingIdentity
+	// RequestIdentity is a correlation ID for the request, typically a UUID, sent in the
+	// X-Broker-API-Request-Identity header so that the request can be traced in the broker's logs.
+	// Optional.
+	RequestIdentity string
 }
 
 // CreateBindingResult is the result of a successful binding creation request.
 type CreateBindingResult struct {
 	// Async indicates whether the broker is handling the bind request asynchronously.
-	Async bool
+	Async bool `json:"async"`
 	// Credentials is a free-form hash of credentials that can be used by applications or users to
 	// access the service.
-	Credentials map[string]interface{}
+	Credentials map[string]interface{} `json:"credentials,omitempty"`
 	// SyslogDrainURl is a URL to which logs must be streamed. CF-specific. May only be supplied by a
 	// service that declares a requirement for the 'syslog_drain' permission.
-	SyslogDrainURL *string
+	SyslogDrainURL *string `json:"syslog_drain_url,omitempty"`
 	// RouteServiceURL is a URL to which the platform must proxy requests to the application the
 	// binding is for. CF-specific. May only be supplied by a service that declares a requirement for
 	// the 'route_service' permission.
-	RouteServiceURL *string
+	RouteServiceURL *string `json:"route_service_url,omitempty"`
 	// VolumeMounts is an array of configuration string for mounting volumes. CF-specific. May only be
 	// supplied by a service that declares a requirement for the 'volume_mount' permission.
-	VolumeMounts []interface{}
+	VolumeMounts []interface{} `json:"volume_mounts,omitempty"`
 	// OperationID is an extra identifier supplied by the broker to identify asynchronous operations.
 	// It should be an empty string if the request is completed synchronously.
-	OperationID string
+	OperationID string `json:"operation,omitempty"`
 }
 
 // DeleteBindingParams stores the parameters used to delete a binding.
@@ -307,15 +394,55 @@ type DeleteBindingParams struct {
 	ServiceID string
 	// PlanID is the ID of the plan to use for the service binding.
 	PlanID string
+	// OriginatingIdentity identifies the user of the platform on whose behalf the request is made.
+	// It is sent in the X-Broker-API-Originating-Identity header. Optional.
+	OriginatingIdentity *OriginatingIdentity
+	// RequestIdentity is a correlation ID for the request, typically a UUID, sent in the
+	// X-Broker-API-Request-Identity header so that the request can be traced in the broker's logs.
+	// Optional.
+	RequestIdentity string
 }
 
 // DeleteBindingResult is the result of a successful binding deletion request.
 type DeleteBindingResult struct {
 	// Async indicates whether the broker is handling the bind request asynchronously.
-	Async bool
+	Async bool `json:"async"`
 	// OperationID is an extra identifier supplied by the broker to identify asynchronous operations.
 	// It should be an empty string if the request is completed synchronously.
-	OperationID string
+	OperationID string `json:"operation,omitempty"`
+}
+
+// GetBindingParams stores the parameters used to fetch a binding.
+type GetBindingParams struct {
+	// Server is the URL for the broker.
+	Server string
+	// APIVersion is the header value associated with the version of the Open Service Broker API used
+	// by the request.
+	APIVersion string
+	// InstanceID is the ID of the service instance that the binding binds to.
+	InstanceID string
+	// BindingID is the ID of the service binding to fetch.
+	BindingID string
+	// ServiceID is the ID of the service used by the service binding. Optional.
+	ServiceID string
+	// PlanID is the ID of the plan used by the service binding. Optional.
+	PlanID string
+}
+
+// GetBindingResult is the result of a successful binding fetch request.
+type GetBindingResult struct {
+	// Credentials is a free-form hash of credentials that can be used by applications or users to
+	// access the service.
+	Credentials map[string]interface{} `json:"credentials,omitempty"`
+	// SyslogDrainURl is a URL to which logs must be streamed. CF-specific.
+	SyslogDrainURL *string `json:"syslog_drain_url,omitempty"`
+	// RouteServiceURL is a URL to which the platform must proxy requests to the application the
+	// binding is for. CF-specific.
+	RouteServiceURL *string `json:"route_service_url,omitempty"`
+	// VolumeMounts is an array of configuration string for mounting volumes. CF-specific.
+	VolumeMounts []interface{} `json:"volume_mounts,omitempty"`
+	// Parameters is the set of configuration options of the service binding.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
 }
 
 // LastOperationParams contains the common params used to poll last operation of the resource.
@@ -359,11 +486,30 @@ type BindingLastOperationParams struct {
 // Operation is the result of a successful operation polling request.
 type Operation struct {
 	// State is the state of the queried operation.
-	State string
+	State string `json:"state"`
 	// Description is a message from the broker describing the current state of the operation.
-	Description string
+	Description string `json:"description,omitempty"`
+	// RetryAfter is the delay the broker asks for in the Retry-After header of its response, or 0 if
+	// it doesn't ask for one. Clients polling the operation should wait at least RetryAfter before
+	// polling again.
+	RetryAfter time.Duration `json:"-"`
 }
 
+// Error codes defined by the Open Service Broker API for failed requests.
+const (
+	// ErrorAsyncRequired means that the broker only supports asynchronous processing of the request,
+	// which must be retried with accepts_incomplete=true.
+	ErrorAsyncRequired = "AsyncRequired"
+	// ErrorConcurrency means that the broker does not support concurrent requests which mutate the
+	// same resource.
+	ErrorConcurrency = "ConcurrencyError"
+	// ErrorRequiresApp means that the broker requires the binding to be for an application.
+	ErrorRequiresApp = "RequiresApp"
+	// ErrorMaintenanceInfoConflict means that the maintenance info in the request doesn't match the
+	// one in the catalog.
+	ErrorMaintenanceInfoConflict = "MaintenanceInfoConflict"
+)
+
 // BrokerError is the result of a failed broker request.
 type BrokerError struct {
 	// StatusCode is the HTTP status code returned by the broker.
@@ -372,6 +518,17 @@ type BrokerError struct {
 	ErrorDescription string
 	// ErrorBody is the response body returned by the broker.
 	ErrorBody string
+	// ErrorCode is the machine readable error code returned by the broker, e.g. "AsyncRequired". For
+	// GCP brokers, it is the status of the error, e.g. "NOT_FOUND".
+	ErrorCode string
+	// ErrorMessage is the human readable description of the error returned by the broker.
+	ErrorMessage string
+	// InstanceUsable is set by the broker when an update or deprovision of a service instance
+	// failed, to tell whether the instance can still be used. Nil if the broker didn't set it.
+	InstanceUsable *bool
+	// UpdateRepeatable is set by the broker when an update of a service instance failed, to tell
+	// whether the update can be repeated. Nil if the broker didn't set it.
+	UpdateRepeatable *bool
 }
 
 // Error is the method inherited from "error" interface to print the error.
@@ -386,5 +543,85 @@ func (e *BrokerError) Error() string {
 		description = e.ErrorDescription
 	}
 
-	return fmt.Sprintf("StatusCode: %s\n Description: %s\n Details: %s", code, description, e.ErrorBody)
+	msg := fmt.Sprintf("StatusCode: %s\n Description: %s\n", code, description)
+	if e.ErrorCode != "" {
+		msg += fmt.Sprintf(" Error: %s\n", e.ErrorCode)
+	}
+	if e.ErrorMessage != "" {
+		msg += fmt.Sprintf(" Message: %s\n", e.ErrorMessage)
+	}
+	if e.InstanceUsable != nil {
+		msg += fmt.Sprintf(" InstanceUsable: %t\n", *e.InstanceUsable)
+	}
+	if e.UpdateRepeatable != nil {
+		msg += fmt.Sprintf(" UpdateRepeatable: %t\n", *e.UpdateRepeatable)
+	}
+	return msg + fmt.Sprintf(" Details: %s", e.ErrorBody)
+}
+
+// OrphanMitigationError is the error of a request creating a service instance or binding after
+// which the broker may have created the resource anyway, e.g. since the request timed out or the
+// broker returned a 5xx code. The OSB API requires platforms to delete such resources, which is
+// called orphan mitigation.
+type OrphanMitigationError struct {
+	Err error
+}
+
+// Error is the method inherited from "error" interface to print the error.
+func (e *OrphanMitigationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the request, e.g. a BrokerError.
+func (e *OrphanMitigationError) Unwrap() error {
+	return e.Err
+}
+
+// NeedsOrphanMitigation returns true iff err is an OrphanMitigationError, i.e. the resource which
+// the failed request created may exist.
+func NeedsOrphanMitigation(err error) bool {
+	var orphanErr *OrphanMitigationError
+	return errors.As(err, &orphanErr)
+}
+
+// IsAsyncRequired returns true iff err is a BrokerError telling that the broker only supports
+// asynchronous processing of the request.
+func IsAsyncRequired(err error) bool {
+	return hasErrorCode(err, http.StatusUnprocessableEntity, ErrorAsyncRequired)
+}
+
+// IsConcurrencyError returns true iff err is a BrokerError telling that another operation is in
+// progress for the same resource.
+func IsConcurrencyError(err error) bool {
+	return hasErrorCode(err, http.StatusUnprocessableEntity, ErrorConcurrency)
+}
+
+// IsRequiresApp returns true iff err is a BrokerError telling that the binding must be for an
+// application.
+func IsRequiresApp(err error) bool {
+	return hasErrorCode(err, http.StatusUnprocessableEntity, ErrorRequiresApp)
+}
+
+// IsMaintenanceInfoConflict returns true iff err is a BrokerError telling that the maintenance info
+// of the request conflicts with the catalog.
+func IsMaintenanceInfoConflict(err error) bool {
+	return hasErrorCode(err, http.StatusUnprocessableEntity, ErrorMaintenanceInfoConflict)
+}
+
+// IsInstanceUnusable returns true iff err is a BrokerError in which the broker reported that the
+// service instance can no longer be used.
+func IsInstanceUnusable(err error) bool {
+	var brokerErr *BrokerError
+	return errors.As(err, &brokerErr) && brokerErr.InstanceUsable != nil && !*brokerErr.InstanceUsable
+}
+
+// IsGone returns true iff err is a BrokerError telling that the resource doesn't exist.
+func IsGone(err error) bool {
+	var brokerErr *BrokerError
+	return errors.As(err, &brokerErr) && brokerErr.StatusCode == http.StatusGone
+}
+
+func hasErrorCode(err error, statusCode int, errorCode string) bool {
+	var brokerErr *BrokerError
+	return errors.As(err, &brokerErr) && brokerErr.StatusCode == statusCode && brokerErr.ErrorCode == errorCode
 }
@@ -0,0 +1,280 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// redacted replaces secrets in recorded interactions.
+const redacted = "REDACTED"
+
+// redactedHeaders are the headers whose values are replaced when recording.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Cassette is a list of recorded request and response pairs, stored as JSON.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and the response to it.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the part of a request which is recorded.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the part of a response which is recorded.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// LoadCassette reads a cassette from a file.
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cassette: %v", err)
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("error unmarshalling cassette %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette to a file, readable only by the current user.
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling cassette: %v", err)
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return fmt.Errorf("error writing cassette: %v", err)
+	}
+	return nil
+}
+
+// recordingClient is a DoClient which records every request and its response to a cassette.
+type recordingClient struct {
+	client DoClient
+	path   string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecordingClient returns a DoClient which sends requests through client, and records them to
+// the cassette file at path. The file is rewritten after every request, so that the interactions
+// so far are kept if the command is interrupted. Authorization headers and binding credentials are
+// redacted. Requests which fail without a response are not recorded.
+func NewRecordingClient(client DoClient, path string) DoClient {
+	return &recordingClient{
+		client: client,
+		path:   path,
+	}
+}
+
+// Do is the method inherited from the DoClient interface.
+func (c *recordingClient) Do(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %v", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %v", err)
+	}
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header),
+			Body:   string(reqBody),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header),
+			Body:       string(redactCredentials(respBody)),
+		},
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cassette.Interactions = append(c.cassette.Interactions, interaction)
+	if err := c.cassette.Save(c.path); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RequestMatcher decides whether a recorded request matches a request to be replayed. body is the
+// body of req, which has already been consumed.
+type RequestMatcher func(req *http.Request, body []byte, recorded *RecordedRequest) bool
+
+// MatchMethodAndURL matches requests with the same method and URL, including the query.
+func MatchMethodAndURL(req *http.Request, body []byte, recorded *RecordedRequest) bool {
+	return req.Method == recorded.Method && req.URL.String() == recorded.URL
+}
+
+// MatchMethodURLAndBody matches requests with the same method, URL and JSON body.
+func MatchMethodURLAndBody(req *http.Request, body []byte, recorded *RecordedRequest) bool {
+	return MatchMethodAndURL(req, body, recorded) && jsonEqual(body, []byte(recorded.Body))
+}
+
+// replayingClient is a DoClient which serves responses from a cassette.
+type replayingClient struct {
+	match RequestMatcher
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// NewReplayingClient returns a DoClient which serves the responses recorded in a cassette without
+// sending any request. Every request is answered with the first unused interaction whose request
+// matches, so that repeated requests such as last operation polls are answered in the recorded
+// order. A request without a matching interaction fails.
+func NewReplayingClient(cassette *Cassette, match RequestMatcher) DoClient {
+	return &replayingClient{
+		match:    match,
+		cassette: cassette,
+		used:     make([]bool, len(cassette.Interactions)),
+	}
+}
+
+// Do is the method inherited from the DoClient interface.
+func (c *replayingClient) Do(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.cassette.Interactions {
+		interaction := &c.cassette.Interactions[i]
+		if c.used[i] || !c.match(req, body, &interaction.Request) {
+			continue
+		}
+
+		c.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Header:        interaction.Response.Header,
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte(interaction.Response.Body))),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction matches request %s %s", req.Method, req.URL)
+}
+
+// readBody reads and returns the body, and replaces it with a reader of the same content.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// redactHeader returns a copy of header with the values of sensitive headers redacted.
+func redactHeader(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	ret := header.Clone()
+	for _, key := range redactedHeaders {
+		if _, ok := ret[key]; ok {
+			ret.Set(key, redacted)
+		}
+	}
+	return ret
+}
+
+// redactCredentials replaces every value under a "credentials" key of a JSON body, as returned
+// when binding and fetching bindings. Bodies which aren't JSON objects are returned unchanged.
+func redactCredentials(body []byte) []byte {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return body
+	}
+	creds, ok := obj["credentials"]
+	if !ok {
+		return body
+	}
+	obj["credentials"] = redactValues(creds)
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+// redactValues returns v with every leaf value replaced.
+func redactValues(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = redactValues(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValues(value)
+		}
+		return v
+	default:
+		return redacted
+	}
+}
+
+// jsonEqual returns whether a and b are equal JSON documents, or equal strings if either isn't
+// JSON.
+func jsonEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRecordAndReplay tests that a recorded session can be replayed without the server, and that
+// secrets are redacted from the cassette.
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"credentials": {"password": "hunter2", "hosts": ["db.example.com"]}}`))
+	}))
+	dir, err := ioutil.TempDir("", "cassette-test")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	params := &CreateBindingParams{
+		Server:     server.URL,
+		APIVersion: "2.13",
+		InstanceID: "instance",
+		BindingID:  "binding",
+		ServiceID:  "service",
+		PlanID:     "plan",
+	}
+	recorder := NewRecordingClient(&MockDoClient{
+		do: func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("Authorization", "Bearer secret-token")
+			return server.Client().Do(req)
+		},
+	}, path)
+	if _, err := NewHttpAdapter(recorder).CreateBinding(context.Background(), params); err != nil {
+		t.Fatalf("Unexpected error from CreateBinding: %v", err)
+	}
+	server.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading cassette: %v", err)
+	}
+	for _, secret := range []string{"hunter2", "db.example.com", "secret-token"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("Cassette contains secret %q:\n%s", secret, b)
+		}
+	}
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from LoadCassette: %v", err)
+	}
+	replayer := NewHttpAdapter(NewReplayingClient(cassette, MatchMethodURLAndBody))
+	res, err := replayer.CreateBinding(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Unexpected error from replayed CreateBinding: %v", err)
+	}
+	if res.Credentials["password"] != redacted {
+		t.Fatalf("Replayed credentials got %+v, want redacted password", res.Credentials)
+	}
+
+	// Every interaction is only replayed once.
+	if _, err := replayer.CreateBinding(context.Background(), params); err == nil {
+		t.Fatal("Got no error but want one when the cassette is used up")
+	}
+}
+
+// TestReplayMatchers tests that requests are matched according to the matcher.
+func TestReplayMatchers(t *testing.T) {
+	cassette := &Cassette{
+		Interactions: []Interaction{
+			{
+				Request:  RecordedRequest{Method: http.MethodPut, URL: "https://broker/v2/service_instances/i", Body: `{"plan_id": "a"}`},
+				Response: RecordedResponse{StatusCode: http.StatusCreated, Body: "{}"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		match RequestMatcher
+		body  string
+		want  bool
+	}{
+		{match: MatchMethodAndURL, body: `{"plan_id": "b"}`, want: true},
+		{match: MatchMethodURLAndBody, body: `{"plan_id":"a"}`, want: true},
+		{match: MatchMethodURLAndBody, body: `{"plan_id": "b"}`, want: false},
+	}
+
+	for i, tc := range testCases {
+		client := NewReplayingClient(cassette, tc.match)
+		req, _ := http.NewRequest(http.MethodPut, "https://broker/v2/service_instances/i", strings.NewReader(tc.body))
+		_, err := client.Do(req)
+		if (err == nil) != tc.want {
+			t.Errorf("Test case %d: got error %v, want match: %t", i, err, tc.want)
+		}
+	}
+}
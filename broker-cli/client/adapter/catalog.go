@@ -0,0 +1,261 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+// Kinds of requests which a plan may publish a parameters schema for.
+const (
+	SchemaInstanceCreate = "service_instance.create"
+	SchemaInstanceUpdate = "service_instance.update"
+	SchemaBindingCreate  = "service_binding.create"
+)
+
+// FindService returns the service with the given ID, or nil if the catalog doesn't have it.
+func (res *GetCatalogResult) FindService(serviceID string) *osb.Service {
+	for i := range res.Services {
+		if res.Services[i].ID == serviceID {
+			return &res.Services[i]
+		}
+	}
+	return nil
+}
+
+// FindPlan returns the service and plan with the given IDs. The plan is nil if the catalog
+// doesn't have it, and both are nil if the catalog doesn't have the service.
+func (res *GetCatalogResult) FindPlan(serviceID, planID string) (*osb.Service, *osb.Plan) {
+	svc := res.FindService(serviceID)
+	if svc == nil {
+		return nil, nil
+	}
+	for i := range svc.Plans {
+		if svc.Plans[i].ID == planID {
+			return svc, &svc.Plans[i]
+		}
+	}
+	return svc, nil
+}
+
+// FindServiceByName returns the service with the given name. The error suggests similar names if
+// the catalog has no such service, and lists the IDs of the services if several have the name.
+func (res *GetCatalogResult) FindServiceByName(name string) (*osb.Service, error) {
+	var matches []*osb.Service
+	var names []string
+	for i := range res.Services {
+		if res.Services[i].Name == name {
+			matches = append(matches, &res.Services[i])
+		}
+		names = append(names, res.Services[i].Name)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("the catalog has no service named %q%s", name, didYouMean(name, names))
+	case 1:
+		return matches[0], nil
+	default:
+		var ids []string
+		for _, svc := range matches {
+			ids = append(ids, fmt.Sprintf("%q", svc.ID))
+		}
+		return nil, fmt.Errorf("the service name %q is ambiguous, it is used by the services with IDs %s", name, strings.Join(ids, ", "))
+	}
+}
+
+// FindPlanByName returns the plan with the given name, and its service. If svc is nil, the plan is
+// looked up in all services, and the error lists the services if several have a plan of that name.
+// The error suggests similar names if no service has such a plan.
+func (res *GetCatalogResult) FindPlanByName(svc *osb.Service, name string) (*osb.Service, *osb.Plan, error) {
+	services := []*osb.Service{svc}
+	if svc == nil {
+		services = nil
+		for i := range res.Services {
+			services = append(services, &res.Services[i])
+		}
+	}
+
+	var matchServices []*osb.Service
+	var matchPlans []*osb.Plan
+	var names []string
+	for _, s := range services {
+		for i := range s.Plans {
+			if s.Plans[i].Name == name {
+				matchServices = append(matchServices, s)
+				matchPlans = append(matchPlans, &s.Plans[i])
+			}
+			names = append(names, s.Plans[i].Name)
+		}
+	}
+
+	switch len(matchPlans) {
+	case 0:
+		if svc != nil {
+			return nil, nil, fmt.Errorf("the service %q has no plan named %q%s", svc.Name, name, didYouMean(name, names))
+		}
+		return nil, nil, fmt.Errorf("the catalog has no plan named %q%s", name, didYouMean(name, names))
+	case 1:
+		return matchServices[0], matchPlans[0], nil
+	default:
+		var owners []string
+		for _, s := range matchServices {
+			owners = append(owners, fmt.Sprintf("%q (ID %q)", s.Name, s.ID))
+		}
+		return nil, nil, fmt.Errorf("the plan name %q is ambiguous, it is used by the services %s", name, strings.Join(owners, ", "))
+	}
+}
+
+// didYouMean returns a suggestion of the candidates which are most similar to name, or "" if none
+// is similar enough to be a likely typo.
+func didYouMean(name string, candidates []string) string {
+	type scored struct {
+		name     string
+		distance int
+	}
+	seen := make(map[string]bool)
+	var similar []scored
+	maxDistance := len(name) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	for _, candidate := range candidates {
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+
+		lower, lowerName := strings.ToLower(candidate), strings.ToLower(name)
+		d := editDistance(lowerName, lower)
+		if d <= maxDistance || strings.HasPrefix(lower, lowerName) || strings.HasPrefix(lowerName, lower) {
+			similar = append(similar, scored{name: candidate, distance: d})
+		}
+	}
+	if len(similar) == 0 {
+		return ""
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].distance != similar[j].distance {
+			return similar[i].distance < similar[j].distance
+		}
+		return similar[i].name < similar[j].name
+	})
+	if len(similar) > 3 {
+		similar = similar[:3]
+	}
+	quoted := make([]string, len(similar))
+	for i, s := range similar {
+		quoted[i] = fmt.Sprintf("%q", s.name)
+	}
+	return ", did you mean " + strings.Join(quoted, " or ") + "?"
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(prev[j]+1, current[j-1]+1, prev[j-1]+cost)
+		}
+		prev = current
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	ret := values[0]
+	for _, v := range values[1:] {
+		if v < ret {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// IsPlanBindable returns whether the plan can be bound to, falling back to the default of its
+// service if the plan doesn't override it.
+func IsPlanBindable(svc *osb.Service, plan *osb.Plan) bool {
+	if plan.Bindable != nil {
+		return *plan.Bindable
+	}
+	return svc.Bindable
+}
+
+// IsPlanUpdateable returns whether instances of the plan can be updated to a different plan,
+// falling back to the default of its service if the plan doesn't override it.
+func IsPlanUpdateable(svc *osb.Service, plan *osb.Plan) bool {
+	if plan.PlanUpdateable != nil {
+		return *plan.PlanUpdateable
+	}
+	return svc.PlanUpdateable
+}
+
+// IsPlanFree returns whether the plan is free. The OSB API specifies plans to be free by default.
+func IsPlanFree(plan *osb.Plan) bool {
+	return plan.Free == nil || *plan.Free
+}
+
+// MaximumPollingDuration returns how long the last operation of an asynchronous request for the
+// plan may be polled. It returns 0 if the plan doesn't limit polling.
+func MaximumPollingDuration(plan *osb.Plan) time.Duration {
+	if plan == nil || plan.MaximumPollingDuration == nil || *plan.MaximumPollingDuration <= 0 {
+		return 0
+	}
+	return time.Duration(*plan.MaximumPollingDuration) * time.Second
+}
+
+// ParametersSchema returns the JSON schema of the parameters of the given kind of request for the
+// plan, or nil if the plan doesn't publish one.
+func ParametersSchema(plan *osb.Plan, kind string) map[string]interface{} {
+	if plan == nil || plan.Schemas == nil {
+		return nil
+	}
+
+	var schemas *map[string]interface{}
+	switch kind {
+	case SchemaInstanceCreate:
+		if plan.Schemas.ServiceInstance != nil {
+			schemas = plan.Schemas.ServiceInstance.Create
+		}
+	case SchemaInstanceUpdate:
+		if plan.Schemas.ServiceInstance != nil {
+			schemas = plan.Schemas.ServiceInstance.Update
+		}
+	case SchemaBindingCreate:
+		if plan.Schemas.ServiceBinding != nil {
+			schemas = plan.Schemas.ServiceBinding.Create
+		}
+	}
+	if schemas == nil {
+		return nil
+	}
+	params, _ := (*schemas)["parameters"].(map[string]interface{})
+	return params
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+var testCatalog = &GetCatalogResult{
+	Services: []osb.Service{
+		{ID: "s1", Name: "cloud-pubsub", Plans: []osb.Plan{{ID: "p1", Name: "beta"}, {ID: "p2", Name: "standard"}}},
+		{ID: "s2", Name: "cloud-sql", Plans: []osb.Plan{{ID: "p3", Name: "beta"}, {ID: "p4", Name: "mysql"}}},
+		{ID: "s3", Name: "dup", Plans: []osb.Plan{{ID: "p5", Name: "default"}}},
+		{ID: "s4", Name: "dup"},
+	},
+}
+
+func TestFindServiceByName(t *testing.T) {
+	testCases := []struct {
+		name    string
+		wantID  string
+		wantErr string
+	}{
+		{name: "cloud-sql", wantID: "s2"},
+		{name: "cloud-pubsb", wantErr: `did you mean "cloud-pubsub"?`},
+		{name: "cloud", wantErr: `did you mean "cloud-sql" or "cloud-pubsub"?`},
+		{name: "redis", wantErr: `the catalog has no service named "redis"`},
+		{name: "dup", wantErr: `is used by the services with IDs "s3", "s4"`},
+	}
+
+	for _, tc := range testCases {
+		svc, err := testCatalog.FindServiceByName(tc.name)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("FindServiceByName(%q) got error %v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || svc.ID != tc.wantID {
+			t.Errorf("FindServiceByName(%q) got %v, %v, want service %s", tc.name, svc, err, tc.wantID)
+		}
+	}
+}
+
+func TestFindPlanByName(t *testing.T) {
+	testCases := []struct {
+		service       *osb.Service
+		name          string
+		wantServiceID string
+		wantPlanID    string
+		wantErr       string
+	}{
+		{service: &testCatalog.Services[1], name: "beta", wantServiceID: "s2", wantPlanID: "p3"},
+		{name: "mysql", wantServiceID: "s2", wantPlanID: "p4"},
+		{name: "beta", wantErr: `is used by the services "cloud-pubsub" (ID "s1"), "cloud-sql" (ID "s2")`},
+		{service: &testCatalog.Services[0], name: "mysql", wantErr: `the service "cloud-pubsub" has no plan named "mysql"`},
+		{name: "standrd", wantErr: `did you mean "standard"?`},
+	}
+
+	for _, tc := range testCases {
+		svc, plan, err := testCatalog.FindPlanByName(tc.service, tc.name)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("FindPlanByName(%v, %q) got error %v, want %q", tc.service, tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || svc.ID != tc.wantServiceID || plan.ID != tc.wantPlanID {
+			t.Errorf("FindPlanByName(%v, %q) got %v, %v, %v, want %s, %s", tc.service, tc.name, svc, plan, err, tc.wantServiceID, tc.wantPlanID)
+		}
+	}
+}
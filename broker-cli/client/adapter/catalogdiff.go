@@ -0,0 +1,193 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+// Kinds of catalog changes.
+const (
+	ServiceAdded    = "service added"
+	ServiceRemoved  = "service removed"
+	ServiceRenamed  = "service renamed"
+	PlanAdded       = "plan added"
+	PlanRemoved     = "plan removed"
+	PlanRenamed     = "plan renamed"
+	BindableChanged = "bindable changed"
+	FreeChanged     = "free changed"
+	SchemaChanged   = "schema changed"
+)
+
+// CatalogChange is a difference between two catalogs. Services and plans are matched by ID.
+type CatalogChange struct {
+	Kind      string `json:"kind"`
+	ServiceID string `json:"service_id"`
+	// PlanID is empty for changes of services.
+	PlanID      string `json:"plan_id,omitempty"`
+	Description string `json:"description"`
+	// Breaking is true if the change may break users of the old catalog, e.g. since a plan they use
+	// was removed or a schema requires new parameters.
+	Breaking bool `json:"breaking"`
+}
+
+// DiffCatalogs returns the changes from the old to the new catalog, ordered by service and plan. A
+// removed or renamed service or plan is breaking, since instances, manifests and commands refer to
+// them. So are plans which are no longer bindable or free, and schemas which require new
+// parameters, drop parameters or change their types.
+func DiffCatalogs(old, new *GetCatalogResult) []*CatalogChange {
+	changes := []*CatalogChange{}
+	for i := range old.Services {
+		svc := &old.Services[i]
+		newSvc := new.FindService(svc.ID)
+		if newSvc == nil {
+			changes = append(changes, &CatalogChange{Kind: ServiceRemoved, ServiceID: svc.ID, Breaking: true,
+				Description: fmt.Sprintf("service %q was removed, along with its %d plans", svc.Name, len(svc.Plans))})
+			continue
+		}
+		if svc.Name != newSvc.Name {
+			changes = append(changes, &CatalogChange{Kind: ServiceRenamed, ServiceID: svc.ID, Breaking: true,
+				Description: fmt.Sprintf("service %q was renamed to %q", svc.Name, newSvc.Name)})
+		}
+		for j := range svc.Plans {
+			changes = append(changes, diffPlans(svc, &svc.Plans[j], newSvc)...)
+		}
+		for j := range newSvc.Plans {
+			if _, plan := old.FindPlan(svc.ID, newSvc.Plans[j].ID); plan == nil {
+				changes = append(changes, &CatalogChange{Kind: PlanAdded, ServiceID: svc.ID, PlanID: newSvc.Plans[j].ID,
+					Description: fmt.Sprintf("plan %q of service %q was added", newSvc.Plans[j].Name, newSvc.Name)})
+			}
+		}
+	}
+	for i := range new.Services {
+		if old.FindService(new.Services[i].ID) == nil {
+			changes = append(changes, &CatalogChange{Kind: ServiceAdded, ServiceID: new.Services[i].ID,
+				Description: fmt.Sprintf("service %q was added with %d plans", new.Services[i].Name, len(new.Services[i].Plans))})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].ServiceID != changes[j].ServiceID {
+			return changes[i].ServiceID < changes[j].ServiceID
+		}
+		return changes[i].PlanID < changes[j].PlanID
+	})
+	return changes
+}
+
+// diffPlans returns the changes of the plan of the old service in the new service.
+func diffPlans(svc *osb.Service, plan *osb.Plan, newSvc *osb.Service) []*CatalogChange {
+	var newPlan *osb.Plan
+	for i := range newSvc.Plans {
+		if newSvc.Plans[i].ID == plan.ID {
+			newPlan = &newSvc.Plans[i]
+		}
+	}
+	change := func(kind string, breaking bool, format string, a ...interface{}) *CatalogChange {
+		return &CatalogChange{Kind: kind, ServiceID: svc.ID, PlanID: plan.ID, Breaking: breaking,
+			Description: fmt.Sprintf("plan %q of service %q ", plan.Name, svc.Name) + fmt.Sprintf(format, a...)}
+	}
+	if newPlan == nil {
+		return []*CatalogChange{change(PlanRemoved, true, "was removed")}
+	}
+
+	var changes []*CatalogChange
+	if plan.Name != newPlan.Name {
+		changes = append(changes, change(PlanRenamed, true, "was renamed to %q", newPlan.Name))
+	}
+	if was, is := IsPlanBindable(svc, plan), IsPlanBindable(newSvc, newPlan); was != is {
+		changes = append(changes, change(BindableChanged, was, "is %s bindable", map[bool]string{true: "now", false: "no longer"}[is]))
+	}
+	if was, is := IsPlanFree(plan), IsPlanFree(newPlan); was != is {
+		changes = append(changes, change(FreeChanged, was, "is %s", map[bool]string{true: "now free", false: "no longer free"}[is]))
+	}
+	for _, kind := range []string{SchemaInstanceCreate, SchemaInstanceUpdate, SchemaBindingCreate} {
+		oldSchema, newSchema := ParametersSchema(plan, kind), ParametersSchema(newPlan, kind)
+		if reflect.DeepEqual(oldSchema, newSchema) {
+			continue
+		}
+		if breaking := breakingSchemaChanges(oldSchema, newSchema); len(breaking) > 0 {
+			changes = append(changes, change(SchemaChanged, true, "changed its %s schema: %s", kind, strings.Join(breaking, ", ")))
+		} else {
+			changes = append(changes, change(SchemaChanged, false, "changed its %s schema compatibly", kind))
+		}
+	}
+	return changes
+}
+
+// breakingSchemaChanges returns the changes of the top-level properties of the parameters schema
+// which may reject parameters that the old schema accepted.
+func breakingSchemaChanges(old, new map[string]interface{}) []string {
+	var breaking []string
+	oldProps, newProps := schemaProperties(old), schemaProperties(new)
+	for _, name := range sortedKeys(oldProps) {
+		newProp, ok := newProps[name]
+		switch {
+		case !ok:
+			breaking = append(breaking, fmt.Sprintf("%q was removed", name))
+		case !reflect.DeepEqual(schemaField(oldProps[name], "type"), schemaField(newProp, "type")):
+			breaking = append(breaking, fmt.Sprintf("the type of %q changed", name))
+		}
+	}
+	oldRequired := make(map[string]bool)
+	for _, name := range schemaRequired(old) {
+		oldRequired[name] = true
+	}
+	for _, name := range schemaRequired(new) {
+		if !oldRequired[name] {
+			breaking = append(breaking, fmt.Sprintf("%q is now required", name))
+		}
+	}
+	return breaking
+}
+
+// schemaProperties returns the properties of a JSON schema, by name.
+func schemaProperties(schema map[string]interface{}) map[string]interface{} {
+	props, _ := schema["properties"].(map[string]interface{})
+	return props
+}
+
+// schemaRequired returns the names of the required properties of a JSON schema.
+func schemaRequired(schema map[string]interface{}) []string {
+	var names []string
+	required, _ := schema["required"].([]interface{})
+	for _, r := range required {
+		if name, ok := r.(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// schemaField returns a field of the JSON schema of a property, or nil if it has no such field.
+func schemaField(prop interface{}, field string) interface{} {
+	m, _ := prop.(map[string]interface{})
+	return m[field]
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
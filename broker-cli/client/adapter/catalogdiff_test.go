@@ -0,0 +1,99 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+// instanceSchema returns the schemas of a plan with the given schema of instance create parameters.
+func instanceSchema(params map[string]interface{}) *osb.Schemas {
+	schema := map[string]interface{}{"parameters": params}
+	return &osb.Schemas{ServiceInstance: &osb.ServiceInstanceSchema{Create: &schema}}
+}
+
+func TestDiffCatalogs(t *testing.T) {
+	paid := false
+	oldSchema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"size": map[string]interface{}{"type": "integer"},
+			"zone": map[string]interface{}{"type": "string"},
+		},
+	}
+	compatibleSchema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"size": map[string]interface{}{"type": "integer", "description": "GB"},
+			"zone": map[string]interface{}{"type": "string"},
+			"tier": map[string]interface{}{"type": "string"},
+		},
+	}
+	breakingSchema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"size": map[string]interface{}{"type": "string"},
+		},
+		"required": []interface{}{"size"},
+	}
+
+	old := &GetCatalogResult{Services: []osb.Service{
+		{ID: "s1", Name: "pubsub", Bindable: true, Plans: []osb.Plan{
+			{ID: "p1", Name: "beta"},
+			{ID: "p2", Name: "standard", Schemas: instanceSchema(oldSchema)},
+			{ID: "p3", Name: "gone"},
+		}},
+		{ID: "s2", Name: "sql", Plans: []osb.Plan{
+			{ID: "p4", Name: "beta", Schemas: instanceSchema(oldSchema)},
+		}},
+		{ID: "s3", Name: "removed"},
+	}}
+	new := &GetCatalogResult{Services: []osb.Service{
+		{ID: "s1", Name: "cloud-pubsub", Bindable: true, Plans: []osb.Plan{
+			{ID: "p1", Name: "beta", Free: &paid},
+			{ID: "p2", Name: "default", Schemas: instanceSchema(compatibleSchema)},
+			{ID: "p5", Name: "new"},
+		}},
+		{ID: "s2", Name: "sql", Bindable: true, Plans: []osb.Plan{
+			{ID: "p4", Name: "beta", Schemas: instanceSchema(breakingSchema)},
+		}},
+		{ID: "s4", Name: "added"},
+	}}
+
+	var got []CatalogChange
+	for _, c := range DiffCatalogs(old, new) {
+		got = append(got, *c)
+	}
+	want := []CatalogChange{
+		{Kind: ServiceRenamed, ServiceID: "s1", Breaking: true, Description: `service "pubsub" was renamed to "cloud-pubsub"`},
+		{Kind: FreeChanged, ServiceID: "s1", PlanID: "p1", Breaking: true, Description: `plan "beta" of service "pubsub" is no longer free`},
+		{Kind: PlanRenamed, ServiceID: "s1", PlanID: "p2", Breaking: true, Description: `plan "standard" of service "pubsub" was renamed to "default"`},
+		{Kind: SchemaChanged, ServiceID: "s1", PlanID: "p2", Description: `plan "standard" of service "pubsub" changed its service_instance.create schema compatibly`},
+		{Kind: PlanRemoved, ServiceID: "s1", PlanID: "p3", Breaking: true, Description: `plan "gone" of service "pubsub" was removed`},
+		{Kind: PlanAdded, ServiceID: "s1", PlanID: "p5", Description: `plan "new" of service "cloud-pubsub" was added`},
+		{Kind: BindableChanged, ServiceID: "s2", PlanID: "p4", Description: `plan "beta" of service "sql" is now bindable`},
+		{Kind: SchemaChanged, ServiceID: "s2", PlanID: "p4", Breaking: true,
+			Description: `plan "beta" of service "sql" changed its service_instance.create schema: the type of "size" changed, "zone" was removed, "size" is now required`},
+		{Kind: ServiceRemoved, ServiceID: "s3", Breaking: true, Description: `service "removed" was removed, along with its 0 plans`},
+		{Kind: ServiceAdded, ServiceID: "s4", Description: `service "added" was added with 0 plans`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffCatalogs got\n%+v\nwant\n%+v", got, want)
+	}
+
+	if changes := DiffCatalogs(old, old); len(changes) != 0 {
+		t.Errorf("DiffCatalogs of the same catalog got %+v, want no changes", changes)
+	}
+}
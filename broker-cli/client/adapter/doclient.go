@@ -0,0 +1,240 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const retryAfterHeader = "Retry-After"
+
+// RetryPolicy configures the retries performed by the client returned from NewRetryingClient.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a request is retried after its first attempt.
+	MaxRetries int
+	// BaseDelay is the delay before the first retry. It doubles with every following attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the computed backoff delay. When the broker asks through the Retry-After header
+	// for a longer delay, the request is not retried and its failure is returned.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by broker-cli unless overridden by flags.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+}
+
+// retryingClient is a DoClient which retries idempotent requests that failed with a transient
+// error.
+type retryingClient struct {
+	client DoClient
+	policy RetryPolicy
+}
+
+// NewRetryingClient returns a DoClient which retries idempotent requests (GET, HEAD, OPTIONS and
+// DELETE, which covers last_operation polling) when they fail with a network error or with one of
+// the status codes 429, 502, 503 and 504. Retries are delayed with exponential backoff and jitter,
+// unless the broker asks for a specific delay through the Retry-After header, which is waited for
+// if it doesn't exceed the maximum delay of the policy. Non-idempotent requests are passed through
+// untouched.
+func NewRetryingClient(client DoClient, policy RetryPolicy) DoClient {
+	return &retryingClient{
+		client: client,
+		policy: policy,
+	}
+}
+
+// Do is the method inherited from the DoClient interface.
+func (c *retryingClient) Do(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req) {
+		return c.client.Do(req)
+	}
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		attemptReq, err := rewindRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.client.Do(attemptReq)
+		if attempt >= c.policy.MaxRetries || !isRetryable(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get(retryAfterHeader), time.Now()); ok {
+				// Retrying earlier than the broker asks would likely fail again, so give up instead.
+				if retryAfter > c.policy.MaxDelay {
+					return resp, err
+				}
+				delay = retryAfter
+			}
+			// Drain the body so that the underlying connection can be reused.
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("request cancelled while waiting to retry: %v", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the delay before the retry following the given attempt. Half of the delay is
+// fixed and the other half is random, so that clients which failed at the same time don't retry
+// in lock step.
+func (c *retryingClient) backoff(attempt int) time.Duration {
+	delay := c.policy.BaseDelay << uint(attempt)
+	if delay > c.policy.MaxDelay || delay <= 0 {
+		delay = c.policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// isIdempotent returns true iff the request can be safely sent more than once.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+		// A request body can only be replayed if it can be recreated.
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	default:
+		return false
+	}
+}
+
+// isRetryable returns true iff the outcome of a request indicates a transient failure.
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// rewindRequest returns a copy of req with a fresh request body, so that the request can be sent
+// again.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("error rewinding request body: %v", err)
+	}
+	rewound := req.Clone(req.Context())
+	rewound.Body = body
+	return rewound, nil
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds
+// or an HTTP date. It returns false if the value is missing or malformed.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// rateLimitedClient is a DoClient which limits the rate of requests with a token bucket.
+type rateLimitedClient struct {
+	client DoClient
+	qps    float64
+	burst  float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimitedClient returns a DoClient which sends at most qps requests per second on average,
+// allowing bursts of up to burst requests. Requests over the limit wait for a token until their
+// context is done.
+func NewRateLimitedClient(client DoClient, qps float64, burst int) DoClient {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimitedClient{
+		client: client,
+		qps:    qps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Do is the method inherited from the DoClient interface.
+func (c *rateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	if delay := c.reserve(time.Now()); delay > 0 {
+		select {
+		case <-req.Context().Done():
+			return nil, fmt.Errorf("request cancelled while waiting for rate limiter: %v", req.Context().Err())
+		case <-time.After(delay):
+		}
+	}
+	return c.client.Do(req)
+}
+
+// reserve takes a token from the bucket and returns how long the caller has to wait before the
+// token becomes valid. Tokens are handed out in order, so the bucket may go into debt.
+func (c *rateLimitedClient) reserve(now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.last) {
+		c.tokens += now.Sub(c.last).Seconds() * c.qps
+		if c.tokens > c.burst {
+			c.tokens = c.burst
+		}
+		c.last = now
+	}
+	c.tokens--
+
+	if c.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-c.tokens / c.qps * float64(time.Second))
+}
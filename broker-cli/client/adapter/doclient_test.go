@@ -0,0 +1,243 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  time.Millisecond,
+	MaxDelay:   10 * time.Millisecond,
+}
+
+// flakyServer returns a server which fails the first failures requests with the given status code
+// and Retry-After header, and counts all the requests it receives.
+func flakyServer(failures int32, statusCode int, retryAfter string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set(retryAfterHeader, retryAfter)
+			}
+			w.WriteHeader(statusCode)
+			return
+		}
+		w.Write([]byte(`{"services": []}`))
+	}))
+}
+
+// TestRetryingClientRetriesIdempotentRequests tests that transient failures of GET requests are
+// retried until the request succeeds.
+func TestRetryingClientRetriesIdempotentRequests(t *testing.T) {
+	var requests int32
+	server := flakyServer(2, http.StatusServiceUnavailable, "", &requests)
+	defer server.Close()
+
+	adapter := NewHttpAdapter(NewRetryingClient(server.Client(), testRetryPolicy))
+	if _, err := adapter.GetCatalog(context.Background(), &GetCatalogParams{Server: server.URL}); err != nil {
+		t.Fatalf("Unexpected error from GetCatalog: %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("Server got %d requests, want 3", requests)
+	}
+}
+
+// TestRetryingClientGivesUp tests that the last failure is returned once the retries are used up.
+func TestRetryingClientGivesUp(t *testing.T) {
+	var requests int32
+	server := flakyServer(10, http.StatusBadGateway, "", &requests)
+	defer server.Close()
+
+	client := NewRetryingClient(server.Client(), testRetryPolicy)
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error from Do: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Status code got %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if want := int32(testRetryPolicy.MaxRetries + 1); requests != want {
+		t.Fatalf("Server got %d requests, want %d", requests, want)
+	}
+}
+
+// TestRetryingClientSkipsNonIdempotentRequests tests that PUT requests are never retried.
+func TestRetryingClientSkipsNonIdempotentRequests(t *testing.T) {
+	var requests int32
+	server := flakyServer(1, http.StatusServiceUnavailable, "", &requests)
+	defer server.Close()
+
+	client := NewRetryingClient(server.Client(), testRetryPolicy)
+	req, _ := http.NewRequest(http.MethodPut, server.URL, bytes.NewReader([]byte("{}")))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error from Do: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Status code got %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if requests != 1 {
+		t.Fatalf("Server got %d requests, want 1", requests)
+	}
+}
+
+// TestRetryingClientHonorsRetryAfter tests that the delay requested by the broker is used instead
+// of the backoff delay.
+func TestRetryingClientHonorsRetryAfter(t *testing.T) {
+	var requests int32
+	server := flakyServer(1, http.StatusTooManyRequests, "1", &requests)
+	defer server.Close()
+
+	policy := testRetryPolicy
+	policy.MaxDelay = 2 * time.Second
+	client := NewRetryingClient(server.Client(), policy)
+	req, _ := http.NewRequest(http.MethodDelete, server.URL, nil)
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error from Do: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status code got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("Request was retried after %v, want at least 1s", elapsed)
+	}
+}
+
+// TestRetryingClientGivesUpOnLongRetryAfter tests that the request is not retried when the broker
+// asks for a delay longer than the maximum delay of the policy.
+func TestRetryingClientGivesUpOnLongRetryAfter(t *testing.T) {
+	var requests int32
+	server := flakyServer(1, http.StatusServiceUnavailable, "3600", &requests)
+	defer server.Close()
+
+	client := NewRetryingClient(server.Client(), testRetryPolicy)
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error from Do: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Status code got %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if requests != 1 {
+		t.Fatalf("Server got %d requests, want 1", requests)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Do returned after %v, want it to return without waiting", elapsed)
+	}
+}
+
+// TestRetryingClientStopsOnCancel tests that a cancelled context interrupts the wait between
+// retries.
+func TestRetryingClientStopsOnCancel(t *testing.T) {
+	var requests int32
+	server := flakyServer(10, http.StatusServiceUnavailable, "60", &requests)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	policy := testRetryPolicy
+	policy.MaxDelay = time.Minute
+	client := NewRetryingClient(server.Client(), policy)
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req.WithContext(ctx)); err == nil {
+		t.Fatal("Got no error but want one when the context expires")
+	}
+	if requests != 1 {
+		t.Fatalf("Server got %d requests, want 1", requests)
+	}
+}
+
+// TestParseRetryAfter tests parsing of both forms of the Retry-After header.
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{value: "", ok: false},
+		{value: "3", delay: 3 * time.Second, ok: true},
+		{value: "-3", ok: false},
+		{value: "Fri, 01 Jun 2018 12:00:10 GMT", delay: 10 * time.Second, ok: true},
+		{value: "Fri, 01 Jun 2018 11:00:00 GMT", delay: 0, ok: true},
+		{value: "soon", ok: false},
+	}
+
+	for _, tc := range testCases {
+		delay, ok := parseRetryAfter(tc.value, now)
+		if delay != tc.delay || ok != tc.ok {
+			t.Errorf("parseRetryAfter(%q) got (%v, %t), want (%v, %t)", tc.value, delay, ok, tc.delay, tc.ok)
+		}
+	}
+}
+
+// TestRateLimitedClient tests that requests over the burst are spread according to the rate.
+func TestRateLimitedClient(t *testing.T) {
+	var requests int32
+	server := flakyServer(0, http.StatusOK, "", &requests)
+	defer server.Close()
+
+	client := NewRateLimitedClient(server.Client(), 20, 2)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if _, err := client.Do(req); err != nil {
+			t.Fatalf("Unexpected error from Do: %v", err)
+		}
+	}
+
+	// The first 2 requests use the burst, and the remaining 4 wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Fatalf("6 requests took %v, want at least 200ms", elapsed)
+	}
+	if requests != 6 {
+		t.Fatalf("Server got %d requests, want 6", requests)
+	}
+}
+
+// TestRateLimitedClientStopsOnCancel tests that waiting for a token respects the request context.
+func TestRateLimitedClientStopsOnCancel(t *testing.T) {
+	var requests int32
+	server := flakyServer(0, http.StatusOK, "", &requests)
+	defer server.Close()
+
+	client := NewRateLimitedClient(server.Client(), 0.1, 1)
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("Unexpected error from Do: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Do(req.WithContext(ctx)); err == nil {
+		t.Fatal("Got no error but want one when the context expires")
+	}
+	if requests != 1 {
+		t.Fatalf("Server got %d requests, want 1", requests)
+	}
+}
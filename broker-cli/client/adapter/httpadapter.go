@@ -16,13 +16,20 @@ package adapter
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
 )
@@ -34,7 +41,12 @@ const (
 	operationKey         = "operation"
 	instanceKey          = "instance"
 	bindingKey           = "binding"
+	pageSizeKey          = "pageSize"
+	pageTokenKey         = "pageToken"
 	apiVersionHeader     = "X-Broker-API-Version"
+
+	originatingIdentityHeader = "X-Broker-API-Originating-Identity"
+	requestIdentityHeader     = "X-Broker-API-Request-Identity"
 )
 
 type DoClient interface {
@@ -54,7 +66,7 @@ func NewHttpAdapter(client DoClient) Adapter {
 }
 
 // CreateBroker creates a broker in project with the given name, title, and catalogs using the request information.
-func (adapter *httpAdapter) CreateBroker(params *CreateBrokerParams) (*osb.Broker, error) {
+func (adapter *httpAdapter) CreateBroker(ctx context.Context, params *CreateBrokerParams) (*osb.Broker, error) {
 	url := fmt.Sprintf("%s/v1beta1/projects/%s/brokers", params.Host, params.Project)
 
 	broker := osb.Broker{
@@ -67,33 +79,34 @@ func (adapter *httpAdapter) CreateBroker(params *CreateBrokerParams) (*osb.Broke
 	}
 
 	ret := &osb.Broker{}
-	err = adapter.doRequest(url, http.MethodPost, bytes.NewReader(postBody), ret)
+	err = adapter.doRequest(ctx, url, http.MethodPost, bytes.NewReader(postBody), ret)
 	return ret, err
 }
 
 // DeleteBroker deletes the broker with the given name from the project using the request information.
-func (adapter *httpAdapter) DeleteBroker(params *DeleteBrokerParams) error {
-	return adapter.doRequest(params.BrokerURL, http.MethodDelete, nil, nil)
+func (adapter *httpAdapter) DeleteBroker(ctx context.Context, params *DeleteBrokerParams) error {
+	return adapter.doRequest(ctx, params.BrokerURL, http.MethodDelete, nil, nil)
 }
 
 // ListBrokers lists the brokers in a given project using the request information.
-func (adapter *httpAdapter) ListBrokers(params *ListBrokersParams) (*ListBrokersResult, error) {
+func (adapter *httpAdapter) ListBrokers(ctx context.Context, params *ListBrokersParams) (*ListBrokersResult, error) {
 	url := fmt.Sprintf("%s/v1beta1/projects/%s/brokers", params.Host, params.Project)
 	ret := &ListBrokersResult{}
-	err := adapter.doRequest(url, http.MethodGet, nil, ret)
+	err := adapter.doRequest(ctx, url, http.MethodGet, nil, ret)
 	return ret, err
 }
 
-func (adapter *httpAdapter) GetCatalog(params *GetCatalogParams) (*GetCatalogResult, error) {
+// GetCatalog fetches the catalog of the given server.
+func (adapter *httpAdapter) GetCatalog(ctx context.Context, params *GetCatalogParams) (*GetCatalogResult, error) {
 	url := fmt.Sprintf("%s/v2/catalog", params.Server)
 
-	statusCode, body, err := adapter.doOSBRequest(url, http.MethodGet, params.APIVersion, nil, nil)
+	statusCode, body, err := adapter.doOSBRequest(ctx, url, http.MethodGet, params.APIVersion, nil, nil, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	if statusCode != http.StatusOK {
-		return nil, validateGCPFailureResponse(body, statusCode, "error fetching catalog")
+		return nil, validateFailureResponse(body, statusCode, "error fetching catalog")
 	}
 
 	res := &GetCatalogResult{}
@@ -105,7 +118,7 @@ func (adapter *httpAdapter) GetCatalog(params *GetCatalogParams) (*GetCatalogRes
 }
 
 // CreateInstance calls the given server to provision a service instance using the request information.
-func (adapter *httpAdapter) CreateInstance(params *CreateInstanceParams) (*CreateInstanceResult, error) {
+func (adapter *httpAdapter) CreateInstance(ctx context.Context, params *CreateInstanceParams) (*CreateInstanceResult, error) {
 	instanceURL := fmt.Sprintf("%s/v2/service_instances/%s", params.Server, params.InstanceID)
 
 	putBody := &osb.ProvisionRequestBody{
@@ -120,11 +133,16 @@ func (adapter *httpAdapter) CreateInstance(params *CreateInstanceParams) (*Creat
 	putParams := url.Values{}
 	putParams.Set(acceptsIncompleteKey, strconv.FormatBool(params.AcceptsIncomplete))
 
-	respCode, respBody, err := adapter.doOSBRequest(instanceURL, http.MethodPut, params.APIVersion, putBody, putParams)
+	header, err := identityHeader(params.OriginatingIdentity, params.RequestIdentity)
 	if err != nil {
 		return nil, err
 	}
 
+	respCode, respBody, err := adapter.doOSBRequest(ctx, instanceURL, http.MethodPut, params.APIVersion, header, putBody, putParams)
+	if err != nil {
+		return nil, orphanMitigationRequestError(err)
+	}
+
 	unmarshalSuccessResponse := func(body []byte, isAsync bool) (*CreateInstanceResult, error) {
 		rb := &osb.ProvisionResponseBody{}
 		err := json.Unmarshal(body, rb)
@@ -137,7 +155,12 @@ func (adapter *httpAdapter) CreateInstance(params *CreateInstanceParams) (*Creat
 	switch respCode {
 	case http.StatusOK, http.StatusCreated:
 		// Identical service instance already exists, or service instance is provisioned synchronously.
-		return unmarshalSuccessResponse(respBody, false)
+		res, err := unmarshalSuccessResponse(respBody, false)
+		if err != nil && respCode == http.StatusCreated {
+			// The resource was created, but its details are lost.
+			return nil, &OrphanMitigationError{Err: err}
+		}
+		return res, err
 	case http.StatusAccepted:
 		// Service instance is being provisioned asynchronously.
 		if !params.AcceptsIncomplete {
@@ -146,38 +169,56 @@ func (adapter *httpAdapter) CreateInstance(params *CreateInstanceParams) (*Creat
 
 		return unmarshalSuccessResponse(respBody, true)
 	case http.StatusBadRequest:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
+		return nil, validateFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
 	case http.StatusConflict:
-		return nil, validateGCPFailureResponse(respBody, respCode, "instance with the same id but different attributes already exists")
+		return nil, validateFailureResponse(respBody, respCode, "instance with the same id but different attributes already exists")
 	case http.StatusUnprocessableEntity:
-		return nil, validateGCPFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
+		return nil, validateFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
 	default:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was not successful")
+		return nil, orphanMitigationError(respCode, validateFailureResponse(respBody, respCode, "request was not successful"))
 	}
 }
 
-// ListInstances lists instances in a given project and broker using the request information.
-func (adapter *httpAdapter) ListInstances(params *ListInstancesParams) (*ListInstancesResult, error) {
-	URL := fmt.Sprintf("%s/instances", params.Server)
+// ListInstances lists a page of the instances in a given project and broker using the request
+// information. NewInstanceIterator lists all of them.
+func (adapter *httpAdapter) ListInstances(ctx context.Context, params *ListInstancesParams) (*ListInstancesResult, error) {
+	URL := fmt.Sprintf("%s/instances%s", params.Server, pageQuery(params.PageSize, params.PageToken))
 	lir := &ListInstancesResult{}
-	if err := adapter.doRequest(URL, http.MethodGet, nil, lir); err != nil {
+	if err := adapter.doRequest(ctx, URL, http.MethodGet, nil, lir); err != nil {
 		return nil, err
 	}
 	return lir, nil
 }
 
-// ListBindings lists bindings to an instance using the request information.
-func (adapter *httpAdapter) ListBindings(params *ListBindingsParams) (*ListBindingsResult, error) {
-	URL := fmt.Sprintf("%s/instances/%s/bindings", params.Server, params.InstanceID)
+// ListBindings lists a page of the bindings to an instance using the request information.
+// NewBindingIterator lists all of them.
+func (adapter *httpAdapter) ListBindings(ctx context.Context, params *ListBindingsParams) (*ListBindingsResult, error) {
+	URL := fmt.Sprintf("%s/instances/%s/bindings%s", params.Server, params.InstanceID, pageQuery(params.PageSize, params.PageToken))
 	ret := &ListBindingsResult{}
-	if err := adapter.doRequest(URL, http.MethodGet, nil, ret); err != nil {
+	if err := adapter.doRequest(ctx, URL, http.MethodGet, nil, ret); err != nil {
 		return nil, err
 	}
 	return ret, nil
 }
 
+// pageQuery returns the query string requesting a page of a list from the admin API, or "" to
+// request the first page of the default size.
+func pageQuery(pageSize int, pageToken string) string {
+	query := url.Values{}
+	if pageSize > 0 {
+		query.Set(pageSizeKey, strconv.Itoa(pageSize))
+	}
+	if pageToken != "" {
+		query.Set(pageTokenKey, pageToken)
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
 // DeleteInstance calls the given server to deprovision a service instance using the request information.
-func (adapter *httpAdapter) DeleteInstance(params *DeleteInstanceParams) (*DeleteInstanceResult, error) {
+func (adapter *httpAdapter) DeleteInstance(ctx context.Context, params *DeleteInstanceParams) (*DeleteInstanceResult, error) {
 	instanceURL := fmt.Sprintf("%s/v2/service_instances/%s", params.Server, params.InstanceID)
 
 	deleteParams := url.Values{}
@@ -185,7 +226,12 @@ func (adapter *httpAdapter) DeleteInstance(params *DeleteInstanceParams) (*Delet
 	deleteParams.Set(planIDKey, params.PlanID)
 	deleteParams.Set(acceptsIncompleteKey, strconv.FormatBool(params.AcceptsIncomplete))
 
-	respCode, respBody, err := adapter.doOSBRequest(instanceURL, http.MethodDelete, params.APIVersion, nil, deleteParams)
+	header, err := identityHeader(params.OriginatingIdentity, params.RequestIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	respCode, respBody, err := adapter.doOSBRequest(ctx, instanceURL, http.MethodDelete, params.APIVersion, header, nil, deleteParams)
 	if err != nil {
 		return nil, err
 	}
@@ -208,16 +254,16 @@ func (adapter *httpAdapter) DeleteInstance(params *DeleteInstanceParams) (*Delet
 		}
 		return &DeleteInstanceResult{Async: true, OperationID: rb.Operation}, nil
 	case http.StatusBadRequest:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
+		return nil, validateFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
 	case http.StatusUnprocessableEntity:
-		return nil, validateGCPFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
+		return nil, validateFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
 	default:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was not successful")
+		return nil, validateFailureResponse(respBody, respCode, "request was not successful")
 	}
 }
 
 // UpdateInstance calls the given server to update a service instance using the request information.
-func (adapter *httpAdapter) UpdateInstance(params *UpdateInstanceParams) (*UpdateInstanceResult, error) {
+func (adapter *httpAdapter) UpdateInstance(ctx context.Context, params *UpdateInstanceParams) (*UpdateInstanceResult, error) {
 	instanceURL := fmt.Sprintf("%s/v2/service_instances/%s", params.Server, params.InstanceID)
 
 	patchBody := &osb.UpdateInstanceRequestBody{
@@ -236,7 +282,12 @@ func (adapter *httpAdapter) UpdateInstance(params *UpdateInstanceParams) (*Updat
 	patchParams := url.Values{}
 	patchParams.Set(acceptsIncompleteKey, strconv.FormatBool(params.AcceptsIncomplete))
 
-	respCode, respBody, err := adapter.doOSBRequest(instanceURL, http.MethodPatch, params.APIVersion, patchBody, patchParams)
+	header, err := identityHeader(params.OriginatingIdentity, params.RequestIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	respCode, respBody, err := adapter.doOSBRequest(ctx, instanceURL, http.MethodPatch, params.APIVersion, header, patchBody, patchParams)
 	if err != nil {
 		return nil, err
 	}
@@ -262,23 +313,55 @@ func (adapter *httpAdapter) UpdateInstance(params *UpdateInstanceParams) (*Updat
 
 		return unmarshalSuccessResponse(respBody, true)
 	case http.StatusBadRequest:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
+		return nil, validateFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
 	case http.StatusUnprocessableEntity:
-		return nil, validateGCPFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
+		return nil, validateFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
 	default:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was not successful")
+		return nil, validateFailureResponse(respBody, respCode, "request was not successful")
+	}
+}
+
+// GetInstance calls the given server to fetch a service instance using the request information.
+func (adapter *httpAdapter) GetInstance(ctx context.Context, params *GetInstanceParams) (*GetInstanceResult, error) {
+	instanceURL := fmt.Sprintf("%s/v2/service_instances/%s", params.Server, params.InstanceID)
+
+	respCode, respBody, err := adapter.doOSBRequest(ctx, instanceURL, http.MethodGet, params.APIVersion, nil, nil, resourceParams(params.ServiceID, params.PlanID))
+	if err != nil {
+		return nil, err
+	}
+
+	switch respCode {
+	case http.StatusOK:
+		rb := &osb.FetchInstanceResponseBody{}
+		err := json.Unmarshal(respBody, rb)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling response body: %s\nerror: %v", string(respBody), err)
+		}
+		return &GetInstanceResult{
+			ServiceID:       rb.ServiceID,
+			PlanID:          rb.PlanID,
+			DashboardURL:    rb.DashboardURL,
+			Parameters:      rb.Parameters,
+			MaintenanceInfo: rb.MaintenanceInfo,
+		}, nil
+	case http.StatusNotFound:
+		return nil, validateFailureResponse(respBody, respCode, "instance doesn't exist or is still being provisioned")
+	case http.StatusUnprocessableEntity:
+		return nil, validateFailureResponse(respBody, respCode, "instance is being updated")
+	default:
+		return nil, validateFailureResponse(respBody, respCode, "request was not successful")
 	}
 }
 
 // InstanceLastOperation calls the given server to get the state of the last operation for the
 // service instance.
-func (adapter *httpAdapter) InstanceLastOperation(params *InstanceLastOperationParams) (*Operation, error) {
+func (adapter *httpAdapter) InstanceLastOperation(ctx context.Context, params *InstanceLastOperationParams) (*Operation, error) {
 	operationURL := fmt.Sprintf("%s/v2/service_instances/%s/last_operation", params.Server, params.InstanceID)
-	return adapter.lastOperation(instanceKey, operationURL, params.LastOperationParams)
+	return adapter.lastOperation(ctx, instanceKey, operationURL, params.LastOperationParams)
 }
 
 // CreateBinding calls the given server to bind to a service instance using the request information.
-func (adapter *httpAdapter) CreateBinding(params *CreateBindingParams) (*CreateBindingResult, error) {
+func (adapter *httpAdapter) CreateBinding(ctx context.Context, params *CreateBindingParams) (*CreateBindingResult, error) {
 	bindingURL := fmt.Sprintf("%s/v2/service_instances/%s/service_bindings/%s", params.Server, params.InstanceID, params.BindingID)
 
 	putBody := &osb.BindRequestBody{
@@ -293,11 +376,16 @@ func (adapter *httpAdapter) CreateBinding(params *CreateBindingParams) (*CreateB
 	putParams := url.Values{}
 	putParams.Set(acceptsIncompleteKey, strconv.FormatBool(params.AcceptsIncomplete))
 
-	respCode, respBody, err := adapter.doOSBRequest(bindingURL, http.MethodPut, params.APIVersion, putBody, putParams)
+	header, err := identityHeader(params.OriginatingIdentity, params.RequestIdentity)
 	if err != nil {
 		return nil, err
 	}
 
+	respCode, respBody, err := adapter.doOSBRequest(ctx, bindingURL, http.MethodPut, params.APIVersion, header, putBody, putParams)
+	if err != nil {
+		return nil, orphanMitigationRequestError(err)
+	}
+
 	marshalSuccessResponse := func(body []byte, isAsync bool) (*CreateBindingResult, error) {
 		rb := &osb.BindResponseBody{}
 		err := json.Unmarshal(body, rb)
@@ -317,7 +405,12 @@ func (adapter *httpAdapter) CreateBinding(params *CreateBindingParams) (*CreateB
 	switch respCode {
 	case http.StatusOK, http.StatusCreated:
 		// Identical service binding already exists, or service binding is created synchronously.
-		return marshalSuccessResponse(respBody, false)
+		res, err := marshalSuccessResponse(respBody, false)
+		if err != nil && respCode == http.StatusCreated {
+			// The resource was created, but its details are lost.
+			return nil, &OrphanMitigationError{Err: err}
+		}
+		return res, err
 	case http.StatusAccepted:
 		// Service binding is being created asynchronously.
 		if !params.AcceptsIncomplete {
@@ -325,18 +418,18 @@ func (adapter *httpAdapter) CreateBinding(params *CreateBindingParams) (*CreateB
 		}
 		return marshalSuccessResponse(respBody, true)
 	case http.StatusBadRequest:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
+		return nil, validateFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
 	case http.StatusConflict:
-		return nil, validateGCPFailureResponse(respBody, respCode, "binding with the same id but different attributes already exists")
+		return nil, validateFailureResponse(respBody, respCode, "binding with the same id but different attributes already exists")
 	case http.StatusUnprocessableEntity:
-		return nil, validateGCPFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
+		return nil, validateFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
 	default:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was not successful")
+		return nil, orphanMitigationError(respCode, validateFailureResponse(respBody, respCode, "request was not successful"))
 	}
 }
 
 // DeleteBinding calls the given server to unbind to a service instance using the request information.
-func (adapter *httpAdapter) DeleteBinding(params *DeleteBindingParams) (*DeleteBindingResult, error) {
+func (adapter *httpAdapter) DeleteBinding(ctx context.Context, params *DeleteBindingParams) (*DeleteBindingResult, error) {
 	bindingURL := fmt.Sprintf("%s/v2/service_instances/%s/service_bindings/%s", params.Server, params.InstanceID, params.BindingID)
 
 	deleteParams := url.Values{}
@@ -344,7 +437,12 @@ func (adapter *httpAdapter) DeleteBinding(params *DeleteBindingParams) (*DeleteB
 	deleteParams.Set(planIDKey, params.PlanID)
 	deleteParams.Set(acceptsIncompleteKey, strconv.FormatBool(params.AcceptsIncomplete))
 
-	respCode, respBody, err := adapter.doOSBRequest(bindingURL, http.MethodDelete, params.APIVersion, nil, deleteParams)
+	header, err := identityHeader(params.OriginatingIdentity, params.RequestIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	respCode, respBody, err := adapter.doOSBRequest(ctx, bindingURL, http.MethodDelete, params.APIVersion, header, nil, deleteParams)
 	if err != nil {
 		return nil, err
 	}
@@ -367,38 +465,74 @@ func (adapter *httpAdapter) DeleteBinding(params *DeleteBindingParams) (*DeleteB
 		}
 		return &DeleteBindingResult{Async: true, OperationID: rb.Operation}, nil
 	case http.StatusBadRequest:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
+		return nil, validateFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
 	case http.StatusUnprocessableEntity:
-		return nil, validateGCPFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
+		return nil, validateFailureResponse(respBody, respCode, "the broker only supports asynchronous requests")
+	default:
+		return nil, validateFailureResponse(respBody, respCode, "request was not successful")
+	}
+}
+
+// GetBinding calls the given server to fetch a service binding using the request information.
+func (adapter *httpAdapter) GetBinding(ctx context.Context, params *GetBindingParams) (*GetBindingResult, error) {
+	bindingURL := fmt.Sprintf("%s/v2/service_instances/%s/service_bindings/%s", params.Server, params.InstanceID, params.BindingID)
+
+	respCode, respBody, err := adapter.doOSBRequest(ctx, bindingURL, http.MethodGet, params.APIVersion, nil, nil, resourceParams(params.ServiceID, params.PlanID))
+	if err != nil {
+		return nil, err
+	}
+
+	switch respCode {
+	case http.StatusOK:
+		rb := &osb.FetchBindingResponseBody{}
+		err := json.Unmarshal(respBody, rb)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshalling response body: %s\nerror: %v", string(respBody), err)
+		}
+		return &GetBindingResult{
+			Credentials:     rb.Credentials,
+			SyslogDrainURL:  rb.SyslogDrainURL,
+			RouteServiceURL: rb.RouteServiceURL,
+			VolumeMounts:    rb.VolumeMounts,
+			Parameters:      rb.Parameters,
+		}, nil
+	case http.StatusNotFound:
+		return nil, validateFailureResponse(respBody, respCode, "binding doesn't exist or is still being created")
 	default:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was not successful")
+		return nil, validateFailureResponse(respBody, respCode, "request was not successful")
 	}
 }
 
 // BindingLastOperation calls the given server to get the state of the last operation for the
 // service binding.
-func (adapter *httpAdapter) BindingLastOperation(params *BindingLastOperationParams) (*Operation, error) {
+func (adapter *httpAdapter) BindingLastOperation(ctx context.Context, params *BindingLastOperationParams) (*Operation, error) {
 	operationURL := fmt.Sprintf("%s/v2/service_instances/%s/service_bindings/%s/last_operation", params.Server, params.InstanceID, params.BindingID)
-	return adapter.lastOperation(bindingKey, operationURL, params.LastOperationParams)
+	return adapter.lastOperation(ctx, bindingKey, operationURL, params.LastOperationParams)
 }
 
-func (adapter *httpAdapter) lastOperation(resource, operationURL string, params *LastOperationParams) (*Operation, error) {
-	getParams := url.Values{}
-	if params.ServiceID != "" {
-		getParams.Set(serviceIDKey, params.ServiceID)
+// resourceParams returns the optional query parameters which identify the service and plan of a
+// resource.
+func resourceParams(serviceID, planID string) url.Values {
+	params := url.Values{}
+	if serviceID != "" {
+		params.Set(serviceIDKey, serviceID)
 	}
-	if params.PlanID != "" {
-		getParams.Set(planIDKey, params.PlanID)
+	if planID != "" {
+		params.Set(planIDKey, planID)
 	}
+	return params
+}
+
+func (adapter *httpAdapter) lastOperation(ctx context.Context, resource, operationURL string, params *LastOperationParams) (*Operation, error) {
+	getParams := resourceParams(params.ServiceID, params.PlanID)
 	if params.OperationID != "" {
 		getParams.Set(operationKey, params.OperationID)
 	}
 
-	respCode, respBody, err := adapter.doOSBRequest(operationURL, http.MethodGet, params.APIVersion, nil, getParams)
+	respCode, respHeader, respBody, err := adapter.doOSBRequestWithHeader(ctx, operationURL, http.MethodGet, params.APIVersion, nil, nil, getParams)
 	if err != nil {
 		return nil, err
 	}
-
 	switch respCode {
 	case http.StatusOK:
 		rb := &osb.OperationResponseBody{}
@@ -406,25 +540,27 @@ func (adapter *httpAdapter) lastOperation(resource, operationURL string, params
 		if err != nil {
 			return nil, fmt.Errorf("error unmarshalling response body: %s\nerror: %v", string(respBody), err)
 		}
-		return &Operation{State: rb.State, Description: rb.Description}, nil
+		retryAfter, _ := parseRetryAfter(respHeader.Get(retryAfterHeader), time.Now())
+		return &Operation{State: rb.State, Description: rb.Description, RetryAfter: retryAfter}, nil
 	case http.StatusBadRequest:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
+		return nil, validateFailureResponse(respBody, respCode, "request was malformed or missing mandatory data")
 	case http.StatusGone:
 		if params.OperationType == OperationDelete {
 			return &Operation{State: OperationSucceeded, Description: fmt.Sprintf("The %s doesn't exist.", resource)}, nil
 		}
 
-		return nil, validateGCPFailureResponse(respBody, respCode, fmt.Sprintf("%s doesn't exist", resource))
+		return nil, validateFailureResponse(respBody, respCode, fmt.Sprintf("%s doesn't exist", resource))
 	default:
-		return nil, validateGCPFailureResponse(respBody, respCode, "request was not successful")
+		return nil, validateFailureResponse(respBody, respCode, "request was not successful")
 	}
 }
 
 // doRequst is a helper function that performs the request, reads the body, checks the status code,
-// and returns an appropriate error message if anything goes wrong.
+// and returns an appropriate error message if anything goes wrong. The request is aborted if ctx is
+// cancelled before it completes.
 // v should be a pointer to the struct that we want to unmarshal the body into.
-func (adapter *httpAdapter) doRequest(url, method string, reqBody io.Reader, v interface{}) error {
-	req, err := http.NewRequest(method, url, reqBody)
+func (adapter *httpAdapter) doRequest(ctx context.Context, url, method string, reqBody io.Reader, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
 		return fmt.Errorf("error creating request: %v", err)
 	}
@@ -453,55 +589,175 @@ func (adapter *httpAdapter) doRequest(url, method string, reqBody io.Reader, v i
 
 // TODO(maqiuyu): Merge doRequest and doOSBRequest.
 // doOSBRequst is a helper function that performs the OSB request, reads the response body, and
-// returns the response status code and response body.
-func (adapter *httpAdapter) doOSBRequest(url, method, apiVersion string, reqBody interface{}, reqParams url.Values) (int, []byte, error) {
+// returns the response status code and response body. The request is aborted if ctx is cancelled
+// before it completes.
+func (adapter *httpAdapter) doOSBRequest(ctx context.Context, url, method, apiVersion string, header http.Header, reqBody interface{}, reqParams url.Values) (int, []byte, error) {
+	respCode, _, respBody, err := adapter.doOSBRequestWithHeader(ctx, url, method, apiVersion, header, reqBody, reqParams)
+	return respCode, respBody, err
+}
+
+// doOSBRequestWithHeader is like doOSBRequest, but also returns the response header.
+func (adapter *httpAdapter) doOSBRequestWithHeader(ctx context.Context, url, method, apiVersion string, header http.Header, reqBody interface{}, reqParams url.Values) (int, http.Header, []byte, error) {
 	var streamedBody io.Reader
 	if reqBody != nil {
 		serializedReqBody, err := json.Marshal(reqBody)
 		if err != nil {
-			return 0, nil, fmt.Errorf("error marshalling the request body %+v: %v", reqBody, err)
+			return 0, nil, nil, fmt.Errorf("error marshalling the request body %+v: %v", reqBody, err)
 		}
 
 		streamedBody = bytes.NewReader(serializedReqBody)
 	}
 
-	req, err := http.NewRequest(method, url, streamedBody)
+	req, err := http.NewRequestWithContext(ctx, method, url, streamedBody)
 	if err != nil {
-		return 0, nil, fmt.Errorf("error creating request: %v", err)
+		return 0, nil, nil, fmt.Errorf("error creating request: %v", err)
 	}
 	req.URL.RawQuery = reqParams.Encode()
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
 	req.Header.Add(apiVersionHeader, apiVersion)
 
+	// Whether the request was written tells if the broker may have received a failed request. The
+	// transport may report it from another goroutine.
+	var written int32
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) { atomic.StoreInt32(&written, 1) },
+	}))
+
 	resp, err := adapter.client.Do(req)
 	if err != nil {
-		return 0, nil, fmt.Errorf("error executing request: %v; error: %v", req, err)
+		return 0, nil, nil, &requestError{
+			msg:     fmt.Sprintf("error executing request: %v; error: %v", req, err),
+			err:     err,
+			written: atomic.LoadInt32(&written) == 1,
+		}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return 0, nil, fmt.Errorf("error reading response body: %v", err)
+		return 0, nil, nil, &requestError{msg: fmt.Sprintf("error reading response body: %v", err), err: err, written: true}
 	}
 
-	return resp.StatusCode, body, nil
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// requestError is the error of a request which got no complete response.
+type requestError struct {
+	msg string
+	err error
+	// written is true if the request was written to the connection before it failed.
+	written bool
 }
 
-// TODO(maqiuyu): Add methods to handle non-GCP errors.
-func validateGCPFailureResponse(body []byte, code int, desc string) error {
-	rb := &gcpBrokerFailureResponseBody{}
+// Error is the method inherited from "error" interface to print the error.
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the error of the HTTP client.
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// mayHaveArrived returns true if the broker may have received the request: it was written, or it
+// timed out at a point the client can't tell, e.g. inside a DoClient which doesn't trace requests.
+// Failures to resolve or connect to the broker mean that nothing was sent.
+func (e *requestError) mayHaveArrived() bool {
+	if e.written {
+		return true
+	}
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	if errors.As(e.err, &dnsErr) || errors.As(e.err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(e.err, context.DeadlineExceeded) || errors.As(e.err, &netErr) && netErr.Timeout()
+}
+
+// identityHeader returns the OSB headers identifying the originator of a request and the request
+// itself. Unset identities are omitted.
+func identityHeader(originatingIdentity *OriginatingIdentity, requestIdentity string) (http.Header, error) {
+	header := http.Header{}
+	if originatingIdentity != nil {
+		value, err := json.Marshal(originatingIdentity.Value)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling the originating identity %+v: %v", originatingIdentity.Value, err)
+		}
+		header.Set(originatingIdentityHeader, originatingIdentity.Platform+" "+base64.StdEncoding.EncodeToString(value))
+	}
+	if requestIdentity != "" {
+		header.Set(requestIdentityHeader, requestIdentity)
+	}
+	return header, nil
+}
+
+// orphanMitigationRequestError wraps the error of a create request which got no response in an
+// OrphanMitigationError if the broker may have received the request anyway. Other errors, e.g. of
+// marshalling the request or connecting to the broker, are returned as they are.
+func orphanMitigationRequestError(err error) error {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.mayHaveArrived() {
+		return &OrphanMitigationError{Err: err}
+	}
+	return err
+}
+
+// orphanMitigationError wraps the error of a create request in an OrphanMitigationError if the
+// status code of the response leaves the outcome of the request unknown: a 2xx code other than 200,
+// 201 and 202, 408 Request Timeout or a 5xx code.
+func orphanMitigationError(code int, err error) error {
+	if code >= http.StatusOK && code < http.StatusMultipleChoices || code == http.StatusRequestTimeout || code >= http.StatusInternalServerError {
+		return &OrphanMitigationError{Err: err}
+	}
+	return err
+}
+
+// validateFailureResponse returns the BrokerError for a failed OSB request. It understands both
+// the error envelope of GCP brokers ({"error": {"code": ..., "message": ..., "status": ...}}) and
+// the error object defined by the OSB API ({"error": "AsyncRequired", "description": ...}).
+func validateFailureResponse(body []byte, code int, desc string) error {
+	rb := &failureResponseBody{}
 	err := json.Unmarshal(body, rb)
 	if err != nil {
 		return &BrokerError{StatusCode: code, ErrorDescription: "error unmarshalling failure response body", ErrorBody: string(body)}
 	}
 
-	return &BrokerError{
+	brokerErr := &BrokerError{
 		StatusCode:       code,
 		ErrorDescription: desc,
 		ErrorBody:        string(body),
+		ErrorMessage:     rb.Description,
+		InstanceUsable:   rb.InstanceUsable,
+		UpdateRepeatable: rb.UpdateRepeatable,
+	}
+
+	if len(rb.Error) == 0 {
+		return brokerErr
+	}
+
+	gcpErr := &gcpBrokerError{}
+	if err := json.Unmarshal(rb.Error, &brokerErr.ErrorCode); err != nil {
+		if err := json.Unmarshal(rb.Error, gcpErr); err == nil {
+			brokerErr.ErrorCode = gcpErr.Status
+			if brokerErr.ErrorMessage == "" {
+				brokerErr.ErrorMessage = gcpErr.Message
+			}
+		}
 	}
+	return brokerErr
 }
 
-type gcpBrokerFailureResponseBody struct {
-	Error *gcpBrokerError `json:"error,omitempty"`
+// failureResponseBody is the union of the failure response bodies of GCP brokers and of brokers
+// following the OSB API. Error is either a string (OSB) or a gcpBrokerError (GCP).
+type failureResponseBody struct {
+	Error            json.RawMessage `json:"error,omitempty"`
+	Description      string          `json:"description,omitempty"`
+	InstanceUsable   *bool           `json:"instance_usable,omitempty"`
+	UpdateRepeatable *bool           `json:"update_repeatable,omitempty"`
 }
 
 type gcpBrokerError struct {
@@ -16,14 +16,20 @@ package adapter
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
@@ -37,7 +43,7 @@ var (
 // TestCreateBrokerFailure tests that errors in CreateBroker are returned correctly.
 func TestCreateBrokerFailure(t *testing.T) {
 	testFailure(t, func(adapter Adapter) (interface{}, error) {
-		return adapter.CreateBroker(&CreateBrokerParams{})
+		return adapter.CreateBroker(context.Background(), &CreateBrokerParams{})
 	})
 }
 
@@ -94,7 +100,7 @@ func TestCreateBrokerSuccess(t *testing.T) {
 	}
 
 	adapter := NewHttpAdapter(client)
-	res, err := adapter.CreateBroker(params)
+	res, err := adapter.CreateBroker(context.Background(), params)
 	if err != nil {
 		t.Fatalf("Unexpected error from CreateBroker: %v", err)
 	}
@@ -107,7 +113,7 @@ func TestCreateBrokerSuccess(t *testing.T) {
 // TestDeleteBrokerFailure tests that errors in doRequest are returned to DeleteBroker.
 func TestDeleteBrokerFailure(t *testing.T) {
 	testFailure(t, func(adapter Adapter) (interface{}, error) {
-		return nil, adapter.DeleteBroker(&DeleteBrokerParams{})
+		return nil, adapter.DeleteBroker(context.Background(), &DeleteBrokerParams{})
 	})
 }
 
@@ -121,14 +127,14 @@ func TestDeleteBrokerSuccess(t *testing.T) {
 	}
 	expectedURL := fmt.Sprintf("%s/v1beta1/projects/%s/brokers/%s", host, project, broker)
 	testSuccess(t, http.MethodDelete, expectedURL, []byte{}, nil, func(adapter Adapter) (interface{}, error) {
-		return nil, adapter.DeleteBroker(params)
+		return nil, adapter.DeleteBroker(context.Background(), params)
 	})
 }
 
 // TestGetCatalogFailure tests failure of GetCatalog.
 func TestGetCatalogFailure(t *testing.T) {
 	testFailure(t, func(adapter Adapter) (interface{}, error) {
-		return adapter.GetCatalog(&GetCatalogParams{})
+		return adapter.GetCatalog(context.Background(), &GetCatalogParams{})
 	})
 }
 
@@ -161,17 +167,23 @@ func TestGetCatalogSuccess(t *testing.T) {
 	expectedRes := &GetCatalogResult{
 		Services: []osb.Service{
 			{
-				Name:        "pubsub",
-				ID:          "0a827bae-824b-462d-b0a0-fa56d7ffb3a2",
-				Description: "PubSub",
-				Bindable:    true,
+				Name:                 "pubsub",
+				ID:                   "0a827bae-824b-462d-b0a0-fa56d7ffb3a2",
+				Description:          "PubSub",
+				Bindable:             true,
+				InstancesRetrievable: true,
 				Plans: []osb.Plan{
 					{
-						ID:          "29a31cec-71e6-4b70-9dfc-cb4a5917e6d0",
-						Name:        "pubsub-plan",
-						Description: "PubSub plan",
-						Free:        &[]bool{true}[0],
-						Bindable:    &[]bool{true}[0],
+						ID:             "29a31cec-71e6-4b70-9dfc-cb4a5917e6d0",
+						Name:           "pubsub-plan",
+						Description:    "PubSub plan",
+						Free:           &[]bool{true}[0],
+						Bindable:       &[]bool{true}[0],
+						PlanUpdateable: &[]bool{false}[0],
+						MaintenanceInfo: &osb.MaintenanceInfo{
+							Version: "2.1.0",
+						},
+						MaximumPollingDuration: &[]int{3600}[0],
 						Schemas: &osb.Schemas{
 							ServiceInstance: &osb.ServiceInstanceSchema{
 								Create: &map[string]interface{}{"parameters": make(map[string]interface{})},
@@ -194,6 +206,7 @@ func TestGetCatalogSuccess(t *testing.T) {
       "id": "0a827bae-824b-462d-b0a0-fa56d7ffb3a2",
       "description": "PubSub",
       "bindable": true,
+      "instances_retrievable": true,
       "plans": [
         {
           "name": "pubsub-plan",
@@ -201,6 +214,11 @@ func TestGetCatalogSuccess(t *testing.T) {
           "description": "PubSub plan",
           "bindable": true,
           "free": true,
+          "plan_updateable": false,
+          "maintenance_info": {
+            "version": "2.1.0"
+          },
+          "maximum_polling_duration": 3600,
           "schemas": {
             "service_instance": {
               "create": {
@@ -243,14 +261,14 @@ func TestGetCatalogSuccess(t *testing.T) {
 }`)
 
 	testSuccess(t, http.MethodGet, expectedURL, expectedBody, expectedRes, func(adapter Adapter) (interface{}, error) {
-		return adapter.GetCatalog(params)
+		return adapter.GetCatalog(context.Background(), params)
 	})
 }
 
 // TestListBrokersFailure tests failure of ListBrokers.
 func TestListBrokersFailure(t *testing.T) {
 	testFailure(t, func(adapter Adapter) (interface{}, error) {
-		return adapter.ListBrokers(&ListBrokersParams{})
+		return adapter.ListBrokers(context.Background(), &ListBrokersParams{})
 	})
 }
 
@@ -282,10 +300,282 @@ func TestListBrokersSuccess(t *testing.T) {
 
 	testSuccess(t, http.MethodGet, expectedURL, expectedBody, expectedRes,
 		func(adapter Adapter) (interface{}, error) {
-			return adapter.ListBrokers(params)
+			return adapter.ListBrokers(context.Background(), params)
 		})
 }
 
+// TestGetInstanceFailure tests failure of GetInstance.
+func TestGetInstanceFailure(t *testing.T) {
+	testFailure(t, func(adapter Adapter) (interface{}, error) {
+		return adapter.GetInstance(context.Background(), &GetInstanceParams{})
+	})
+}
+
+// TestGetInstanceSuccess tests success of GetInstance.
+func TestGetInstanceSuccess(t *testing.T) {
+	params := &GetInstanceParams{
+		Server:     "https://www.servicebroker.com",
+		InstanceID: "instance",
+		PlanID:     "plan",
+	}
+	expectedURL := fmt.Sprintf("%s/v2/service_instances/%s?plan_id=%s", params.Server, params.InstanceID, params.PlanID)
+
+	expectedBody := []byte(`{
+  "service_id": "service",
+  "plan_id": "plan",
+  "dashboard_url": "https://console.cloud.google.com",
+  "parameters": {"topicId": "topic"},
+  "maintenance_info": {"version": "1.2.0", "description": "Security patch"}
+}`)
+
+	expectedRes := &GetInstanceResult{
+		ServiceID:    "service",
+		PlanID:       "plan",
+		DashboardURL: "https://console.cloud.google.com",
+		Parameters:   map[string]interface{}{"topicId": "topic"},
+		MaintenanceInfo: &osb.MaintenanceInfo{
+			Version:     "1.2.0",
+			Description: "Security patch",
+		},
+	}
+
+	testSuccess(t, http.MethodGet, expectedURL, expectedBody, expectedRes, func(adapter Adapter) (interface{}, error) {
+		return adapter.GetInstance(context.Background(), params)
+	})
+}
+
+// TestGetBindingFailure tests failure of GetBinding.
+func TestGetBindingFailure(t *testing.T) {
+	testFailure(t, func(adapter Adapter) (interface{}, error) {
+		return adapter.GetBinding(context.Background(), &GetBindingParams{})
+	})
+}
+
+// TestGetBindingSuccess tests success of GetBinding.
+func TestGetBindingSuccess(t *testing.T) {
+	params := &GetBindingParams{
+		Server:     "https://www.servicebroker.com",
+		InstanceID: "instance",
+		BindingID:  "binding",
+	}
+	expectedURL := fmt.Sprintf("%s/v2/service_instances/%s/service_bindings/%s", params.Server, params.InstanceID, params.BindingID)
+
+	expectedBody := []byte(`{
+  "credentials": {"privateKeyData": "secret", "projectId": "project"},
+  "parameters": {"serviceAccount": "account"}
+}`)
+
+	expectedRes := &GetBindingResult{
+		Credentials: map[string]interface{}{"privateKeyData": "secret", "projectId": "project"},
+		Parameters:  map[string]interface{}{"serviceAccount": "account"},
+	}
+
+	testSuccess(t, http.MethodGet, expectedURL, expectedBody, expectedRes, func(adapter Adapter) (interface{}, error) {
+		return adapter.GetBinding(context.Background(), params)
+	})
+}
+
+// TestValidateFailureResponse tests that both OSB and GCP error bodies are parsed into BrokerError.
+func TestValidateFailureResponse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		code     int
+		body     string
+		expected *BrokerError
+	}{
+		{
+			name: "OSB error",
+			code: http.StatusUnprocessableEntity,
+			body: `{"error": "AsyncRequired", "description": "Only asynchronous provisioning is supported", "instance_usable": false, "update_repeatable": true}`,
+			expected: &BrokerError{
+				ErrorCode:        ErrorAsyncRequired,
+				ErrorMessage:     "Only asynchronous provisioning is supported",
+				InstanceUsable:   &[]bool{false}[0],
+				UpdateRepeatable: &[]bool{true}[0],
+			},
+		},
+		{
+			name: "OSB description only",
+			code: http.StatusBadRequest,
+			body: `{"description": "Missing plan_id"}`,
+			expected: &BrokerError{
+				ErrorMessage: "Missing plan_id",
+			},
+		},
+		{
+			name: "GCP error",
+			code: http.StatusNotFound,
+			body: `{"error": {"code": 404, "message": "Instance not found", "status": "NOT_FOUND"}}`,
+			expected: &BrokerError{
+				ErrorCode:    "NOT_FOUND",
+				ErrorMessage: "Instance not found",
+			},
+		},
+		{
+			name: "not JSON",
+			code: http.StatusBadGateway,
+			body: `<html>Bad Gateway</html>`,
+			expected: &BrokerError{
+				ErrorDescription: "error unmarshalling failure response body",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		err := validateFailureResponse([]byte(tc.body), tc.code, "description")
+		brokerErr, ok := err.(*BrokerError)
+		if !ok {
+			t.Errorf("%s: got error of type %T, want *BrokerError", tc.name, err)
+			continue
+		}
+
+		tc.expected.StatusCode = tc.code
+		tc.expected.ErrorBody = tc.body
+		if tc.expected.ErrorDescription == "" {
+			tc.expected.ErrorDescription = "description"
+		}
+		if !reflect.DeepEqual(brokerErr, tc.expected) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, brokerErr, tc.expected)
+		}
+	}
+}
+
+// TestBrokerErrorChecks tests the checks for the error codes defined by the OSB API.
+func TestBrokerErrorChecks(t *testing.T) {
+	client := &MockDoClient{
+		do: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusUnprocessableEntity,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error": "AsyncRequired", "description": "async only"}`)),
+			}, nil
+		},
+	}
+
+	_, err := NewHttpAdapter(client).CreateInstance(context.Background(), &CreateInstanceParams{})
+	if !IsAsyncRequired(err) {
+		t.Fatalf("IsAsyncRequired(%v) got false, want true", err)
+	}
+	if IsConcurrencyError(err) {
+		t.Fatalf("IsConcurrencyError(%v) got true, want false", err)
+	}
+	if IsAsyncRequired(expectedErr) {
+		t.Fatalf("IsAsyncRequired(%v) got true, want false", expectedErr)
+	}
+
+	concurrencyErr := fmt.Errorf("wrapped: %w", &BrokerError{StatusCode: http.StatusUnprocessableEntity, ErrorCode: ErrorConcurrency})
+	if !IsConcurrencyError(concurrencyErr) {
+		t.Fatalf("IsConcurrencyError(%v) got false, want true", concurrencyErr)
+	}
+}
+
+// TestOrphanMitigationErrors tests which failed create requests need orphan mitigation.
+func TestOrphanMitigationErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		code int
+		body string
+		err  error
+		want bool
+	}{
+		{name: "failed before sending", err: expectedErr, want: false},
+		{name: "dial error", err: &url.Error{Op: "Put", Err: &net.OpError{Op: "dial", Err: expectedErr}}, want: false},
+		{name: "deadline exceeded", err: &url.Error{Op: "Put", Err: context.DeadlineExceeded}, want: true},
+		{name: "read timeout", err: &url.Error{Op: "Put", Err: &net.OpError{Op: "read", Err: timeoutError{}}}, want: true},
+		{name: "created with malformed body", code: http.StatusCreated, body: "{", want: true},
+		{name: "ok with malformed body", code: http.StatusOK, body: "{", want: false},
+		{name: "no content", code: http.StatusNoContent, body: "", want: true},
+		{name: "request timeout", code: http.StatusRequestTimeout, body: "{}", want: true},
+		{name: "internal server error", code: http.StatusInternalServerError, body: "{}", want: true},
+		{name: "bad gateway", code: http.StatusBadGateway, body: "<html>", want: true},
+		{name: "bad request", code: http.StatusBadRequest, body: "{}", want: false},
+		{name: "conflict", code: http.StatusConflict, body: "{}", want: false},
+	}
+
+	for _, tc := range testCases {
+		adapter := NewHttpAdapter(&MockDoClient{
+			do: func(req *http.Request) (*http.Response, error) {
+				if tc.err != nil {
+					return nil, tc.err
+				}
+				return &http.Response{StatusCode: tc.code, Body: ioutil.NopCloser(strings.NewReader(tc.body))}, nil
+			},
+		})
+
+		_, instanceErr := adapter.CreateInstance(context.Background(), &CreateInstanceParams{})
+		_, bindingErr := adapter.CreateBinding(context.Background(), &CreateBindingParams{})
+		for _, err := range []error{instanceErr, bindingErr} {
+			if err == nil {
+				t.Errorf("%s: got no error, want one", tc.name)
+			} else if got := NeedsOrphanMitigation(err); got != tc.want {
+				t.Errorf("%s: NeedsOrphanMitigation(%v) got %t, want %t", tc.name, err, got, tc.want)
+			}
+		}
+	}
+
+	// Broker errors stay visible through the wrapper.
+	_, err := NewHttpAdapter(&MockDoClient{
+		do: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error": "ConcurrencyError"}`)),
+			}, nil
+		},
+	}).CreateInstance(context.Background(), &CreateInstanceParams{})
+	var brokerErr *BrokerError
+	if !errors.As(err, &brokerErr) || brokerErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("CreateInstance got error %v, want a wrapped BrokerError", err)
+	}
+}
+
+// timeoutError is a net.Error which timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// TestOrphanMitigationNetworkErrors tests that only create requests which may have reached the
+// broker need orphan mitigation.
+func TestOrphanMitigationNetworkErrors(t *testing.T) {
+	// Nothing listens on the address of a closed server.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	// This server reads the request and closes the connection without responding.
+	hangup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Error hijacking connection: %v", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer hangup.Close()
+
+	testCases := []struct {
+		name   string
+		server string
+		want   bool
+	}{
+		{name: "nothing listening", server: closed.URL, want: false},
+		{name: "connection closed after the request", server: hangup.URL, want: true},
+	}
+
+	for _, tc := range testCases {
+		adapter := NewHttpAdapter(http.DefaultClient)
+		_, instanceErr := adapter.CreateInstance(context.Background(), &CreateInstanceParams{Server: tc.server, InstanceID: "i"})
+		_, bindingErr := adapter.CreateBinding(context.Background(), &CreateBindingParams{Server: tc.server, InstanceID: "i", BindingID: "b"})
+		for _, err := range []error{instanceErr, bindingErr} {
+			if err == nil {
+				t.Errorf("%s: got no error, want one", tc.name)
+			} else if got := NeedsOrphanMitigation(err); got != tc.want {
+				t.Errorf("%s: NeedsOrphanMitigation(%v) got %t, want %t", tc.name, err, got, tc.want)
+			}
+		}
+	}
+}
+
 // TestDoRequestSuccess tests the success case of doRequest, namely that it will
 // correctly do the request and unmarshal the body.
 func TestDoRequestSuccess(t *testing.T) {
@@ -328,9 +618,9 @@ func TestDoRequestSuccess(t *testing.T) {
 		},
 	}
 
-	adapter := &httpAdapter{client}
+	adapter := &httpAdapter{client: client}
 	resBody := make(map[string]string)
-	err := adapter.doRequest(expectedURL, expectedMethod, bytes.NewReader(expectedReqBody), &resBody)
+	err := adapter.doRequest(context.Background(), expectedURL, expectedMethod, bytes.NewReader(expectedReqBody), &resBody)
 	if err != nil {
 		t.Fatalf("Unexpected error from doRequest: %v", err)
 	}
@@ -352,7 +642,7 @@ func TestDoRequestFailure(t *testing.T) {
 	expectedErr := expectedErr
 
 	do := func(t *testCase) error {
-		adapter := &httpAdapter{&MockDoClient{
+		adapter := &httpAdapter{client: &MockDoClient{
 			do: func(req *http.Request) (*http.Response, error) {
 				return &http.Response{
 					Body:       t.responseBody,
@@ -361,7 +651,7 @@ func TestDoRequestFailure(t *testing.T) {
 			},
 		}}
 
-		return adapter.doRequest("", t.method, nil, nil)
+		return adapter.doRequest(context.Background(), "", t.method, nil, nil)
 	}
 
 	// Here is a valid test case to make sure that tests are only failing
@@ -407,6 +697,88 @@ func TestDoRequestFailure(t *testing.T) {
 	}
 }
 
+// TestDoOSBRequestCancelled tests that a hung broker call is aborted once its context expires.
+func TestDoOSBRequestCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	adapter := NewHttpAdapter(server.Client())
+	done := make(chan error, 1)
+	go func() {
+		_, err := adapter.GetCatalog(ctx, &GetCatalogParams{Server: server.URL})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Got no error but want one when the context expires")
+		}
+		if ctx.Err() != context.DeadlineExceeded {
+			t.Fatalf("Context error got %v, want %v", ctx.Err(), context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetCatalog did not return after its context expired")
+	}
+}
+
+// TestIdentityHeaders tests that the originating and request identities are sent with mutating
+// requests.
+func TestIdentityHeaders(t *testing.T) {
+	var header http.Header
+	adapter := NewHttpAdapter(&MockDoClient{
+		do: func(req *http.Request) (*http.Response, error) {
+			header = req.Header
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+			}, nil
+		},
+	})
+
+	_, err := adapter.CreateInstance(context.Background(), &CreateInstanceParams{
+		Server:     "https://example.com",
+		InstanceID: "instance",
+		OriginatingIdentity: &OriginatingIdentity{
+			Platform: "kubernetes",
+			Value:    map[string]interface{}{"username": "jane@example.com"},
+		},
+		RequestIdentity: "e26cea66-cb1b-4a4b-a1e5-3cf0e7f8b8e4",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error from CreateInstance: %v", err)
+	}
+
+	// base64 of {"username":"jane@example.com"}.
+	wantOriginatingIdentity := "kubernetes eyJ1c2VybmFtZSI6ImphbmVAZXhhbXBsZS5jb20ifQ=="
+	if got := header.Get(originatingIdentityHeader); got != wantOriginatingIdentity {
+		t.Errorf("%s header got %q, want %q", originatingIdentityHeader, got, wantOriginatingIdentity)
+	}
+	if got, want := header.Get(requestIdentityHeader), "e26cea66-cb1b-4a4b-a1e5-3cf0e7f8b8e4"; got != want {
+		t.Errorf("%s header got %q, want %q", requestIdentityHeader, got, want)
+	}
+
+	// Unset identities are omitted.
+	if _, err := adapter.DeleteInstance(context.Background(), &DeleteInstanceParams{Server: "https://example.com", InstanceID: "instance"}); err != nil {
+		t.Fatalf("Unexpected error from DeleteInstance: %v", err)
+	}
+	for _, key := range []string{originatingIdentityHeader, requestIdentityHeader} {
+		if _, ok := header[key]; ok {
+			t.Errorf("Got unexpected %s header %q", key, header.Get(key))
+		}
+	}
+}
+
 type MockDoClient struct {
 	do func(*http.Request) (*http.Response, error)
 }
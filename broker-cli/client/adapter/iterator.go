@@ -0,0 +1,126 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+// IteratorDone is returned by the Next methods of iterators once every item was returned.
+var IteratorDone = errors.New("no more items in iterator")
+
+// pager tracks the page tokens of a paginated list.
+type pager struct {
+	token string
+	// last is true once the last page was fetched.
+	last bool
+}
+
+// advance records the token of the next page. A broker repeating the token would make the iteration
+// loop forever, so that is an error.
+func (p *pager) advance(next string) error {
+	if next != "" && next == p.token {
+		return fmt.Errorf("the broker returned the page token %q twice", next)
+	}
+	p.token = next
+	p.last = next == ""
+	return nil
+}
+
+// InstanceIterator iterates over the instances of a broker. It fetches them with ListInstances a
+// page at a time, so that only one page is held in memory.
+type InstanceIterator struct {
+	ctx     context.Context
+	adapter Adapter
+	params  ListInstancesParams
+	pager   pager
+	page    []*osb.Instance
+	err     error
+}
+
+// NewInstanceIterator returns an iterator over the instances listed with params, whose PageSize sets
+// the size of the pages. The iteration starts at the page of params.PageToken.
+func NewInstanceIterator(ctx context.Context, adapter Adapter, params *ListInstancesParams) *InstanceIterator {
+	return &InstanceIterator{ctx: ctx, adapter: adapter, params: *params, pager: pager{token: params.PageToken}}
+}
+
+// Next returns the next instance, or IteratorDone once every instance was returned. The error of a
+// failed page request is returned by every later call.
+func (it *InstanceIterator) Next() (*osb.Instance, error) {
+	for len(it.page) == 0 && it.err == nil {
+		if it.pager.last {
+			return nil, IteratorDone
+		}
+		it.params.PageToken = it.pager.token
+		res, err := it.adapter.ListInstances(it.ctx, &it.params)
+		if err != nil {
+			it.err = err
+			break
+		}
+		it.page = res.Instances
+		it.err = it.pager.advance(res.NextPageToken)
+	}
+	if len(it.page) == 0 {
+		return nil, it.err
+	}
+	i := it.page[0]
+	it.page = it.page[1:]
+	return i, nil
+}
+
+// BindingIterator iterates over the bindings to an instance. It fetches them with ListBindings a
+// page at a time, so that only one page is held in memory.
+type BindingIterator struct {
+	ctx     context.Context
+	adapter Adapter
+	params  ListBindingsParams
+	pager   pager
+	page    []*osb.Binding
+	err     error
+}
+
+// NewBindingIterator returns an iterator over the bindings listed with params, whose PageSize sets
+// the size of the pages. The iteration starts at the page of params.PageToken.
+func NewBindingIterator(ctx context.Context, adapter Adapter, params *ListBindingsParams) *BindingIterator {
+	return &BindingIterator{ctx: ctx, adapter: adapter, params: *params, pager: pager{token: params.PageToken}}
+}
+
+// Next returns the next binding, or IteratorDone once every binding was returned. The error of a
+// failed page request is returned by every later call.
+func (it *BindingIterator) Next() (*osb.Binding, error) {
+	for len(it.page) == 0 && it.err == nil {
+		if it.pager.last {
+			return nil, IteratorDone
+		}
+		it.params.PageToken = it.pager.token
+		res, err := it.adapter.ListBindings(it.ctx, &it.params)
+		if err != nil {
+			it.err = err
+			break
+		}
+		it.page = res.Bindings
+		it.err = it.pager.advance(res.NextPageToken)
+	}
+	if len(it.page) == 0 {
+		return nil, it.err
+	}
+	b := it.page[0]
+	it.page = it.page[1:]
+	return b, nil
+}
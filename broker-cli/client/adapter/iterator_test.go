@@ -0,0 +1,99 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adapter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pagedClient returns a client serving the given response bodies by page token, and records the
+// requested URLs.
+func pagedClient(pages map[string]string, urls *[]string) *MockDoClient {
+	return &MockDoClient{
+		do: func(req *http.Request) (*http.Response, error) {
+			*urls = append(*urls, req.URL.String())
+			body, ok := pages[req.URL.Query().Get(pageTokenKey)]
+			if !ok {
+				return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(strings.NewReader("no such page"))}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+		},
+	}
+}
+
+func TestInstanceIterator(t *testing.T) {
+	var urls []string
+	adapter := NewHttpAdapter(pagedClient(map[string]string{
+		"":   `{"instances": [{"instance_id": "i1"}, {"instance_id": "i2"}], "nextPageToken": "t2"}`,
+		"t2": `{"instances": [], "nextPageToken": "t3"}`,
+		"t3": `{"instances": [{"instance_id": "i3"}]}`,
+	}, &urls))
+
+	it := NewInstanceIterator(context.Background(), adapter, &ListInstancesParams{Server: "https://broker", PageSize: 2})
+	var got []string
+	for {
+		i, err := it.Next()
+		if err == IteratorDone {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error from Next: %v", err)
+		}
+		got = append(got, i.ID)
+	}
+	if want := []string{"i1", "i2", "i3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstanceIterator got %v, want %v", got, want)
+	}
+	wantURLs := []string{
+		"https://broker/instances?pageSize=2",
+		"https://broker/instances?pageSize=2&pageToken=t2",
+		"https://broker/instances?pageSize=2&pageToken=t3",
+	}
+	if !reflect.DeepEqual(urls, wantURLs) {
+		t.Errorf("InstanceIterator requested %v, want %v", urls, wantURLs)
+	}
+	if _, err := it.Next(); err != IteratorDone {
+		t.Errorf("Next after the last instance got error %v, want IteratorDone", err)
+	}
+}
+
+func TestBindingIteratorErrors(t *testing.T) {
+	var urls []string
+	adapter := NewHttpAdapter(pagedClient(map[string]string{
+		"":   `{"bindings": [{"binding_id": "b1"}], "nextPageToken": "t2"}`,
+		"t2": `{"bindings": [{"binding_id": "b2"}], "nextPageToken": "t2"}`,
+	}, &urls))
+
+	it := NewBindingIterator(context.Background(), adapter, &ListBindingsParams{Server: "https://broker", InstanceID: "i1"})
+	for _, want := range []string{"b1", "b2"} {
+		b, err := it.Next()
+		if err != nil || b.ID != want {
+			t.Fatalf("Next got %v, %v, want binding %s", b, err, want)
+		}
+	}
+	if _, err := it.Next(); err == nil || !strings.Contains(err.Error(), "page token") {
+		t.Errorf("Next after a repeated page token got error %v, want one", err)
+	}
+
+	it = NewBindingIterator(context.Background(), adapter, &ListBindingsParams{Server: "https://broker", InstanceID: "i1", PageToken: "missing"})
+	if _, err := it.Next(); err == nil || err == IteratorDone {
+		t.Errorf("Next of a failed page got error %v, want the request error", err)
+	}
+}
@@ -0,0 +1,455 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakebroker contains an in-process fake of a service broker, which serves the OSB v2 API
+// as well as the GCP admin API used by broker-cli. It keeps all state in memory and is meant for
+// tests and local experimentation, e.g.
+//
+//	server := httptest.NewServer(fakebroker.New(fakebroker.Options{}))
+//	client := adapter.NewHttpAdapter(server.Client())
+//	client.GetCatalog(ctx, &adapter.GetCatalogParams{Server: server.URL})
+//
+// The fake serves a generic OSB broker at the root of its URL, and GCP brokers created through the
+// admin API at <URL>/v1beta1/projects/<project>/brokers/<broker>.
+package fakebroker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+const (
+	apiVersionHeader = "X-Broker-API-Version"
+
+	// OSB error codes returned by the fake.
+	errorAsyncRequired    = "AsyncRequired"
+	errorConcurrencyError = "ConcurrencyError"
+)
+
+// Options configures a fake broker.
+type Options struct {
+	// Catalog is the list of services offered by the broker. DefaultCatalog is used if it is empty.
+	Catalog []osb.Service
+	// AsyncDuration is how long asynchronous operations stay in progress before they succeed.
+	// Requests are handled synchronously if it is 0, even if the client accepts asynchronous
+	// processing.
+	AsyncDuration time.Duration
+	// AsyncRequired makes the broker reject synchronous requests which create, update or delete
+	// resources with the AsyncRequired error.
+	AsyncRequired bool
+	// RetryAfter is sent in the Retry-After header of last operation responses while the operation
+	// is in progress, rounded to seconds. No header is sent if it is 0.
+	RetryAfter time.Duration
+	// PageSize is the size of the pages of instances and bindings listed by the admin API unless
+	// the request sets pageSize. It defaults to 100.
+	PageSize int
+	// Now returns the current time. It defaults to time.Now and can be overridden to control the
+	// progress of asynchronous operations in tests.
+	Now func() time.Time
+}
+
+// Fault makes the broker fail matching requests with an OSB error.
+type Fault struct {
+	// Method is the HTTP method of the requests to fail. Empty matches every method.
+	Method string
+	// Path is a pattern in the syntax of path.Match, which is matched against the request path
+	// relative to the broker URL, e.g. "/v2/service_instances/*". Empty matches every path.
+	Path string
+	// StatusCode is the status code of the error response.
+	StatusCode int
+	// ErrorCode and Description make up the OSB error object of the response. Both are optional.
+	ErrorCode   string
+	Description string
+	// Times is how many requests fail before the fault is removed. 0 fails requests until
+	// ClearFaults is called.
+	Times int
+}
+
+// Broker is a fake service broker. It implements http.Handler and is safe for concurrent use.
+type Broker struct {
+	catalog       []osb.Service
+	asyncDuration time.Duration
+	asyncRequired bool
+	retryAfter    time.Duration
+	pageSize      int
+	now           func() time.Time
+
+	mu     sync.Mutex
+	faults []*Fault
+	// brokers holds the state of every broker served by the fake, keyed by its name
+	// ("projects/<project>/brokers/<broker>"). The generic broker has the empty name.
+	brokers map[string]*brokerState
+	// nextID is used to generate unique operation IDs.
+	nextID int
+}
+
+// brokerState is the state of a single broker served by the fake.
+type brokerState struct {
+	broker     osb.Broker
+	instances  map[string]*instance
+	operations map[string]*operation
+}
+
+// instance is a service instance.
+type instance struct {
+	id         string
+	serviceID  string
+	planID     string
+	context    map[string]interface{}
+	parameters map[string]interface{}
+	createTime string
+	// provisioned is false until the operation which creates the instance succeeds.
+	provisioned bool
+	// pending is the operation in progress for the instance or one of its bindings, if any.
+	pending  *operation
+	bindings map[string]*binding
+}
+
+// binding is a service binding.
+type binding struct {
+	id          string
+	parameters  map[string]interface{}
+	credentials map[string]interface{}
+	provisioned bool
+}
+
+// operation is an asynchronous operation on an instance or binding.
+type operation struct {
+	id         string
+	instanceID string
+	bindingID  string
+	// apply changes the state of the broker once the operation succeeds.
+	apply func()
+	done  time.Time
+	state string
+}
+
+// Operation states defined by the OSB API.
+const (
+	stateInProgress = "in progress"
+	stateSucceeded  = "succeeded"
+)
+
+// New returns a fake broker configured by opts.
+func New(opts Options) *Broker {
+	b := &Broker{
+		catalog:       opts.Catalog,
+		asyncDuration: opts.AsyncDuration,
+		asyncRequired: opts.AsyncRequired,
+		retryAfter:    opts.RetryAfter,
+		pageSize:      opts.PageSize,
+		now:           opts.Now,
+		brokers:       map[string]*brokerState{"": newBrokerState(osb.Broker{})},
+	}
+	if len(b.catalog) == 0 {
+		b.catalog = DefaultCatalog()
+	}
+	if b.now == nil {
+		b.now = time.Now
+	}
+	if b.pageSize <= 0 {
+		b.pageSize = 100
+	}
+	return b
+}
+
+// DefaultCatalog returns the catalog served by a fake broker unless Options.Catalog is set. It has
+// a single bindable service, whose instances and bindings can be fetched, with a free and a paid
+// plan.
+func DefaultCatalog() []osb.Service {
+	free, paid := true, false
+	return []osb.Service{
+		{
+			Name:                 "fake-service",
+			ID:                   "fake-service-id",
+			Description:          "A service offered by the fake broker",
+			Tags:                 []string{"fake"},
+			Bindable:             true,
+			PlanUpdateable:       true,
+			InstancesRetrievable: true,
+			BindingsRetrievable:  true,
+			Plans: []osb.Plan{
+				{ID: "fake-plan-free-id", Name: "free", Description: "A free plan", Free: &free},
+				{ID: "fake-plan-paid-id", Name: "paid", Description: "A paid plan", Free: &paid},
+			},
+		},
+	}
+}
+
+// InjectFault makes the broker fail requests matching f until it is used up or cleared. Faults are
+// matched in the order they were injected.
+func (b *Broker) InjectFault(f Fault) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.faults = append(b.faults, &f)
+}
+
+// ClearFaults removes all injected faults.
+func (b *Broker) ClearFaults() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.faults = nil
+}
+
+// ServeHTTP is the method inherited from the http.Handler interface.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.completeOperations()
+
+	name, rest, ok := splitBrokerPath(r.URL.Path)
+	if !ok {
+		b.serveAdmin(w, r)
+		return
+	}
+	state := b.brokers[name]
+	if state == nil {
+		writeError(w, http.StatusNotFound, "", fmt.Sprintf("broker %q does not exist", name))
+		return
+	}
+	if b.injectFault(w, r.Method, rest) {
+		return
+	}
+
+	if strings.HasPrefix(rest, "/v2/") {
+		b.serveOSB(w, r, state, rest)
+		return
+	}
+	serveInstancesAdmin(w, r, state, rest, b.pageSize)
+}
+
+// splitBrokerPath splits a request path into the name of the broker and the path relative to the
+// broker URL. It returns false if the path addresses the brokers of a project or a broker itself,
+// which are served by the admin API.
+func splitBrokerPath(p string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSuffix(p, "/"), "/")
+	// ["", "v1beta1", "projects", <project>, "brokers", <broker>, <rest>...]
+	if len(parts) < 5 || parts[1] != "v1beta1" || parts[2] != "projects" || parts[4] != "brokers" {
+		return "", p, true
+	}
+	if len(parts) <= 6 {
+		return "", "", false
+	}
+	return strings.Join(parts[2:6], "/"), "/" + strings.Join(parts[6:], "/"), true
+}
+
+// injectFault writes the error of the first fault matching the request and returns true, or
+// returns false if no fault matches.
+func (b *Broker) injectFault(w http.ResponseWriter, method, p string) bool {
+	for i, f := range b.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		if f.Path != "" {
+			if ok, _ := path.Match(f.Path, p); !ok {
+				continue
+			}
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				b.faults = append(b.faults[:i], b.faults[i+1:]...)
+			}
+		}
+		writeError(w, f.StatusCode, f.ErrorCode, f.Description)
+		return true
+	}
+	return false
+}
+
+// serveAdmin serves the GCP admin API which manages the brokers of a project.
+func (b *Broker) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	project := parts[3]
+	collection := fmt.Sprintf("projects/%s/brokers", project)
+	if b.injectFault(w, r.Method, "/"+strings.Join(parts[1:], "/")) {
+		return
+	}
+
+	switch {
+	case len(parts) == 5 && r.Method == http.MethodGet:
+		res := struct {
+			Brokers []osb.Broker `json:"brokers"`
+		}{Brokers: []osb.Broker{}}
+		for name, state := range b.brokers {
+			if strings.HasPrefix(name, collection+"/") {
+				res.Brokers = append(res.Brokers, state.broker)
+			}
+		}
+		sort.Slice(res.Brokers, func(i, j int) bool { return res.Brokers[i].Name < res.Brokers[j].Name })
+		writeJSON(w, http.StatusOK, res)
+	case len(parts) == 5 && r.Method == http.MethodPost:
+		broker := osb.Broker{}
+		if err := json.NewDecoder(r.Body).Decode(&broker); err != nil {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("error decoding broker: %v", err))
+			return
+		}
+		if !strings.HasPrefix(broker.Name, collection+"/") || strings.Count(broker.Name, "/") != 3 {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("broker name %q is not of the form %s/<broker>", broker.Name, collection))
+			return
+		}
+		if _, ok := b.brokers[broker.Name]; ok {
+			writeError(w, http.StatusConflict, "", fmt.Sprintf("broker %q already exists", broker.Name))
+			return
+		}
+		url := fmt.Sprintf("http://%s/v1beta1/%s", r.Host, broker.Name)
+		createTime := b.now().UTC().Format(time.RFC3339)
+		broker.URL = &url
+		broker.CreateTime = &createTime
+		b.brokers[broker.Name] = newBrokerState(broker)
+		writeJSON(w, http.StatusOK, broker)
+	case len(parts) == 6 && r.Method == http.MethodDelete:
+		name := collection + "/" + parts[5]
+		if _, ok := b.brokers[name]; !ok {
+			writeError(w, http.StatusNotFound, "", fmt.Sprintf("broker %q does not exist", name))
+			return
+		}
+		delete(b.brokers, name)
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		writeError(w, http.StatusNotFound, "", fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+	}
+}
+
+// serveInstancesAdmin serves the GCP admin API which lists the instances and bindings of a broker,
+// a page at a time.
+func serveInstancesAdmin(w http.ResponseWriter, r *http.Request, state *brokerState, rest string, defaultPageSize int) {
+	parts := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	if r.Method != http.MethodGet || len(parts) < 2 || parts[1] != "instances" {
+		writeError(w, http.StatusNotFound, "", fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+		return
+	}
+	pageSize := defaultPageSize
+	if s := r.URL.Query().Get("pageSize"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("invalid pageSize %q", s))
+			return
+		}
+		if n > 0 {
+			pageSize = n
+		}
+	}
+	// The page token is the ID of the last item of the previous page, since items are sorted by ID.
+	pageToken := r.URL.Query().Get("pageToken")
+
+	switch {
+	case len(parts) == 2:
+		res := struct {
+			Instances     []*osb.Instance `json:"instances"`
+			NextPageToken string          `json:"nextPageToken,omitempty"`
+		}{Instances: []*osb.Instance{}}
+		for _, i := range state.sortedInstances() {
+			if i.id <= pageToken {
+				continue
+			}
+			if len(res.Instances) == pageSize {
+				res.NextPageToken = res.Instances[pageSize-1].ID
+				break
+			}
+			res.Instances = append(res.Instances, &osb.Instance{ID: i.id, ServiceID: i.serviceID, PlanID: i.planID, CreateTime: i.createTime})
+		}
+		writeJSON(w, http.StatusOK, res)
+	case len(parts) == 4 && parts[3] == "bindings":
+		i := state.instances[parts[2]]
+		if i == nil {
+			writeError(w, http.StatusNotFound, "", fmt.Sprintf("instance %q does not exist", parts[2]))
+			return
+		}
+		res := struct {
+			Bindings      []*osb.Binding `json:"bindings"`
+			NextPageToken string         `json:"nextPageToken,omitempty"`
+		}{Bindings: []*osb.Binding{}}
+		for _, b := range i.sortedBindings() {
+			if b.id <= pageToken {
+				continue
+			}
+			if len(res.Bindings) == pageSize {
+				res.NextPageToken = res.Bindings[pageSize-1].ID
+				break
+			}
+			res.Bindings = append(res.Bindings, &osb.Binding{ID: b.id})
+		}
+		writeJSON(w, http.StatusOK, res)
+	default:
+		writeError(w, http.StatusNotFound, "", fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+	}
+}
+
+// completeOperations applies the asynchronous operations which are due.
+func (b *Broker) completeOperations() {
+	now := b.now()
+	for _, state := range b.brokers {
+		for _, op := range state.operations {
+			if op.state == stateInProgress && !now.Before(op.done) {
+				op.state = stateSucceeded
+				op.apply()
+			}
+		}
+	}
+}
+
+func newBrokerState(broker osb.Broker) *brokerState {
+	return &brokerState{
+		broker:     broker,
+		instances:  make(map[string]*instance),
+		operations: make(map[string]*operation),
+	}
+}
+
+// sortedInstances returns the instances of the broker, ordered by ID.
+func (s *brokerState) sortedInstances() []*instance {
+	ret := make([]*instance, 0, len(s.instances))
+	for _, i := range s.instances {
+		ret = append(ret, i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].id < ret[j].id })
+	return ret
+}
+
+// sortedBindings returns the bindings of the instance, ordered by ID.
+func (i *instance) sortedBindings() []*binding {
+	ret := make([]*binding, 0, len(i.bindings))
+	for _, b := range i.bindings {
+		ret = append(ret, b)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].id < ret[j].id })
+	return ret
+}
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an OSB error object as the body of the response.
+func writeError(w http.ResponseWriter, statusCode int, errorCode, description string) {
+	writeJSON(w, statusCode, struct {
+		Error       string `json:"error,omitempty"`
+		Description string `json:"description,omitempty"`
+	}{Error: errorCode, Description: description})
+}
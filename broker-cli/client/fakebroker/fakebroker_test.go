@@ -0,0 +1,363 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakebroker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+)
+
+const (
+	testAPIVersion = "2.13"
+	testServiceID  = "fake-service-id"
+	testPlanID     = "fake-plan-free-id"
+)
+
+// fakeClock is a clock which only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestServer(opts Options) (*httptest.Server, *Broker, adapter.Adapter) {
+	broker := New(opts)
+	server := httptest.NewServer(broker)
+	return server, broker, adapter.NewHttpAdapter(server.Client())
+}
+
+func TestCatalog(t *testing.T) {
+	server, _, client := newTestServer(Options{})
+	defer server.Close()
+
+	res, err := client.GetCatalog(context.Background(), &adapter.GetCatalogParams{Server: server.URL, APIVersion: testAPIVersion})
+	if err != nil {
+		t.Fatalf("Unexpected error from GetCatalog: %v", err)
+	}
+	if !reflect.DeepEqual(res.Services, DefaultCatalog()) {
+		t.Fatalf("Catalog got %+v, want %+v", res.Services, DefaultCatalog())
+	}
+}
+
+// TestSyncLifecycle tests that instances and bindings are created, listed, fetched and deleted
+// synchronously.
+func TestSyncLifecycle(t *testing.T) {
+	server, _, client := newTestServer(Options{})
+	defer server.Close()
+	ctx := context.Background()
+
+	if _, err := client.CreateInstance(ctx, &adapter.CreateInstanceParams{
+		Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1", ServiceID: testServiceID, PlanID: testPlanID,
+		Parameters: map[string]interface{}{"size": "small"},
+	}); err != nil {
+		t.Fatalf("Unexpected error from CreateInstance: %v", err)
+	}
+
+	instance, err := client.GetInstance(ctx, &adapter.GetInstanceParams{Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1"})
+	if err != nil {
+		t.Fatalf("Unexpected error from GetInstance: %v", err)
+	}
+	if instance.PlanID != testPlanID || instance.Parameters["size"] != "small" {
+		t.Fatalf("GetInstance got %+v, want plan %q and parameters {size: small}", instance, testPlanID)
+	}
+
+	bind, err := client.CreateBinding(ctx, &adapter.CreateBindingParams{
+		Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1", BindingID: "b1", ServiceID: testServiceID, PlanID: testPlanID,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error from CreateBinding: %v", err)
+	}
+	if bind.Credentials["username"] != "b1" {
+		t.Fatalf("CreateBinding got credentials %+v, want username b1", bind.Credentials)
+	}
+
+	instances, err := client.ListInstances(ctx, &adapter.ListInstancesParams{Server: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error from ListInstances: %v", err)
+	}
+	if len(instances.Instances) != 1 || instances.Instances[0].ID != "i1" {
+		t.Fatalf("ListInstances got %+v, want instance i1", instances.Instances)
+	}
+	bindings, err := client.ListBindings(ctx, &adapter.ListBindingsParams{Server: server.URL, InstanceID: "i1"})
+	if err != nil {
+		t.Fatalf("Unexpected error from ListBindings: %v", err)
+	}
+	if len(bindings.Bindings) != 1 || bindings.Bindings[0].ID != "b1" {
+		t.Fatalf("ListBindings got %+v, want binding b1", bindings.Bindings)
+	}
+
+	if _, err := client.DeleteBinding(ctx, &adapter.DeleteBindingParams{
+		Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1", BindingID: "b1", ServiceID: testServiceID, PlanID: testPlanID,
+	}); err != nil {
+		t.Fatalf("Unexpected error from DeleteBinding: %v", err)
+	}
+	if _, err := client.DeleteInstance(ctx, &adapter.DeleteInstanceParams{
+		Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1", ServiceID: testServiceID, PlanID: testPlanID,
+	}); err != nil {
+		t.Fatalf("Unexpected error from DeleteInstance: %v", err)
+	}
+	if _, err := client.GetInstance(ctx, &adapter.GetInstanceParams{Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1"}); err == nil {
+		t.Fatal("GetInstance got no error for a deleted instance")
+	}
+}
+
+// TestListPages tests that the admin API lists instances and bindings a page at a time.
+func TestListPages(t *testing.T) {
+	server, _, client := newTestServer(Options{PageSize: 2})
+	defer server.Close()
+	ctx := context.Background()
+
+	for _, id := range []string{"i1", "i2", "i3", "i4", "i5"} {
+		if _, err := client.CreateInstance(ctx, &adapter.CreateInstanceParams{
+			Server: server.URL, APIVersion: testAPIVersion, InstanceID: id, ServiceID: testServiceID, PlanID: testPlanID,
+		}); err != nil {
+			t.Fatalf("Unexpected error from CreateInstance: %v", err)
+		}
+	}
+	for _, id := range []string{"b1", "b2", "b3"} {
+		if _, err := client.CreateBinding(ctx, &adapter.CreateBindingParams{
+			Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1", BindingID: id, ServiceID: testServiceID, PlanID: testPlanID,
+		}); err != nil {
+			t.Fatalf("Unexpected error from CreateBinding: %v", err)
+		}
+	}
+
+	page, err := client.ListInstances(ctx, &adapter.ListInstancesParams{Server: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error from ListInstances: %v", err)
+	}
+	if len(page.Instances) != 2 || page.NextPageToken == "" {
+		t.Fatalf("ListInstances got %+v, want a first page of 2 instances", page)
+	}
+
+	var instances []string
+	it := adapter.NewInstanceIterator(ctx, client, &adapter.ListInstancesParams{Server: server.URL, PageSize: 3})
+	for i, err := it.Next(); err != adapter.IteratorDone; i, err = it.Next() {
+		if err != nil {
+			t.Fatalf("Unexpected error from InstanceIterator: %v", err)
+		}
+		instances = append(instances, i.ID)
+	}
+	if want := []string{"i1", "i2", "i3", "i4", "i5"}; !reflect.DeepEqual(instances, want) {
+		t.Errorf("InstanceIterator got %v, want %v", instances, want)
+	}
+
+	var bindings []string
+	bit := adapter.NewBindingIterator(ctx, client, &adapter.ListBindingsParams{Server: server.URL, InstanceID: "i1"})
+	for b, err := bit.Next(); err != adapter.IteratorDone; b, err = bit.Next() {
+		if err != nil {
+			t.Fatalf("Unexpected error from BindingIterator: %v", err)
+		}
+		bindings = append(bindings, b.ID)
+	}
+	if want := []string{"b1", "b2", "b3"}; !reflect.DeepEqual(bindings, want) {
+		t.Errorf("BindingIterator got %v, want %v", bindings, want)
+	}
+}
+
+// TestAsyncOperation tests that asynchronous operations stay in progress until they are due and
+// that concurrent operations are rejected meanwhile.
+func TestAsyncOperation(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)}
+	server, _, client := newTestServer(Options{AsyncDuration: time.Minute, Now: clock.Now})
+	defer server.Close()
+	ctx := context.Background()
+
+	res, err := client.CreateInstance(ctx, &adapter.CreateInstanceParams{
+		Server: server.URL, APIVersion: testAPIVersion, AcceptsIncomplete: true, InstanceID: "i1", ServiceID: testServiceID, PlanID: testPlanID,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error from CreateInstance: %v", err)
+	}
+	if !res.Async || res.OperationID == "" {
+		t.Fatalf("CreateInstance got %+v, want an asynchronous operation", res)
+	}
+
+	pollParams := &adapter.InstanceLastOperationParams{
+		Server:     server.URL,
+		InstanceID: "i1",
+		LastOperationParams: &adapter.LastOperationParams{
+			APIVersion:  testAPIVersion,
+			OperationID: res.OperationID,
+		},
+	}
+	op, err := client.InstanceLastOperation(ctx, pollParams)
+	if err != nil {
+		t.Fatalf("Unexpected error from InstanceLastOperation: %v", err)
+	}
+	if op.State != adapter.OperationInProgress {
+		t.Fatalf("Operation state got %q, want %q", op.State, adapter.OperationInProgress)
+	}
+
+	_, err = client.DeleteInstance(ctx, &adapter.DeleteInstanceParams{
+		Server: server.URL, APIVersion: testAPIVersion, AcceptsIncomplete: true, InstanceID: "i1", ServiceID: testServiceID, PlanID: testPlanID,
+	})
+	if !adapter.IsConcurrencyError(err) {
+		t.Fatalf("DeleteInstance got error %v, want a ConcurrencyError", err)
+	}
+
+	clock.Advance(time.Minute)
+	op, err = client.InstanceLastOperation(ctx, pollParams)
+	if err != nil {
+		t.Fatalf("Unexpected error from InstanceLastOperation: %v", err)
+	}
+	if op.State != adapter.OperationSucceeded {
+		t.Fatalf("Operation state got %q, want %q", op.State, adapter.OperationSucceeded)
+	}
+	if _, err := client.GetInstance(ctx, &adapter.GetInstanceParams{Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1"}); err != nil {
+		t.Fatalf("Unexpected error from GetInstance: %v", err)
+	}
+}
+
+// TestRetryAfter tests that the delay the broker asks for while an operation is in progress is
+// returned in Operation.RetryAfter.
+func TestRetryAfter(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)}
+	server, _, client := newTestServer(Options{AsyncDuration: time.Minute, RetryAfter: 5 * time.Second, Now: clock.Now})
+	defer server.Close()
+
+	res, err := client.CreateInstance(context.Background(), &adapter.CreateInstanceParams{
+		Server: server.URL, APIVersion: testAPIVersion, AcceptsIncomplete: true, InstanceID: "i1", ServiceID: testServiceID, PlanID: testPlanID,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error from CreateInstance: %v", err)
+	}
+	pollParams := &adapter.InstanceLastOperationParams{
+		Server:     server.URL,
+		InstanceID: "i1",
+		LastOperationParams: &adapter.LastOperationParams{
+			APIVersion:  testAPIVersion,
+			OperationID: res.OperationID,
+		},
+	}
+
+	op, err := client.InstanceLastOperation(context.Background(), pollParams)
+	if err != nil {
+		t.Fatalf("Unexpected error from InstanceLastOperation: %v", err)
+	}
+	if op.RetryAfter != 5*time.Second {
+		t.Errorf("Retry-After of an operation in progress got %v, want 5s", op.RetryAfter)
+	}
+
+	clock.Advance(time.Minute)
+	op, err = client.InstanceLastOperation(context.Background(), pollParams)
+	if err != nil {
+		t.Fatalf("Unexpected error from InstanceLastOperation: %v", err)
+	}
+	if op.RetryAfter != 0 {
+		t.Errorf("Retry-After of a finished operation got %v, want 0", op.RetryAfter)
+	}
+}
+
+// TestAsyncRequired tests that synchronous requests are rejected if the broker requires
+// asynchronous processing.
+func TestAsyncRequired(t *testing.T) {
+	server, _, client := newTestServer(Options{AsyncDuration: time.Millisecond, AsyncRequired: true})
+	defer server.Close()
+
+	_, err := client.CreateInstance(context.Background(), &adapter.CreateInstanceParams{
+		Server: server.URL, APIVersion: testAPIVersion, InstanceID: "i1", ServiceID: testServiceID, PlanID: testPlanID,
+	})
+	if !adapter.IsAsyncRequired(err) {
+		t.Fatalf("CreateInstance got error %v, want AsyncRequired", err)
+	}
+}
+
+// TestInjectFault tests that injected faults fail matching requests the given number of times.
+func TestInjectFault(t *testing.T) {
+	server, broker, client := newTestServer(Options{})
+	defer server.Close()
+	ctx := context.Background()
+
+	broker.InjectFault(Fault{
+		Method:      http.MethodGet,
+		Path:        "/v2/catalog",
+		StatusCode:  http.StatusInternalServerError,
+		Description: "injected",
+		Times:       1,
+	})
+
+	params := &adapter.GetCatalogParams{Server: server.URL, APIVersion: testAPIVersion}
+	_, err := client.GetCatalog(ctx, params)
+	if brokerErr, ok := err.(*adapter.BrokerError); !ok || brokerErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("GetCatalog got error %v, want the injected fault", err)
+	}
+	if _, err := client.GetCatalog(ctx, params); err != nil {
+		t.Fatalf("Unexpected error from GetCatalog after the fault was used up: %v", err)
+	}
+}
+
+// TestBrokers tests the admin API which manages GCP brokers, and that each broker has its own
+// instances.
+func TestBrokers(t *testing.T) {
+	server, _, client := newTestServer(Options{})
+	defer server.Close()
+	ctx := context.Background()
+
+	broker, err := client.CreateBroker(ctx, &adapter.CreateBrokerParams{Host: server.URL, Project: "p", Name: "b", Title: "Broker"})
+	if err != nil {
+		t.Fatalf("Unexpected error from CreateBroker: %v", err)
+	}
+	brokerURL := server.URL + "/v1beta1/projects/p/brokers/b"
+	if broker.URL == nil || *broker.URL != brokerURL {
+		t.Fatalf("CreateBroker got URL %v, want %q", broker.URL, brokerURL)
+	}
+
+	brokers, err := client.ListBrokers(ctx, &adapter.ListBrokersParams{Host: server.URL, Project: "p"})
+	if err != nil {
+		t.Fatalf("Unexpected error from ListBrokers: %v", err)
+	}
+	if len(brokers.Brokers) != 1 || brokers.Brokers[0].Name != "projects/p/brokers/b" {
+		t.Fatalf("ListBrokers got %+v, want broker projects/p/brokers/b", brokers.Brokers)
+	}
+
+	if _, err := client.CreateInstance(ctx, &adapter.CreateInstanceParams{
+		Server: brokerURL, APIVersion: testAPIVersion, InstanceID: "i1", ServiceID: testServiceID, PlanID: testPlanID,
+	}); err != nil {
+		t.Fatalf("Unexpected error from CreateInstance: %v", err)
+	}
+	instances, err := client.ListInstances(ctx, &adapter.ListInstancesParams{Server: server.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error from ListInstances: %v", err)
+	}
+	if len(instances.Instances) != 0 {
+		t.Fatalf("ListInstances of the generic broker got %+v, want none", instances.Instances)
+	}
+
+	if err := client.DeleteBroker(ctx, &adapter.DeleteBrokerParams{BrokerURL: brokerURL}); err != nil {
+		t.Fatalf("Unexpected error from DeleteBroker: %v", err)
+	}
+	if _, err := client.ListInstances(ctx, &adapter.ListInstancesParams{Server: brokerURL}); err == nil {
+		t.Fatal("ListInstances got no error for a deleted broker")
+	}
+}
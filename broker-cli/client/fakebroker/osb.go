@@ -0,0 +1,347 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakebroker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+// serveOSB serves the OSB v2 API of a broker. rest is the request path relative to the broker URL.
+func (b *Broker) serveOSB(w http.ResponseWriter, r *http.Request, state *brokerState, rest string) {
+	if r.Header.Get(apiVersionHeader) == "" {
+		writeError(w, http.StatusPreconditionFailed, "", fmt.Sprintf("missing %s header", apiVersionHeader))
+		return
+	}
+
+	// ["", "v2", "service_instances", <instance>, "service_bindings", <binding>, "last_operation"]
+	parts := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	switch {
+	case len(parts) == 3 && parts[2] == "catalog" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, struct {
+			Services []osb.Service `json:"services"`
+		}{Services: b.catalog})
+	case len(parts) == 4 && parts[2] == "service_instances":
+		b.serveInstance(w, r, state, parts[3])
+	case len(parts) == 5 && parts[2] == "service_instances" && parts[4] == "last_operation" && r.Method == http.MethodGet:
+		b.serveLastOperation(w, r, state)
+	case len(parts) == 6 && parts[2] == "service_instances" && parts[4] == "service_bindings":
+		b.serveBinding(w, r, state, parts[3], parts[5])
+	case len(parts) == 7 && parts[2] == "service_instances" && parts[4] == "service_bindings" && parts[6] == "last_operation" && r.Method == http.MethodGet:
+		b.serveLastOperation(w, r, state)
+	default:
+		writeError(w, http.StatusNotFound, "", fmt.Sprintf("%s %s is not supported", r.Method, r.URL.Path))
+	}
+}
+
+// serveInstance serves the requests which provision, update, deprovision and fetch an instance.
+func (b *Broker) serveInstance(w http.ResponseWriter, r *http.Request, state *brokerState, instanceID string) {
+	i := state.instances[instanceID]
+	switch r.Method {
+	case http.MethodPut:
+		body := osb.ProvisionRequestBody{}
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		if _, plan := b.findPlan(body.ServiceID, body.PlanID); plan == nil {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("plan %q of service %q is not in the catalog", body.PlanID, body.ServiceID))
+			return
+		}
+		if i != nil {
+			if i.serviceID != body.ServiceID || i.planID != body.PlanID || !reflect.DeepEqual(i.parameters, body.Parameters) {
+				writeError(w, http.StatusConflict, "", fmt.Sprintf("instance %q already exists with different attributes", instanceID))
+				return
+			}
+			if !i.provisioned {
+				writeJSON(w, http.StatusAccepted, osb.ProvisionResponseBody{Operation: i.pending.id})
+				return
+			}
+			writeJSON(w, http.StatusOK, osb.ProvisionResponseBody{})
+			return
+		}
+
+		i = &instance{
+			id:         instanceID,
+			serviceID:  body.ServiceID,
+			planID:     body.PlanID,
+			context:    body.Context,
+			parameters: body.Parameters,
+			createTime: b.now().UTC().Format(time.RFC3339),
+			bindings:   make(map[string]*binding),
+		}
+		if op, ok := b.startOperation(w, r, state, i, "", func() { i.provisioned = true }); ok {
+			state.instances[instanceID] = i
+			if op != nil {
+				writeJSON(w, http.StatusAccepted, osb.ProvisionResponseBody{Operation: op.id})
+				return
+			}
+			writeJSON(w, http.StatusCreated, osb.ProvisionResponseBody{})
+		}
+	case http.MethodPatch:
+		body := osb.UpdateInstanceRequestBody{}
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		if i == nil || !i.provisioned {
+			writeError(w, http.StatusNotFound, "", fmt.Sprintf("instance %q does not exist", instanceID))
+			return
+		}
+		planID := i.planID
+		if body.PlanID != "" {
+			if _, plan := b.findPlan(i.serviceID, body.PlanID); plan == nil {
+				writeError(w, http.StatusBadRequest, "", fmt.Sprintf("plan %q of service %q is not in the catalog", body.PlanID, i.serviceID))
+				return
+			}
+			planID = body.PlanID
+		}
+		if op, ok := b.startOperation(w, r, state, i, "", func() {
+			i.planID = planID
+			if body.Context != nil {
+				i.context = body.Context
+			}
+			if body.Parameters != nil {
+				i.parameters = body.Parameters
+			}
+		}); ok {
+			writeJSON(w, asyncStatus(op, http.StatusOK), osb.UpdateInstanceResponseBody{Operation: operationID(op)})
+		}
+	case http.MethodDelete:
+		if i == nil {
+			writeJSON(w, http.StatusGone, struct{}{})
+			return
+		}
+		if op, ok := b.startOperation(w, r, state, i, "", func() { delete(state.instances, instanceID) }); ok {
+			writeJSON(w, asyncStatus(op, http.StatusOK), osb.DeprovisionResponseBody{Operation: operationID(op)})
+		}
+	case http.MethodGet:
+		if i == nil || !i.provisioned {
+			writeError(w, http.StatusNotFound, "", fmt.Sprintf("instance %q does not exist", instanceID))
+			return
+		}
+		if i.pending != nil && i.pending.bindingID == "" {
+			writeError(w, http.StatusUnprocessableEntity, errorConcurrencyError, fmt.Sprintf("instance %q is being updated", instanceID))
+			return
+		}
+		svc := b.findService(i.serviceID)
+		if svc == nil || !svc.InstancesRetrievable {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("service %q does not support fetching instances", i.serviceID))
+			return
+		}
+		writeJSON(w, http.StatusOK, osb.FetchInstanceResponseBody{
+			ServiceID:  i.serviceID,
+			PlanID:     i.planID,
+			Parameters: i.parameters,
+		})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "", fmt.Sprintf("%s is not supported for instances", r.Method))
+	}
+}
+
+// serveBinding serves the requests which create, delete and fetch a binding.
+func (b *Broker) serveBinding(w http.ResponseWriter, r *http.Request, state *brokerState, instanceID, bindingID string) {
+	i := state.instances[instanceID]
+	if i == nil || !i.provisioned {
+		if r.Method == http.MethodDelete {
+			writeJSON(w, http.StatusGone, struct{}{})
+			return
+		}
+		writeError(w, http.StatusNotFound, "", fmt.Sprintf("instance %q does not exist", instanceID))
+		return
+	}
+	bnd := i.bindings[bindingID]
+
+	switch r.Method {
+	case http.MethodPut:
+		body := osb.BindRequestBody{}
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		svc, plan := b.findPlan(body.ServiceID, body.PlanID)
+		if plan == nil || body.ServiceID != i.serviceID {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("plan %q of service %q does not match instance %q", body.PlanID, body.ServiceID, instanceID))
+			return
+		}
+		if (plan.Bindable != nil && !*plan.Bindable) || (plan.Bindable == nil && !svc.Bindable) {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("plan %q is not bindable", body.PlanID))
+			return
+		}
+		if bnd != nil {
+			if !reflect.DeepEqual(bnd.parameters, body.Parameters) {
+				writeError(w, http.StatusConflict, "", fmt.Sprintf("binding %q already exists with different attributes", bindingID))
+				return
+			}
+			if !bnd.provisioned {
+				writeJSON(w, http.StatusAccepted, osb.BindResponseBody{Operation: i.pending.id})
+				return
+			}
+			writeJSON(w, http.StatusOK, osb.BindResponseBody{Credentials: bnd.credentials})
+			return
+		}
+
+		bnd = &binding{
+			id:         bindingID,
+			parameters: body.Parameters,
+			credentials: map[string]interface{}{
+				"username": bindingID,
+				"password": fmt.Sprintf("password-%s", bindingID),
+			},
+		}
+		if op, ok := b.startOperation(w, r, state, i, bindingID, func() { bnd.provisioned = true }); ok {
+			i.bindings[bindingID] = bnd
+			if op != nil {
+				writeJSON(w, http.StatusAccepted, osb.BindResponseBody{Operation: op.id})
+				return
+			}
+			writeJSON(w, http.StatusCreated, osb.BindResponseBody{Credentials: bnd.credentials})
+		}
+	case http.MethodDelete:
+		if bnd == nil {
+			writeJSON(w, http.StatusGone, struct{}{})
+			return
+		}
+		if op, ok := b.startOperation(w, r, state, i, bindingID, func() { delete(i.bindings, bindingID) }); ok {
+			writeJSON(w, asyncStatus(op, http.StatusOK), osb.UnbindResponseBody{Operation: operationID(op)})
+		}
+	case http.MethodGet:
+		if bnd == nil || !bnd.provisioned {
+			writeError(w, http.StatusNotFound, "", fmt.Sprintf("binding %q does not exist", bindingID))
+			return
+		}
+		svc := b.findService(i.serviceID)
+		if svc == nil || !svc.BindingsRetrievable {
+			writeError(w, http.StatusBadRequest, "", fmt.Sprintf("service %q does not support fetching bindings", i.serviceID))
+			return
+		}
+		writeJSON(w, http.StatusOK, osb.FetchBindingResponseBody{
+			Credentials: bnd.credentials,
+			Parameters:  bnd.parameters,
+		})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "", fmt.Sprintf("%s is not supported for bindings", r.Method))
+	}
+}
+
+// startOperation starts an operation on instance i, or on its binding bindingID if set. apply
+// changes the state of the broker once the operation is done. The operation is completed right
+// away and nil is returned if it is synchronous. False is returned if the request was rejected, in
+// which case the error response has already been written.
+func (b *Broker) startOperation(w http.ResponseWriter, r *http.Request, state *brokerState, i *instance, bindingID string, apply func()) (*operation, bool) {
+	if i.pending != nil {
+		writeError(w, http.StatusUnprocessableEntity, errorConcurrencyError, fmt.Sprintf("operation %q is in progress for instance %q", i.pending.id, i.id))
+		return nil, false
+	}
+
+	async := r.URL.Query().Get("accepts_incomplete") == "true"
+	if !async && b.asyncRequired {
+		writeError(w, http.StatusUnprocessableEntity, errorAsyncRequired, "this broker only supports asynchronous requests")
+		return nil, false
+	}
+	if !async || b.asyncDuration == 0 {
+		apply()
+		return nil, true
+	}
+
+	b.nextID++
+	op := &operation{
+		id:         fmt.Sprintf("operation-%d", b.nextID),
+		instanceID: i.id,
+		bindingID:  bindingID,
+		done:       b.now().Add(b.asyncDuration),
+		state:      stateInProgress,
+	}
+	op.apply = func() {
+		i.pending = nil
+		apply()
+	}
+	i.pending = op
+	state.operations[op.id] = op
+	return op, true
+}
+
+// serveLastOperation serves the last operation of an instance or binding.
+func (b *Broker) serveLastOperation(w http.ResponseWriter, r *http.Request, state *brokerState) {
+	id := r.URL.Query().Get("operation")
+	op := state.operations[id]
+	if op == nil {
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("operation %q does not exist", id))
+		return
+	}
+	if op.state == stateInProgress && b.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(b.retryAfter.Seconds())))
+	}
+	writeJSON(w, http.StatusOK, osb.OperationResponseBody{
+		State:       op.state,
+		Description: fmt.Sprintf("Operation %s is %s", op.id, op.state),
+	})
+}
+
+// findService returns the service with the given ID, or nil if the catalog doesn't have it.
+func (b *Broker) findService(serviceID string) *osb.Service {
+	for i := range b.catalog {
+		if b.catalog[i].ID == serviceID {
+			return &b.catalog[i]
+		}
+	}
+	return nil
+}
+
+// findPlan returns the service and plan with the given IDs. The plan is nil if the catalog doesn't
+// have it.
+func (b *Broker) findPlan(serviceID, planID string) (*osb.Service, *osb.Plan) {
+	svc := b.findService(serviceID)
+	if svc == nil {
+		return nil, nil
+	}
+	for i := range svc.Plans {
+		if svc.Plans[i].ID == planID {
+			return svc, &svc.Plans[i]
+		}
+	}
+	return svc, nil
+}
+
+// decodeBody decodes the JSON request body into v. It writes an error response and returns false
+// if the body is malformed.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("error decoding request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// asyncStatus returns 202 for an asynchronous operation and syncStatus otherwise.
+func asyncStatus(op *operation, syncStatus int) int {
+	if op != nil {
+		return http.StatusAccepted
+	}
+	return syncStatus
+}
+
+// operationID returns the ID of an asynchronous operation, or an empty string for a synchronous
+// one.
+func operationID(op *operation) string {
+	if op == nil {
+		return ""
+	}
+	return op.id
+}
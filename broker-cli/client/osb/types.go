@@ -45,6 +45,14 @@ type DashboardClient struct {
 	RedirectURI *string `json:"redirect_uri"`
 }
 
+// MaintenanceInfo corresponds to the Maintenance Info Object in the Open Service Broker API.
+type MaintenanceInfo struct {
+	// Version is the semantic version of the maintenance info of a service instance or plan.
+	Version string `json:"version"`
+	// Description is a human readable description of the changes made by the maintenance.
+	Description string `json:"description,omitempty"`
+}
+
 // Plan corresponds to the Plan Object in the Open Service Broker API.
 type Plan struct {
 	ID          string `json:"id"`
@@ -58,6 +66,14 @@ type Plan struct {
 	Bindable *bool                  `json:"bindable"`
 	Schemas  *Schemas               `json:"schemas"`
 	Metadata map[string]interface{} `json:"metadata"`
+	// PlanUpdateable specifies whether instances of the plan can be updated to a different plan. If
+	// not specified, then consumers should use the PlanUpdateable property from the Service.
+	PlanUpdateable *bool `json:"plan_updateable,omitempty"`
+	// MaintenanceInfo is the maintenance info that instances of the plan should be updated to.
+	MaintenanceInfo *MaintenanceInfo `json:"maintenance_info,omitempty"`
+	// MaximumPollingDuration is the number of seconds after which the platform should stop polling
+	// the last operation of an asynchronous request for the plan. Nil means there is no limit.
+	MaximumPollingDuration *int `json:"maximum_polling_duration,omitempty"`
 }
 
 // Schemas contains the schemas for the service instance and service bindings of a plan.
@@ -81,6 +97,13 @@ type Service struct {
 	DashboardClient *DashboardClient       `json:"dashboard_client"`
 	// PlanUpdateable is true iff the service supports up/downgrade of some plans.
 	PlanUpdateable bool `json:"plan_updateable"`
+	// InstancesRetrievable is true iff the service supports fetching service instances.
+	InstancesRetrievable bool `json:"instances_retrievable,omitempty"`
+	// BindingsRetrievable is true iff the service supports fetching service bindings.
+	BindingsRetrievable bool `json:"bindings_retrievable,omitempty"`
+	// AllowContextUpdates is true iff the service accepts updates which only change the context of
+	// a service instance.
+	AllowContextUpdates bool `json:"allow_context_updates,omitempty"`
 	// Plans is a list of plans for this service.
 	Plans []Plan `json:"plans"`
 }
@@ -127,6 +150,20 @@ type ProvisionResponseBody struct {
 	Operation string `json:"operation,omitempty"`
 }
 
+// FetchInstanceResponseBody is the response body for a successful fetch instance request.
+type FetchInstanceResponseBody struct {
+	// ServiceID is the ID of the service used by the service instance.
+	ServiceID string `json:"service_id,omitempty"`
+	// PlanID is the ID of the plan used by the service instance.
+	PlanID string `json:"plan_id,omitempty"`
+	// DashboardURL is the URL of a web-based management user interface for the service instance.
+	DashboardURL string `json:"dashboard_url,omitempty"`
+	// Parameters is the set of configuration options of the service instance.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	// MaintenanceInfo is the maintenance info currently applied to the service instance.
+	MaintenanceInfo *MaintenanceInfo `json:"maintenance_info,omitempty"`
+}
+
 // DeprovisionResponseBody is the response body for a successful deprovision request.
 type DeprovisionResponseBody struct {
 	// Operation is an extra identifier supplied by the broker to identify asynchronous operations.
@@ -205,6 +242,22 @@ type BindResponseBody struct {
 	Operation string `json:"operation,omitempty"`
 }
 
+// FetchBindingResponseBody is the response body for a successful fetch binding request.
+type FetchBindingResponseBody struct {
+	// Credentials is a free-form hash of credentials that can be used by applications or users to
+	// access the service.
+	Credentials map[string]interface{} `json:"credentials,omitempty"`
+	// SyslogDrainURl is a URL to which logs must be streamed. CF-specific.
+	SyslogDrainURL *string `json:"syslog_drain_url,omitempty"`
+	// RouteServiceURL is a URL to which the platform must proxy requests to the application the
+	// binding is for. CF-specific.
+	RouteServiceURL *string `json:"route_service_url,omitempty"`
+	// VolumeMounts is an array of configuration string for mounting volumes. CF-specific.
+	VolumeMounts []interface{} `json:"volume_mounts,omitempty"`
+	// Parameters is the set of configuration options of the service binding.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
 // UnbindResponseBody is the response body for a successful unbind request.
 type UnbindResponseBody struct {
 	// Operation is an extra identifier supplied by the broker to identify asynchronous operations.
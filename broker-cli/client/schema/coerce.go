@@ -0,0 +1,137 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Coerce converts the string value of the field at path, e.g. ["nodes", "size"], to the type which
+// the schema declares for the field. Fields with several types get the first of their non-string
+// types which value parses as, or else a string. If the schema doesn't declare a type, value is
+// parsed as JSON if it is valid JSON, and used as a string otherwise. schema may be nil.
+func Coerce(schema map[string]interface{}, path []string, value string) (interface{}, error) {
+	v := &validator{root: schema}
+	var current interface{} = schema
+	for _, name := range path {
+		current = v.property(current, name)
+	}
+
+	var types []interface{}
+	if s, ok := v.deref(current).(map[string]interface{}); ok {
+		switch t := s["type"].(type) {
+		case string:
+			types = []interface{}{t}
+		case []interface{}:
+			types = t
+		}
+	}
+	if len(types) == 0 {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err == nil {
+			return parsed, nil
+		}
+		return value, nil
+	}
+
+	allowString := false
+	for _, t := range types {
+		if t == "string" {
+			allowString = true
+			continue
+		}
+		if parsed, ok := parseAs(fmt.Sprint(t), value); ok {
+			return parsed, nil
+		}
+	}
+	if allowString {
+		return value, nil
+	}
+	return nil, fmt.Errorf("invalid value %q, want %s", value, formatType(types))
+}
+
+// property returns the schema of the named property of objects valid against the schema, or nil
+// if it is unknown.
+func (v *validator) property(schemaValue interface{}, name string) interface{} {
+	schema, ok := v.deref(schemaValue).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		if property, ok := properties[name]; ok {
+			return property
+		}
+	}
+	if patterns, ok := schema["patternProperties"].(map[string]interface{}); ok {
+		for pattern, property := range patterns {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(name) {
+				return property
+			}
+		}
+	}
+	if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+		return additional
+	}
+	return nil
+}
+
+// deref follows the references of a schema, and returns nil if they can't be resolved.
+func (v *validator) deref(schemaValue interface{}) interface{} {
+	// Guard against reference cycles.
+	for i := 0; i < 32; i++ {
+		schema, ok := schemaValue.(map[string]interface{})
+		if !ok {
+			return schemaValue
+		}
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			return nil
+		}
+		schemaValue = resolved
+	}
+	return nil
+}
+
+// parseAs parses value as a JSON schema type, and returns whether it is valid for the type.
+func parseAs(t, value string) (interface{}, bool) {
+	switch t {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		return float64(n), err == nil
+	case "number":
+		n, err := strconv.ParseFloat(value, 64)
+		return n, err == nil
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		return b, err == nil
+	case "null":
+		return nil, value == "null"
+	case "object", "array":
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, false
+		}
+		return parsed, typeName(parsed) == t
+	default:
+		return nil, false
+	}
+}
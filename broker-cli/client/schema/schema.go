@@ -0,0 +1,414 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema validates values against the JSON schemas which brokers publish for the
+// parameters of their plans. It supports the validation keywords of JSON Schema draft-04, which
+// the OSB API requires, as well as const and the numeric exclusiveMinimum and exclusiveMaximum of
+// later drafts. References are only resolved within the schema itself, and formats are not
+// checked.
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError is a violation of the schema by a single field.
+type ValidationError struct {
+	// Path is the path of the field, starting with the root name given to Validate, e.g.
+	// "parameters.nodes[0].size".
+	Path string
+	// Message describes the violation.
+	Message string
+}
+
+// Error is the method inherited from the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// identifier matches property names which are printed after a dot in paths.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Validate returns the violations of the schema by value, which must be the generic value
+// unmarshalled from JSON. root is the name of the value at the start of error paths.
+func Validate(schema map[string]interface{}, value interface{}, root string) []*ValidationError {
+	v := &validator{root: schema, resolving: make(map[refKey]bool)}
+	v.validate(schema, value, root)
+	return v.errs
+}
+
+// validator collects the violations of a schema.
+type validator struct {
+	// root is the schema which references are resolved against.
+	root map[string]interface{}
+	// resolving holds the references being resolved for the values at their paths, so that cycles
+	// of references which never reach a nested value are reported instead of recursing forever.
+	resolving map[refKey]bool
+	errs      []*ValidationError
+}
+
+// refKey is a reference resolved for the value at path.
+type refKey struct {
+	ref  string
+	path string
+}
+
+func (v *validator) errorf(path, format string, a ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// valid returns whether the value at path is valid against the schema, without recording
+// violations.
+func (v *validator) valid(schema interface{}, value interface{}, path string) bool {
+	sub := &validator{root: v.root, resolving: v.resolving}
+	sub.validate(schema, value, path)
+	return len(sub.errs) == 0
+}
+
+func (v *validator) validate(schemaValue interface{}, value interface{}, path string) {
+	switch s := schemaValue.(type) {
+	case bool:
+		if !s {
+			v.errorf(path, "no value is allowed")
+		}
+		return
+	case map[string]interface{}:
+		v.validateSchema(s, value, path)
+	}
+}
+
+func (v *validator) validateSchema(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		key := refKey{ref: ref, path: path}
+		if v.resolving[key] {
+			v.errorf(path, "the schema reference %q refers back to itself", ref)
+			return
+		}
+		v.resolving[key] = true
+		defer delete(v.resolving, key)
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			v.errorf(path, "%v", err)
+			return
+		}
+		// Keywords next to $ref are ignored as of draft-04.
+		v.validate(resolved, value, path)
+		return
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		v.errorf(path, "got %s, want %s", typeName(value), formatType(t))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.errorf(path, "got %s, want one of %s", formatValue(value), formatValues(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		v.errorf(path, "got %s, want %s", formatValue(value), formatValue(c))
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, val, path)
+	case []interface{}:
+		v.validateArray(schema, val, path)
+	case string:
+		v.validateString(schema, val, path)
+	case float64:
+		v.validateNumber(schema, val, path)
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			v.validate(sub, value, path)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if v.valid(sub, value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.errorf(path, "doesn't match any of the allowed schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, sub := range oneOf {
+			if v.valid(sub, value, path) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.errorf(path, "matches %d of the schemas, want exactly one", matched)
+		}
+	}
+	if not, ok := schema["not"]; ok && v.valid(not, value, path) {
+		v.errorf(path, "matches a disallowed schema")
+	}
+}
+
+func (v *validator) validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, ok := obj[name]; !ok {
+					v.errorf(propertyPath(path, name), "required field is missing")
+				}
+			}
+		}
+	}
+	if min, ok := number(schema["minProperties"]); ok && float64(len(obj)) < min {
+		v.errorf(path, "has %d fields, want at least %v", len(obj), min)
+	}
+	if max, ok := number(schema["maxProperties"]); ok && float64(len(obj)) > max {
+		v.errorf(path, "has %d fields, want at most %v", len(obj), max)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fieldPath := propertyPath(path, key)
+		matched := false
+		if sub, ok := properties[key]; ok {
+			matched = true
+			v.validate(sub, obj[key], fieldPath)
+		}
+		for pattern, sub := range patternProperties {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+				matched = true
+				v.validate(sub, obj[key], fieldPath)
+			}
+		}
+		if matched || !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			v.errorf(fieldPath, "unknown field")
+			continue
+		}
+		v.validate(additional, obj[key], fieldPath)
+	}
+}
+
+func (v *validator) validateArray(schema map[string]interface{}, arr []interface{}, path string) {
+	if min, ok := number(schema["minItems"]); ok && float64(len(arr)) < min {
+		v.errorf(path, "has %d items, want at least %v", len(arr), min)
+	}
+	if max, ok := number(schema["maxItems"]); ok && float64(len(arr)) > max {
+		v.errorf(path, "has %d items, want at most %v", len(arr), max)
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := range arr {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(arr[i], arr[j]) {
+					v.errorf(fmt.Sprintf("%s[%d]", path, i), "duplicates item %d", j)
+				}
+			}
+		}
+	}
+
+	switch items := schema["items"].(type) {
+	case []interface{}:
+		// Tuple validation: every item has its own schema.
+		for i := range arr {
+			if i < len(items) {
+				v.validate(items[i], arr[i], fmt.Sprintf("%s[%d]", path, i))
+			} else if additional, ok := schema["additionalItems"]; ok {
+				v.validate(additional, arr[i], fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case nil:
+	default:
+		for i := range arr {
+			v.validate(items, arr[i], fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func (v *validator) validateString(schema map[string]interface{}, s string, path string) {
+	length := float64(utf8.RuneCountInString(s))
+	if min, ok := number(schema["minLength"]); ok && length < min {
+		v.errorf(path, "has %v characters, want at least %v", length, min)
+	}
+	if max, ok := number(schema["maxLength"]); ok && length > max {
+		v.errorf(path, "has %v characters, want at most %v", length, max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		// Patterns which Go can't compile, e.g. with lookaheads, aren't checked.
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(s) {
+			v.errorf(path, "%q doesn't match the pattern %q", s, pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(schema map[string]interface{}, n float64, path string) {
+	if min, ok := number(schema["minimum"]); ok {
+		// As of draft-04, exclusiveMinimum is a flag which modifies minimum.
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && n <= min {
+			v.errorf(path, "got %v, want more than %v", n, min)
+		} else if n < min {
+			v.errorf(path, "got %v, want at least %v", n, min)
+		}
+	}
+	if max, ok := number(schema["maximum"]); ok {
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && n >= max {
+			v.errorf(path, "got %v, want less than %v", n, max)
+		} else if n > max {
+			v.errorf(path, "got %v, want at most %v", n, max)
+		}
+	}
+	// As of draft-06, exclusiveMinimum and exclusiveMaximum are numbers.
+	if min, ok := number(schema["exclusiveMinimum"]); ok && n <= min {
+		v.errorf(path, "got %v, want more than %v", n, min)
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && n >= max {
+		v.errorf(path, "got %v, want less than %v", n, max)
+	}
+	if multiple, ok := number(schema["multipleOf"]); ok && multiple > 0 {
+		if q := n / multiple; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.errorf(path, "got %v, want a multiple of %v", n, multiple)
+		}
+	}
+}
+
+// resolve returns the schema referenced by a JSON pointer within the root schema, e.g.
+// "#/definitions/size".
+func (v *validator) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("can't resolve the external schema reference %q", ref)
+	}
+	var current interface{} = v.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("can't resolve the schema reference %q", ref)
+		}
+		if current, ok = obj[token]; !ok {
+			return nil, fmt.Errorf("can't resolve the schema reference %q", ref)
+		}
+	}
+	return current, nil
+}
+
+// matchesType returns whether value has the type, or one of the types, of the type keyword t.
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		name := typeName(value)
+		return name == t || (t == "number" && name == "integer")
+	case []interface{}:
+		for _, each := range t {
+			if matchesType(each, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// typeName returns the JSON schema type of a generic JSON value.
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// formatType formats the type keyword for error messages.
+func formatType(t interface{}) string {
+	if types, ok := t.([]interface{}); ok {
+		names := make([]string, len(types))
+		for i, each := range types {
+			names[i] = fmt.Sprint(each)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func formatValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(value)
+}
+
+func formatValues(values []interface{}) string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = formatValue(value)
+	}
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
+
+// number returns the value of a numeric keyword, and whether it is set.
+func number(value interface{}) (float64, bool) {
+	n, ok := value.(float64)
+	return n, ok
+}
+
+// propertyPath returns the path of a field of the object at path.
+func propertyPath(path, name string) string {
+	if identifier.MatchString(name) {
+		return path + "." + name
+	}
+	return fmt.Sprintf("%s[%q]", path, name)
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+	"$schema": "http://json-schema.org/draft-04/schema#",
+	"type": "object",
+	"required": ["name", "size"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 3, "pattern": "^[a-z]+$"},
+		"size": {"$ref": "#/definitions/size"},
+		"replicas": {"type": "integer", "minimum": 1, "maximum": 5, "exclusiveMaximum": true},
+		"ratio": {"type": "number", "exclusiveMinimum": 0, "multipleOf": 0.5},
+		"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+		"zones": {"type": "array", "items": {"type": "string"}, "minItems": 1, "uniqueItems": true},
+		"backup": {"oneOf": [{"type": "boolean"}, {"type": "object", "required": ["schedule"]}]}
+	},
+	"definitions": {
+		"size": {"enum": ["small", "large"]}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(testSchema), &schema); err != nil {
+		t.Fatalf("Error unmarshalling schema: %v", err)
+	}
+
+	testCases := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "valid",
+			value: `{"name": "mydb", "size": "small", "replicas": 4, "ratio": 1.5, "labels": {"a": "b"}, "zones": ["a", "b"], "backup": true}`,
+		},
+		{
+			name:  "missing required fields",
+			value: `{}`,
+			want: []string{
+				`parameters.name: required field is missing`,
+				`parameters.size: required field is missing`,
+			},
+		},
+		{
+			name:  "wrong types",
+			value: `{"name": 1, "size": "small", "replicas": 1.5, "labels": {"a": 1}, "zones": "a"}`,
+			want: []string{
+				`parameters.labels.a: got integer, want string`,
+				`parameters.name: got integer, want string`,
+				`parameters.replicas: got number, want integer`,
+				`parameters.zones: got string, want array`,
+			},
+		},
+		{
+			name:  "constraints",
+			value: `{"name": "Abc", "size": "medium", "replicas": 5, "ratio": 0.3, "zones": ["a", "a"], "backup": {}, "my key": 1}`,
+			want: []string{
+				`parameters.backup: matches 0 of the schemas, want exactly one`,
+				`parameters["my key"]: unknown field`,
+				`parameters.name: "Abc" doesn't match the pattern "^[a-z]+$"`,
+				`parameters.ratio: got 0.3, want a multiple of 0.5`,
+				`parameters.replicas: got 5, want less than 5`,
+				`parameters.size: got "medium", want one of ["small", "large"]`,
+				`parameters.zones[1]: duplicates item 0`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tc.value), &value); err != nil {
+				t.Fatalf("Error unmarshalling value: %v", err)
+			}
+			var got []string
+			for _, err := range Validate(schema, value, "parameters") {
+				got = append(got, err.Error())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Validate got errors:\n%q\nwant:\n%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateReferenceCycles(t *testing.T) {
+	testCases := []struct {
+		name   string
+		schema string
+		value  string
+		want   []string
+	}{
+		{
+			name:   "reference to itself",
+			schema: `{"$ref": "#/definitions/a", "definitions": {"a": {"$ref": "#/definitions/a"}}}`,
+			value:  `{}`,
+			want:   []string{`parameters: the schema reference "#/definitions/a" refers back to itself`},
+		},
+		{
+			name:   "cycle of references",
+			schema: `{"$ref": "#/definitions/a", "definitions": {"a": {"$ref": "#/definitions/b"}, "b": {"$ref": "#/definitions/a"}}}`,
+			value:  `1`,
+			want:   []string{`parameters: the schema reference "#/definitions/a" refers back to itself`},
+		},
+		{
+			name:   "cycle through a combination",
+			schema: `{"anyOf": [{"$ref": "#"}]}`,
+			value:  `1`,
+			want:   []string{`parameters: doesn't match any of the allowed schemas`},
+		},
+		{
+			name:   "recursive schema",
+			schema: `{"type": "object", "properties": {"name": {"type": "string"}, "children": {"type": "array", "items": {"$ref": "#"}}}}`,
+			value:  `{"name": "a", "children": [{"name": "b", "children": [{"name": 1}]}]}`,
+			want:   []string{`parameters.children[0].children[0].name: got integer, want string`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var schema map[string]interface{}
+			if err := json.Unmarshal([]byte(tc.schema), &schema); err != nil {
+				t.Fatalf("Error unmarshalling schema: %v", err)
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(tc.value), &value); err != nil {
+				t.Fatalf("Error unmarshalling value: %v", err)
+			}
+			var got []string
+			for _, err := range Validate(schema, value, "parameters") {
+				got = append(got, err.Error())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Validate got errors:\n%q\nwant:\n%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(testSchema), &schema); err != nil {
+		t.Fatalf("Error unmarshalling schema: %v", err)
+	}
+
+	testCases := []struct {
+		path    []string
+		value   string
+		want    interface{}
+		wantErr bool
+	}{
+		{path: []string{"name"}, value: "123", want: "123"},
+		{path: []string{"replicas"}, value: "3", want: 3.0},
+		{path: []string{"replicas"}, value: "3.5", wantErr: true},
+		{path: []string{"ratio"}, value: "1.5", want: 1.5},
+		{path: []string{"labels", "team"}, value: "true", want: "true"},
+		{path: []string{"zones"}, value: `["a"]`, want: []interface{}{"a"}},
+		{path: []string{"zones"}, value: `a`, wantErr: true},
+		{path: []string{"size"}, value: "small", want: "small"},
+		{path: []string{"backup"}, value: "true", want: true},
+		{path: []string{"unknown", "field"}, value: "false", want: false},
+		{path: []string{"unknown"}, value: "not json", want: "not json"},
+	}
+
+	for _, tc := range testCases {
+		got, err := Coerce(schema, tc.path, tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Coerce(%v, %q) got error %v, want error %v", tc.path, tc.value, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Coerce(%v, %q) got %#v, want %#v", tc.path, tc.value, got, tc.want)
+		}
+	}
+	if got, err := Coerce(nil, []string{"a"}, "1"); err != nil || got != 1.0 {
+		t.Errorf("Coerce without a schema got %#v, %v, want 1", got, err)
+	}
+}
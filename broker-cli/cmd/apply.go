@@ -0,0 +1,560 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/inventory"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/manifest"
+	"github.com/spf13/cobra"
+)
+
+// Actions of apply.
+const (
+	applyCreate = "create"
+	applyUpdate = "update"
+	applyDelete = "delete"
+)
+
+// applyAction is a change made by apply to reconcile the broker with the manifest.
+type applyAction struct {
+	Action     string `json:"action"`
+	InstanceID string `json:"instance_id"`
+	// BindingID is empty if the action is on the instance.
+	BindingID string `json:"binding_id,omitempty"`
+	ServiceID string `json:"service_id"`
+	PlanID    string `json:"plan_id"`
+	// PreviousPlanID is set by updates which change the plan.
+	PreviousPlanID string                 `json:"previous_plan_id,omitempty"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	Context        map[string]interface{} `json:"context,omitempty"`
+	// Reason lists what an update changes, e.g. "plan, parameters".
+	Reason string `json:"reason,omitempty"`
+}
+
+// applyPlan are the actions of apply, in the order they are made: deletions of bindings before
+// their instances, and creations of instances before their bindings.
+type applyPlan struct {
+	BrokerURL string         `json:"broker_url"`
+	Actions   []*applyAction `json:"actions"`
+}
+
+var (
+	applyFlags struct {
+		flags.BrokerURLConstructor
+		apiVersion       string
+		filename         string
+		prune            bool
+		dryRun           bool
+		force            bool
+		validate         string
+		orphanMitigation bool
+	}
+
+	// applyCmd represents the apply command.
+	applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Reconcile the instances and bindings of a broker with a manifest",
+		Long: "Create the service instances and bindings declared by a YAML or JSON manifest which the broker doesn't have, and update " +
+			"the instances whose plan or parameters differ. With --prune, the instances and bindings which aren't declared are deleted. " +
+			"The changes are printed and confirmed before they are made, and asynchronous operations are waited on.\n\n" +
+			"Example manifest:\n\n" +
+			"instances:\n" +
+			"  - instance_id: db\n" +
+			"    service_name: cloud-sql\n" +
+			"    plan_name: beta\n" +
+			"    parameters:\n" +
+			"      tier: small\n" +
+			"    bindings:\n" +
+			"      - binding_id: db-app\n",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.CheckFlags(&applyFlags.filename)
+			if applyFlags.filename == "-" && !applyFlags.force && !applyFlags.dryRun {
+				// The manifest consumes stdin, so the changes couldn't be confirmed.
+				log.Fatalf("Reading the manifest from stdin requires --force or --dry-run, since the changes can't be confirmed")
+			}
+
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			checkAdminFlags("Applying manifests", &applyFlags.BrokerURLConstructor)
+			client := httpAdapterFromFlag()
+			brokerURL, err := applyFlags.AdminBrokerURL()
+			if err != nil {
+				log.Fatalf("Error applying %s: %v", applyFlags.filename, err)
+			}
+			m, err := readManifest(applyFlags.filename)
+			if err != nil {
+				log.Fatalf("Error applying %s: %v", applyFlags.filename, err)
+			}
+			plan, err := planApply(ctx, client, brokerURL, m)
+			if err != nil {
+				log.Fatalf("Error applying %s to broker %s: %v", applyFlags.filename, brokerURL, err)
+			}
+
+			if applyFlags.dryRun || len(plan.Actions) == 0 {
+				printApplyPlan(plan)
+				return
+			}
+			if !applyFlags.force {
+				// The prompt isn't part of the result, so that it doesn't end up in JSON output.
+				infof("The following changes will be made to broker %q\n", brokerURL)
+				for _, a := range plan.Actions {
+					infof("%s\n", applyActionLine(a))
+				}
+				infof("Enter y/Y to continue or anything else to quit\n")
+				response := ""
+				fmt.Scanf("%s\n", &response)
+				if !(response == "y" || response == "Y") {
+					infof("Stopped applying the manifest as per user request\n")
+					return
+				}
+			}
+
+			for n, a := range plan.Actions {
+				if err := runApplyAction(ctx, client, brokerURL, a); err != nil {
+					log.Fatalf("Failed to %s: %v\nMade %d of the %d changes, apply the manifest again to make the others.", describeApplyAction(a), err, n, len(plan.Actions))
+				}
+				infof("Done: %s\n", describeApplyAction(a))
+			}
+			printResult(plan, applyTable(plan), func() {
+				fmt.Printf("Successfully applied %s to broker %q with %d changes!!\n", applyFlags.filename, brokerURL, len(plan.Actions))
+			})
+		},
+	}
+)
+
+func init() {
+	flags.StringFlag(applyCmd.PersistentFlags(), &applyFlags.Server, flags.ServerLongName, flags.ServerShortName,
+		fmt.Sprintf("[Required if %s and %s are not given] Broker URL to make request to (https://...). Its instances must be listable, as they are for GCP brokers, see --%s.", flags.ProjectLongName, flags.BrokerLongName, flags.AdminAPILongName))
+	flags.StringFlagWithDefault(applyCmd.PersistentFlags(), &applyFlags.apiVersion,
+		flags.ApiVersionLongName, flags.ApiVersionShortName, flags.ApiVersionDefault, flags.ApiVersionDescription)
+	flags.StringFlag(applyCmd.PersistentFlags(), &applyFlags.Project, flags.ProjectLongName, flags.ProjectShortName,
+		fmt.Sprintf("[Required if %s is not given] the GCP project of the broker", flags.ServerLongName))
+	flags.StringFlag(applyCmd.PersistentFlags(), &applyFlags.Broker, flags.BrokerLongName, flags.BrokerShortName,
+		fmt.Sprintf("[Required if %s is not given] the broker name", flags.ServerLongName))
+	flags.BoolFlag(applyCmd.PersistentFlags(), &applyFlags.AdminAPI, flags.AdminAPILongName, "", flags.AdminAPIDescription)
+	applyCmd.PersistentFlags().StringVar(&applyFlags.Host, flags.HostLongName, flags.HostBrokerDefault, "")
+	applyCmd.PersistentFlags().MarkHidden(flags.HostLongName)
+
+	flags.StringFlag(applyCmd.PersistentFlags(), &applyFlags.filename, "filename", "f",
+		"[Required] The YAML or JSON manifest declaring the instances and bindings of the broker, or - to read it from stdin, which requires --force or --dry-run.")
+	flags.BoolFlag(applyCmd.PersistentFlags(), &applyFlags.prune, "prune", "",
+		"[Optional] If specified, the instances and bindings of the broker which the manifest doesn't declare are deleted. (Default: FALSE)")
+	flags.BoolFlag(applyCmd.PersistentFlags(), &applyFlags.dryRun, "dry-run", "",
+		"[Optional] If specified, the changes are printed in the order they would be made instead of being made. (Default: FALSE)")
+	flags.BoolFlag(applyCmd.PersistentFlags(), &applyFlags.force, "force", "",
+		"[Optional] If specified, the changes are made without user approval. (Default: FALSE)")
+	flags.StringFlagWithDefault(applyCmd.PersistentFlags(), &applyFlags.validate, "validate", "", validateStrict,
+		"[Optional] How the parameters are validated against the JSON schema of the plan in the broker catalog before making changes: "+
+			"strict fails on violations, warn prints them and off skips validation.")
+	flags.BoolFlag(applyCmd.PersistentFlags(), &applyFlags.orphanMitigation, "orphan-mitigation", "",
+		orphanMitigationUsage("instance or binding"))
+
+	RootCmd.AddCommand(applyCmd)
+}
+
+// readManifest reads the manifest from a file, or from stdin if path is "-".
+func readManifest(path string) (*manifest.Manifest, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %v", err)
+	}
+	m, err := manifest.Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// planApply compares the manifest with the instances and bindings listed in the broker, and returns
+// the actions reconciling them. The parameters of existing instances are compared with the ones
+// fetched from the broker if the service supports it, or else with the ones in the inventory. Instances
+// whose parameters are unknown are updated if the manifest gives parameters.
+func planApply(ctx context.Context, client adapter.Adapter, brokerURL string, m *manifest.Manifest) (*applyPlan, error) {
+	for _, i := range m.Instances {
+		resolveNames(ctx, client, applyFlags.apiVersion, brokerURL, &i.ServiceID, &i.PlanID, i.ServiceName, i.PlanName)
+		i.ServiceName, i.PlanName = "", ""
+	}
+	lir, err := listInstances(ctx, client, brokerURL, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the instances of the broker: %v", err)
+	}
+	existing := make(map[string]*instance)
+	for _, i := range lir.Instances {
+		existing[i.ID] = i
+	}
+	declared := make(map[string]*manifest.Instance)
+	for _, i := range m.Instances {
+		declared[i.ID] = i
+	}
+
+	plan := &applyPlan{BrokerURL: brokerURL, Actions: []*applyAction{}}
+	if applyFlags.prune {
+		for _, i := range lir.Instances {
+			d := declared[i.ID]
+			for _, b := range i.Bindings {
+				if d == nil || !declaresBinding(d, b) {
+					plan.Actions = append(plan.Actions, &applyAction{Action: applyDelete, InstanceID: i.ID, BindingID: b, ServiceID: i.ServiceID, PlanID: i.PlanID})
+				}
+			}
+			if d == nil {
+				plan.Actions = append(plan.Actions, &applyAction{Action: applyDelete, InstanceID: i.ID, ServiceID: i.ServiceID, PlanID: i.PlanID})
+			}
+		}
+	}
+
+	for _, d := range m.Instances {
+		e := existing[d.ID]
+		switch {
+		case e == nil:
+			validateParameters(ctx, client, applyFlags.apiVersion, brokerURL, d.ServiceID, d.PlanID, adapter.SchemaInstanceCreate, applyFlags.validate, d.Parameters)
+			plan.Actions = append(plan.Actions, &applyAction{Action: applyCreate, InstanceID: d.ID, ServiceID: d.ServiceID, PlanID: d.PlanID,
+				Parameters: d.Parameters, Context: d.Context})
+		case e.ServiceID != d.ServiceID:
+			return nil, fmt.Errorf("instance %q has service %q, which can't be changed to %q", d.ID, e.ServiceID, d.ServiceID)
+		default:
+			if a := planInstanceUpdate(ctx, client, brokerURL, e, d); a != nil {
+				validateParameters(ctx, client, applyFlags.apiVersion, brokerURL, d.ServiceID, d.PlanID, adapter.SchemaInstanceUpdate, applyFlags.validate, a.Parameters)
+				plan.Actions = append(plan.Actions, a)
+			}
+		}
+
+		for _, b := range d.Bindings {
+			if e != nil && containsAny(e.Bindings, b.ID) {
+				// Bindings can't be updated, so existing ones are kept as they are.
+				continue
+			}
+			validateParameters(ctx, client, applyFlags.apiVersion, brokerURL, d.ServiceID, d.PlanID, adapter.SchemaBindingCreate, applyFlags.validate, b.Parameters)
+			plan.Actions = append(plan.Actions, &applyAction{Action: applyCreate, InstanceID: d.ID, BindingID: b.ID, ServiceID: d.ServiceID, PlanID: d.PlanID,
+				Parameters: b.Parameters, Context: b.Context})
+		}
+	}
+	return plan, nil
+}
+
+// planInstanceUpdate returns the update of the existing instance e to the declared instance d, or nil
+// if they don't differ.
+func planInstanceUpdate(ctx context.Context, client adapter.Adapter, brokerURL string, e *instance, d *manifest.Instance) *applyAction {
+	a := &applyAction{Action: applyUpdate, InstanceID: d.ID, ServiceID: d.ServiceID, PlanID: d.PlanID, Context: d.Context}
+	var reasons []string
+	if e.PlanID != d.PlanID {
+		a.PreviousPlanID = e.PlanID
+		reasons = append(reasons, "plan")
+	}
+	current, known := currentParameters(ctx, client, brokerURL, e)
+	switch {
+	case !known && len(d.Parameters) > 0:
+		a.Parameters = d.Parameters
+		reasons = append(reasons, "parameters, whose current values are unknown")
+	case known && !sameParameters(current, d.Parameters):
+		a.Parameters = d.Parameters
+		reasons = append(reasons, "parameters")
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	a.Reason = strings.Join(reasons, ", ")
+	return a
+}
+
+// currentParameters returns the parameters of the instance, fetched from the broker if its service
+// supports it or else recorded in the inventory, and whether they are known.
+func currentParameters(ctx context.Context, client adapter.Adapter, brokerURL string, i *instance) (map[string]interface{}, bool) {
+	if checkRetrievable(ctx, client, applyFlags.apiVersion, brokerURL, i.ServiceID, false) == nil {
+		gir, err := client.GetInstance(ctx, &adapter.GetInstanceParams{
+			Server:     brokerURL,
+			APIVersion: applyFlags.apiVersion,
+			InstanceID: i.ID,
+			ServiceID:  i.ServiceID,
+			PlanID:     i.PlanID,
+		})
+		if err == nil {
+			return gir.Parameters, true
+		}
+		infof("Warning: error fetching instance %q, comparing its parameters with the inventory: %v\n", i.ID, err)
+	}
+	if r := loadInventory().FindInstance(brokerURL, i.ID); r != nil {
+		return r.Parameters, true
+	}
+	return nil, false
+}
+
+// sameParameters returns whether the parameters are equal, with no parameters being equal to an
+// empty object.
+func sameParameters(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// declaresBinding returns whether the instance of the manifest declares the binding.
+func declaresBinding(i *manifest.Instance, bindingID string) bool {
+	for _, b := range i.Bindings {
+		if b.ID == bindingID {
+			return true
+		}
+	}
+	return false
+}
+
+// runApplyAction makes the action, and waits until its operation finishes if it is asynchronous.
+func runApplyAction(ctx context.Context, client adapter.Adapter, brokerURL string, a *applyAction) error {
+	i := &instance{ID: a.InstanceID, ServiceID: a.ServiceID, PlanID: a.PlanID}
+	switch {
+	case a.Action == applyDelete && a.BindingID != "":
+		return deleteBinding(ctx, client, applyFlags.apiVersion, brokerURL, i, a.BindingID, false)
+	case a.Action == applyDelete:
+		return deleteInstance(ctx, client, applyFlags.apiVersion, brokerURL, i, false)
+	case a.Action == applyCreate && a.BindingID != "":
+		return applyCreateBinding(ctx, client, brokerURL, a)
+	case a.Action == applyCreate:
+		return applyCreateInstance(ctx, client, brokerURL, a)
+	case a.Action == applyUpdate:
+		return applyUpdateInstance(ctx, client, brokerURL, a)
+	}
+	return fmt.Errorf("unknown action %q", a.Action)
+}
+
+// applyCreateInstance creates the instance of the action.
+func applyCreateInstance(ctx context.Context, client adapter.Adapter, brokerURL string, a *applyAction) error {
+	var res *adapter.CreateInstanceResult
+	err := withAsyncFallback(true, func(acceptsIncomplete bool) error {
+		var err error
+		res, err = client.CreateInstance(ctx, &adapter.CreateInstanceParams{
+			Server:              brokerURL,
+			APIVersion:          applyFlags.apiVersion,
+			AcceptsIncomplete:   acceptsIncomplete,
+			OriginatingIdentity: originatingIdentityFromFlag(ctx),
+			RequestIdentity:     newRequestIdentity(),
+			InstanceID:          a.InstanceID,
+			ServiceID:           a.ServiceID,
+			PlanID:              a.PlanID,
+			Context:             a.Context,
+			Parameters:          a.Parameters,
+		})
+		return err
+	})
+	if err != nil {
+		orphanReport := mitigateOrphan(applyFlags.orphanMitigation, client, applyFlags.apiVersion, brokerURL,
+			&instance{ID: a.InstanceID, ServiceID: a.ServiceID, PlanID: a.PlanID}, "", err)
+		return fmt.Errorf("%v%s%s", err, brokerErrorHint(err), orphanReport)
+	}
+	updateInventory(func(inv *inventory.Inventory) {
+		inv.PutInstance(&inventory.Instance{
+			BrokerURL:     brokerURL,
+			InstanceID:    a.InstanceID,
+			ServiceID:     a.ServiceID,
+			PlanID:        a.PlanID,
+			Parameters:    a.Parameters,
+			Context:       a.Context,
+			LastOperation: inventoryOperation(res.Async, res.OperationID, inventory.OperationCreate),
+			Source:        inventory.SourceCreated,
+		})
+	})
+	if !res.Async {
+		return nil
+	}
+	return waitOnApplyAction(ctx, client, brokerURL, a, res.OperationID, adapter.OperationCreate)
+}
+
+// applyUpdateInstance updates the plan or parameters of the instance of the action.
+func applyUpdateInstance(ctx context.Context, client adapter.Adapter, brokerURL string, a *applyAction) error {
+	planID := ""
+	if a.PreviousPlanID != "" {
+		planID = a.PlanID
+	}
+	var res *adapter.UpdateInstanceResult
+	err := withAsyncFallback(true, func(acceptsIncomplete bool) error {
+		var err error
+		res, err = client.UpdateInstance(ctx, &adapter.UpdateInstanceParams{
+			Server:              brokerURL,
+			APIVersion:          applyFlags.apiVersion,
+			AcceptsIncomplete:   acceptsIncomplete,
+			OriginatingIdentity: originatingIdentityFromFlag(ctx),
+			RequestIdentity:     newRequestIdentity(),
+			InstanceID:          a.InstanceID,
+			ServiceID:           a.ServiceID,
+			PlanID:              planID,
+			Context:             a.Context,
+			Parameters:          a.Parameters,
+			PreviousPlanID:      a.PreviousPlanID,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%v%s", err, brokerErrorHint(err))
+	}
+	updateInventory(func(inv *inventory.Inventory) {
+		i := inv.FindInstance(brokerURL, a.InstanceID)
+		if i == nil {
+			return
+		}
+		i.PlanID = a.PlanID
+		if a.Parameters != nil {
+			i.Parameters = a.Parameters
+		}
+		if a.Context != nil {
+			i.Context = a.Context
+		}
+		i.LastOperation = inventoryOperation(res.Async, res.OperationID, inventory.OperationUpdate)
+		inv.PutInstance(i)
+	})
+	if !res.Async {
+		return nil
+	}
+	return waitOnApplyAction(ctx, client, brokerURL, a, res.OperationID, adapter.OperationUpdate)
+}
+
+// applyCreateBinding creates the binding of the action.
+func applyCreateBinding(ctx context.Context, client adapter.Adapter, brokerURL string, a *applyAction) error {
+	var res *adapter.CreateBindingResult
+	err := withAsyncFallback(true, func(acceptsIncomplete bool) error {
+		var err error
+		res, err = client.CreateBinding(ctx, &adapter.CreateBindingParams{
+			Server:              brokerURL,
+			APIVersion:          applyFlags.apiVersion,
+			AcceptsIncomplete:   acceptsIncomplete,
+			OriginatingIdentity: originatingIdentityFromFlag(ctx),
+			RequestIdentity:     newRequestIdentity(),
+			InstanceID:          a.InstanceID,
+			BindingID:           a.BindingID,
+			ServiceID:           a.ServiceID,
+			PlanID:              a.PlanID,
+			Context:             a.Context,
+			Parameters:          a.Parameters,
+		})
+		return err
+	})
+	if err != nil {
+		orphanReport := mitigateOrphan(applyFlags.orphanMitigation, client, applyFlags.apiVersion, brokerURL,
+			&instance{ID: a.InstanceID, ServiceID: a.ServiceID, PlanID: a.PlanID}, a.BindingID, err)
+		return fmt.Errorf("%v%s%s", err, brokerErrorHint(err), orphanReport)
+	}
+	updateInventory(func(inv *inventory.Inventory) {
+		inv.PutBinding(&inventory.Binding{
+			BrokerURL:     brokerURL,
+			InstanceID:    a.InstanceID,
+			BindingID:     a.BindingID,
+			ServiceID:     a.ServiceID,
+			PlanID:        a.PlanID,
+			Parameters:    a.Parameters,
+			LastOperation: inventoryOperation(res.Async, res.OperationID, inventory.OperationCreate),
+			Source:        inventory.SourceCreated,
+		})
+	})
+	if !res.Async {
+		return nil
+	}
+	return waitOnApplyAction(ctx, client, brokerURL, a, res.OperationID, adapter.OperationCreate)
+}
+
+// waitOnApplyAction waits until the asynchronous operation of the action finishes, and records it in
+// the inventory.
+func waitOnApplyAction(ctx context.Context, client adapter.Adapter, brokerURL string, a *applyAction, opID string, opType adapter.OperationType) error {
+	poll := pollInstanceOpFunc(client, applyFlags.apiVersion, brokerURL, a.InstanceID, a.ServiceID, a.PlanID, opID, opType)
+	if a.BindingID != "" {
+		poll = pollBindingOpFunc(client, applyFlags.apiVersion, brokerURL, a.InstanceID, a.BindingID, a.ServiceID, a.PlanID, opID, opType)
+	}
+	op, err := waitOnOperation(ctx, poll, maximumPollingDuration(ctx, client, applyFlags.apiVersion, brokerURL, a.ServiceID, a.PlanID),
+		liveProgress(fmt.Sprintf("the %s of %s", applyActionNouns[a.Action], describeApplyResource(a))))
+	if err != nil {
+		return fmt.Errorf("error polling last operation %q: %v", opID, err)
+	}
+	invOp := inventoryOperationType(opType)
+	if a.BindingID != "" {
+		recordBindingOperation(brokerURL, a.InstanceID, a.BindingID, opID, invOp, op)
+	} else {
+		recordInstanceOperation(brokerURL, a.InstanceID, opID, invOp, op)
+	}
+	if op.State != adapter.OperationSucceeded {
+		return fmt.Errorf("operation %q failed: %+v", opID, *op)
+	}
+	return nil
+}
+
+// applyActionNouns are the nouns of the actions for progress messages.
+var applyActionNouns = map[string]string{applyCreate: "creation", applyUpdate: "update", applyDelete: "deletion"}
+
+// describeApplyAction returns the action for messages, e.g. `create binding "b" of instance "i"`.
+func describeApplyAction(a *applyAction) string {
+	return a.Action + " " + describeApplyResource(a)
+}
+
+// describeApplyResource returns the resource of the action for messages, e.g. `binding "b" of
+// instance "i"`.
+func describeApplyResource(a *applyAction) string {
+	if a.BindingID != "" {
+		return fmt.Sprintf("binding %q of instance %q", a.BindingID, a.InstanceID)
+	}
+	return fmt.Sprintf("instance %q", a.InstanceID)
+}
+
+// applyTable returns the table printed for --output=table.
+func applyTable(plan *applyPlan) *output.Table {
+	table := &output.Table{Columns: []string{"action", "instance id", "binding id", "service id", "plan id", "reason"}}
+	for _, a := range plan.Actions {
+		table.Rows = append(table.Rows, []string{a.Action, a.InstanceID, a.BindingID, a.ServiceID, a.PlanID, a.Reason})
+	}
+	return table
+}
+
+// printApplyPlan prints the plan of apply --dry-run in the output format.
+func printApplyPlan(plan *applyPlan) {
+	printResult(plan, applyTable(plan), func() {
+		if len(plan.Actions) == 0 {
+			fmt.Printf("Broker %q already matches the manifest\n", plan.BrokerURL)
+			return
+		}
+		fmt.Printf("The following changes would be made to broker %q, in this order\n", plan.BrokerURL)
+		for _, a := range plan.Actions {
+			fmt.Println(applyActionLine(a))
+		}
+	})
+}
+
+// applyActionMarks mark the lines of creations, updates and deletions.
+var applyActionMarks = map[string]string{applyCreate: "+", applyUpdate: "~", applyDelete: "-"}
+
+// applyActionLine returns the line describing the action in a list of changes.
+func applyActionLine(a *applyAction) string {
+	line := fmt.Sprintf("  %s %s", applyActionMarks[a.Action], describeApplyAction(a))
+	switch {
+	case a.Action == applyUpdate && a.PreviousPlanID != "":
+		line += fmt.Sprintf(": %s (plan %s -> %s)", a.Reason, a.PreviousPlanID, a.PlanID)
+	case a.Action == applyUpdate:
+		line += ": " + a.Reason
+	case a.Action == applyCreate && a.BindingID == "":
+		line += fmt.Sprintf(" (Service: %s, Plan: %s)", a.ServiceID, a.PlanID)
+	}
+	return line
+}
@@ -0,0 +1,270 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/fakebroker"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/inventory"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/manifest"
+)
+
+const (
+	testServiceID = "fake-service-id"
+	testFreePlan  = "fake-plan-free-id"
+)
+
+// testResource is an instance, or a binding if bindingID is set, which exists before apply plans.
+type testResource struct {
+	instanceID string
+	bindingID  string
+	parameters map[string]interface{}
+}
+
+func TestPlanApply(t *testing.T) {
+	testCases := []struct {
+		name string
+		// notRetrievable makes the instances of the service unretrievable, so that their parameters
+		// come from the inventory.
+		notRetrievable bool
+		existing       []testResource
+		// inventory are the parameters recorded in the inventory, keyed by instance ID.
+		inventory map[string]map[string]interface{}
+		manifest  string
+		prune     bool
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "creates instances before their bindings",
+			manifest: `
+instances:
+  - instance_id: i1
+    service_id: fake-service-id
+    plan_id: fake-plan-free-id
+    bindings:
+      - binding_id: b1
+`,
+			want: []string{
+				"  + create instance \"i1\" (Service: fake-service-id, Plan: fake-plan-free-id)",
+				"  + create binding \"b1\" of instance \"i1\"",
+			},
+		},
+		{
+			name: "prune deletes bindings before their instance",
+			existing: []testResource{
+				{instanceID: "i1"}, {instanceID: "i1", bindingID: "b1"}, {instanceID: "i1", bindingID: "b2"},
+				{instanceID: "i2"}, {instanceID: "i2", bindingID: "b1"}, {instanceID: "i2", bindingID: "b2"},
+			},
+			manifest: `
+instances:
+  - instance_id: i2
+    service_id: fake-service-id
+    plan_id: fake-plan-free-id
+    bindings:
+      - binding_id: b2
+`,
+			prune: true,
+			want: []string{
+				"  - delete binding \"b1\" of instance \"i1\"",
+				"  - delete binding \"b2\" of instance \"i1\"",
+				"  - delete instance \"i1\"",
+				"  - delete binding \"b1\" of instance \"i2\"",
+			},
+		},
+		{
+			name:     "undeclared resources are kept without prune",
+			existing: []testResource{{instanceID: "i1"}, {instanceID: "i1", bindingID: "b1"}},
+			manifest: "instances: []\n",
+			want:     nil,
+		},
+		{
+			name:     "refuses to change the service",
+			existing: []testResource{{instanceID: "i1"}},
+			manifest: `
+instances:
+  - instance_id: i1
+    service_id: other-service-id
+    plan_id: fake-plan-free-id
+`,
+			wantErr: `instance "i1" has service "fake-service-id", which can't be changed to "other-service-id"`,
+		},
+		{
+			name:     "plan change",
+			existing: []testResource{{instanceID: "i1"}},
+			manifest: `
+instances:
+  - instance_id: i1
+    service_id: fake-service-id
+    plan_id: fake-plan-paid-id
+`,
+			want: []string{"  ~ update instance \"i1\": plan (plan fake-plan-free-id -> fake-plan-paid-id)"},
+		},
+		{
+			name:     "parameters fetched from the broker differ",
+			existing: []testResource{{instanceID: "i1", parameters: map[string]interface{}{"size": "small"}}},
+			// The inventory is only used if the broker can't return the instance.
+			inventory: map[string]map[string]interface{}{"i1": {"size": "large"}},
+			manifest: `
+instances:
+  - instance_id: i1
+    service_id: fake-service-id
+    plan_id: fake-plan-free-id
+    parameters: {size: large}
+`,
+			want: []string{"  ~ update instance \"i1\": parameters"},
+		},
+		{
+			name:     "parameters fetched from the broker match",
+			existing: []testResource{{instanceID: "i1", parameters: map[string]interface{}{"size": "small"}}},
+			manifest: `
+instances:
+  - instance_id: i1
+    service_id: fake-service-id
+    plan_id: fake-plan-free-id
+    parameters: {size: small}
+`,
+			want: nil,
+		},
+		{
+			name:           "parameters recorded in the inventory differ",
+			notRetrievable: true,
+			existing:       []testResource{{instanceID: "i1", parameters: map[string]interface{}{"size": "large"}}},
+			inventory:      map[string]map[string]interface{}{"i1": {"size": "small"}},
+			manifest: `
+instances:
+  - instance_id: i1
+    service_id: fake-service-id
+    plan_id: fake-plan-free-id
+    parameters: {size: large}
+`,
+			want: []string{"  ~ update instance \"i1\": parameters"},
+		},
+		{
+			name:           "parameters recorded in the inventory match",
+			notRetrievable: true,
+			existing:       []testResource{{instanceID: "i1", parameters: map[string]interface{}{"size": "large"}}},
+			inventory:      map[string]map[string]interface{}{"i1": {"size": "small"}},
+			manifest: `
+instances:
+  - instance_id: i1
+    service_id: fake-service-id
+    plan_id: fake-plan-free-id
+    parameters: {size: small}
+`,
+			want: nil,
+		},
+		{
+			name:           "parameters unknown",
+			notRetrievable: true,
+			existing:       []testResource{{instanceID: "i1"}, {instanceID: "i2"}},
+			manifest: `
+instances:
+  - instance_id: i1
+    service_id: fake-service-id
+    plan_id: fake-plan-free-id
+    parameters: {size: small}
+  - instance_id: i2
+    service_id: fake-service-id
+    plan_id: fake-plan-free-id
+`,
+			want: []string{"  ~ update instance \"i1\": parameters, whose current values are unknown"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			catalog := fakebroker.DefaultCatalog()
+			catalog[0].InstancesRetrievable = !tc.notRetrievable
+			client, brokerURL := setupApplyTest(t, catalog)
+			applyFlags.prune = tc.prune
+			createTestResources(t, client, brokerURL, tc.existing)
+
+			inv := &inventory.Inventory{}
+			for id, parameters := range tc.inventory {
+				inv.PutInstance(&inventory.Instance{BrokerURL: brokerURL, InstanceID: id, ServiceID: testServiceID, PlanID: testFreePlan, Parameters: parameters})
+			}
+			if err := inv.Save(inventoryFlag); err != nil {
+				t.Fatalf("Error saving the inventory: %v", err)
+			}
+
+			m, err := manifest.Parse([]byte(tc.manifest))
+			if err != nil {
+				t.Fatalf("Error parsing manifest: %v", err)
+			}
+			plan, err := planApply(context.Background(), client, brokerURL, m)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("planApply got error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error from planApply: %v", err)
+			}
+
+			var got []string
+			for _, a := range plan.Actions {
+				got = append(got, applyActionLine(a))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("planApply got actions:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
+
+// setupApplyTest starts a fake broker with the catalog and sets the flags used by apply for the
+// test, with an inventory in a temporary directory. The flags are restored once the test finishes.
+func setupApplyTest(t *testing.T, catalog []osb.Service) (adapter.Adapter, string) {
+	server := httptest.NewServer(fakebroker.New(fakebroker.Options{Catalog: catalog}))
+	savedFlags, savedInventory := applyFlags, inventoryFlag
+	t.Cleanup(func() {
+		server.Close()
+		applyFlags, inventoryFlag = savedFlags, savedInventory
+		catalogCacheMu.Lock()
+		delete(catalogCache, server.URL)
+		catalogCacheMu.Unlock()
+	})
+	applyFlags.apiVersion, applyFlags.validate, applyFlags.prune = "2.13", validateOff, false
+	inventoryFlag = filepath.Join(t.TempDir(), "inventory.json")
+	return adapter.NewHttpAdapter(server.Client()), server.URL
+}
+
+// createTestResources creates the resources in the broker, in order, on the free plan.
+func createTestResources(t *testing.T, client adapter.Adapter, brokerURL string, resources []testResource) {
+	ctx := context.Background()
+	for _, r := range resources {
+		var err error
+		if r.bindingID != "" {
+			_, err = client.CreateBinding(ctx, &adapter.CreateBindingParams{Server: brokerURL, APIVersion: "2.13",
+				InstanceID: r.instanceID, BindingID: r.bindingID, ServiceID: testServiceID, PlanID: testFreePlan, Parameters: r.parameters})
+		} else {
+			_, err = client.CreateInstance(ctx, &adapter.CreateInstanceParams{Server: brokerURL, APIVersion: "2.13",
+				InstanceID: r.instanceID, ServiceID: testServiceID, PlanID: testFreePlan, Parameters: r.parameters})
+		}
+		if err != nil {
+			t.Fatalf("Error creating %+v: %v", r, err)
+		}
+	}
+}
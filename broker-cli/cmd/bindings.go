@@ -15,28 +15,45 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/credentials"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/inventory"
 	"github.com/spf13/cobra"
 )
 
 var (
 	bindingsFlags struct {
 		flags.BrokerURLConstructor
-		apiVersion   string
-		instanceID   string
-		bindingID    string
-		wait         bool
-		serviceID    string
-		planID       string
-		context      string
-		bindResource string
-		appGUID      string
-		parameters   string
-		operationID  string
+		apiVersion        string
+		instanceID        string
+		bindingID         string
+		wait              bool
+		acceptsIncomplete bool
+		serviceID         string
+		planID            string
+		serviceName       string
+		planName          string
+		context           string
+		contextFile       string
+		bindResource      string
+		appGUID           string
+		parameters        string
+		parametersFile    string
+		params            []string
+		validate          string
+		operationID       string
+		outputSecret      string
+		outputEnv         string
+		outputFile        string
+		orphanMitigation  bool
 	}
 
 	// bindingsCmd represents the bindings command.
@@ -51,49 +68,127 @@ var (
 		Short: "Create a service binding",
 		Long:  "Create a service binding",
 		Run: func(cmd *cobra.Command, args []string) {
-			flags.CheckFlags(&bindingsFlags.instanceID, &bindingsFlags.bindingID, &bindingsFlags.serviceID, &bindingsFlags.planID)
+			flags.CheckFlags(&bindingsFlags.instanceID, &bindingsFlags.bindingID)
+			checkCredentialsFlags()
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL, err := bindingsFlags.BrokerURL()
 			if err != nil {
 				log.Fatalf("Error creating binding %s to instance %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, err)
 			}
+			resolveNames(ctx, client, bindingsFlags.apiVersion, brokerURL, &bindingsFlags.serviceID, &bindingsFlags.planID, bindingsFlags.serviceName, bindingsFlags.planName)
+			flags.CheckFlags(&bindingsFlags.serviceID, &bindingsFlags.planID)
 
-			res, err := client.CreateBinding(&adapter.CreateBindingParams{
-				Server:            brokerURL,
-				APIVersion:        bindingsFlags.apiVersion,
-				AcceptsIncomplete: true,
-				InstanceID:        bindingsFlags.instanceID,
-				BindingID:         bindingsFlags.bindingID,
-				ServiceID:         bindingsFlags.serviceID,
-				PlanID:            bindingsFlags.planID,
-				Context:           parseStringToObjectMap(bindingsFlags.context),
-				AppGUID:           bindingsFlags.appGUID,
-				BindResource:      parseStringToObjectMap(bindingsFlags.bindResource),
-				Parameters:        parseStringToObjectMap(bindingsFlags.parameters),
+			parameters, err := parametersFromFlags(ctx, client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.serviceID, bindingsFlags.planID, adapter.SchemaBindingCreate,
+				bindingsFlags.parametersFile, bindingsFlags.parameters, bindingsFlags.params)
+			if err != nil {
+				log.Fatalf("Error creating binding %s to instance %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, err)
+			}
+			validateParameters(ctx, client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.serviceID, bindingsFlags.planID, adapter.SchemaBindingCreate, bindingsFlags.validate, parameters)
+			requestContext, err := requestContextFromFlags(bindingsFlags.contextFile, bindingsFlags.context)
+			if err != nil {
+				log.Fatalf("Error creating binding %s to instance %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, err)
+			}
+			bindResource, err := parseStringToObjectMap(bindingsFlags.bindResource)
+			if err != nil {
+				log.Fatalf("Error creating binding %s to instance %s: invalid --bindresource: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, err)
+			}
+
+			requestIdentity := newRequestIdentity()
+			infof("Request identity: %s\n", requestIdentity)
+			var res *adapter.CreateBindingResult
+			err = withAsyncFallback(bindingsFlags.acceptsIncomplete, func(acceptsIncomplete bool) error {
+				var err error
+				res, err = client.CreateBinding(ctx, &adapter.CreateBindingParams{
+					Server:              brokerURL,
+					APIVersion:          bindingsFlags.apiVersion,
+					AcceptsIncomplete:   acceptsIncomplete,
+					OriginatingIdentity: originatingIdentityFromFlag(ctx),
+					RequestIdentity:     requestIdentity,
+					InstanceID:          bindingsFlags.instanceID,
+					BindingID:           bindingsFlags.bindingID,
+					ServiceID:           bindingsFlags.serviceID,
+					PlanID:              bindingsFlags.planID,
+					Context:             requestContext,
+					AppGUID:             bindingsFlags.appGUID,
+					BindResource:        bindResource,
+					Parameters:          parameters,
+				})
+				return err
 			})
 			if err != nil {
-				log.Fatalf("Error creating binding %s to instance %s in broker %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err)
+				orphanReport := mitigateOrphan(bindingsFlags.orphanMitigation, client, bindingsFlags.apiVersion, brokerURL,
+					&instance{ID: bindingsFlags.instanceID, ServiceID: bindingsFlags.serviceID, PlanID: bindingsFlags.planID}, bindingsFlags.bindingID, err)
+				log.Fatalf("Error creating binding %s to instance %s in broker %s: %v%s%s", bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err, brokerErrorHint(err), orphanReport)
 			}
+			updateInventory(func(inv *inventory.Inventory) {
+				inv.PutBinding(&inventory.Binding{
+					BrokerURL:     brokerURL,
+					InstanceID:    bindingsFlags.instanceID,
+					BindingID:     bindingsFlags.bindingID,
+					ServiceID:     bindingsFlags.serviceID,
+					PlanID:        bindingsFlags.planID,
+					Parameters:    parameters,
+					LastOperation: inventoryOperation(res.Async, res.OperationID, inventory.OperationCreate),
+					Source:        inventory.SourceCreated,
+				})
+			})
+
+			out := &operationResult{RequestIdentity: requestIdentity, Result: res}
 
 			if !res.Async {
-				fmt.Printf("Successfully created the binding %s: %+v\n", bindingsFlags.bindingID, *res)
+				printBindingResult(out, takeCredentials(&res.Credentials), func() {
+					fmt.Printf("Successfully created the binding %s: %+v\n", bindingsFlags.bindingID, *res)
+				})
 				return
 			}
 
 			if !bindingsFlags.wait {
-				fmt.Printf("Successfully started the operation to create the binding %s: %+v\n", bindingsFlags.bindingID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully started the operation to create the binding %s: %+v\n", bindingsFlags.bindingID, *res)
+				})
+				if exportingCredentials() {
+					infof("The credentials weren't exported since the binding is still being created. Export them with bindings get once it is.\n")
+				}
 				return
 			}
 
-			op, err := waitOnOperation(pollBindingOpFunc(client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, bindingsFlags.serviceID,
-				bindingsFlags.planID, res.OperationID, adapter.OperationCreate), false)
+			op, err := waitOnOperation(ctx, pollBindingOpFunc(client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, bindingsFlags.serviceID,
+				bindingsFlags.planID, res.OperationID, adapter.OperationCreate),
+				maximumPollingDuration(ctx, client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.serviceID, bindingsFlags.planID),
+				liveProgress(fmt.Sprintf("the creation of binding %s", bindingsFlags.bindingID)))
 			if err != nil {
-				log.Fatalf("Error polling last operation %q for binding %s: %v", res.OperationID, bindingsFlags.bindingID, err)
+				log.Fatalf("Error polling last operation %q for binding %s: %v%s", res.OperationID, bindingsFlags.bindingID, err,
+					waitHint(err, "bindings", brokerURL, "instance", bindingsFlags.instanceID, "binding", bindingsFlags.bindingID, "service", bindingsFlags.serviceID, "plan", bindingsFlags.planID, "operation", res.OperationID))
 			}
+			recordBindingOperation(brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, res.OperationID, inventory.OperationCreate, op)
 
 			if op.State == adapter.OperationSucceeded {
-				fmt.Printf("Successfully created the binding %s asynchronously (operation %q): %+v\n", bindingsFlags.bindingID, res.OperationID, *op)
+				out.LastOperation = op
+				creds := takeCredentials(&res.Credentials)
+				if exportingCredentials() {
+					// The credentials of asynchronous bindings are only returned by fetching them.
+					if err := checkRetrievable(ctx, client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.serviceID, true); err != nil {
+						log.Fatalf("Error fetching the credentials of binding %s to instance %s in broker %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err)
+					}
+					gbr, err := client.GetBinding(ctx, &adapter.GetBindingParams{
+						Server:     brokerURL,
+						APIVersion: bindingsFlags.apiVersion,
+						InstanceID: bindingsFlags.instanceID,
+						BindingID:  bindingsFlags.bindingID,
+						ServiceID:  bindingsFlags.serviceID,
+						PlanID:     bindingsFlags.planID,
+					})
+					if err != nil {
+						log.Fatalf("Error fetching the credentials of binding %s to instance %s in broker %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err)
+					}
+					creds = gbr.Credentials
+				}
+				printBindingResult(out, creds, func() {
+					fmt.Printf("Successfully created the binding %s asynchronously (operation %q): %+v\n", bindingsFlags.bindingID, res.OperationID, *op)
+				})
 				return
 			}
 
@@ -107,45 +202,77 @@ var (
 		Long:  "Delete a service binding",
 
 		Run: func(cmd *cobra.Command, args []string) {
-			flags.CheckFlags(&bindingsFlags.instanceID, &bindingsFlags.bindingID, &bindingsFlags.serviceID, &bindingsFlags.planID)
+			flags.CheckFlags(&bindingsFlags.instanceID, &bindingsFlags.bindingID)
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL, err := bindingsFlags.BrokerURL()
 			if err != nil {
 				log.Fatalf("Error deleting binding %s to instance %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, err)
 			}
-
-			res, err := client.DeleteBinding(&adapter.DeleteBindingParams{
-				Server:            brokerURL,
-				APIVersion:        bindingsFlags.apiVersion,
-				AcceptsIncomplete: true,
-				InstanceID:        bindingsFlags.instanceID,
-				BindingID:         bindingsFlags.bindingID,
-				ServiceID:         bindingsFlags.serviceID,
-				PlanID:            bindingsFlags.planID,
+			resolveNames(ctx, client, bindingsFlags.apiVersion, brokerURL, &bindingsFlags.serviceID, &bindingsFlags.planID, bindingsFlags.serviceName, bindingsFlags.planName)
+			fillBindingFlags(brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, &bindingsFlags.serviceID, &bindingsFlags.planID, nil)
+			flags.CheckFlags(&bindingsFlags.serviceID, &bindingsFlags.planID)
+
+			requestIdentity := newRequestIdentity()
+			infof("Request identity: %s\n", requestIdentity)
+			var res *adapter.DeleteBindingResult
+			err = withAsyncFallback(bindingsFlags.acceptsIncomplete, func(acceptsIncomplete bool) error {
+				var err error
+				res, err = client.DeleteBinding(ctx, &adapter.DeleteBindingParams{
+					Server:              brokerURL,
+					APIVersion:          bindingsFlags.apiVersion,
+					AcceptsIncomplete:   acceptsIncomplete,
+					OriginatingIdentity: originatingIdentityFromFlag(ctx),
+					RequestIdentity:     requestIdentity,
+					InstanceID:          bindingsFlags.instanceID,
+					BindingID:           bindingsFlags.bindingID,
+					ServiceID:           bindingsFlags.serviceID,
+					PlanID:              bindingsFlags.planID,
+				})
+				return err
 			})
 			if err != nil {
-				log.Fatalf("Error deleting binding %s to instance %s in broker %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err)
+				log.Fatalf("Error deleting binding %s to instance %s in broker %s: %v%s", bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err, brokerErrorHint(err))
 			}
+			deleteOp := &adapter.Operation{State: adapter.OperationSucceeded}
+			if res.Async {
+				deleteOp.State = adapter.OperationInProgress
+			}
+			recordBindingOperation(brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, res.OperationID, inventory.OperationDelete, deleteOp)
+
+			out := &operationResult{RequestIdentity: requestIdentity, Result: res}
 
 			if !res.Async {
-				fmt.Printf("Successfully deleted the binding %s: %+v\n", bindingsFlags.bindingID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully deleted the binding %s: %+v\n", bindingsFlags.bindingID, *res)
+				})
 				return
 			}
 
 			if !bindingsFlags.wait {
-				fmt.Printf("Successfully started the operation to delete the binding %s: %+v\n", bindingsFlags.bindingID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully started the operation to delete the binding %s: %+v\n", bindingsFlags.bindingID, *res)
+				})
 				return
 			}
 
-			op, err := waitOnOperation(pollBindingOpFunc(client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, bindingsFlags.serviceID,
-				bindingsFlags.planID, res.OperationID, adapter.OperationDelete), false)
+			op, err := waitOnOperation(ctx, pollBindingOpFunc(client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, bindingsFlags.serviceID,
+				bindingsFlags.planID, res.OperationID, adapter.OperationDelete),
+				maximumPollingDuration(ctx, client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.serviceID, bindingsFlags.planID),
+				liveProgress(fmt.Sprintf("the deletion of binding %s", bindingsFlags.bindingID)))
 			if err != nil {
-				log.Fatalf("Error polling last operation %q for binding %s: %v", res.OperationID, bindingsFlags.bindingID, err)
+				log.Fatalf("Error polling last operation %q for binding %s: %v%s", res.OperationID, bindingsFlags.bindingID, err,
+					waitHint(err, "bindings", brokerURL, "instance", bindingsFlags.instanceID, "binding", bindingsFlags.bindingID, "service", bindingsFlags.serviceID, "plan", bindingsFlags.planID, "operation", res.OperationID))
 			}
+			recordBindingOperation(brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, res.OperationID, inventory.OperationDelete, op)
 
 			if op.State == adapter.OperationSucceeded {
-				fmt.Printf("Successfully deleted the binding %s asynchronously (operation %q): %+v\n", bindingsFlags.bindingID, res.OperationID, *op)
+				out.LastOperation = op
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully deleted the binding %s asynchronously (operation %q): %+v\n", bindingsFlags.bindingID, res.OperationID, *op)
+				})
 				return
 			}
 
@@ -153,6 +280,50 @@ var (
 		},
 	}
 
+	bindingsGetCmd = &cobra.Command{
+		Use:   "get",
+		Short: "Fetch a service binding",
+		Long:  "Fetch a service binding, including its credentials and parameters",
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.CheckFlags(&bindingsFlags.instanceID, &bindingsFlags.bindingID)
+			checkCredentialsFlags()
+
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			client := httpAdapterFromFlag()
+			brokerURL, err := bindingsFlags.BrokerURL()
+			if err != nil {
+				log.Fatalf("Error fetching binding %s to instance %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, err)
+			}
+			resolveNames(ctx, client, bindingsFlags.apiVersion, brokerURL, &bindingsFlags.serviceID, &bindingsFlags.planID, bindingsFlags.serviceName, bindingsFlags.planName)
+
+			if err := checkRetrievable(ctx, client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.serviceID, true); err != nil {
+				log.Fatalf("Error fetching binding %s to instance %s in broker %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err)
+			}
+			res, err := client.GetBinding(ctx, &adapter.GetBindingParams{
+				Server:     brokerURL,
+				APIVersion: bindingsFlags.apiVersion,
+				InstanceID: bindingsFlags.instanceID,
+				BindingID:  bindingsFlags.bindingID,
+				ServiceID:  bindingsFlags.serviceID,
+				PlanID:     bindingsFlags.planID,
+			})
+			if err != nil {
+				log.Fatalf("Error fetching binding %s to instance %s in broker %s: %v", bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err)
+			}
+
+			printBindingResult(res, takeCredentials(&res.Credentials), func() {
+				fmt.Printf("Successfully fetched the binding %s:\n", bindingsFlags.bindingID)
+				if exportingCredentials() {
+					fmt.Printf("   Credentials: exported, not printed\n")
+				} else {
+					fmt.Printf("   Credentials: %s\n", formatObjectMap(res.Credentials))
+				}
+				fmt.Printf("   Parameters: %s\n", formatObjectMap(res.Parameters))
+			})
+		},
+	}
+
 	bindingsPollCmd = &cobra.Command{
 		Use:   "poll",
 		Short: "Poll the operation for the service binding",
@@ -160,19 +331,69 @@ var (
 		Run: func(cmd *cobra.Command, args []string) {
 			flags.CheckFlags(&bindingsFlags.instanceID, &bindingsFlags.bindingID)
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL, err := bindingsFlags.BrokerURL()
 			if err != nil {
 				log.Fatalf("Error polling operation %q for binding %s to instance %s: %v", bindingsFlags.operationID, bindingsFlags.bindingID, bindingsFlags.instanceID, err)
 			}
+			resolveNames(ctx, client, bindingsFlags.apiVersion, brokerURL, &bindingsFlags.serviceID, &bindingsFlags.planID, bindingsFlags.serviceName, bindingsFlags.planName)
+			opType := fillBindingFlags(brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, &bindingsFlags.serviceID, &bindingsFlags.planID, &bindingsFlags.operationID)
 			pollBindingOp := pollBindingOpFunc(client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID,
-				bindingsFlags.serviceID, bindingsFlags.planID, bindingsFlags.operationID, adapter.OperationUnknown)
-			op, err := pollBindingOp()
+				bindingsFlags.serviceID, bindingsFlags.planID, bindingsFlags.operationID, opType)
+			op, err := pollBindingOp(ctx)
 			if err != nil {
 				log.Fatalf("Error polling operation %q for binding %s to instance %s in broker %s: %v", bindingsFlags.operationID, bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err)
 			}
+			if opType != adapter.OperationUnknown {
+				recordBindingOperation(brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, bindingsFlags.operationID, inventoryOperationType(opType), op)
+			}
 
-			fmt.Printf("Successfully polled the operation %q for binding %s to instance %s in broker %s: %+v\n", bindingsFlags.operationID, bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, *op)
+			printResult(op, nil, func() {
+				fmt.Printf("Successfully polled the operation %q for binding %s to instance %s in broker %s: %+v\n", bindingsFlags.operationID, bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, *op)
+			})
+		},
+	}
+
+	bindingsWaitCmd = &cobra.Command{
+		Use:   "wait",
+		Short: "Wait for the operation for the service binding to finish",
+		Long: "Poll the operation for the service binding until it finishes, e.g. to resume waiting after --wait-timeout. " +
+			"The command fails if the operation fails.",
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.CheckFlags(&bindingsFlags.instanceID, &bindingsFlags.bindingID)
+
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			client := httpAdapterFromFlag()
+			brokerURL, err := bindingsFlags.BrokerURL()
+			if err != nil {
+				log.Fatalf("Error waiting on operation %q for binding %s to instance %s: %v", bindingsFlags.operationID, bindingsFlags.bindingID, bindingsFlags.instanceID, err)
+			}
+			resolveNames(ctx, client, bindingsFlags.apiVersion, brokerURL, &bindingsFlags.serviceID, &bindingsFlags.planID, bindingsFlags.serviceName, bindingsFlags.planName)
+			opType := fillBindingFlags(brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, &bindingsFlags.serviceID, &bindingsFlags.planID, &bindingsFlags.operationID)
+			op, err := waitOnOperation(ctx, pollBindingOpFunc(client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID,
+				bindingsFlags.serviceID, bindingsFlags.planID, bindingsFlags.operationID, opType),
+				maximumPollingDuration(ctx, client, bindingsFlags.apiVersion, brokerURL, bindingsFlags.serviceID, bindingsFlags.planID),
+				liveProgress(fmt.Sprintf("binding %s", bindingsFlags.bindingID)))
+			if err != nil {
+				log.Fatalf("Error waiting on operation %q for binding %s to instance %s in broker %s: %v%s", bindingsFlags.operationID, bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, err,
+					waitHint(err, "bindings", brokerURL, "instance", bindingsFlags.instanceID, "binding", bindingsFlags.bindingID, "service", bindingsFlags.serviceID,
+						"plan", bindingsFlags.planID, "operation", bindingsFlags.operationID))
+			}
+			if opType != adapter.OperationUnknown {
+				recordBindingOperation(brokerURL, bindingsFlags.instanceID, bindingsFlags.bindingID, bindingsFlags.operationID, inventoryOperationType(opType), op)
+			}
+
+			if op.State == adapter.OperationSucceeded {
+				printResult(op, nil, func() {
+					fmt.Printf("The operation %q for binding %s to instance %s in broker %s succeeded: %+v\n", bindingsFlags.operationID, bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, *op)
+				})
+				return
+			}
+
+			log.Fatalf("The operation %q for binding %s to instance %s in broker %s failed: %+v\n", bindingsFlags.operationID, bindingsFlags.bindingID, bindingsFlags.instanceID, brokerURL, *op)
 		},
 	}
 )
@@ -180,7 +401,7 @@ var (
 func init() {
 	// Flags for `bindings` command group and all subgroups.
 	flags.StringFlag(bindingsCmd.PersistentFlags(), &bindingsFlags.Server, flags.ServerLongName, flags.ServerShortName,
-		fmt.Sprintf("[Required if %s and %s are not given] Broker URL to make request to (https://...).", flags.ProjectLongName, flags.BrokerLongName))
+		fmt.Sprintf("[Required if %s and %s are not given] Broker URL to make request to (https://...). Any OSB broker URL is accepted.", flags.ProjectLongName, flags.BrokerLongName))
 	flags.StringFlag(bindingsCmd.PersistentFlags(), &bindingsFlags.instanceID, "instance", "i",
 		"[Required] Service instance ID.")
 	flags.StringFlag(bindingsCmd.PersistentFlags(), &bindingsFlags.bindingID, "binding", "d",
@@ -197,10 +418,19 @@ func init() {
 	// Flags for `bindings create` command group.
 	flags.BoolFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.wait, "wait", "w",
 		"[Optional] If specified, the broker will keep polling the last operation. (Default: FALSE)")
+	flags.BoolFlagWithDefault(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.acceptsIncomplete, "accepts-incomplete", "a", true,
+		"[Optional] If set to false, the broker is asked to process the request synchronously. The request is "+
+			"retried asynchronously if the broker requires it. (Default: TRUE)")
+	flags.BoolFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.orphanMitigation, "orphan-mitigation", "",
+		orphanMitigationUsage("binding"))
 	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.serviceID, "service", "r",
-		"[Required] The service ID used to create the service binding.")
+		"[Required unless --service-name is given] The service ID used to create the service binding.")
 	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.planID, "plan", "l",
-		"[Required] The plan ID used to create the service binding.")
+		"[Required unless --plan-name is given] The plan ID used to create the service binding.")
+	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.serviceName, "service-name", "",
+		nameFlagUsage("service"))
+	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.planName, "plan-name", "",
+		nameFlagUsage("plan"))
 	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.context, "context", "t",
 		"[Optional] [JSON Object] Contextual information under which the service binding is to be created.")
 	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.bindResource, "bindresource", "e",
@@ -209,33 +439,81 @@ func init() {
 		"[Optional] [Deprecated in favor of 'binding_resource'.'app_guid']  GUID of an application "+
 			"associated with the binding to be created.")
 	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.parameters, "parameters", "m",
-		"[Optional] [JSON Object] Configuration options for the service binding.")
+		"[Optional] [JSON Object] Configuration options for the service binding. Takes precedence over --parameters-file.")
+	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.parametersFile, "parameters-file", "",
+		"[Optional] A JSON or YAML file with configuration options for the service binding, or - to read them from stdin.")
+	flags.StringArrayFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.params, "param", "",
+		"[Optional] A configuration option given as key.path=value, which takes precedence over --parameters and --parameters-file. "+
+			"The value is converted to the type declared by the JSON schema of the plan. Can be repeated.")
+	flags.StringFlag(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.contextFile, "context-file", "",
+		"[Optional] A JSON or YAML file with the contextual information of the service binding, or - to read it from stdin. "+
+			"--context takes precedence over it.")
+	flags.StringFlagWithDefault(bindingsCreateCmd.PersistentFlags(), &bindingsFlags.validate, "validate", "", validateStrict,
+		"[Optional] How the parameters are validated against the JSON schema of the plan in the broker catalog before sending them: "+
+			"strict fails on violations, warn prints them and off skips validation.")
 
 	// Flags for `bindings delete` command group.
 	flags.BoolFlag(bindingsDeleteCmd.PersistentFlags(), &bindingsFlags.wait, "wait", "w",
 		"[Optional] If specified, the broker will keep polling the last operation. (Default: FALSE)")
+	flags.BoolFlagWithDefault(bindingsDeleteCmd.PersistentFlags(), &bindingsFlags.acceptsIncomplete, "accepts-incomplete", "a", true,
+		"[Optional] If set to false, the broker is asked to process the request synchronously. The request is "+
+			"retried asynchronously if the broker requires it. (Default: TRUE)")
 	flags.StringFlag(bindingsDeleteCmd.PersistentFlags(), &bindingsFlags.serviceID, "service", "r",
-		"[Required] The service ID used by the service binding.")
+		"[Required unless --service-name is given or the binding is in the inventory] The service ID used by the service binding.")
 	flags.StringFlag(bindingsDeleteCmd.PersistentFlags(), &bindingsFlags.planID, "plan", "l",
-		"[Required] The plan ID used by the service binding.")
+		"[Required unless --plan-name is given or the binding is in the inventory] The plan ID used by the service binding.")
+	flags.StringFlag(bindingsDeleteCmd.PersistentFlags(), &bindingsFlags.serviceName, "service-name", "",
+		nameFlagUsage("service"))
+	flags.StringFlag(bindingsDeleteCmd.PersistentFlags(), &bindingsFlags.planName, "plan-name", "",
+		nameFlagUsage("plan"))
+
+	// Flags for `bindings get` command group.
+	flags.StringFlag(bindingsGetCmd.PersistentFlags(), &bindingsFlags.serviceID, "service", "r",
+		"[Optional] The service ID used by the service binding.")
+	flags.StringFlag(bindingsGetCmd.PersistentFlags(), &bindingsFlags.planID, "plan", "l",
+		"[Optional] The plan ID used by the service binding.")
+	flags.StringFlag(bindingsGetCmd.PersistentFlags(), &bindingsFlags.serviceName, "service-name", "",
+		nameFlagUsage("service"))
+	flags.StringFlag(bindingsGetCmd.PersistentFlags(), &bindingsFlags.planName, "plan-name", "",
+		nameFlagUsage("plan"))
+
+	// Flags for `bindings create` and `bindings get` command groups.
+	for _, cmd := range []*cobra.Command{bindingsCreateCmd, bindingsGetCmd} {
+		flags.StringFlag(cmd.PersistentFlags(), &bindingsFlags.outputSecret, "output-secret", "",
+			"[Optional] Print a Kubernetes Secret manifest named name[:namespace] with a key per credential instead of the result, "+
+				"in YAML unless --output is json. Nested values are encoded in JSON.")
+		flags.StringFlag(cmd.PersistentFlags(), &bindingsFlags.outputEnv, "output-env", "",
+			"[Optional] Write the credentials to this dotenv file, with a variable per credential, e.g. DB_HOST for db-host. Nested values are encoded in JSON.")
+		flags.StringFlag(cmd.PersistentFlags(), &bindingsFlags.outputFile, "output-file", "",
+			"[Optional] Write the credentials to this JSON file.")
+	}
 
-	// Flags for `bindings poll` command group.
-	flags.StringFlag(bindingsPollCmd.PersistentFlags(), &bindingsFlags.serviceID, "service", "r",
-		"[Optional] The service ID used to create the service binding. If present, must not be an empty string.")
-	flags.StringFlag(bindingsPollCmd.PersistentFlags(), &bindingsFlags.planID, "plan", "l",
-		"[Optional] The plan ID used to create the service binding. If present, must not be an empty string.")
-	flags.StringFlag(bindingsPollCmd.PersistentFlags(), &bindingsFlags.operationID, "operation", "o",
-		"[Optional] The operation ID used to poll the operation for the service binding. If present, must not be an empty string.")
+	// Flags for `bindings poll` and `bindings wait` command groups.
+	for _, cmd := range []*cobra.Command{bindingsPollCmd, bindingsWaitCmd} {
+		flags.StringFlag(cmd.PersistentFlags(), &bindingsFlags.serviceID, "service", "r",
+			"[Optional] The service ID used to create the service binding. If present, must not be an empty string.")
+		flags.StringFlag(cmd.PersistentFlags(), &bindingsFlags.planID, "plan", "l",
+			"[Optional] The plan ID used to create the service binding. If present, must not be an empty string.")
+		flags.StringFlag(cmd.PersistentFlags(), &bindingsFlags.serviceName, "service-name", "",
+			nameFlagUsage("service"))
+		flags.StringFlag(cmd.PersistentFlags(), &bindingsFlags.planName, "plan-name", "",
+			nameFlagUsage("plan"))
+		flags.StringFlag(cmd.PersistentFlags(), &bindingsFlags.operationID, "operation", "",
+			"[Optional] The operation ID used to poll the operation for the service binding. If present, must not be an empty string. "+
+				"(Default: the operation in progress recorded in the inventory)")
+	}
 
 	RootCmd.AddCommand(bindingsCmd)
 	bindingsCmd.AddCommand(bindingsCreateCmd)
 	bindingsCmd.AddCommand(bindingsDeleteCmd)
+	bindingsCmd.AddCommand(bindingsGetCmd)
 	bindingsCmd.AddCommand(bindingsPollCmd)
+	bindingsCmd.AddCommand(bindingsWaitCmd)
 }
 
-func pollBindingOpFunc(client adapter.Adapter, apiVersion, brokerURL, instanceID, bindingID, serviceID, planID, opID string, opType adapter.OperationType) func() (*adapter.Operation, error) {
-	cb := func() (*adapter.Operation, error) {
-		return client.BindingLastOperation(&adapter.BindingLastOperationParams{
+func pollBindingOpFunc(client adapter.Adapter, apiVersion, brokerURL, instanceID, bindingID, serviceID, planID, opID string, opType adapter.OperationType) func(context.Context) (*adapter.Operation, error) {
+	cb := func(ctx context.Context) (*adapter.Operation, error) {
+		return client.BindingLastOperation(ctx, &adapter.BindingLastOperationParams{
 			Server:     brokerURL,
 			InstanceID: instanceID,
 			BindingID:  bindingID,
@@ -251,35 +529,130 @@ func pollBindingOpFunc(client adapter.Adapter, apiVersion, brokerURL, instanceID
 	return cb
 }
 
-func deleteBinding(client adapter.Adapter, apiVersion, brokerURL string, i *instance, bindingID string, showProgress bool) error {
+func deleteBinding(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL string, i *instance, bindingID string, showProgress bool) error {
+	requestIdentity := newRequestIdentity()
 	if showProgress {
-		fmt.Printf("Deleting binding %q to instance %q in broker %q\n", bindingID, i.ID, brokerURL)
+		infof("Deleting binding %q to instance %q in broker %q with request identity %s\n", bindingID, i.ID, brokerURL, requestIdentity)
 	}
 
-	res, err := client.DeleteBinding(&adapter.DeleteBindingParams{
-		Server:            brokerURL,
-		InstanceID:        i.ID,
-		BindingID:         bindingID,
-		ServiceID:         i.serviceID,
-		PlanID:            i.planID,
-		AcceptsIncomplete: true,
-		APIVersion:        apiVersion,
+	// Cleanup may race with operations still in progress, so give them a chance to finish.
+	var res *adapter.DeleteBindingResult
+	err := retryOnConcurrencyError(ctx, func() error {
+		var err error
+		res, err = client.DeleteBinding(ctx, &adapter.DeleteBindingParams{
+			Server:              brokerURL,
+			InstanceID:          i.ID,
+			BindingID:           bindingID,
+			ServiceID:           i.ServiceID,
+			PlanID:              i.PlanID,
+			AcceptsIncomplete:   true,
+			OriginatingIdentity: originatingIdentityFromFlag(ctx),
+			RequestIdentity:     requestIdentity,
+			APIVersion:          apiVersion,
+		})
+		return err
 	})
 	if err != nil {
 		return err
 	}
+	if !res.Async {
+		recordBindingOperation(brokerURL, i.ID, bindingID, "", inventory.OperationDelete, &adapter.Operation{State: adapter.OperationSucceeded})
+		return nil
+	}
 
-	op, err := waitOnOperation(pollBindingOpFunc(client, flags.ApiVersionDefault, brokerURL, i.ID, bindingID, i.serviceID, i.planID, res.OperationID, adapter.OperationDelete), showProgress)
+	op, err := waitOnOperation(ctx, pollBindingOpFunc(client, flags.ApiVersionDefault, brokerURL, i.ID, bindingID, i.ServiceID, i.PlanID, res.OperationID, adapter.OperationDelete),
+		maximumPollingDuration(ctx, client, apiVersion, brokerURL, i.ServiceID, i.PlanID), nil)
 	if err != nil {
 		return fmt.Errorf("Error polling last operation %q for binding %q to instance %q in broker %q: %v", res.OperationID, bindingID, i.ID, brokerURL, err)
 	}
 
+	recordBindingOperation(brokerURL, i.ID, bindingID, res.OperationID, inventory.OperationDelete, op)
 	if op.State == adapter.OperationSucceeded {
-		if showProgress {
-			fmt.Print("Done\n")
-		}
 		return nil
 	}
 
-	return fmt.Errorf("Failed to delete binding %q to instance %q in broker %q: %+v", bindingID, i.ID, brokerURL, *op)
+	return &operationFailedError{msg: fmt.Sprintf("Failed to delete binding %q to instance %q in broker %q: %+v", bindingID, i.ID, brokerURL, *op)}
+}
+
+// exportingCredentials returns whether any of the flags exporting the credentials of the binding is
+// given.
+func exportingCredentials() bool {
+	return bindingsFlags.outputSecret != "" || bindingsFlags.outputEnv != "" || bindingsFlags.outputFile != ""
+}
+
+// takeCredentials returns the credentials of a binding result for printBindingResult. If they are
+// exported, they are removed from the result, so that printing it doesn't leak them to terminals and
+// logs.
+func takeCredentials(creds *map[string]interface{}) map[string]interface{} {
+	c := *creds
+	if exportingCredentials() {
+		*creds = nil
+	}
+	return c
+}
+
+// secretFromFlag returns the name and namespace of the Secret given by --output-secret.
+func secretFromFlag() (name, namespace string) {
+	name = bindingsFlags.outputSecret
+	if i := strings.Index(name, ":"); i >= 0 {
+		name, namespace = name[:i], name[i+1:]
+	}
+	return name, namespace
+}
+
+// checkCredentialsFlags checks the flags exporting credentials before the binding is requested.
+// With --output-secret, the manifest is the only output on stdout, so the output format is switched
+// from text or table to YAML, which also prints progress to stderr.
+func checkCredentialsFlags() {
+	if bindingsFlags.outputSecret == "" {
+		return
+	}
+	if name, _ := secretFromFlag(); name == "" {
+		log.Fatalf("Invalid --output-secret %q, expected name[:namespace]", bindingsFlags.outputSecret)
+	}
+	if f := printer.Format(); f == output.FormatText || f == output.FormatTable {
+		var err error
+		if printer, err = output.NewPrinter(output.FormatYAML); err != nil {
+			log.Fatalf("Error printing the secret: %v", err)
+		}
+	}
+}
+
+// printBindingResult exports the credentials as given by the --output-env and --output-file flags,
+// and prints res like printResult, or the Secret manifest instead with --output-secret. res must not
+// hold the exported credentials, see takeCredentials.
+func printBindingResult(res interface{}, creds map[string]interface{}, text func()) {
+	if bindingsFlags.outputFile != "" {
+		b, err := credentials.JSON(creds)
+		if err == nil {
+			err = credentials.WriteFile(bindingsFlags.outputFile, b)
+		}
+		if err != nil {
+			log.Fatalf("Error writing the credentials to %s: %v", bindingsFlags.outputFile, err)
+		}
+		infof("Wrote the credentials to %s\n", bindingsFlags.outputFile)
+	}
+	if bindingsFlags.outputEnv != "" {
+		b, err := credentials.Dotenv(creds)
+		if err == nil {
+			err = credentials.WriteFile(bindingsFlags.outputEnv, b)
+		}
+		if err != nil {
+			log.Fatalf("Error writing the credentials to %s: %v", bindingsFlags.outputEnv, err)
+		}
+		infof("Wrote the credentials to %s\n", bindingsFlags.outputEnv)
+	}
+
+	if bindingsFlags.outputSecret == "" {
+		printResult(res, nil, text)
+		return
+	}
+	name, namespace := secretFromFlag()
+	secret, err := credentials.Secret(name, namespace, creds)
+	if err != nil {
+		log.Fatalf("Error creating the secret: %v", err)
+	}
+	if err := printer.Print(os.Stdout, secret, nil); err != nil {
+		log.Fatalf("Error printing the secret: %v", err)
+	}
 }
@@ -15,11 +15,23 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
 	"github.com/spf13/cobra"
 )
 
@@ -34,6 +46,19 @@ var (
 		verbose bool
 		force   bool
 		cleanup bool
+
+		parallelism int
+		retries     int
+		pageSize    int
+
+		// Flags selecting the resources deleted by brokers cleanup.
+		services  []string
+		plans     []string
+		olderThan time.Duration
+		idRegex   string
+		exclude   []string
+		dryRun    bool
+		planFile  string
 	}
 
 	// brokersCmd represents the brokers command.
@@ -50,6 +75,7 @@ var (
 		Long:  "Create a service broker",
 		Run: func(cmd *cobra.Command, args []string) {
 			flags.CheckFlags(&brokersFlags.project, &brokersFlags.broker)
+			checkGCPAdminFlags("Creating brokers")
 
 			// Title defaults to name if not present.
 			title := brokersFlags.title
@@ -57,8 +83,10 @@ var (
 				title = brokersFlags.broker
 			}
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			http := httpAdapterFromFlag()
-			res, err := http.CreateBroker(&adapter.CreateBrokerParams{
+			res, err := http.CreateBroker(ctx, &adapter.CreateBrokerParams{
 				Host:    brokersFlags.host,
 				Project: brokersFlags.project,
 				Name:    brokersFlags.broker,
@@ -68,10 +96,12 @@ var (
 				log.Fatalf("Failed to create broker %q in project %q: %v\n", brokersFlags.broker, brokersFlags.project, err)
 			}
 
-			fmt.Printf("Successfully created broker %q in project %q!!\n", brokersFlags.broker, brokersFlags.project)
-			fmt.Printf("   Title: %s\n", res.Title)
-			fmt.Printf("   URL: %s\n", *res.URL)
-			fmt.Printf("   Create time: %s\n", *res.CreateTime)
+			printResult(res, nil, func() {
+				fmt.Printf("Successfully created broker %q in project %q!!\n", brokersFlags.broker, brokersFlags.project)
+				fmt.Printf("   Title: %s\n", res.Title)
+				fmt.Printf("   URL: %s\n", *res.URL)
+				fmt.Printf("   Create time: %s\n", *res.CreateTime)
+			})
 		},
 	}
 
@@ -82,17 +112,33 @@ var (
 		Long:  "Delete a service broker",
 		Run: func(cmd *cobra.Command, args []string) {
 			flags.CheckFlags(&brokersFlags.project, &brokersFlags.broker)
+			checkGCPAdminFlags("Deleting brokers")
+			if brokersFlags.cleanup {
+				checkCleanupFlags()
+			}
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL := flags.ConstructBrokerURL(brokersFlags.host, brokersFlags.project, brokersFlags.broker)
 
 			if brokersFlags.cleanup {
-				if err := cleanupBroker(client, brokerURL); err != nil {
-					return
+				report, err := cleanupBroker(ctx, client, brokerURL, planBrokerCleanup(ctx, client, brokerURL, &cleanupFilter{}))
+				if err != nil {
+					if err.Error() == userCancelledBrokerCleanup {
+						fmt.Println(userCancelledBrokerCleanup)
+						return
+					}
+					log.Fatalf("Failed to cleanup broker %q: %v\n", brokerURL, err)
+				}
+				if !report.complete() {
+					printCleanupReport(ctx, client, report)
+					log.Fatalf("Not deleting broker %q in project %q since its cleanup failed", brokersFlags.broker, brokersFlags.project)
 				}
+				infof("Deleted %d resources in broker %q\n", len(report.Deleted), brokerURL)
 			}
 
-			if err := client.DeleteBroker(&adapter.DeleteBrokerParams{
+			if err := client.DeleteBroker(ctx, &adapter.DeleteBrokerParams{
 				BrokerURL: brokerURL,
 			}); err != nil {
 				log.Fatalf("Failed to delete broker %q in project %q: %v\n", brokersFlags.broker, brokersFlags.project, err)
@@ -107,15 +153,56 @@ var (
 	brokersCleanupCmd = &cobra.Command{
 		Use:   "cleanup",
 		Short: "Delete all service instances and bindings within a broker",
-		Long:  "Delete all service instances and bindings within a broker",
+		Long: "Delete the service instances within a broker, each after its bindings. All instances are deleted unless " +
+			"some are selected by --service, --plan, --older-than, --id-regex or --exclude. With --dry-run, the deletions " +
+			"are only printed; a plan printed with --output json or yaml can be run later with --plan-file.",
 		Run: func(cmd *cobra.Command, args []string) {
 			flags.CheckFlags(&brokersFlags.project, &brokersFlags.broker)
+			checkGCPAdminFlags("Cleaning up brokers")
+			checkCleanupFlags()
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL := flags.ConstructBrokerURL(brokersFlags.host, brokersFlags.project, brokersFlags.broker)
 
-			if err := cleanupBroker(client, brokerURL); err == nil {
-				fmt.Printf("Successfully cleaned up broker %q in project %q!!\n", brokersFlags.broker, brokersFlags.project)
+			filter, err := cleanupFilterFromFlags()
+			if err != nil {
+				log.Fatalf("Invalid cleanup filter: %v", err)
+			}
+			// Unless a plan file is given, the plan is made while the broker is listed a page at a
+			// time, and its deletions start as soon as they are planned.
+			targets := planBrokerCleanup(ctx, client, brokerURL, filter)
+			if brokersFlags.planFile != "" {
+				if !filter.empty() {
+					log.Fatalf("--plan-file can't be used with --service, --plan, --older-than, --id-regex or --exclude")
+				}
+				plan, err := loadCleanupPlan(brokersFlags.planFile, brokerURL)
+				if err != nil {
+					log.Fatalf("Failed to plan the cleanup of broker %q: %v\n", brokerURL, err)
+				}
+				planned, _ := plan.targets()
+				targets = sliceTargets(planned)
+			}
+			if brokersFlags.dryRun {
+				if err := printCleanupPlan(brokerURL, targets); err != nil {
+					log.Fatalf("Failed to plan the cleanup of broker %q: %v\n", brokerURL, err)
+				}
+				return
+			}
+
+			report, err := cleanupBroker(ctx, client, brokerURL, targets)
+			if err != nil {
+				if err.Error() == userCancelledBrokerCleanup {
+					fmt.Println(userCancelledBrokerCleanup)
+					return
+				}
+				log.Fatalf("Failed to cleanup broker %q: %v\n", brokerURL, err)
 			}
+			printCleanupReport(ctx, client, report)
+			if !report.complete() {
+				log.Fatalf("Failed to cleanup broker %q in project %q", brokersFlags.broker, brokersFlags.project)
+			}
+			infof("Successfully cleaned up broker %q in project %q!!\n", brokersFlags.broker, brokersFlags.project)
 		},
 	}
 
@@ -126,22 +213,30 @@ var (
 		Long:  "List service brokers in a project",
 		Run: func(cmd *cobra.Command, args []string) {
 			flags.CheckFlags(&brokersFlags.project)
+			checkGCPAdminFlags("Listing brokers")
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			http := httpAdapterFromFlag()
-			res, err := http.ListBrokers(&adapter.ListBrokersParams{
+			res, err := http.ListBrokers(ctx, &adapter.ListBrokersParams{
 				Host:    brokersFlags.host,
 				Project: brokersFlags.project})
 			if err != nil {
 				log.Fatalf("Failed to list brokers in project %q: %v\n", brokersFlags.project, err)
 			}
 
-			if len(res.Brokers) == 0 {
-				fmt.Printf("Project %q has no associated brokers\n", brokersFlags.project)
-				return
+			if res.Brokers == nil {
+				res.Brokers = []osb.Broker{}
 			}
+			printResult(res, brokersTable(res), func() {
+				if len(res.Brokers) == 0 {
+					fmt.Printf("Project %q has no associated brokers\n", brokersFlags.project)
+					return
+				}
 
-			fmt.Printf("Successfully listed brokers in project %q!!\n\n", brokersFlags.project)
-			printListBrokers(res)
+				fmt.Printf("Successfully listed brokers in project %q!!\n\n", brokersFlags.project)
+				printListBrokers(res)
+			})
 		},
 	}
 )
@@ -171,66 +266,645 @@ func init() {
 	flags.BoolFlag(brokersCleanupCmd.PersistentFlags(), &brokersFlags.force, "force", "f",
 		"[Optional] If specified, the tool will forcefully delete broker contents without user approval (Default: FALSE)")
 
+	cleanupFlags := brokersCleanupCmd.PersistentFlags()
+	flags.StringArrayFlag(cleanupFlags, &brokersFlags.services, "service", "",
+		"[Optional] Only delete the instances of the service with this ID or name. Can be repeated.")
+	flags.StringArrayFlag(cleanupFlags, &brokersFlags.plans, "plan", "",
+		"[Optional] Only delete the instances of the plan with this ID or name. Can be repeated.")
+	flags.DurationFlag(cleanupFlags, &brokersFlags.olderThan, "older-than", "", 0,
+		"[Optional] Only delete the instances created at least this long ago, e.g. 72h. Instances without a create time are kept.")
+	flags.StringFlag(cleanupFlags, &brokersFlags.idRegex, "id-regex", "",
+		"[Optional] Only delete the instances whose ID matches this regular expression.")
+	flags.StringArrayFlag(cleanupFlags, &brokersFlags.exclude, "exclude", "",
+		"[Optional] Keep the instances whose ID matches this regular expression. Can be repeated.")
+	flags.BoolFlag(cleanupFlags, &brokersFlags.dryRun, "dry-run", "",
+		"[Optional] If specified, the deletions are printed in the order they would be made instead of being made. (Default: FALSE)")
+	flags.StringFlag(cleanupFlags, &brokersFlags.planFile, "plan-file", "",
+		"[Optional] File with a plan printed by --dry-run with --output json or yaml, or - for stdin, whose deletions are made instead of listing the broker.")
+
+	// Flags for brokers cleanup and brokers delete --cleanup.
+	for _, cmd := range []*cobra.Command{brokersCleanupCmd, brokersDeleteCmd} {
+		flags.IntFlag(cmd.PersistentFlags(), &brokersFlags.parallelism, "parallelism", "", 4,
+			"[Optional] Maximum number of instances which are deleted at the same time, each after its bindings.")
+		flags.IntFlag(cmd.PersistentFlags(), &brokersFlags.retries, "retries", "", 2,
+			"[Optional] Number of times the deletion of a binding or instance is retried after its operation fails or the broker returns a 5xx code which --max-retries doesn't retry. The cleanup continues with the other resources regardless.")
+		flags.IntFlag(cmd.PersistentFlags(), &brokersFlags.pageSize, "page-size", "", 0,
+			pageSizeUsage)
+	}
+
 	RootCmd.AddCommand(brokersCmd)
 	brokersCmd.AddCommand(brokersCreateCmd, brokersDeleteCmd, brokersCleanupCmd, brokersListCmd)
 }
 
-func cleanupBroker(client adapter.Adapter, brokerURL string) (ret error) {
-	defer func() {
-		if ret != nil && ret.Error() != userCancelledBrokerCleanup {
-			log.Printf("Failed to cleanup broker %q: %v\n", brokerURL, ret)
-			if lir, err := listInstances(client, brokerURL); err == nil {
-				log.Println("The below resources are yet to be cleaned up!!")
-				printListInstances(client, lir, brokerURL)
-			}
-		}
-	}()
+// checkCleanupFlags exits if the flags of the cleanup workers are invalid.
+func checkCleanupFlags() {
+	if brokersFlags.parallelism < 1 {
+		log.Fatalf("--parallelism must be at least 1, got %d", brokersFlags.parallelism)
+	}
+}
 
-	showProgress := brokersFlags.verbose
-	lir, err := listInstances(client, brokerURL)
-	if err != nil {
-		return err
+// cleanupResult is the outcome of the deletion of a binding or an instance by a broker cleanup.
+type cleanupResult struct {
+	InstanceID string `json:"instance_id"`
+	// BindingID is empty if the result is for the instance.
+	BindingID string `json:"binding_id,omitempty"`
+	// Attempts is the number of deletion requests, 0 if the deletion wasn't attempted.
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// cleanupReport is the output of a broker cleanup.
+type cleanupReport struct {
+	BrokerURL string           `json:"broker_url"`
+	Deleted   []*cleanupResult `json:"deleted"`
+	Failed    []*cleanupResult `json:"failed"`
+	// Remaining are the instances left in the broker after the cleanup.
+	Remaining []*instance `json:"remaining"`
+	// RemainingError is set if the instances left in the broker couldn't be listed.
+	RemainingError string `json:"remaining_error,omitempty"`
+	// Stopped is the reason the cleanup stopped before every selected instance was deleted, e.g. the
+	// failure to list the broker or an interruption.
+	Stopped string `json:"stopped,omitempty"`
+
+	mu sync.Mutex
+}
+
+// complete returns whether the cleanup deleted everything it was meant to.
+func (r *cleanupReport) complete() bool {
+	return len(r.Failed) == 0 && len(r.Remaining) == 0 && r.RemainingError == "" && r.Stopped == ""
+}
+
+// add adds the result to the report. It is safe for concurrent use.
+func (r *cleanupReport) add(res *cleanupResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if res.Error == "" {
+		r.Deleted = append(r.Deleted, res)
+	} else {
+		r.Failed = append(r.Failed, res)
+	}
+	if brokersFlags.verbose {
+		if res.Error == "" {
+			infof("Deleted %s\n", describeCleanupResult(res))
+		} else {
+			infof("Failed to delete %s: %s\n", describeCleanupResult(res), res.Error)
+		}
 	}
+}
 
-	if len(lir.instances) == 0 {
-		fmt.Println("There are no service instances associated with the broker")
-		return nil
+// cleanupBroker makes the deletions of the targets, with the bindings and instance of up to
+// brokersFlags.parallelism instances being deleted at a time. The targets are deleted as they
+// arrive, unless the user is asked to confirm them first. Failed deletions are retried
+// brokersFlags.retries times, see deleteWithRetries. The deletion of an instance is only skipped if
+// some of its bindings couldn't be deleted. Once ctx is done, no more instances are started, and
+// the report says why the cleanup stopped, as it does if listing the targets fails. An error is
+// returned if the cleanup didn't start; failed deletions are listed in the report instead.
+func cleanupBroker(ctx context.Context, client adapter.Adapter, brokerURL string, targets cleanupTargets) (*cleanupReport, error) {
+	if brokersFlags.parallelism < 1 {
+		return nil, fmt.Errorf("the parallelism must be at least 1, got %d", brokersFlags.parallelism)
 	}
+	report := &cleanupReport{BrokerURL: brokerURL, Deleted: []*cleanupResult{}, Failed: []*cleanupResult{}, Remaining: []*instance{}}
 
 	if !brokersFlags.force {
-		fmt.Printf("The following service instances in broker %q will be deleted\n", brokerURL)
-		printListInstances(client, lir, brokerURL)
+		// The user confirms the whole plan, so it is made before anything is deleted.
+		var planned []*cleanupTarget
+		if err := targets(func(t *cleanupTarget) error {
+			planned = append(planned, t)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		if len(planned) == 0 {
+			return report, nil
+		}
+		fmt.Printf("The following bindings and service instances in broker %q will be deleted\n", brokerURL)
+		n := 0
+		for _, t := range planned {
+			for _, step := range t.steps() {
+				n++
+				printCleanupStep(n, step)
+			}
+		}
 		fmt.Printf("Enter y/Y to continue or anything else to quit\n")
 		response := ""
 		fmt.Scanf("%s\n", &response)
 		if !(response == "y" || response == "Y") {
-			return fmt.Errorf(userCancelledBrokerCleanup)
+			return nil, fmt.Errorf(userCancelledBrokerCleanup)
+		}
+		targets = sliceTargets(planned)
+	}
+
+	work := make(chan *cleanupTarget)
+	var wg sync.WaitGroup
+	for w := 0; w < brokersFlags.parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range work {
+				cleanupInstance(ctx, client, brokerURL, t, report)
+			}
+		}()
+	}
+	// The targets are kept to check which of them remain, without the rest of the broker's listing.
+	started := make(map[string]*cleanupTarget)
+	err := targets(func(t *cleanupTarget) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		started[t.instance.ID] = t
+		work <- t
+		return nil
+	})
+	close(work)
+	wg.Wait()
+	if err != nil {
+		report.Stopped = err.Error()
+	}
+	if len(started) == 0 {
+		return report, nil
+	}
+
+	sortCleanupResults(report.Deleted)
+	sortCleanupResults(report.Failed)
+	// The context may be done, e.g. if the user interrupted the cleanup.
+	listCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	remaining, err := remainingInstances(listCtx, client, brokerURL, started)
+	if err != nil {
+		report.RemainingError = err.Error()
+		return report, nil
+	}
+	report.Remaining = remaining
+	return report, nil
+}
+
+// cleanupInstance deletes the bindings of the target, and then its instance if planned unless some
+// of the bindings couldn't be deleted.
+func cleanupInstance(ctx context.Context, client adapter.Adapter, brokerURL string, t *cleanupTarget, report *cleanupReport) {
+	i := t.instance
+	failed := 0
+	for _, b := range i.Bindings {
+		res := &cleanupResult{InstanceID: i.ID, BindingID: b}
+		deleteWithRetries(ctx, res, func() error {
+			return deleteBinding(ctx, client, flags.ApiVersionDefault, brokerURL, i, b, brokersFlags.verbose)
+		})
+		report.add(res)
+		if res.Error != "" {
+			failed++
+		}
+	}
+	if !t.deleteInstance {
+		return
+	}
+
+	res := &cleanupResult{InstanceID: i.ID}
+	if failed > 0 {
+		res.Error = fmt.Sprintf("not deleted since %d of its %d bindings couldn't be deleted", failed, len(i.Bindings))
+	} else {
+		deleteWithRetries(ctx, res, func() error {
+			return deleteInstance(ctx, client, flags.ApiVersionDefault, brokerURL, i, brokersFlags.verbose)
+		})
+	}
+	report.add(res)
+}
+
+// deleteWithRetries calls del until it succeeds, it failed brokersFlags.retries + 1 times or ctx is
+// done, and records the attempts and the last error in res. Only the failures which aren't retried
+// by the requests themselves are retried, see retryDeletion.
+func deleteWithRetries(ctx context.Context, res *cleanupResult, del func() error) {
+	delay := time.Second
+	for {
+		res.Attempts++
+		err := del()
+		if err == nil {
+			res.Error = ""
+			return
+		}
+		res.Error = err.Error()
+		if res.Attempts > brokersFlags.retries || ctx.Err() != nil || !retryDeletion(err) {
+			return
+		}
+		if brokersFlags.verbose {
+			infof("Retrying the deletion of %s in %v: %v\n", describeCleanupResult(res), delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// retryDeletion returns whether a failed deletion is worth retrying as a whole. The layers below
+// already retry the transient failures: the DoClient retries network errors and the 429, 502, 503
+// and 504 codes, retryOnConcurrencyError retries ConcurrencyError, and waitOnOperation waits as long
+// as the plan allows. Other 4xx codes won't change when retried. What remains are operations which
+// failed and the other 5xx codes.
+func retryDeletion(err error) bool {
+	var opErr *operationFailedError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var brokerErr *adapter.BrokerError
+	if !errors.As(err, &brokerErr) {
+		return false
+	}
+	switch brokerErr.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return false
+	default:
+		return brokerErr.StatusCode >= http.StatusInternalServerError
+	}
+}
+
+// sortCleanupResults sorts the results by instance, with the bindings of an instance before it.
+func sortCleanupResults(results []*cleanupResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.InstanceID != b.InstanceID {
+			return a.InstanceID < b.InstanceID
+		}
+		if a.BindingID == "" || b.BindingID == "" {
+			return b.BindingID == "" && a.BindingID != ""
+		}
+		return a.BindingID < b.BindingID
+	})
+}
+
+// describeCleanupResult returns the resource of the result for messages, e.g. `binding "b" of
+// instance "i"`.
+func describeCleanupResult(res *cleanupResult) string {
+	if res.BindingID != "" {
+		return fmt.Sprintf("binding %q of instance %q", res.BindingID, res.InstanceID)
+	}
+	return fmt.Sprintf("instance %q", res.InstanceID)
+}
+
+// cleanupTable returns the table printed for --output=table, with a row per deleted, failed or
+// remaining resource.
+func cleanupTable(report *cleanupReport) *output.Table {
+	table := &output.Table{Columns: []string{"status", "instance id", "binding id", "attempts", "error"}}
+	for _, res := range report.Deleted {
+		table.Rows = append(table.Rows, []string{"deleted", res.InstanceID, res.BindingID, fmt.Sprint(res.Attempts), ""})
+	}
+	for _, res := range report.Failed {
+		table.Rows = append(table.Rows, []string{"failed", res.InstanceID, res.BindingID, fmt.Sprint(res.Attempts), strings.Join(strings.Fields(res.Error), " ")})
+	}
+	for _, i := range report.Remaining {
+		for _, b := range i.Bindings {
+			table.Rows = append(table.Rows, []string{"remaining", i.ID, b, "", ""})
+		}
+		table.Rows = append(table.Rows, []string{"remaining", i.ID, "", "", ""})
+	}
+	return table
+}
+
+// printCleanupReport prints the report of a broker cleanup in the output format.
+func printCleanupReport(ctx context.Context, client adapter.Adapter, report *cleanupReport) {
+	printResult(report, cleanupTable(report), func() {
+		if len(report.Deleted) == 0 && len(report.Failed) == 0 && report.complete() {
+			fmt.Println("There are no service instances to delete in the broker")
+			return
+		}
+		bindings, instances := 0, 0
+		for _, res := range report.Deleted {
+			if res.BindingID != "" {
+				bindings++
+			} else {
+				instances++
+			}
+		}
+		fmt.Printf("Deleted %d bindings and %d instances in broker %q\n", bindings, instances, report.BrokerURL)
+		if len(report.Failed) > 0 {
+			fmt.Printf("Failed to delete %d resources:\n", len(report.Failed))
+			for _, res := range report.Failed {
+				fmt.Printf("   %s (%d attempts): %s\n", describeCleanupResult(res), res.Attempts, res.Error)
+			}
+		}
+		if report.Stopped != "" {
+			fmt.Printf("The cleanup stopped before deleting every selected instance: %s\n", report.Stopped)
+		}
+		switch {
+		case report.RemainingError != "":
+			fmt.Printf("Couldn't list the resources remaining in the broker: %s\n", report.RemainingError)
+		case len(report.Remaining) > 0:
+			fmt.Println("The below resources are yet to be cleaned up!!")
+			printListInstances(ctx, client, &listInstancesResult{Instances: report.Remaining}, flags.ApiVersionDefault, report.BrokerURL)
+		}
+	})
+}
+
+// cleanupFilter selects the instances deleted by brokers cleanup. An instance is selected if it
+// matches every given criterion.
+type cleanupFilter struct {
+	services  []string
+	plans     []string
+	olderThan time.Duration
+	idRegex   *regexp.Regexp
+	exclude   []*regexp.Regexp
+}
+
+// cleanupFilterFromFlags returns the filter given by the brokers cleanup flags.
+func cleanupFilterFromFlags() (*cleanupFilter, error) {
+	f := &cleanupFilter{services: brokersFlags.services, plans: brokersFlags.plans, olderThan: brokersFlags.olderThan}
+	if brokersFlags.idRegex != "" {
+		re, err := regexp.Compile(brokersFlags.idRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --id-regex: %v", err)
+		}
+		f.idRegex = re
+	}
+	for _, expr := range brokersFlags.exclude {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --exclude: %v", err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+// empty returns whether the filter selects all instances.
+func (f *cleanupFilter) empty() bool {
+	return len(f.services) == 0 && len(f.plans) == 0 && f.olderThan <= 0 && f.idRegex == nil && len(f.exclude) == 0
+}
+
+// match returns whether the filter selects the instance. Services and plans match by ID or by the
+// names set by resolveInstanceNames.
+func (f *cleanupFilter) match(i *instance, now time.Time) bool {
+	if len(f.services) > 0 && !containsAny(f.services, i.ServiceID, i.ServiceName) {
+		return false
+	}
+	if len(f.plans) > 0 && !containsAny(f.plans, i.PlanID, i.PlanName) {
+		return false
+	}
+	if f.olderThan > 0 {
+		created, err := time.Parse(time.RFC3339, i.CreateTime)
+		if err != nil || now.Sub(created) < f.olderThan {
+			return false
+		}
+	}
+	if f.idRegex != nil && !f.idRegex.MatchString(i.ID) {
+		return false
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(i.ID) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAny returns whether any of the non-empty values is in list.
+func containsAny(list []string, values ...string) bool {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		for _, l := range list {
+			if l == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cleanupStep is the deletion of a binding or an instance by brokers cleanup.
+type cleanupStep struct {
+	InstanceID string `json:"instance_id"`
+	// BindingID is empty if the step deletes the instance.
+	BindingID string `json:"binding_id,omitempty"`
+	ServiceID string `json:"service_id"`
+	PlanID    string `json:"plan_id"`
+}
+
+// cleanupPlan are the deletions made by brokers cleanup, in the order they are made: the bindings of
+// an instance before the instance.
+type cleanupPlan struct {
+	BrokerURL string         `json:"broker_url"`
+	Steps     []*cleanupStep `json:"steps"`
+}
+
+// cleanupTarget is an instance with the bindings deleted by a cleanup plan, and whether the
+// instance itself is deleted after them.
+type cleanupTarget struct {
+	instance       *instance
+	deleteInstance bool
+}
+
+// remains returns whether any resource of the target is still in the listed instance.
+func (t *cleanupTarget) remains(i *instance) bool {
+	if t.deleteInstance {
+		return true
+	}
+	for _, b := range t.instance.Bindings {
+		if containsAny(i.Bindings, b) {
+			return true
 		}
 	}
+	return false
+}
+
+// cleanupTargets calls fn with every target of a cleanup, in the order of the plan, and stops at
+// the first error of fn.
+type cleanupTargets func(fn func(t *cleanupTarget) error) error
 
-	errorMap := make(map[string]error)
-	for _, i := range lir.instances {
-		for _, b := range i.bindings {
-			if err := deleteBinding(client, flags.ApiVersionDefault, brokerURL, i, b, showProgress); err != nil {
-				errorMap[i.ID] = err
-				break
+// sliceTargets returns the cleanupTargets of targets held in memory, e.g. of a plan file.
+func sliceTargets(targets []*cleanupTarget) cleanupTargets {
+	return func(fn func(t *cleanupTarget) error) error {
+		for _, t := range targets {
+			if err := fn(t); err != nil {
+				return err
 			}
 		}
+		return nil
+	}
+}
+
+// planBrokerCleanup returns the targets deleting the instances of the broker selected by the
+// filter, along with all their bindings. The instances are listed a page at a time while the
+// targets are passed on, and only the bindings of the selected ones are listed.
+func planBrokerCleanup(ctx context.Context, client adapter.Adapter, brokerURL string, filter *cleanupFilter) cleanupTargets {
+	return func(fn func(t *cleanupTarget) error) error {
+		now := time.Now()
+		it := adapter.NewInstanceIterator(ctx, client, &adapter.ListInstancesParams{Server: brokerURL, PageSize: brokersFlags.pageSize})
+		for {
+			osbInstance, err := it.Next()
+			if err == adapter.IteratorDone {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			i := instanceFromOSB(osbInstance)
+			if len(filter.services) > 0 || len(filter.plans) > 0 {
+				resolveInstanceNames(ctx, client, &listInstancesResult{Instances: []*instance{i}}, flags.ApiVersionDefault, brokerURL)
+			}
+			if !filter.match(i, now) {
+				continue
+			}
 
-		if _, ok := errorMap[i.ID]; !ok {
-			if err := deleteInstance(client, flags.ApiVersionDefault, brokerURL, i, showProgress); err != nil {
-				errorMap[i.ID] = err
+			if i.Bindings, err = listBindingIDs(ctx, client, brokerURL, i.ID, brokersFlags.pageSize); err != nil {
+				return err
+			}
+			if err := fn(&cleanupTarget{instance: i, deleteInstance: true}); err != nil {
+				return err
 			}
 		}
 	}
+}
+
+// remainingInstances returns the instances of the targets, keyed by ID, which remain in the broker,
+// along with their bindings. The instances of the broker are streamed a page at a time.
+func remainingInstances(ctx context.Context, client adapter.Adapter, brokerURL string, targets map[string]*cleanupTarget) ([]*instance, error) {
+	remaining := []*instance{}
+	it := adapter.NewInstanceIterator(ctx, client, &adapter.ListInstancesParams{Server: brokerURL, PageSize: brokersFlags.pageSize})
+	for {
+		osbInstance, err := it.Next()
+		if err == adapter.IteratorDone {
+			return remaining, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := targets[osbInstance.ID]
+		if t == nil {
+			continue
+		}
+
+		i := instanceFromOSB(osbInstance)
+		if i.Bindings, err = listBindingIDs(ctx, client, brokerURL, i.ID, brokersFlags.pageSize); err != nil {
+			return nil, err
+		}
+		if t.remains(i) {
+			remaining = append(remaining, i)
+		}
+	}
+}
+
+// loadCleanupPlan reads a plan printed by brokers cleanup --dry-run in JSON or YAML from path, or
+// from stdin if path is "-", and checks that it is for the broker and valid.
+func loadCleanupPlan(path, brokerURL string) (*cleanupPlan, error) {
+	obj, err := readObjectFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan: %v", err)
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan: %v", err)
+	}
+	plan := &cleanupPlan{}
+	if err := json.Unmarshal(b, plan); err != nil {
+		return nil, fmt.Errorf("error parsing plan %s: %v", path, err)
+	}
+	if plan.BrokerURL != brokerURL {
+		return nil, fmt.Errorf("plan %s is for broker %q, not %q", path, plan.BrokerURL, brokerURL)
+	}
+	if _, err := plan.targets(); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %v", path, err)
+	}
+	return plan, nil
+}
+
+// targets groups the steps of the plan by instance, in the order of the plan. An error is returned
+// if a step is repeated, lacks IDs, or deletes a binding after its instance.
+func (p *cleanupPlan) targets() ([]*cleanupTarget, error) {
+	var targets []*cleanupTarget
+	byID := make(map[string]*cleanupTarget)
+	for n, step := range p.Steps {
+		if step == nil || step.InstanceID == "" || step.ServiceID == "" || step.PlanID == "" {
+			return nil, fmt.Errorf("step %d needs an instance_id, service_id and plan_id", n+1)
+		}
+		t := byID[step.InstanceID]
+		if t == nil {
+			t = &cleanupTarget{instance: &instance{ID: step.InstanceID, ServiceID: step.ServiceID, PlanID: step.PlanID}}
+			byID[step.InstanceID] = t
+			targets = append(targets, t)
+		}
+		switch {
+		case t.deleteInstance:
+			return nil, fmt.Errorf("step %d is after the deletion of instance %q", n+1, step.InstanceID)
+		case step.BindingID == "":
+			t.deleteInstance = true
+		case containsAny(t.instance.Bindings, step.BindingID):
+			return nil, fmt.Errorf("step %d deletes binding %q of instance %q again", n+1, step.BindingID, step.InstanceID)
+		default:
+			t.instance.Bindings = append(t.instance.Bindings, step.BindingID)
+		}
+	}
+	return targets, nil
+}
+
+// steps returns the steps of the plan which delete the target.
+func (t *cleanupTarget) steps() []*cleanupStep {
+	i := t.instance
+	var steps []*cleanupStep
+	for _, b := range i.Bindings {
+		steps = append(steps, &cleanupStep{InstanceID: i.ID, BindingID: b, ServiceID: i.ServiceID, PlanID: i.PlanID})
+	}
+	if t.deleteInstance {
+		steps = append(steps, &cleanupStep{InstanceID: i.ID, ServiceID: i.ServiceID, PlanID: i.PlanID})
+	}
+	return steps
+}
 
-	if len(errorMap) > 0 {
-		return fmt.Errorf("failed to cleanup service instances in broker with error %v", errorMap)
+// printCleanupPlan prints the plan of brokers cleanup --dry-run in the output format, a step at a
+// time as the targets are planned, see output.ListStream.
+func printCleanupPlan(brokerURL string, targets cleanupTargets) error {
+	var stream *output.ListStream
+	if printer.Format() != output.FormatText {
+		columns := []string{"step", "instance id", "binding id", "service id", "plan id"}
+		n := 0
+		stream = printer.NewListStream(os.Stdout, map[string]interface{}{"broker_url": brokerURL}, "steps", columns, func(item interface{}) []string {
+			step := item.(*cleanupStep)
+			n++
+			return []string{fmt.Sprint(n), step.InstanceID, step.BindingID, step.ServiceID, step.PlanID}
+		})
 	}
 
+	n := 0
+	err := targets(func(t *cleanupTarget) error {
+		for _, step := range t.steps() {
+			n++
+			if stream != nil {
+				if err := stream.Add(step); err != nil {
+					return err
+				}
+				continue
+			}
+			if n == 1 {
+				fmt.Printf("The following bindings and service instances in broker %q would be deleted, in this order\n", brokerURL)
+			}
+			printCleanupStep(n, step)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if stream != nil {
+		return stream.Close(nil)
+	}
+	if n == 0 {
+		fmt.Printf("No service instances in broker %q would be deleted\n", brokerURL)
+	}
 	return nil
 }
 
+// printCleanupStep prints the step as the given item of a numbered list.
+func printCleanupStep(number int, step *cleanupStep) {
+	if step.BindingID != "" {
+		fmt.Printf("%d. Delete binding %q of instance %q\n", number, step.BindingID, step.InstanceID)
+	} else {
+		fmt.Printf("%d. Delete instance %q (Service: %s, Plan: %s)\n", number, step.InstanceID, step.ServiceID, step.PlanID)
+	}
+}
+
 func printListBrokers(result *adapter.ListBrokersResult) {
 	for index, b := range result.Brokers {
 		fmt.Printf("%d. %s\n", index+1, b.Name)
@@ -238,3 +912,12 @@ func printListBrokers(result *adapter.ListBrokersResult) {
 		fmt.Printf("   Create time: %s\n\n", *b.CreateTime)
 	}
 }
+
+// brokersTable returns the table printed for --output=table.
+func brokersTable(result *adapter.ListBrokersResult) *output.Table {
+	table := &output.Table{Columns: []string{"name", "title", "url", "create time"}}
+	for _, b := range result.Brokers {
+		table.Rows = append(table.Rows, []string{b.Name, b.Title, stringValue(b.URL), stringValue(b.CreateTime)})
+	}
+	return table
+}
@@ -0,0 +1,582 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/yaml"
+)
+
+const testBrokerURL = "https://broker"
+
+// cleanupAdapter is a fake broker holding instances and their bindings, which deletes them
+// synchronously. Only the methods used by brokers cleanup are implemented.
+type cleanupAdapter struct {
+	adapter.Adapter
+
+	mu sync.Mutex
+	// instances maps the IDs of the instances to the IDs of their bindings.
+	instances map[string][]string
+	// deletes counts the deletions of every resource, keyed by "instance" or "instance/binding".
+	deletes map[string]int
+	// active is the number of deletions in progress, and maxActive its maximum.
+	active    int
+	maxActive int
+	// fail returns the error of a deletion of the resource, or nil if it succeeds.
+	fail func(resource string, attempt int) error
+	// onDelete is called at the start of every deletion if set.
+	onDelete func(resource string)
+	// listErr returns the error of listing the page of instances after the token, or nil.
+	listErr func(pageToken string) error
+}
+
+// newCleanupAdapter returns a cleanupAdapter with n instances i0, i1... which have the given
+// bindings each.
+func newCleanupAdapter(n int, bindings ...string) *cleanupAdapter {
+	a := &cleanupAdapter{instances: make(map[string][]string), deletes: make(map[string]int)}
+	for i := 0; i < n; i++ {
+		a.instances[fmt.Sprintf("i%d", i)] = append([]string(nil), bindings...)
+	}
+	return a
+}
+
+func (a *cleanupAdapter) ListInstances(ctx context.Context, params *adapter.ListInstancesParams) (*adapter.ListInstancesResult, error) {
+	if a.listErr != nil {
+		if err := a.listErr(params.PageToken); err != nil {
+			return nil, err
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Pages are sorted by ID and start after the token, the last ID of the previous page, as in the
+	// fake broker.
+	var ids []string
+	for id := range a.instances {
+		if id > params.PageToken {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	res := &adapter.ListInstancesResult{}
+	if params.PageSize > 0 && len(ids) > params.PageSize {
+		ids = ids[:params.PageSize]
+		res.NextPageToken = ids[len(ids)-1]
+	}
+	for _, id := range ids {
+		res.Instances = append(res.Instances, &osb.Instance{ID: id, ServiceID: "s", PlanID: "p"})
+	}
+	return res, nil
+}
+
+func (a *cleanupAdapter) ListBindings(ctx context.Context, params *adapter.ListBindingsParams) (*adapter.ListBindingsResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	res := &adapter.ListBindingsResult{}
+	for _, b := range a.instances[params.InstanceID] {
+		res.Bindings = append(res.Bindings, &osb.Binding{ID: b})
+	}
+	return res, nil
+}
+
+func (a *cleanupAdapter) DeleteInstance(ctx context.Context, params *adapter.DeleteInstanceParams) (*adapter.DeleteInstanceResult, error) {
+	if err := a.delete(params.InstanceID, ""); err != nil {
+		return nil, err
+	}
+	return &adapter.DeleteInstanceResult{}, nil
+}
+
+func (a *cleanupAdapter) DeleteBinding(ctx context.Context, params *adapter.DeleteBindingParams) (*adapter.DeleteBindingResult, error) {
+	if err := a.delete(params.InstanceID, params.BindingID); err != nil {
+		return nil, err
+	}
+	return &adapter.DeleteBindingResult{}, nil
+}
+
+// delete deletes the instance, or its binding if bindingID isn't empty. Missing resources are
+// deleted successfully, as the adapter does when the broker answers 410 Gone.
+func (a *cleanupAdapter) delete(instanceID, bindingID string) error {
+	resource := instanceID
+	if bindingID != "" {
+		resource += "/" + bindingID
+	}
+	if a.onDelete != nil {
+		a.onDelete(resource)
+	}
+
+	a.mu.Lock()
+	a.deletes[resource]++
+	attempt := a.deletes[resource]
+	a.active++
+	if a.active > a.maxActive {
+		a.maxActive = a.active
+	}
+	a.mu.Unlock()
+
+	// Give the other workers a chance to overlap.
+	time.Sleep(5 * time.Millisecond)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.active--
+	if a.fail != nil {
+		if err := a.fail(resource, attempt); err != nil {
+			return err
+		}
+	}
+	if bindingID == "" {
+		delete(a.instances, instanceID)
+		return nil
+	}
+	var bindings []string
+	for _, b := range a.instances[instanceID] {
+		if b != bindingID {
+			bindings = append(bindings, b)
+		}
+	}
+	a.instances[instanceID] = bindings
+	return nil
+}
+
+// setupCleanupTest sets the flags used by brokers cleanup for the test, and restores them once the
+// test finishes.
+func setupCleanupTest(t *testing.T, parallelism, retries int) {
+	savedFlags, savedInventory, savedIdentity := brokersFlags, inventoryFlag, originatingIdentityFlag
+	t.Cleanup(func() {
+		brokersFlags, inventoryFlag, originatingIdentityFlag = savedFlags, savedInventory, savedIdentity
+		originatingIdentityOnce, originatingIdentity = sync.Once{}, nil
+	})
+	brokersFlags.force, brokersFlags.verbose = true, false
+	brokersFlags.parallelism, brokersFlags.retries = parallelism, retries
+	// The instances are listed a few at a time, so that they are deleted while being listed.
+	brokersFlags.pageSize = 3
+	inventoryFlag, originatingIdentityFlag = "", `{"username": "test"}`
+	originatingIdentityOnce, originatingIdentity = sync.Once{}, nil
+}
+
+func TestCleanupBrokerDeletesEverythingOnce(t *testing.T) {
+	setupCleanupTest(t, 4, 2)
+	client := newCleanupAdapter(20, "b0", "b1")
+	ctx := context.Background()
+
+	report, err := cleanupBroker(ctx, client, testBrokerURL, planBrokerCleanup(ctx, client, testBrokerURL, &cleanupFilter{}))
+	if err != nil {
+		t.Fatalf("Unexpected error from cleanupBroker: %v", err)
+	}
+
+	if len(client.deletes) != 60 {
+		t.Errorf("cleanupBroker deleted %d resources, want 60", len(client.deletes))
+	}
+	for resource, n := range client.deletes {
+		if n != 1 {
+			t.Errorf("cleanupBroker deleted %s %d times, want once", resource, n)
+		}
+	}
+	if client.maxActive < 2 || client.maxActive > 4 {
+		t.Errorf("cleanupBroker made up to %d deletions at a time, want between 2 and the parallelism of 4", client.maxActive)
+	}
+	if len(report.Deleted) != 60 || len(report.Failed) != 0 || len(report.Remaining) != 0 || report.RemainingError != "" {
+		t.Errorf("cleanupBroker reported %d deleted, %d failed and %d remaining (%q), want 60 deleted",
+			len(report.Deleted), len(report.Failed), len(report.Remaining), report.RemainingError)
+	}
+	// Every instance is reported after its bindings.
+	for n, res := range report.Deleted {
+		instance := report.Deleted[n-n%3].InstanceID
+		if res.InstanceID != instance || (res.BindingID == "") != (n%3 == 2) {
+			t.Fatalf("Result %d of the report is %+v, want the bindings of instance %s before it", n, res, instance)
+		}
+	}
+}
+
+func TestCleanupBrokerStopsOnCancellation(t *testing.T) {
+	setupCleanupTest(t, 2, 2)
+	client := newCleanupAdapter(20)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.onDelete = func(resource string) { cancel() }
+
+	report, err := cleanupBroker(ctx, client, testBrokerURL, planBrokerCleanup(ctx, client, testBrokerURL, &cleanupFilter{}))
+	if err != nil {
+		t.Fatalf("Unexpected error from cleanupBroker: %v", err)
+	}
+
+	// The workers finish the instances they started, and at most one more instance is handed over
+	// while the cancellation races with the dispatch.
+	if deleted := len(client.deletes); deleted == 0 || deleted > 3 {
+		t.Errorf("cleanupBroker deleted %d instances after the cancellation, want between 1 and 3", deleted)
+	}
+	if len(report.Deleted) != len(client.deletes) || report.Stopped != context.Canceled.Error() || report.complete() {
+		t.Errorf("cleanupBroker reported %d deleted instances and stopped %q, want %d deleted and stopped %q",
+			len(report.Deleted), report.Stopped, len(client.deletes), context.Canceled)
+	}
+}
+
+func TestCleanupBrokerListingFails(t *testing.T) {
+	setupCleanupTest(t, 2, 2)
+	client := newCleanupAdapter(10, "b0")
+	// The first page, of i0, i1 and i10, is deleted before listing the second page fails.
+	client.listErr = func(pageToken string) error {
+		if pageToken != "" {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}
+	ctx := context.Background()
+
+	report, err := cleanupBroker(ctx, client, testBrokerURL, planBrokerCleanup(ctx, client, testBrokerURL, &cleanupFilter{}))
+	if err != nil {
+		t.Fatalf("Unexpected error from cleanupBroker: %v", err)
+	}
+
+	if len(client.deletes) != 6 || len(report.Deleted) != 6 {
+		t.Errorf("cleanupBroker deleted %v and reported %d deletions, want the 3 instances of the first page and their bindings",
+			client.deletes, len(report.Deleted))
+	}
+	if report.Stopped != "broker unavailable" || report.complete() {
+		t.Errorf("cleanupBroker reported stopping with %q, want the listing error", report.Stopped)
+	}
+}
+
+func TestCleanupBrokerRetries(t *testing.T) {
+	setupCleanupTest(t, 2, 1)
+	client := newCleanupAdapter(4, "b0")
+	client.fail = func(resource string, attempt int) error {
+		switch resource {
+		case "i0":
+			// Retried until it succeeds.
+			if attempt == 1 {
+				return &adapter.BrokerError{StatusCode: http.StatusInternalServerError}
+			}
+		case "i1":
+			// Won't change when retried.
+			return &adapter.BrokerError{StatusCode: http.StatusBadRequest}
+		case "i2":
+			// Already retried by the DoClient.
+			return &adapter.BrokerError{StatusCode: http.StatusServiceUnavailable}
+		case "i3/b0":
+			// Keeps the instance from being deleted.
+			return &operationFailedError{msg: "failed"}
+		}
+		return nil
+	}
+	ctx := context.Background()
+
+	report, err := cleanupBroker(ctx, client, testBrokerURL, planBrokerCleanup(ctx, client, testBrokerURL, &cleanupFilter{}))
+	if err != nil {
+		t.Fatalf("Unexpected error from cleanupBroker: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, res := range append(report.Deleted, report.Failed...) {
+		resource := res.InstanceID
+		if res.BindingID != "" {
+			resource += "/" + res.BindingID
+		}
+		status := "deleted"
+		if res.Error != "" {
+			status = "failed"
+		}
+		got[resource] = fmt.Sprintf("%s after %d attempts", status, res.Attempts)
+	}
+	want := map[string]string{
+		"i0/b0": "deleted after 1 attempts",
+		"i0":    "deleted after 2 attempts",
+		"i1/b0": "deleted after 1 attempts",
+		"i1":    "failed after 1 attempts",
+		"i2/b0": "deleted after 1 attempts",
+		"i2":    "failed after 1 attempts",
+		"i3/b0": "failed after 2 attempts",
+		"i3":    "failed after 0 attempts",
+	}
+	for resource, w := range want {
+		if got[resource] != w {
+			t.Errorf("The deletion of %s got %q, want %q", resource, got[resource], w)
+		}
+	}
+	if len(report.Remaining) != 3 {
+		t.Errorf("cleanupBroker reported %d remaining instances, want 3", len(report.Remaining))
+	}
+}
+
+func TestCleanupBrokerInvalidParallelism(t *testing.T) {
+	setupCleanupTest(t, 0, 2)
+	client := newCleanupAdapter(1)
+
+	targets := sliceTargets([]*cleanupTarget{{instance: &instance{ID: "i0", ServiceID: "s", PlanID: "p"}, deleteInstance: true}})
+	if _, err := cleanupBroker(context.Background(), client, testBrokerURL, targets); err == nil {
+		t.Errorf("cleanupBroker with a parallelism of 0 got no error, want one")
+	}
+	if len(client.deletes) != 0 {
+		t.Errorf("cleanupBroker with a parallelism of 0 deleted %v, want nothing", client.deletes)
+	}
+}
+
+func TestCleanupFilterMatch(t *testing.T) {
+	now := time.Date(2018, 6, 10, 12, 0, 0, 0, time.UTC)
+	old := &instance{ID: "test-old", ServiceID: "sql-id", ServiceName: "sql", PlanID: "small-id", PlanName: "small", CreateTime: "2018-06-01T12:00:00Z"}
+	recent := &instance{ID: "test-recent", ServiceID: "sql-id", ServiceName: "sql", PlanID: "large-id", PlanName: "large", CreateTime: "2018-06-10T11:00:00Z"}
+	undated := &instance{ID: "prod-undated", ServiceID: "pubsub-id", PlanID: "small-id"}
+	instances := []*instance{old, recent, undated}
+
+	testCases := []struct {
+		name      string
+		services  []string
+		plans     []string
+		olderThan time.Duration
+		idRegex   string
+		exclude   []string
+		want      []*instance
+	}{
+		{
+			name: "empty filter",
+			want: instances,
+		},
+		{
+			name:     "service by name",
+			services: []string{"sql"},
+			want:     []*instance{old, recent},
+		},
+		{
+			name:     "service by ID",
+			services: []string{"pubsub-id"},
+			want:     []*instance{undated},
+		},
+		{
+			name:  "plans by name or ID",
+			plans: []string{"large", "small-id"},
+			want:  instances,
+		},
+		{
+			name:      "older than keeps undated instances",
+			olderThan: 72 * time.Hour,
+			want:      []*instance{old},
+		},
+		{
+			name:    "ID regex",
+			idRegex: "^test-",
+			want:    []*instance{old, recent},
+		},
+		{
+			name:    "exclude",
+			exclude: []string{"old$", "^prod-"},
+			want:    []*instance{recent},
+		},
+		{
+			name:     "exclude wins over the other criteria",
+			services: []string{"sql"},
+			idRegex:  "^test-",
+			exclude:  []string{"recent"},
+			want:     []*instance{old},
+		},
+		{
+			name:     "every criterion must match",
+			services: []string{"sql"},
+			plans:    []string{"small"},
+			want:     []*instance{old},
+		},
+		{
+			name:     "unknown service",
+			services: []string{"redis"},
+			want:     nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &cleanupFilter{services: tc.services, plans: tc.plans, olderThan: tc.olderThan}
+			if tc.idRegex != "" {
+				f.idRegex = regexp.MustCompile(tc.idRegex)
+			}
+			for _, expr := range tc.exclude {
+				f.exclude = append(f.exclude, regexp.MustCompile(expr))
+			}
+
+			var got []*instance
+			for _, i := range instances {
+				if f.match(i, now) {
+					got = append(got, i)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("cleanupFilter matched %v, want %v", instanceIDs(got), instanceIDs(tc.want))
+			}
+		})
+	}
+}
+
+// instanceIDs returns the IDs of the instances.
+func instanceIDs(instances []*instance) []string {
+	var ids []string
+	for _, i := range instances {
+		ids = append(ids, i.ID)
+	}
+	return ids
+}
+
+func TestCleanupPlanTargets(t *testing.T) {
+	testCases := []struct {
+		name    string
+		steps   []*cleanupStep
+		want    []*cleanupTarget
+		wantErr string
+	}{
+		{
+			name: "bindings before instances",
+			steps: []*cleanupStep{
+				{InstanceID: "i1", BindingID: "b1", ServiceID: "s", PlanID: "p"},
+				{InstanceID: "i1", BindingID: "b2", ServiceID: "s", PlanID: "p"},
+				{InstanceID: "i1", ServiceID: "s", PlanID: "p"},
+				{InstanceID: "i2", ServiceID: "s", PlanID: "p"},
+			},
+			want: []*cleanupTarget{
+				{instance: &instance{ID: "i1", ServiceID: "s", PlanID: "p", Bindings: []string{"b1", "b2"}}, deleteInstance: true},
+				{instance: &instance{ID: "i2", ServiceID: "s", PlanID: "p"}, deleteInstance: true},
+			},
+		},
+		{
+			name:  "only bindings",
+			steps: []*cleanupStep{{InstanceID: "i1", BindingID: "b1", ServiceID: "s", PlanID: "p"}},
+			want: []*cleanupTarget{
+				{instance: &instance{ID: "i1", ServiceID: "s", PlanID: "p", Bindings: []string{"b1"}}},
+			},
+		},
+		{
+			name:    "missing IDs",
+			steps:   []*cleanupStep{{InstanceID: "i1", ServiceID: "s"}},
+			wantErr: "step 1 needs an instance_id, service_id and plan_id",
+		},
+		{
+			name: "binding after its instance",
+			steps: []*cleanupStep{
+				{InstanceID: "i1", ServiceID: "s", PlanID: "p"},
+				{InstanceID: "i1", BindingID: "b1", ServiceID: "s", PlanID: "p"},
+			},
+			wantErr: `step 2 is after the deletion of instance "i1"`,
+		},
+		{
+			name: "repeated binding",
+			steps: []*cleanupStep{
+				{InstanceID: "i1", BindingID: "b1", ServiceID: "s", PlanID: "p"},
+				{InstanceID: "i1", BindingID: "b1", ServiceID: "s", PlanID: "p"},
+			},
+			wantErr: `step 2 deletes binding "b1" of instance "i1" again`,
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := (&cleanupPlan{BrokerURL: testBrokerURL, Steps: tc.steps}).targets()
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("%s: targets got error %v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Unexpected error from targets: %v", tc.name, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: targets got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLoadCleanupPlan(t *testing.T) {
+	plan := &cleanupPlan{BrokerURL: testBrokerURL, Steps: []*cleanupStep{
+		{InstanceID: "i0", BindingID: "b0", ServiceID: "s", PlanID: "p"},
+		{InstanceID: "i0", ServiceID: "s", PlanID: "p"},
+		{InstanceID: "gone", BindingID: "b0", ServiceID: "s", PlanID: "p"},
+		{InstanceID: "gone", ServiceID: "s", PlanID: "p"},
+	}}
+	jsonPlan, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Error marshalling plan: %v", err)
+	}
+	yamlPlan, err := yaml.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Error marshalling plan: %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, format := range []struct {
+		name string
+		data []byte
+	}{{"json", jsonPlan}, {"yaml", yamlPlan}} {
+		path := filepath.Join(dir, "plan."+format.name)
+		if err := ioutil.WriteFile(path, format.data, 0600); err != nil {
+			t.Fatalf("Error writing plan: %v", err)
+		}
+
+		loaded, err := loadCleanupPlan(path, testBrokerURL)
+		if err != nil {
+			t.Fatalf("Unexpected error loading the %s plan: %v", format.name, err)
+		}
+		if !reflect.DeepEqual(loaded, plan) {
+			t.Errorf("Loading the %s plan got %+v, want %+v", format.name, loaded, plan)
+		}
+		if _, err := loadCleanupPlan(path, "https://other-broker"); err == nil {
+			t.Errorf("Loading the %s plan for another broker got no error, want one", format.name)
+		}
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := ioutil.WriteFile(invalid, []byte("broker_url: "+testBrokerURL+"\nsteps:\n- {instance_id: i0}\n"), 0600); err != nil {
+		t.Fatalf("Error writing plan: %v", err)
+	}
+	if _, err := loadCleanupPlan(invalid, testBrokerURL); err == nil {
+		t.Errorf("Loading a plan with an incomplete step got no error, want one")
+	}
+}
+
+func TestCleanupBrokerSavedPlan(t *testing.T) {
+	setupCleanupTest(t, 2, 2)
+	// The saved plan names the instance "gone", which the broker no longer has, and leaves i1 alone.
+	client := newCleanupAdapter(2, "b0")
+	plan := &cleanupPlan{BrokerURL: testBrokerURL, Steps: []*cleanupStep{
+		{InstanceID: "i0", BindingID: "b0", ServiceID: "s", PlanID: "p"},
+		{InstanceID: "i0", ServiceID: "s", PlanID: "p"},
+		{InstanceID: "gone", BindingID: "b0", ServiceID: "s", PlanID: "p"},
+		{InstanceID: "gone", ServiceID: "s", PlanID: "p"},
+	}}
+
+	targets, err := plan.targets()
+	if err != nil {
+		t.Fatalf("Unexpected error from targets: %v", err)
+	}
+	report, err := cleanupBroker(context.Background(), client, testBrokerURL, sliceTargets(targets))
+	if err != nil {
+		t.Fatalf("Unexpected error from cleanupBroker: %v", err)
+	}
+	// Deleting a missing resource succeeds, as the broker answers 410 Gone.
+	if len(report.Deleted) != 4 || len(report.Failed) != 0 || len(report.Remaining) != 0 {
+		t.Errorf("cleanupBroker reported %d deleted, %d failed and %d remaining, want 4 deleted",
+			len(report.Deleted), len(report.Failed), len(report.Remaining))
+	}
+	if _, ok := client.instances["i1"]; !ok || client.deletes["i1"] != 0 || client.deletes["i1/b0"] != 0 {
+		t.Errorf("cleanupBroker touched instance i1, which isn't in the plan")
+	}
+}
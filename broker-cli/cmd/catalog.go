@@ -15,32 +15,59 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/schema"
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/servicecatalog"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/yaml"
 	"github.com/spf13/cobra"
 )
 
+// Values of the --validate flag.
+const (
+	validateStrict = "strict"
+	validateWarn   = "warn"
+	validateOff    = "off"
+)
+
 var (
+	// catalogCache caches the catalogs fetched by cachedCatalog, keyed by broker URL.
+	catalogCache   = make(map[string]*adapter.GetCatalogResult)
+	catalogCacheMu sync.Mutex
+
 	catalogFlags struct {
 		flags.BrokerURLConstructor
-		apiVersion string
+		apiVersion        string
+		clusterBrokerName string
+		namespace         string
 	}
 	// catalogCmd represents the catalogs command.
 	catalogCmd = &cobra.Command{
 		Use:   "catalog",
 		Short: "Get broker catalog",
 		Long:  "Get broker catalog",
+		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL, err := catalogFlags.BrokerURL()
 			if err != nil {
 				log.Fatalf("Error getting catalog: %v\n", err)
 			}
 
-			res, err := client.GetCatalog(&adapter.GetCatalogParams{
+			res, err := client.GetCatalog(ctx, &adapter.GetCatalogParams{
 				APIVersion: catalogFlags.apiVersion,
 				Server:     brokerURL,
 			})
@@ -48,30 +75,204 @@ var (
 				log.Fatalf("Error getting catalog %q: %v\n", brokerURL, err)
 			}
 
-			if len(res.Services) == 0 {
-				fmt.Printf("Broker %q in project %q has no associated services\n", catalogFlags.Broker, catalogFlags.Project)
-				return
+			if res.Services == nil {
+				res.Services = []osb.Service{}
 			}
+			printResult(res, catalogTable(res), func() {
+				if len(res.Services) == 0 {
+					fmt.Printf("Broker %s has no associated services\n", catalogFlags.BrokerName())
+					return
+				}
 
-			fmt.Printf("Successfully fetched service catalog for broker %q within project %q!!\n\n", catalogFlags.Broker, catalogFlags.Project)
-			fmt.Println("Services:")
-			for index, svc := range res.Services {
-				fmt.Printf("%d. %s (%s)\n", index+1, svc.Name, svc.ID)
-				fmt.Printf("   Description: %s\n", svc.Description)
-				fmt.Printf("   Plans:\n")
-				for index, plan := range svc.Plans {
-					fmt.Printf("   %d. %s (%s)\n", index+1, plan.Name, plan.ID)
-					fmt.Printf("      Description: %s", plan.Description)
-					fmt.Printf("      Bindable: %t\n\n", *plan.Bindable)
+				fmt.Printf("Successfully fetched service catalog for broker %s!!\n\n", catalogFlags.BrokerName())
+				fmt.Println("Services:")
+				for index, svc := range res.Services {
+					fmt.Printf("%d. %s (%s)\n", index+1, svc.Name, svc.ID)
+					fmt.Printf("   Description: %s\n", svc.Description)
+					fmt.Printf("   Bindable: %t, Plan updateable: %t, Allow context updates: %t\n", svc.Bindable, svc.PlanUpdateable, svc.AllowContextUpdates)
+					fmt.Printf("   Instances retrievable: %t, Bindings retrievable: %t\n", svc.InstancesRetrievable, svc.BindingsRetrievable)
+					fmt.Printf("   Plans:\n")
+					for index := range svc.Plans {
+						plan := &svc.Plans[index]
+						fmt.Printf("   %d. %s (%s)\n", index+1, plan.Name, plan.ID)
+						fmt.Printf("      Description: %s\n", plan.Description)
+						fmt.Printf("      Free: %t, Bindable: %t, Plan updateable: %t\n", adapter.IsPlanFree(plan), adapter.IsPlanBindable(&svc, plan), adapter.IsPlanUpdateable(&svc, plan))
+						if plan.MaintenanceInfo != nil {
+							fmt.Printf("      Maintenance info: %s %s\n", plan.MaintenanceInfo.Version, plan.MaintenanceInfo.Description)
+						}
+						if d := adapter.MaximumPollingDuration(plan); d > 0 {
+							fmt.Printf("      Maximum polling duration: %v\n", d)
+						}
+						fmt.Println()
+					}
+					fmt.Println()
 				}
-				fmt.Println()
+			})
+		},
+	}
+
+	catalogSaveCmd = &cobra.Command{
+		Use:   "save FILE",
+		Short: "Save the broker catalog to a file",
+		Long:  "Save the catalog of the broker to a JSON file, which can be compared to the catalog of a broker by catalog diff.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			brokerURL, err := catalogFlags.BrokerURL()
+			if err != nil {
+				log.Fatalf("Error saving catalog: %v\n", err)
 			}
+			res, err := httpAdapterFromFlag().GetCatalog(ctx, &adapter.GetCatalogParams{
+				APIVersion: catalogFlags.apiVersion,
+				Server:     brokerURL,
+			})
+			if err != nil {
+				log.Fatalf("Error getting catalog %q: %v\n", brokerURL, err)
+			}
+
+			b, err := json.MarshalIndent(res, "", "  ")
+			if err != nil {
+				log.Fatalf("Error saving catalog: %v\n", err)
+			}
+			if err := ioutil.WriteFile(args[0], append(b, '\n'), 0600); err != nil {
+				log.Fatalf("Error saving catalog: %v\n", err)
+			}
+			infof("Saved the catalog of broker %q with %d services to %s\n", brokerURL, len(res.Services), args[0])
+		},
+	}
+
+	catalogDiffCmd = &cobra.Command{
+		Use:   "diff OLD [NEW]",
+		Short: "Compare two broker catalogs",
+		Long: "Compare the services and plans of two catalogs, each given by a file saved by catalog save or by a broker URL (https://...). " +
+			"NEW defaults to the catalog of the broker given by flags. Services and plans are matched by ID. " +
+			"Removed and renamed services and plans, plans which are no longer bindable or free, and parameters schemas which " +
+			"drop parameters, change their types or require new ones are breaking changes, which make the command fail.",
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			client := httpAdapterFromFlag()
+
+			oldCatalog, err := loadCatalog(ctx, client, args[0])
+			if err != nil {
+				log.Fatalf("Error comparing catalogs: %v\n", err)
+			}
+			newSource := ""
+			if len(args) == 2 {
+				newSource = args[1]
+			} else if newSource, err = catalogFlags.BrokerURL(); err != nil {
+				log.Fatalf("Error comparing catalogs: %v\n", err)
+			}
+			newCatalog, err := loadCatalog(ctx, client, newSource)
+			if err != nil {
+				log.Fatalf("Error comparing catalogs: %v\n", err)
+			}
+
+			res := &catalogDiffResult{Old: args[0], New: newSource, Changes: adapter.DiffCatalogs(oldCatalog, newCatalog)}
+			for _, c := range res.Changes {
+				if c.Breaking {
+					res.Breaking++
+				}
+			}
+			printResult(res, catalogDiffTable(res), func() {
+				if len(res.Changes) == 0 {
+					fmt.Printf("The catalogs %s and %s have the same services and plans\n", res.Old, res.New)
+					return
+				}
+				fmt.Printf("Changes from %s to %s:\n", res.Old, res.New)
+				for _, c := range res.Changes {
+					mark := " "
+					if c.Breaking {
+						mark = "!"
+					}
+					fmt.Printf("%s %s\n", mark, c.Description)
+				}
+			})
+			if res.Breaking > 0 {
+				log.Fatalf("Found %d breaking changes from %s to %s", res.Breaking, res.Old, res.New)
+			}
+		},
+	}
+
+	catalogExportK8sCmd = &cobra.Command{
+		Use:   "export-k8s",
+		Short: "Generate Kubernetes Service Catalog manifests from the broker catalog",
+		Long: "Generate the ClusterServiceClass and ClusterServicePlan manifests of the services and plans of the broker catalog, " +
+			"along with a skeleton ServiceInstance manifest per plan and a ServiceBinding manifest per bindable plan. " +
+			"The parameters of the skeletons are the defaults and required properties of the create schemas of the plans, " +
+			"with placeholders for required properties without a default. The text output is a stream of YAML documents, " +
+			"other output formats print a v1 List.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			brokerURL, err := catalogFlags.BrokerURL()
+			if err != nil {
+				log.Fatalf("Error exporting catalog: %v\n", err)
+			}
+			brokerName := catalogFlags.clusterBrokerName
+			if brokerName == "" {
+				brokerName = catalogFlags.Broker
+			}
+			if brokerName == "" {
+				log.Fatalf("Error exporting catalog: the ClusterServiceBroker name is required, set --cluster-broker-name or --%s", flags.BrokerLongName)
+			}
+
+			res, err := httpAdapterFromFlag().GetCatalog(ctx, &adapter.GetCatalogParams{
+				APIVersion: catalogFlags.apiVersion,
+				Server:     brokerURL,
+			})
+			if err != nil {
+				log.Fatalf("Error getting catalog %q: %v\n", brokerURL, err)
+			}
+
+			items := []interface{}{}
+			for i := range res.Services {
+				svc := &res.Services[i]
+				items = append(items, servicecatalog.ClusterServiceClass(brokerName, svc))
+				for j := range svc.Plans {
+					items = append(items, servicecatalog.ClusterServicePlan(brokerName, svc, &svc.Plans[j]))
+				}
+				for j := range svc.Plans {
+					plan := &svc.Plans[j]
+					instanceName := servicecatalog.Name(svc.Name, plan.Name)
+					items = append(items, servicecatalog.ServiceInstance(instanceName, catalogFlags.namespace, svc, plan))
+					if adapter.IsPlanBindable(svc, plan) {
+						bindingName := servicecatalog.Name(svc.Name, plan.Name, "binding")
+						items = append(items, servicecatalog.ServiceBinding(bindingName, catalogFlags.namespace, instanceName, plan))
+					}
+				}
+			}
+
+			list := map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items}
+			printResult(list, nil, func() {
+				for n, item := range items {
+					b, err := yaml.Marshal(item)
+					if err != nil {
+						log.Fatalf("Error exporting catalog: %v\n", err)
+					}
+					if n > 0 {
+						fmt.Println("---")
+					}
+					fmt.Print(string(b))
+				}
+			})
 		},
 	}
 )
 
+// catalogDiffResult is the result of catalog diff.
+type catalogDiffResult struct {
+	Old      string                   `json:"old"`
+	New      string                   `json:"new"`
+	Changes  []*adapter.CatalogChange `json:"changes"`
+	Breaking int                      `json:"breaking"`
+}
+
 func init() {
-	flags.StringFlag(catalogCmd.PersistentFlags(), &catalogFlags.Server, flags.ServerLongName, flags.ServerShortName, fmt.Sprintf("[Required if %s and %s are not given] Broker URL to make request to (https://...).", flags.ProjectLongName, flags.BrokerLongName))
+	flags.StringFlag(catalogCmd.PersistentFlags(), &catalogFlags.Server, flags.ServerLongName, flags.ServerShortName, fmt.Sprintf("[Required if %s and %s are not given] Broker URL to make request to (https://...). Any OSB broker URL is accepted.", flags.ProjectLongName, flags.BrokerLongName))
 	flags.StringFlag(catalogCmd.PersistentFlags(), &catalogFlags.Project, flags.ProjectLongName, flags.ProjectShortName, fmt.Sprintf("[Required if %s is not given] the GCP project of the broker", flags.ServerLongName))
 	flags.StringFlag(catalogCmd.PersistentFlags(), &catalogFlags.Broker, flags.BrokerLongName, flags.BrokerShortName, fmt.Sprintf("[Required if %s is not given] the broker name", flags.ServerLongName))
 	flags.StringFlagWithDefault(catalogCmd.PersistentFlags(), &catalogFlags.apiVersion, flags.ApiVersionLongName, flags.ApiVersionShortName, flags.ApiVersionDefault,
@@ -81,5 +282,173 @@ func init() {
 	catalogCmd.PersistentFlags().StringVar(&catalogFlags.Host, flags.HostLongName, flags.HostBrokerDefault, "")
 	catalogCmd.PersistentFlags().MarkHidden(flags.HostLongName)
 
+	flags.StringFlag(catalogExportK8sCmd.Flags(), &catalogFlags.clusterBrokerName, "cluster-broker-name", "",
+		fmt.Sprintf("[Optional] Name of the ClusterServiceBroker which the classes and plans belong to. (Default: the %s flag)", flags.BrokerLongName))
+	flags.StringFlag(catalogExportK8sCmd.Flags(), &catalogFlags.namespace, "namespace", "",
+		"[Optional] Namespace of the ServiceInstance and ServiceBinding skeletons. (Default: none, i.e. the namespace they are applied to)")
+
+	catalogCmd.AddCommand(catalogSaveCmd)
+	catalogCmd.AddCommand(catalogDiffCmd)
+	catalogCmd.AddCommand(catalogExportK8sCmd)
 	RootCmd.AddCommand(catalogCmd)
 }
+
+// catalogDiffTable returns the table printed for --output=table, with a row per change.
+func catalogDiffTable(res *catalogDiffResult) *output.Table {
+	table := &output.Table{Columns: []string{"kind", "service id", "plan id", "breaking", "description"}}
+	for _, c := range res.Changes {
+		table.Rows = append(table.Rows, []string{c.Kind, c.ServiceID, c.PlanID, fmt.Sprint(c.Breaking), c.Description})
+	}
+	return table
+}
+
+// loadCatalog returns the catalog of the broker if source is an http(s) URL, and otherwise the
+// catalog saved to the file by catalog save.
+func loadCatalog(ctx context.Context, client adapter.Adapter, source string) (*adapter.GetCatalogResult, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		res, err := client.GetCatalog(ctx, &adapter.GetCatalogParams{
+			APIVersion: catalogFlags.apiVersion,
+			Server:     source,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting catalog %q: %v", source, err)
+		}
+		return res, nil
+	}
+
+	obj, err := readObjectFile(source)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog %s: %v", source, err)
+	}
+	res := &adapter.GetCatalogResult{}
+	if err := json.Unmarshal(b, res); err != nil {
+		return nil, fmt.Errorf("error parsing catalog %s: %v", source, err)
+	}
+	return res, nil
+}
+
+// catalogTable returns the table printed for --output=table, with a row per plan.
+func catalogTable(res *adapter.GetCatalogResult) *output.Table {
+	table := &output.Table{Columns: []string{"service", "service id", "plan", "plan id", "free", "bindable", "plan updateable"}}
+	for i := range res.Services {
+		svc := &res.Services[i]
+		for j := range svc.Plans {
+			plan := &svc.Plans[j]
+			table.Rows = append(table.Rows, []string{svc.Name, svc.ID, plan.Name, plan.ID,
+				fmt.Sprint(adapter.IsPlanFree(plan)), fmt.Sprint(adapter.IsPlanBindable(svc, plan)), fmt.Sprint(adapter.IsPlanUpdateable(svc, plan))})
+		}
+	}
+	return table
+}
+
+// cachedCatalog returns the catalog of the broker, fetching it only the first time it is needed
+// during the command.
+func cachedCatalog(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL string) (*adapter.GetCatalogResult, error) {
+	catalogCacheMu.Lock()
+	defer catalogCacheMu.Unlock()
+
+	if res, ok := catalogCache[brokerURL]; ok {
+		return res, nil
+	}
+	res, err := client.GetCatalog(ctx, &adapter.GetCatalogParams{
+		APIVersion: apiVersion,
+		Server:     brokerURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	catalogCache[brokerURL] = res
+	return res, nil
+}
+
+// maximumPollingDuration returns how long operations on resources of the given plan may be polled,
+// as advertised by the catalog of the broker. It returns 0 if the plan doesn't limit polling or
+// can't be found.
+func maximumPollingDuration(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL, serviceID, planID string) time.Duration {
+	if serviceID == "" || planID == "" {
+		return 0
+	}
+	res, err := cachedCatalog(ctx, client, apiVersion, brokerURL)
+	if err != nil {
+		return 0
+	}
+	_, plan := res.FindPlan(serviceID, planID)
+	return adapter.MaximumPollingDuration(plan)
+}
+
+// checkRetrievable returns an error if the catalog of the broker says that the instances of the
+// service, or its bindings if bindings is set, can't be fetched. If the catalog or the service can't
+// be found, whether they can be fetched is unknown and the broker is left to answer the request.
+func checkRetrievable(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL, serviceID string, bindings bool) error {
+	if serviceID == "" {
+		return nil
+	}
+	res, err := cachedCatalog(ctx, client, apiVersion, brokerURL)
+	if err != nil {
+		return nil
+	}
+	svc := res.FindService(serviceID)
+	switch {
+	case svc == nil:
+		return nil
+	case bindings && !svc.BindingsRetrievable:
+		return fmt.Errorf("service %q (%s) does not support fetching service bindings", svc.Name, svc.ID)
+	case !bindings && !svc.InstancesRetrievable:
+		return fmt.Errorf("service %q (%s) does not support fetching service instances", svc.Name, svc.ID)
+	}
+	return nil
+}
+
+// validateParameters validates the parameters of a request against the schema which the plan
+// publishes in the catalog of the broker for the kind of request, see adapter.ParametersSchema.
+// Violations are fatal in strict mode and printed as warnings in warn mode. Validation is skipped if
+// the catalog can't be fetched or the plan has no schema.
+func validateParameters(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL, serviceID, planID, kind, mode string, parameters map[string]interface{}) {
+	switch mode {
+	case validateOff:
+		return
+	case validateStrict, validateWarn:
+	default:
+		log.Fatalf("Unknown --validate mode %q, want %s, %s or %s", mode, validateStrict, validateWarn, validateOff)
+	}
+	// Updates without parameters keep the current ones, so required parameters may be omitted.
+	if parameters == nil && kind == adapter.SchemaInstanceUpdate {
+		return
+	}
+	if parameters == nil {
+		parameters = map[string]interface{}{}
+	}
+
+	res, err := cachedCatalog(ctx, client, apiVersion, brokerURL)
+	if err != nil {
+		infof("Skipping validation of the parameters since the catalog couldn't be fetched: %v\n", err)
+		return
+	}
+	_, plan := res.FindPlan(serviceID, planID)
+	if plan == nil {
+		infof("Skipping validation of the parameters since the catalog has no plan %q of service %q\n", planID, serviceID)
+		return
+	}
+	paramsSchema := adapter.ParametersSchema(plan, kind)
+	if paramsSchema == nil {
+		return
+	}
+
+	errs := schema.Validate(paramsSchema, parameters, "parameters")
+	if len(errs) == 0 {
+		return
+	}
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, "   "+err.Error())
+	}
+	if mode == validateStrict {
+		log.Fatalf("The parameters don't match the %s schema of plan %q:\n%s\nUse --validate=%s or --validate=%s to send them anyway.",
+			kind, planID, strings.Join(msgs, "\n"), validateWarn, validateOff)
+	}
+	infof("Warning: the parameters don't match the %s schema of plan %q:\n%s\n", kind, planID, strings.Join(msgs, "\n"))
+}
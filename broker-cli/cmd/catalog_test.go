@@ -0,0 +1,65 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/fakebroker"
+)
+
+func TestCheckRetrievable(t *testing.T) {
+	catalog := fakebroker.DefaultCatalog()
+	catalog[0].InstancesRetrievable, catalog[0].BindingsRetrievable = true, false
+	broker := httptest.NewServer(fakebroker.New(fakebroker.Options{Catalog: catalog}))
+	defer broker.Close()
+	// broken fails every request, so its catalog can't be fetched.
+	broken := httptest.NewServer(http.NotFoundHandler())
+	defer broken.Close()
+	t.Cleanup(func() {
+		catalogCacheMu.Lock()
+		delete(catalogCache, broker.URL)
+		delete(catalogCache, broken.URL)
+		catalogCacheMu.Unlock()
+	})
+
+	testCases := []struct {
+		name      string
+		brokerURL string
+		serviceID string
+		bindings  bool
+		wantErr   bool
+	}{
+		{name: "retrievable instances", brokerURL: broker.URL, serviceID: testServiceID},
+		{name: "non-retrievable bindings", brokerURL: broker.URL, serviceID: testServiceID, bindings: true, wantErr: true},
+		{name: "unknown service", brokerURL: broker.URL, serviceID: "other-service-id", bindings: true},
+		{name: "no service", brokerURL: broker.URL, bindings: true},
+		{name: "catalog error", brokerURL: broken.URL, serviceID: testServiceID, bindings: true},
+	}
+
+	client := adapter.NewHttpAdapter(http.DefaultClient)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkRetrievable(context.Background(), client, "2.13", tc.brokerURL, tc.serviceID, tc.bindings)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("checkRetrievable got error %v, want error: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
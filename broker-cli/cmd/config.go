@@ -0,0 +1,277 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/config"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// brokerLocationFlags are the flags which together select the broker. A context doesn't set any of
+// them once one is given, so that --server can't clash with the project and broker of the context.
+var brokerLocationFlags = []string{flags.ServerLongName, flags.ProjectLongName, flags.BrokerLongName}
+
+// contextInfo is a context in the result of config get-contexts.
+type contextInfo struct {
+	*config.Context
+	Current bool `json:"current"`
+}
+
+var (
+	configFlags struct {
+		context config.Context
+	}
+
+	// configCmd represents the config command.
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the broker-cli configuration file",
+		Long: "Manage the contexts of the broker-cli configuration file. A context bundles the broker and authentication " +
+			"flags of commands, which default to the settings of the current context. Flags given to a command take precedence.",
+		// The context isn't applied, since the flags of set-context would otherwise default to it.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			printerFromFlag()
+		},
+	}
+
+	configSetContextCmd = &cobra.Command{
+		Use:   "set-context NAME",
+		Short: "Create or update a context",
+		Long:  "Create a context, or update the settings given by flags in an existing context. Setting a flag to an empty string removes it from the context.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := loadConfig()
+			c := cfg.FindContext(args[0])
+			created := c == nil
+			if created {
+				c = &config.Context{Name: args[0]}
+			}
+			fields := contextFields(c)
+			for name, value := range contextFields(&configFlags.context) {
+				if cmd.Flags().Changed(name) {
+					*fields[name] = *value
+				}
+			}
+			if c.Server != "" && (c.Project != "" || c.Broker != "") {
+				log.Fatalf("Context %q can't set both %s and %s or %s", c.Name, flags.ServerLongName, flags.ProjectLongName, flags.BrokerLongName)
+			}
+			cfg.PutContext(c)
+			saveConfig(cfg)
+
+			verb := "Modified"
+			if created {
+				verb = "Created"
+			}
+			infof("%s context %q in %s\n", verb, c.Name, configFlag)
+		},
+	}
+
+	configUseContextCmd = &cobra.Command{
+		Use:   "use-context NAME",
+		Short: "Set the current context",
+		Long:  "Set the current context, whose settings are the defaults of the flags of commands.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := loadConfig()
+			if cfg.FindContext(args[0]) == nil {
+				log.Fatalf("Context %q not found in %s", args[0], configFlag)
+			}
+			cfg.CurrentContext = args[0]
+			saveConfig(cfg)
+			infof("Switched to context %q\n", args[0])
+		},
+	}
+
+	configGetContextsCmd = &cobra.Command{
+		Use:   "get-contexts",
+		Short: "List the contexts",
+		Long:  "List the contexts of the configuration file, marking the current one.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := loadConfig()
+			contexts := make([]*contextInfo, 0, len(cfg.Contexts))
+			for _, c := range cfg.Contexts {
+				contexts = append(contexts, &contextInfo{Context: c, Current: c.Name == cfg.CurrentContext})
+			}
+
+			table := &output.Table{Columns: []string{"current", "name", "server", "project", "broker", "auth-type"}}
+			for _, c := range contexts {
+				current := ""
+				if c.Current {
+					current = "*"
+				}
+				table.Rows = append(table.Rows, []string{current, c.Name, c.Server, c.Project, c.Broker, c.AuthType})
+			}
+			printResult(contexts, table, func() {
+				if len(contexts) == 0 {
+					fmt.Printf("No contexts in %s\n", configFlag)
+					return
+				}
+				for _, c := range contexts {
+					marker := " "
+					if c.Current {
+						marker = "*"
+					}
+					fmt.Printf("%s %s\n", marker, c.Name)
+				}
+			})
+		},
+	}
+
+	configViewCmd = &cobra.Command{
+		Use:   "view",
+		Short: "Print the configuration",
+		Long:  "Print the configuration file, in YAML unless --output is given.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg := loadConfig()
+			printResult(cfg, nil, func() {
+				b, err := yaml.Marshal(cfg)
+				if err != nil {
+					log.Fatalf("Error printing config: %v", err)
+				}
+				fmt.Print(string(b))
+			})
+		},
+	}
+)
+
+func init() {
+	fields := contextFields(&configFlags.context)
+	for _, name := range contextFlagNames {
+		flags.StringFlag(configSetContextCmd.Flags(), fields[name], name, "",
+			fmt.Sprintf("[Optional] The default of the --%s flag of commands using the context.", name))
+	}
+
+	configCmd.AddCommand(configSetContextCmd)
+	configCmd.AddCommand(configUseContextCmd)
+	configCmd.AddCommand(configGetContextsCmd)
+	configCmd.AddCommand(configViewCmd)
+	RootCmd.AddCommand(configCmd)
+}
+
+// contextFlagNames are the names of the flags which can be set by a context, in the order of
+// config set-context --help.
+var contextFlagNames = []string{
+	flags.ServerLongName, flags.ProjectLongName, flags.BrokerLongName, flags.HostLongName, flags.ApiVersionLongName,
+	"creds", "auth-type", "username", "password-file", "token-file", "client-cert", "client-key", "ca-bundle",
+}
+
+// contextFields returns the settings of the context, by the name of the flag they are the default
+// of.
+func contextFields(c *config.Context) map[string]*string {
+	return map[string]*string{
+		flags.ServerLongName:     &c.Server,
+		flags.ProjectLongName:    &c.Project,
+		flags.BrokerLongName:     &c.Broker,
+		flags.HostLongName:       &c.Host,
+		flags.ApiVersionLongName: &c.Version,
+		"creds":                  &c.Creds,
+		"auth-type":              &c.AuthType,
+		"username":               &c.Username,
+		"password-file":          &c.PasswordFile,
+		"token-file":             &c.TokenFile,
+		"client-cert":            &c.ClientCert,
+		"client-key":             &c.ClientKey,
+		"ca-bundle":              &c.CABundle,
+	}
+}
+
+// defaultConfigPath returns the path of the configuration file in the user's config directory.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "broker-cli", "config.yaml")
+}
+
+// loadConfig returns the configuration in the file given by configFlag.
+func loadConfig() *config.Config {
+	if configFlag == "" {
+		return &config.Config{}
+	}
+	cfg, err := config.Load(configFlag)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	return cfg
+}
+
+// saveConfig writes the configuration to the file given by configFlag.
+func saveConfig(cfg *config.Config) {
+	if configFlag == "" {
+		log.Fatalf("Can't save the config, --config is empty")
+	}
+	if err := cfg.Save(configFlag); err != nil {
+		log.Fatalf("Error saving config: %v", err)
+	}
+}
+
+// applyConfigContext sets the flags of the command which weren't given to the settings of the
+// context selected by configContextFlag, or of the current context.
+func applyConfigContext(cmd *cobra.Command) {
+	cfg := loadConfig()
+	name := configContextFlag
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name == "" {
+		return
+	}
+	c := cfg.FindContext(name)
+	if c == nil {
+		log.Fatalf("Context %q not found in %s", name, configFlag)
+	}
+
+	fs := cmd.Flags()
+	skip := make(map[string]bool)
+	for _, name := range brokerLocationFlags {
+		if fs.Changed(name) {
+			for _, name := range brokerLocationFlags {
+				skip[name] = true
+			}
+		}
+	}
+	for name, value := range contextFields(c) {
+		if *value == "" || skip[name] {
+			continue
+		}
+		if err := setFlagDefault(fs, name, *value); err != nil {
+			log.Fatalf("Error applying context %q: %v", c.Name, err)
+		}
+	}
+}
+
+// setFlagDefault sets the flag to value unless it was given or the command has no such flag.
+func setFlagDefault(fs *pflag.FlagSet, name, value string) error {
+	f := fs.Lookup(name)
+	if f == nil || f.Changed {
+		return nil
+	}
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("invalid value %q for --%s: %v", value, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/fakebroker"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	devFlags struct {
+		port          int
+		catalogFile   string
+		asyncDuration time.Duration
+		asyncRequired bool
+		retryAfter    time.Duration
+	}
+
+	// devCmd represents the dev command.
+	devCmd = &cobra.Command{
+		Use:   "dev",
+		Short: "Tools for developing against service brokers",
+		Long:  "Tools for developing against service brokers",
+	}
+
+	devFakeBrokerCmd = &cobra.Command{
+		Use:   "fake-broker",
+		Short: "Run an in-memory fake service broker",
+		Long: "Run an in-memory fake service broker which serves the OSB API at its root URL, as well as " +
+			"the admin API of GCP brokers. Other broker-cli commands can be pointed at it with --server and --auth-type=none, " +
+			"along with --admin-api for those listing instances.",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts := fakebroker.Options{
+				AsyncDuration: devFlags.asyncDuration,
+				AsyncRequired: devFlags.asyncRequired,
+				RetryAfter:    devFlags.retryAfter,
+			}
+			if devFlags.catalogFile != "" {
+				b, err := ioutil.ReadFile(devFlags.catalogFile)
+				if err != nil {
+					log.Fatalf("Error reading catalog file %s: %v", devFlags.catalogFile, err)
+				}
+				catalog := &adapter.GetCatalogResult{}
+				if err := json.Unmarshal(b, catalog); err != nil {
+					log.Fatalf("Error unmarshalling catalog file %s: %v", devFlags.catalogFile, err)
+				}
+				opts.Catalog = catalog.Services
+			}
+
+			addr := fmt.Sprintf("localhost:%d", devFlags.port)
+			fmt.Printf("Serving a fake broker at http://%s\n", addr)
+			log.Fatal(http.ListenAndServe(addr, fakebroker.New(opts)))
+		},
+	}
+)
+
+func init() {
+	flags.IntFlag(devFakeBrokerCmd.PersistentFlags(), &devFlags.port, "port", "", 8080,
+		"[Optional] Port to listen on.")
+	flags.StringFlag(devFakeBrokerCmd.PersistentFlags(), &devFlags.catalogFile, "catalog", "",
+		"[Optional] JSON file with the catalog to serve, in the format of the OSB catalog response. (Default: a single fake service)")
+	flags.DurationFlag(devFakeBrokerCmd.PersistentFlags(), &devFlags.asyncDuration, "async-duration", "", 5*time.Second,
+		"[Optional] How long asynchronous operations stay in progress. Set to 0 to handle every request synchronously.")
+	flags.BoolFlag(devFakeBrokerCmd.PersistentFlags(), &devFlags.asyncRequired, "async-required", "",
+		"[Optional] If specified, the broker rejects synchronous requests with the AsyncRequired error. (Default: FALSE)")
+	flags.DurationFlag(devFakeBrokerCmd.PersistentFlags(), &devFlags.retryAfter, "retry-after", "", 0,
+		"[Optional] Delay sent in the Retry-After header of last operation responses while operations are in progress, in whole seconds. (Default: no header)")
+
+	RootCmd.AddCommand(devCmd)
+	devCmd.AddCommand(devFakeBrokerCmd)
+}
@@ -16,6 +16,7 @@ package flags
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 )
 
@@ -28,19 +29,30 @@ const (
 // BrokerURLConstructor is a struct that describes the fields which can be used to
 // generate a broker URL via BrokerURL().
 type BrokerURLConstructor struct {
-	Broker  string
-	Host    string
-	Project string
-	Server  string
+	// AdminAPI is set if the broker given by Server serves the admin API of GCP brokers, see
+	// AdminBrokerURL.
+	AdminAPI bool
+	Broker   string
+	Host     string
+	Project  string
+	Server   string
 }
 
 func ConstructBrokerURL(host, project, broker string) string {
 	return fmt.Sprintf("%s/v1beta1/projects/%s/brokers/%s", host, project, broker)
 }
 
+// validateServer checks the --server flag. A URL under the GCP service end point must be a valid
+// GCP broker URL, from which the project and broker names are extracted. Any other absolute http(s)
+// URL is accepted as the base URL of a generic OSB broker.
 func (flags *BrokerURLConstructor) validateServer() error {
 	if !strings.HasPrefix(flags.Server, flags.Host) {
-		return fmt.Errorf("broker server URL %q should always begin with service end point %q", flags.Server, flags.Host)
+		u, err := url.Parse(flags.Server)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("broker server URL %q should be an absolute http or https URL", flags.Server)
+		}
+		flags.Server = strings.TrimSuffix(flags.Server, "/")
+		return nil
 	}
 
 	parts := strings.Split(flags.Server, "/")
@@ -56,7 +68,8 @@ func (flags *BrokerURLConstructor) validateServer() error {
 
 // There are two available options for service broker commands. Users are
 // allowed to pass either --server or (--project and --broker). If the latter
-// is used then we generate the URL assuming we are using a GCP broker.
+// is used then we generate the URL assuming we are using a GCP broker. The
+// former may be the URL of any OSB broker.
 // BrokerURL checks that only one of the two options is passed
 // in, that is, only either (--server) or (--project and --broker) are used,
 // and returns the generated broker URL.
@@ -77,3 +90,26 @@ func (flags *BrokerURLConstructor) BrokerURL() (string, error) {
 	}
 	return ConstructBrokerURL(flags.Host, flags.Project, flags.Broker), nil
 }
+
+// AdminBrokerURL is like BrokerURL, but fails unless the broker serves the admin API which lists
+// instances and bindings: the URL must be a GCP broker URL under Host, or AdminAPI must be set. It
+// is used by commands which call the admin API rather than the OSB API.
+func (flags *BrokerURLConstructor) AdminBrokerURL() (string, error) {
+	brokerURL, err := flags.BrokerURL()
+	if err != nil {
+		return "", err
+	}
+	if !flags.AdminAPI && (flags.Project == "" || flags.Broker == "") {
+		return "", fmt.Errorf("broker server URL %q is not a GCP broker, this command only supports GCP brokers and brokers serving the same admin API with --%s", brokerURL, AdminAPILongName)
+	}
+	return brokerURL, nil
+}
+
+// BrokerName returns the broker as shown in messages: its quoted name within its quoted project, or
+// its quoted URL if they can't be parsed from --server. It must be called after BrokerURL.
+func (flags *BrokerURLConstructor) BrokerName() string {
+	if flags.Project == "" || flags.Broker == "" {
+		return fmt.Sprintf("%q", flags.Server)
+	}
+	return fmt.Sprintf("%q within project %q", flags.Broker, flags.Project)
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags
+
+import "testing"
+
+func TestBrokerURL(t *testing.T) {
+	testCases := []struct {
+		name      string
+		flags     BrokerURLConstructor
+		wantURL   string
+		wantName  string
+		wantAdmin bool
+		wantError bool
+	}{
+		{
+			name:      "project and broker",
+			flags:     BrokerURLConstructor{Host: HostBrokerDefault, Project: "p", Broker: "b"},
+			wantURL:   HostBrokerDefault + "/v1beta1/projects/p/brokers/b",
+			wantName:  `"b" within project "p"`,
+			wantAdmin: true,
+		},
+		{
+			name:      "GCP server",
+			flags:     BrokerURLConstructor{Host: HostBrokerDefault, Server: HostBrokerDefault + "/v1beta1/projects/p/brokers/b"},
+			wantURL:   HostBrokerDefault + "/v1beta1/projects/p/brokers/b",
+			wantName:  `"b" within project "p"`,
+			wantAdmin: true,
+		},
+		{
+			name:      "malformed GCP server",
+			flags:     BrokerURLConstructor{Host: HostBrokerDefault, Server: HostBrokerDefault + "/v1beta1/projects/p"},
+			wantError: true,
+		},
+		{
+			name:     "generic server",
+			flags:    BrokerURLConstructor{Host: HostBrokerDefault, Server: "http://localhost:8080/broker/"},
+			wantURL:  "http://localhost:8080/broker",
+			wantName: `"http://localhost:8080/broker"`,
+		},
+		{
+			name:      "generic server serving the admin API",
+			flags:     BrokerURLConstructor{Host: HostBrokerDefault, Server: "http://localhost:8080/broker/", AdminAPI: true},
+			wantURL:   "http://localhost:8080/broker",
+			wantName:  `"http://localhost:8080/broker"`,
+			wantAdmin: true,
+		},
+		{
+			name:      "relative server",
+			flags:     BrokerURLConstructor{Host: HostBrokerDefault, Server: "localhost:8080"},
+			wantError: true,
+		},
+		{
+			name:      "no flags",
+			flags:     BrokerURLConstructor{Host: HostBrokerDefault},
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		flags := tc.flags
+		url, err := flags.BrokerURL()
+		if tc.wantError {
+			if err == nil {
+				t.Errorf("%s: BrokerURL got no error but want one", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error from BrokerURL: %v", tc.name, err)
+			continue
+		}
+		if url != tc.wantURL {
+			t.Errorf("%s: BrokerURL got %q, want %q", tc.name, url, tc.wantURL)
+		}
+		if name := flags.BrokerName(); name != tc.wantName {
+			t.Errorf("%s: BrokerName got %s, want %s", tc.name, name, tc.wantName)
+		}
+
+		flags = tc.flags
+		if _, err := flags.AdminBrokerURL(); (err == nil) != tc.wantAdmin {
+			t.Errorf("%s: AdminBrokerURL got error %v, want error: %t", tc.name, err, !tc.wantAdmin)
+		}
+	}
+}
@@ -15,6 +15,8 @@
 package flags
 
 const (
+	AdminAPILongName      = "admin-api"
+	AdminAPIDescription   = "[Optional] If specified, the broker given with --server serves the admin API of GCP brokers which lists instances and bindings, as the fake broker does. (Default: FALSE)"
 	ApiVersionLongName    = "version"
 	ApiVersionShortName   = "v"
 	ApiVersionDefault     = "2.13"
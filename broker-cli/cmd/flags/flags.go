@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/spf13/pflag"
 )
@@ -48,6 +49,47 @@ func BoolFlag(flagset *pflag.FlagSet, p *bool, long, short, usage string) {
 	flagset.BoolVarP(p, long, short, false /* bool flags default to FALSE */, usage)
 }
 
+// DurationFlag is a wrapper to *FlagSet.DurationVarP which accepts the default value for the flag.
+// It also does some book keeping so that the flag can be used with GetShortName and GetLongName.
+func DurationFlag(flagset *pflag.FlagSet, p *time.Duration, long, short string, defaultValue time.Duration, usage string) {
+	if p == nil {
+		log.Fatal("nil pointer given to DurationVarP? This should never happen")
+	}
+	nameMap[p] = Names{short: short, long: long}
+	flagset.DurationVarP(p, long, short, defaultValue, usage)
+}
+
+// Float64Flag is a wrapper to *FlagSet.Float64VarP which accepts the default value for the flag.
+// It also does some book keeping so that the flag can be used with GetShortName and GetLongName.
+func Float64Flag(flagset *pflag.FlagSet, p *float64, long, short string, defaultValue float64, usage string) {
+	if p == nil {
+		log.Fatal("nil pointer given to Float64VarP? This should never happen")
+	}
+	nameMap[p] = Names{short: short, long: long}
+	flagset.Float64VarP(p, long, short, defaultValue, usage)
+}
+
+// IntFlag is a wrapper to *FlagSet.IntVarP which accepts the default value for the flag. It also
+// does some book keeping so that the flag can be used with GetShortName and GetLongName.
+func IntFlag(flagset *pflag.FlagSet, p *int, long, short string, defaultValue int, usage string) {
+	if p == nil {
+		log.Fatal("nil pointer given to IntVarP? This should never happen")
+	}
+	nameMap[p] = Names{short: short, long: long}
+	flagset.IntVarP(p, long, short, defaultValue, usage)
+}
+
+// BoolFlagWithDefault is a wrapper to *FlagSet.BoolVarP which accepts the default value for the
+// flag. It also does some book keeping so that the flag can be used with GetShortName and
+// GetLongName.
+func BoolFlagWithDefault(flagset *pflag.FlagSet, p *bool, long, short string, defaultValue bool, usage string) {
+	if p == nil {
+		log.Fatal("nil pointer given to BoolVarP? This should never happen")
+	}
+	nameMap[p] = Names{short: short, long: long}
+	flagset.BoolVarP(p, long, short, defaultValue, usage)
+}
+
 // CheckFlags checks whether all given flags were specified. If any are missing this
 // will print an error message and call os.Exit(2).
 // requiredFlags should be pointers to the flag variables (e.g. &credsFlag).
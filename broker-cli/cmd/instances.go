@@ -15,26 +15,36 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/inventory"
 	"github.com/spf13/cobra"
 )
 
 // instance is a Service Instance.
 type instance struct {
-	ID         string
-	serviceID  string
-	planID     string
-	createTime string
-	bindings   []string
+	ID         string `json:"instance_id"`
+	ServiceID  string `json:"service_id"`
+	PlanID     string `json:"plan_id"`
+	CreateTime string `json:"create_time,omitempty"`
+	// ServiceName and PlanName are looked up in the catalog of the broker, see resolveInstanceNames.
+	ServiceName string   `json:"service_name,omitempty"`
+	PlanName    string   `json:"plan_name,omitempty"`
+	Bindings    []string `json:"bindings"`
 }
 
 // listInstancesResult is the output from ListInstances.
 type listInstancesResult struct {
-	instances []*instance
+	Instances []*instance `json:"instances"`
+	// Truncated is true if the broker has more instances than the listing was limited to.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 var (
@@ -44,16 +54,26 @@ var (
 		instanceID             string
 		serviceID              string
 		planID                 string
+		serviceName            string
+		planName               string
 		organizationGUID       string
 		spaceGUID              string
 		parameters             string
+		parametersFile         string
+		params                 []string
 		context                string
+		contextFile            string
 		wait                   bool
+		acceptsIncomplete      bool
 		operationID            string
+		validate               string
 		previousServiceID      string
 		previousPlanID         string
 		previousOrganizationID string
 		previousSpaceID        string
+		orphanMitigation       bool
+		pageSize               int
+		limit                  int
 	}
 
 	// instancesCmd represents the instances command.
@@ -68,48 +88,99 @@ var (
 		Short: "Create a service instance",
 		Long:  "Create a service instance",
 		Run: func(cmd *cobra.Command, args []string) {
-			flags.CheckFlags(&instancesFlags.instanceID, &instancesFlags.serviceID, &instancesFlags.planID)
+			flags.CheckFlags(&instancesFlags.instanceID)
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL, err := instancesFlags.BrokerURL()
 			if err != nil {
 				log.Fatalf("Error creating instance %s: %v", instancesFlags.instanceID, err)
 			}
+			resolveNames(ctx, client, instancesFlags.apiVersion, brokerURL, &instancesFlags.serviceID, &instancesFlags.planID, instancesFlags.serviceName, instancesFlags.planName)
+			flags.CheckFlags(&instancesFlags.serviceID, &instancesFlags.planID)
+
+			parameters, err := parametersFromFlags(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, instancesFlags.planID, adapter.SchemaInstanceCreate,
+				instancesFlags.parametersFile, instancesFlags.parameters, instancesFlags.params)
+			if err != nil {
+				log.Fatalf("Error creating instance %s: %v", instancesFlags.instanceID, err)
+			}
+			validateParameters(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, instancesFlags.planID, adapter.SchemaInstanceCreate, instancesFlags.validate, parameters)
+			requestContext, err := requestContextFromFlags(instancesFlags.contextFile, instancesFlags.context)
+			if err != nil {
+				log.Fatalf("Error creating instance %s: %v", instancesFlags.instanceID, err)
+			}
 
-			res, err := client.CreateInstance(&adapter.CreateInstanceParams{
-				Server:            brokerURL,
-				APIVersion:        instancesFlags.apiVersion,
-				AcceptsIncomplete: true,
-				InstanceID:        instancesFlags.instanceID,
-				ServiceID:         instancesFlags.serviceID,
-				PlanID:            instancesFlags.planID,
-				Context:           parseStringToObjectMap(instancesFlags.context),
-				OrganizationGUID:  instancesFlags.organizationGUID,
-				SpaceGUID:         instancesFlags.spaceGUID,
-				Parameters:        parseStringToObjectMap(instancesFlags.parameters),
+			requestIdentity := newRequestIdentity()
+			infof("Request identity: %s\n", requestIdentity)
+			var res *adapter.CreateInstanceResult
+			err = withAsyncFallback(instancesFlags.acceptsIncomplete, func(acceptsIncomplete bool) error {
+				var err error
+				res, err = client.CreateInstance(ctx, &adapter.CreateInstanceParams{
+					Server:              brokerURL,
+					APIVersion:          instancesFlags.apiVersion,
+					AcceptsIncomplete:   acceptsIncomplete,
+					OriginatingIdentity: originatingIdentityFromFlag(ctx),
+					RequestIdentity:     requestIdentity,
+					InstanceID:          instancesFlags.instanceID,
+					ServiceID:           instancesFlags.serviceID,
+					PlanID:              instancesFlags.planID,
+					Context:             requestContext,
+					OrganizationGUID:    instancesFlags.organizationGUID,
+					SpaceGUID:           instancesFlags.spaceGUID,
+					Parameters:          parameters,
+				})
+				return err
 			})
 			if err != nil {
-				log.Fatalf("Error creating instance %s in broker %s: %v", instancesFlags.instanceID, brokerURL, err)
+				orphanReport := mitigateOrphan(instancesFlags.orphanMitigation, client, instancesFlags.apiVersion, brokerURL,
+					&instance{ID: instancesFlags.instanceID, ServiceID: instancesFlags.serviceID, PlanID: instancesFlags.planID}, "", err)
+				log.Fatalf("Error creating instance %s in broker %s: %v%s%s", instancesFlags.instanceID, brokerURL, err, brokerErrorHint(err), orphanReport)
 			}
+			updateInventory(func(inv *inventory.Inventory) {
+				inv.PutInstance(&inventory.Instance{
+					BrokerURL:     brokerURL,
+					InstanceID:    instancesFlags.instanceID,
+					ServiceID:     instancesFlags.serviceID,
+					PlanID:        instancesFlags.planID,
+					Parameters:    parameters,
+					Context:       requestContext,
+					LastOperation: inventoryOperation(res.Async, res.OperationID, inventory.OperationCreate),
+					Source:        inventory.SourceCreated,
+				})
+			})
+
+			out := &operationResult{RequestIdentity: requestIdentity, Result: res}
 
 			if !res.Async {
-				fmt.Printf("Successfully created the instance %s: %+v\n", instancesFlags.instanceID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully created the instance %s: %+v\n", instancesFlags.instanceID, *res)
+				})
 				return
 			}
 
 			if !instancesFlags.wait {
-				fmt.Printf("Successfully started the operation to create instance %s: %+v\n", instancesFlags.instanceID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully started the operation to create instance %s: %+v\n", instancesFlags.instanceID, *res)
+				})
 				return
 			}
 
-			op, err := waitOnOperation(pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID,
-				instancesFlags.planID, res.OperationID, adapter.OperationCreate), false)
+			op, err := waitOnOperation(ctx, pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID,
+				instancesFlags.planID, res.OperationID, adapter.OperationCreate),
+				maximumPollingDuration(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, instancesFlags.planID),
+				liveProgress(fmt.Sprintf("the creation of instance %s", instancesFlags.instanceID)))
 			if err != nil {
-				log.Fatalf("Error polling last operation %q for instance %s: %v", res.OperationID, instancesFlags.instanceID, err)
+				log.Fatalf("Error polling last operation %q for instance %s: %v%s", res.OperationID, instancesFlags.instanceID, err,
+					waitHint(err, "instances", brokerURL, "instance", instancesFlags.instanceID, "service", instancesFlags.serviceID, "plan", instancesFlags.planID, "operation", res.OperationID))
 			}
+			recordInstanceOperation(brokerURL, instancesFlags.instanceID, res.OperationID, inventory.OperationCreate, op)
 
 			if op.State == adapter.OperationSucceeded {
-				fmt.Printf("Successfully created the instance %s asynchronously (operation %q): %+v\n", instancesFlags.instanceID, res.OperationID, *op)
+				out.LastOperation = op
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully created the instance %s asynchronously (operation %q): %+v\n", instancesFlags.instanceID, res.OperationID, *op)
+				})
 				return
 			}
 
@@ -122,24 +193,55 @@ var (
 		Short: "List service instances in a broker",
 		Long:  "List service instances in a broker",
 		Run: func(cmd *cobra.Command, args []string) {
-			client := httpAdapterFromFlag()
-			brokerURL, err := instancesFlags.BrokerURL()
+			checkAdminFlags("Listing instances", &instancesFlags.BrokerURLConstructor)
+			brokerURL, err := instancesFlags.AdminBrokerURL()
 			if err != nil {
 				log.Fatalf("Error listing instances: %v", err)
 			}
-			res, err := listInstances(client, brokerURL)
+
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			client := httpAdapterFromFlag()
+
+			// The instances are printed as their pages arrive, except for formats which need the
+			// whole list, see output.ListStream.
+			var stream *output.ListStream
+			if printer.Format() != output.FormatText {
+				stream = printer.NewListStream(os.Stdout, nil, "instances", instanceColumns, func(item interface{}) []string {
+					return instanceRow(item.(*instance))
+				})
+			}
+			count := 0
+			truncated, err := forEachInstance(ctx, client, brokerURL, instancesFlags.pageSize, instancesFlags.limit, func(i *instance) error {
+				resolveInstanceNames(ctx, client, &listInstancesResult{Instances: []*instance{i}}, instancesFlags.apiVersion, brokerURL)
+				count++
+				if stream != nil {
+					return stream.Add(i)
+				}
+				if count == 1 {
+					fmt.Printf("Successfully listed service instances in broker %s!!\n\n", instancesFlags.BrokerName())
+				}
+				printInstance(count, i)
+				return nil
+			})
 			if err != nil {
 				log.Fatalf("Error listing instances in broker %s: %v", brokerURL, err)
 			}
 
-			if len(res.instances) == 0 {
-				fmt.Printf("Broker %q in project %q has no associated instances\n", instancesFlags.Broker, instancesFlags.Project)
-				return
+			if stream != nil {
+				var tail map[string]interface{}
+				if truncated {
+					tail = map[string]interface{}{"truncated": true}
+				}
+				if err := stream.Close(tail); err != nil {
+					log.Fatalf("Error printing result: %v", err)
+				}
+			} else if count == 0 {
+				fmt.Printf("Broker %s has no associated instances\n", instancesFlags.BrokerName())
+			}
+			if truncated {
+				infof("The broker has more than %d instances, use a higher --limit to list more\n", instancesFlags.limit)
 			}
-
-			fmt.Printf("Successfully listed service instances in broker %q within project %q!!\n\n", instancesFlags.Broker, instancesFlags.Project)
-			printListInstances(client, res, brokerURL)
-
 		},
 	}
 
@@ -148,44 +250,76 @@ var (
 		Short: "Delete a service instance",
 		Long:  "Delete a service instance",
 		Run: func(cmd *cobra.Command, args []string) {
-			flags.CheckFlags(&instancesFlags.instanceID, &instancesFlags.serviceID, &instancesFlags.planID)
+			flags.CheckFlags(&instancesFlags.instanceID)
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL, err := instancesFlags.BrokerURL()
 			if err != nil {
 				log.Fatalf("Error deleting instance %s: %v", instancesFlags.instanceID, err)
 			}
-
-			res, err := client.DeleteInstance(&adapter.DeleteInstanceParams{
-				APIVersion:        instancesFlags.apiVersion,
-				Server:            brokerURL,
-				AcceptsIncomplete: true,
-				InstanceID:        instancesFlags.instanceID,
-				ServiceID:         instancesFlags.serviceID,
-				PlanID:            instancesFlags.planID,
+			resolveNames(ctx, client, instancesFlags.apiVersion, brokerURL, &instancesFlags.serviceID, &instancesFlags.planID, instancesFlags.serviceName, instancesFlags.planName)
+			fillInstanceFlags(brokerURL, instancesFlags.instanceID, &instancesFlags.serviceID, &instancesFlags.planID, nil)
+			flags.CheckFlags(&instancesFlags.serviceID, &instancesFlags.planID)
+
+			requestIdentity := newRequestIdentity()
+			infof("Request identity: %s\n", requestIdentity)
+			var res *adapter.DeleteInstanceResult
+			err = withAsyncFallback(instancesFlags.acceptsIncomplete, func(acceptsIncomplete bool) error {
+				var err error
+				res, err = client.DeleteInstance(ctx, &adapter.DeleteInstanceParams{
+					APIVersion:          instancesFlags.apiVersion,
+					Server:              brokerURL,
+					AcceptsIncomplete:   acceptsIncomplete,
+					OriginatingIdentity: originatingIdentityFromFlag(ctx),
+					RequestIdentity:     requestIdentity,
+					InstanceID:          instancesFlags.instanceID,
+					ServiceID:           instancesFlags.serviceID,
+					PlanID:              instancesFlags.planID,
+				})
+				return err
 			})
 			if err != nil {
-				log.Fatalf("Error deleting instance %s in broker %s: %v", instancesFlags.instanceID, brokerURL, err)
+				log.Fatalf("Error deleting instance %s in broker %s: %v%s", instancesFlags.instanceID, brokerURL, err, brokerErrorHint(err))
 			}
+			deleteOp := &adapter.Operation{State: adapter.OperationSucceeded}
+			if res.Async {
+				deleteOp.State = adapter.OperationInProgress
+			}
+			recordInstanceOperation(brokerURL, instancesFlags.instanceID, res.OperationID, inventory.OperationDelete, deleteOp)
+
+			out := &operationResult{RequestIdentity: requestIdentity, Result: res}
 
 			if !res.Async {
-				fmt.Printf("Successfully deleted the instance %s: %+v\n", instancesFlags.instanceID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully deleted the instance %s: %+v\n", instancesFlags.instanceID, *res)
+				})
 				return
 			}
 
 			if !instancesFlags.wait {
-				fmt.Printf("Successfully started the operation to delete instance %s: %+v\n", instancesFlags.instanceID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully started the operation to delete instance %s: %+v\n", instancesFlags.instanceID, *res)
+				})
 				return
 			}
 
-			op, err := waitOnOperation(pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID,
-				instancesFlags.planID, res.OperationID, adapter.OperationDelete), false)
+			op, err := waitOnOperation(ctx, pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID,
+				instancesFlags.planID, res.OperationID, adapter.OperationDelete),
+				maximumPollingDuration(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, instancesFlags.planID),
+				liveProgress(fmt.Sprintf("the deletion of instance %s", instancesFlags.instanceID)))
 			if err != nil {
-				log.Fatalf("Error polling last operation %q for instance %s: %v", instancesFlags.operationID, instancesFlags.instanceID, err)
+				log.Fatalf("Error polling last operation %q for instance %s: %v%s", res.OperationID, instancesFlags.instanceID, err,
+					waitHint(err, "instances", brokerURL, "instance", instancesFlags.instanceID, "service", instancesFlags.serviceID, "plan", instancesFlags.planID, "operation", res.OperationID))
 			}
+			recordInstanceOperation(brokerURL, instancesFlags.instanceID, res.OperationID, inventory.OperationDelete, op)
 
 			if op.State == adapter.OperationSucceeded {
-				fmt.Printf("Successfully deleted the instance %s asynchronously (operation %q): %+v\n", instancesFlags.instanceID, res.OperationID, *op)
+				out.LastOperation = op
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully deleted the instance %s asynchronously (operation %q): %+v\n", instancesFlags.instanceID, res.OperationID, *op)
+				})
 				return
 			}
 
@@ -198,49 +332,101 @@ var (
 		Short: "Update a service instance",
 		Long:  "Update a service instance",
 		Run: func(cmd *cobra.Command, args []string) {
-			flags.CheckFlags(&instancesFlags.instanceID, &instancesFlags.serviceID)
+			flags.CheckFlags(&instancesFlags.instanceID)
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL, err := instancesFlags.BrokerURL()
 			if err != nil {
 				log.Fatalf("Error updating instance %s: %v", instancesFlags.instanceID, err)
 			}
+			resolveNames(ctx, client, instancesFlags.apiVersion, brokerURL, &instancesFlags.serviceID, &instancesFlags.planID, instancesFlags.serviceName, instancesFlags.planName)
+			flags.CheckFlags(&instancesFlags.serviceID)
+
+			parameters, err := parametersFromFlags(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, updatedPlanID(), adapter.SchemaInstanceUpdate,
+				instancesFlags.parametersFile, instancesFlags.parameters, instancesFlags.params)
+			if err != nil {
+				log.Fatalf("Error updating instance %s: %v", instancesFlags.instanceID, err)
+			}
+			validateParameters(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, updatedPlanID(), adapter.SchemaInstanceUpdate, instancesFlags.validate, parameters)
+			requestContext, err := requestContextFromFlags(instancesFlags.contextFile, instancesFlags.context)
+			if err != nil {
+				log.Fatalf("Error updating instance %s: %v", instancesFlags.instanceID, err)
+			}
 
-			res, err := client.UpdateInstance(&adapter.UpdateInstanceParams{
-				APIVersion:             instancesFlags.apiVersion,
-				Server:                 brokerURL,
-				AcceptsIncomplete:      true,
-				InstanceID:             instancesFlags.instanceID,
-				ServiceID:              instancesFlags.serviceID,
-				PlanID:                 instancesFlags.planID,
-				Context:                parseStringToObjectMap(instancesFlags.context),
-				Parameters:             parseStringToObjectMap(instancesFlags.parameters),
-				PreviousServiceID:      instancesFlags.previousServiceID,
-				PreviousPlanID:         instancesFlags.previousPlanID,
-				PreviousOrganizationID: instancesFlags.previousOrganizationID,
-				PreviousSpaceID:        instancesFlags.previousSpaceID,
+			requestIdentity := newRequestIdentity()
+			infof("Request identity: %s\n", requestIdentity)
+			var res *adapter.UpdateInstanceResult
+			err = withAsyncFallback(instancesFlags.acceptsIncomplete, func(acceptsIncomplete bool) error {
+				var err error
+				res, err = client.UpdateInstance(ctx, &adapter.UpdateInstanceParams{
+					APIVersion:             instancesFlags.apiVersion,
+					Server:                 brokerURL,
+					AcceptsIncomplete:      acceptsIncomplete,
+					OriginatingIdentity:    originatingIdentityFromFlag(ctx),
+					RequestIdentity:        requestIdentity,
+					InstanceID:             instancesFlags.instanceID,
+					ServiceID:              instancesFlags.serviceID,
+					PlanID:                 instancesFlags.planID,
+					Context:                requestContext,
+					Parameters:             parameters,
+					PreviousServiceID:      instancesFlags.previousServiceID,
+					PreviousPlanID:         instancesFlags.previousPlanID,
+					PreviousOrganizationID: instancesFlags.previousOrganizationID,
+					PreviousSpaceID:        instancesFlags.previousSpaceID,
+				})
+				return err
 			})
 			if err != nil {
-				log.Fatalf("Error updating instance %s in broker %s: %v", instancesFlags.instanceID, brokerURL, err)
+				log.Fatalf("Error updating instance %s in broker %s: %v%s", instancesFlags.instanceID, brokerURL, err, brokerErrorHint(err))
 			}
+			updateInventory(func(inv *inventory.Inventory) {
+				i := inv.FindInstance(brokerURL, instancesFlags.instanceID)
+				if i == nil {
+					return
+				}
+				if planID := updatedPlanID(); planID != "" {
+					i.PlanID = planID
+				}
+				i.Parameters = mergeObjects(i.Parameters, parameters)
+				if requestContext != nil {
+					i.Context = requestContext
+				}
+				i.LastOperation = inventoryOperation(res.Async, res.OperationID, inventory.OperationUpdate)
+				inv.PutInstance(i)
+			})
+
+			out := &operationResult{RequestIdentity: requestIdentity, Result: res}
 
 			if !res.Async {
-				fmt.Printf("Successfully updated the instance %s: %+v\n", instancesFlags.instanceID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully updated the instance %s: %+v\n", instancesFlags.instanceID, *res)
+				})
 				return
 			}
 
 			if !instancesFlags.wait {
-				fmt.Printf("Successfully started the operation to update instance %s: %+v\n", instancesFlags.instanceID, *res)
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully started the operation to update instance %s: %+v\n", instancesFlags.instanceID, *res)
+				})
 				return
 			}
 
-			op, err := waitOnOperation(pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID, instancesFlags.planID, res.OperationID, adapter.OperationUpdate), false)
+			op, err := waitOnOperation(ctx, pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID, instancesFlags.planID, res.OperationID, adapter.OperationUpdate),
+				maximumPollingDuration(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, updatedPlanID()),
+				liveProgress(fmt.Sprintf("the update of instance %s", instancesFlags.instanceID)))
 			if err != nil {
-				log.Fatalf("Error polling last operation %q for instance %s: %v", res.OperationID, instancesFlags.instanceID, err)
+				log.Fatalf("Error polling last operation %q for instance %s: %v%s", res.OperationID, instancesFlags.instanceID, err,
+					waitHint(err, "instances", brokerURL, "instance", instancesFlags.instanceID, "service", instancesFlags.serviceID, "plan", updatedPlanID(), "operation", res.OperationID))
 			}
+			recordInstanceOperation(brokerURL, instancesFlags.instanceID, res.OperationID, inventory.OperationUpdate, op)
 
 			if op.State == adapter.OperationSucceeded {
-				fmt.Printf("Successfully updated the instance %s asynchronously (operation %q): %+v\n", instancesFlags.instanceID, res.OperationID, *op)
+				out.LastOperation = op
+				printResult(out, nil, func() {
+					fmt.Printf("Successfully updated the instance %s asynchronously (operation %q): %+v\n", instancesFlags.instanceID, res.OperationID, *op)
+				})
 				return
 			}
 
@@ -248,6 +434,51 @@ var (
 		},
 	}
 
+	instancesGetCmd = &cobra.Command{
+		Use:   "get",
+		Short: "Fetch a service instance",
+		Long:  "Fetch a service instance, including its current parameters and dashboard URL",
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.CheckFlags(&instancesFlags.instanceID)
+
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			client := httpAdapterFromFlag()
+			brokerURL, err := instancesFlags.BrokerURL()
+			if err != nil {
+				log.Fatalf("Error fetching instance %s: %v", instancesFlags.instanceID, err)
+			}
+			resolveNames(ctx, client, instancesFlags.apiVersion, brokerURL, &instancesFlags.serviceID, &instancesFlags.planID, instancesFlags.serviceName, instancesFlags.planName)
+
+			if err := checkRetrievable(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, false); err != nil {
+				log.Fatalf("Error fetching instance %s in broker %s: %v", instancesFlags.instanceID, brokerURL, err)
+			}
+			res, err := client.GetInstance(ctx, &adapter.GetInstanceParams{
+				Server:     brokerURL,
+				APIVersion: instancesFlags.apiVersion,
+				InstanceID: instancesFlags.instanceID,
+				ServiceID:  instancesFlags.serviceID,
+				PlanID:     instancesFlags.planID,
+			})
+			if err != nil {
+				log.Fatalf("Error fetching instance %s in broker %s: %v", instancesFlags.instanceID, brokerURL, err)
+			}
+
+			printResult(res, nil, func() {
+				fmt.Printf("Successfully fetched the instance %s:\n", instancesFlags.instanceID)
+				fmt.Printf("   Service: %s\n", res.ServiceID)
+				fmt.Printf("   Plan: %s\n", res.PlanID)
+				if res.DashboardURL != "" {
+					fmt.Printf("   Dashboard URL: %s\n", res.DashboardURL)
+				}
+				if res.MaintenanceInfo != nil {
+					fmt.Printf("   Maintenance info: %s %s\n", res.MaintenanceInfo.Version, res.MaintenanceInfo.Description)
+				}
+				fmt.Printf("   Parameters: %s\n", formatObjectMap(res.Parameters))
+			})
+		},
+	}
+
 	instancesPollCmd = &cobra.Command{
 		Use:   "poll",
 		Short: "Poll the operation for the service instance",
@@ -255,18 +486,68 @@ var (
 		Run: func(cmd *cobra.Command, args []string) {
 			flags.CheckFlags(&instancesFlags.instanceID)
 
+			ctx, cancel := contextFromFlag()
+			defer cancel()
 			client := httpAdapterFromFlag()
 			brokerURL, err := instancesFlags.BrokerURL()
 			if err != nil {
 				log.Fatalf("Error polling operation %s for instance %s: %v", instancesFlags.operationID, instancesFlags.instanceID, err)
 			}
-			pollInstanceOp := pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID, instancesFlags.planID, instancesFlags.operationID, adapter.OperationUnknown)
-			op, err := pollInstanceOp()
+			resolveNames(ctx, client, instancesFlags.apiVersion, brokerURL, &instancesFlags.serviceID, &instancesFlags.planID, instancesFlags.serviceName, instancesFlags.planName)
+			opType := fillInstanceFlags(brokerURL, instancesFlags.instanceID, &instancesFlags.serviceID, &instancesFlags.planID, &instancesFlags.operationID)
+			pollInstanceOp := pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID, instancesFlags.planID, instancesFlags.operationID, opType)
+			op, err := pollInstanceOp(ctx)
 			if err != nil {
 				log.Fatalf("Error polling operation %q for instance %s in broker %s: %v", instancesFlags.operationID, instancesFlags.instanceID, brokerURL, err)
 			}
+			if opType != adapter.OperationUnknown {
+				recordInstanceOperation(brokerURL, instancesFlags.instanceID, instancesFlags.operationID, inventoryOperationType(opType), op)
+			}
+
+			printResult(op, nil, func() {
+				fmt.Printf("Successfully polled the operation %q for instance %s in broker %s: %+v\n", instancesFlags.operationID, instancesFlags.instanceID, brokerURL, *op)
+			})
+		},
+	}
+
+	instancesWaitCmd = &cobra.Command{
+		Use:   "wait",
+		Short: "Wait for the operation for the service instance to finish",
+		Long: "Poll the operation for the service instance until it finishes, e.g. to resume waiting after --wait-timeout. " +
+			"The command fails if the operation fails.",
+		Run: func(cmd *cobra.Command, args []string) {
+			flags.CheckFlags(&instancesFlags.instanceID)
+
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			client := httpAdapterFromFlag()
+			brokerURL, err := instancesFlags.BrokerURL()
+			if err != nil {
+				log.Fatalf("Error waiting on operation %s for instance %s: %v", instancesFlags.operationID, instancesFlags.instanceID, err)
+			}
+			resolveNames(ctx, client, instancesFlags.apiVersion, brokerURL, &instancesFlags.serviceID, &instancesFlags.planID, instancesFlags.serviceName, instancesFlags.planName)
+			opType := fillInstanceFlags(brokerURL, instancesFlags.instanceID, &instancesFlags.serviceID, &instancesFlags.planID, &instancesFlags.operationID)
+			op, err := waitOnOperation(ctx, pollInstanceOpFunc(client, instancesFlags.apiVersion, brokerURL, instancesFlags.instanceID, instancesFlags.serviceID,
+				instancesFlags.planID, instancesFlags.operationID, opType),
+				maximumPollingDuration(ctx, client, instancesFlags.apiVersion, brokerURL, instancesFlags.serviceID, instancesFlags.planID),
+				liveProgress(fmt.Sprintf("instance %s", instancesFlags.instanceID)))
+			if err != nil {
+				log.Fatalf("Error waiting on operation %q for instance %s in broker %s: %v%s", instancesFlags.operationID, instancesFlags.instanceID, brokerURL, err,
+					waitHint(err, "instances", brokerURL, "instance", instancesFlags.instanceID, "service", instancesFlags.serviceID, "plan", instancesFlags.planID,
+						"operation", instancesFlags.operationID))
+			}
+			if opType != adapter.OperationUnknown {
+				recordInstanceOperation(brokerURL, instancesFlags.instanceID, instancesFlags.operationID, inventoryOperationType(opType), op)
+			}
 
-			fmt.Printf("Successfully polled the operation %q for instance %s in broker %s: %+v\n", instancesFlags.operationID, instancesFlags.instanceID, brokerURL, *op)
+			if op.State == adapter.OperationSucceeded {
+				printResult(op, nil, func() {
+					fmt.Printf("The operation %q for instance %s in broker %s succeeded: %+v\n", instancesFlags.operationID, instancesFlags.instanceID, brokerURL, *op)
+				})
+				return
+			}
+
+			log.Fatalf("The operation %q for instance %s in broker %s failed: %+v\n", instancesFlags.operationID, instancesFlags.instanceID, brokerURL, *op)
 		},
 	}
 )
@@ -274,7 +555,7 @@ var (
 func init() {
 	// Flags for `instances` command group and all subgroups.
 	flags.StringFlag(instancesCmd.PersistentFlags(), &instancesFlags.Server, flags.ServerLongName, flags.ServerShortName,
-		fmt.Sprintf("[Required if %s and %s are not given] Broker URL to make request to (https://...).", flags.ProjectLongName, flags.BrokerLongName))
+		fmt.Sprintf("[Required if %s and %s are not given] Broker URL to make request to (https://...). Any OSB broker URL is accepted.", flags.ProjectLongName, flags.BrokerLongName))
 	flags.StringFlagWithDefault(instancesCmd.PersistentFlags(), &instancesFlags.apiVersion,
 		flags.ApiVersionLongName, flags.ApiVersionShortName, flags.ApiVersionDefault, flags.ApiVersionDescription)
 	flags.StringFlag(instancesCmd.PersistentFlags(), &instancesFlags.Project, flags.ProjectLongName, flags.ProjectShortName,
@@ -291,76 +572,149 @@ func init() {
 		"[Required] Service instance ID.")
 	flags.BoolFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.wait, "wait", "w",
 		"[Optional] If specified, the broker will keep polling the last operation. (Default: FALSE)")
+	flags.BoolFlagWithDefault(instancesCreateCmd.PersistentFlags(), &instancesFlags.acceptsIncomplete, "accepts-incomplete", "a", true,
+		"[Optional] If set to false, the broker is asked to process the request synchronously. The request is "+
+			"retried asynchronously if the broker requires it. (Default: TRUE)")
+	flags.BoolFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.orphanMitigation, "orphan-mitigation", "",
+		orphanMitigationUsage("instance"))
 	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.serviceID, "service", "r",
-		"[Required] The service ID used to create the service instance.")
+		"[Required unless --service-name is given] The service ID used to create the service instance.")
 	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.planID, "plan", "l",
-		"[Required] The plan ID used to create the service instance.")
+		"[Required unless --plan-name is given] The plan ID used to create the service instance.")
+	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.serviceName, "service-name", "",
+		nameFlagUsage("service"))
+	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.planName, "plan-name", "",
+		nameFlagUsage("plan"))
 	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.context, "context", "t",
 		"[Optional] [JSON Object] Platform specific contextual information under which the service "+
 			"instance is to be provisioned.")
-	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.organizationGUID, "organization", "o",
+	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.organizationGUID, "organization", "",
 		"[Optional] [Deprecated in favor of 'Context'] The platform GUID for the organization under"+
 			" which the service instance is to be provisioned.")
 	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.spaceGUID, "space", "e",
 		"[Optional] [Deprecated in favor of 'Context'] The identifier for the project space within "+
 			"the platform organization.")
 	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.parameters, "parameters", "m",
-		"[Optional] [JSON Object] Configuration options for the service instance.")
+		"[Optional] [JSON Object] Configuration options for the service instance. Takes precedence over --parameters-file.")
+	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.parametersFile, "parameters-file", "",
+		"[Optional] A JSON or YAML file with configuration options for the service instance, or - to read them from stdin.")
+	flags.StringArrayFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.params, "param", "",
+		"[Optional] A configuration option given as key.path=value, which takes precedence over --parameters and --parameters-file. "+
+			"The value is converted to the type declared by the JSON schema of the plan. Can be repeated.")
+	flags.StringFlag(instancesCreateCmd.PersistentFlags(), &instancesFlags.contextFile, "context-file", "",
+		"[Optional] A JSON or YAML file with the contextual information of the service instance, or - to read it from stdin. "+
+			"--context takes precedence over it.")
+	flags.StringFlagWithDefault(instancesCreateCmd.PersistentFlags(), &instancesFlags.validate, "validate", "", validateStrict,
+		"[Optional] How the parameters are validated against the JSON schema of the plan in the broker catalog before sending them: "+
+			"strict fails on violations, warn prints them and off skips validation.")
 
 	// Flags for `instances delete` command group.
 	flags.StringFlag(instancesDeleteCmd.PersistentFlags(), &instancesFlags.instanceID, "instance", "i",
 		"[Required] Service instance ID.")
 	flags.BoolFlag(instancesDeleteCmd.PersistentFlags(), &instancesFlags.wait, "wait", "w",
 		"[Optional] If specified, the broker will keep polling the last operation. (Default: FALSE)")
+	flags.BoolFlagWithDefault(instancesDeleteCmd.PersistentFlags(), &instancesFlags.acceptsIncomplete, "accepts-incomplete", "a", true,
+		"[Optional] If set to false, the broker is asked to process the request synchronously. The request is "+
+			"retried asynchronously if the broker requires it. (Default: TRUE)")
 	flags.StringFlag(instancesDeleteCmd.PersistentFlags(), &instancesFlags.serviceID, "service", "r",
-		"[Required] The service ID used by the service instance.")
+		"[Required unless --service-name is given or the instance is in the inventory] The service ID used by the service instance.")
 	flags.StringFlag(instancesDeleteCmd.PersistentFlags(), &instancesFlags.planID, "plan", "l",
-		"[Required] The plan ID used by the service instance.")
+		"[Required unless --plan-name is given or the instance is in the inventory] The plan ID used by the service instance.")
+	flags.StringFlag(instancesDeleteCmd.PersistentFlags(), &instancesFlags.serviceName, "service-name", "",
+		nameFlagUsage("service"))
+	flags.StringFlag(instancesDeleteCmd.PersistentFlags(), &instancesFlags.planName, "plan-name", "",
+		nameFlagUsage("plan"))
 
 	// Flags for `instances update` command group.
 	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.instanceID, "instance", "i",
 		"[Required] Service instance ID.")
 	flags.BoolFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.wait, "wait", "w",
 		"[Optional] If specified, the broker will keep polling the last operation. (Default: FALSE)")
+	flags.BoolFlagWithDefault(instancesUpdateCmd.PersistentFlags(), &instancesFlags.acceptsIncomplete, "accepts-incomplete", "a", true,
+		"[Optional] If set to false, the broker is asked to process the request synchronously. The request is "+
+			"retried asynchronously if the broker requires it. (Default: TRUE)")
 	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.serviceID, "service", "r",
-		"[Required] The service ID used by the service instance.")
+		"[Required unless --service-name is given] The service ID used by the service instance.")
 	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.planID, "plan", "l",
 		"[Optional] The plan ID used by the service instance.")
+	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.serviceName, "service-name", "",
+		nameFlagUsage("service"))
+	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.planName, "plan-name", "",
+		nameFlagUsage("plan"))
 	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.context, "context", "t",
 		"[Optional] [JSON Object] Platform specific contextual information under which the service "+
 			"instance is provisioned.")
 	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.parameters, "parameters", "m",
-		"[Optional] [JSON Object] Configuration options for the service instance.")
+		"[Optional] [JSON Object] Configuration options for the service instance. Takes precedence over --parameters-file.")
+	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.parametersFile, "parameters-file", "",
+		"[Optional] A JSON or YAML file with configuration options for the service instance, or - to read them from stdin.")
+	flags.StringArrayFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.params, "param", "",
+		"[Optional] A configuration option given as key.path=value, which takes precedence over --parameters and --parameters-file. "+
+			"The value is converted to the type declared by the JSON schema of the plan. Can be repeated.")
+	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.contextFile, "context-file", "",
+		"[Optional] A JSON or YAML file with the contextual information of the service instance, or - to read it from stdin. "+
+			"--context takes precedence over it.")
+	flags.StringFlagWithDefault(instancesUpdateCmd.PersistentFlags(), &instancesFlags.validate, "validate", "", validateStrict,
+		"[Optional] How the parameters are validated against the JSON schema of the plan in the broker catalog before sending them: "+
+			"strict fails on violations, warn prints them and off skips validation.")
 	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.previousServiceID, "oldservice", "f",
 		"[Optional] [Deprecated because it is immutable] The service ID used by the service instance.")
 	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.previousPlanID, "oldplan", "n",
 		"[Optional] The plan ID used by the service instance prior to the update.")
-	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.previousOrganizationID, "oldorganization", "o",
+	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.previousOrganizationID, "oldorganization", "",
 		"[Optional] [Deprecated in favor of 'Context'] ID of the organization specified for the service instance.")
 	flags.StringFlag(instancesUpdateCmd.PersistentFlags(), &instancesFlags.previousSpaceID, "oldspace", "e",
 		"[Optional] [Deprecated in favor of 'Context'] ID of the space specified for the service instance.")
 
-	// Flags for `instances poll` command group.
-	flags.StringFlag(instancesPollCmd.PersistentFlags(), &instancesFlags.instanceID, "instance", "i",
+	// Flags for `instances get` command group.
+	flags.StringFlag(instancesGetCmd.PersistentFlags(), &instancesFlags.instanceID, "instance", "i",
 		"[Required] Service instance ID.")
-	flags.StringFlag(instancesPollCmd.PersistentFlags(), &instancesFlags.serviceID, "service", "r",
-		"[Optional] The service ID used to create the service instance. If present, must not be an empty string.")
-	flags.StringFlag(instancesPollCmd.PersistentFlags(), &instancesFlags.planID, "plan", "l",
-		"[Optional] The plan ID used to create the service instance. If present, must not be an empty string.")
-	flags.StringFlag(instancesPollCmd.PersistentFlags(), &instancesFlags.operationID, "operation", "o",
-		"[Optional] The operation ID used to poll the operation for the service instance. If present, must not be an empty string.")
+	flags.StringFlag(instancesGetCmd.PersistentFlags(), &instancesFlags.serviceID, "service", "r",
+		"[Optional] The service ID used by the service instance.")
+	flags.StringFlag(instancesGetCmd.PersistentFlags(), &instancesFlags.planID, "plan", "l",
+		"[Optional] The plan ID used by the service instance.")
+	flags.StringFlag(instancesGetCmd.PersistentFlags(), &instancesFlags.serviceName, "service-name", "",
+		nameFlagUsage("service"))
+	flags.StringFlag(instancesGetCmd.PersistentFlags(), &instancesFlags.planName, "plan-name", "",
+		nameFlagUsage("plan"))
+
+	// Flags for `instances poll` and `instances wait` command groups.
+	for _, cmd := range []*cobra.Command{instancesPollCmd, instancesWaitCmd} {
+		flags.StringFlag(cmd.PersistentFlags(), &instancesFlags.instanceID, "instance", "i",
+			"[Required] Service instance ID.")
+		flags.StringFlag(cmd.PersistentFlags(), &instancesFlags.serviceID, "service", "r",
+			"[Optional] The service ID used to create the service instance. If present, must not be an empty string.")
+		flags.StringFlag(cmd.PersistentFlags(), &instancesFlags.planID, "plan", "l",
+			"[Optional] The plan ID used to create the service instance. If present, must not be an empty string.")
+		flags.StringFlag(cmd.PersistentFlags(), &instancesFlags.serviceName, "service-name", "",
+			nameFlagUsage("service"))
+		flags.StringFlag(cmd.PersistentFlags(), &instancesFlags.planName, "plan-name", "",
+			nameFlagUsage("plan"))
+		flags.StringFlag(cmd.PersistentFlags(), &instancesFlags.operationID, "operation", "",
+			"[Optional] The operation ID used to poll the operation for the service instance. If present, must not be an empty string. "+
+				"(Default: the operation in progress recorded in the inventory)")
+	}
+
+	// Flags for `instances list` command group.
+	flags.IntFlag(instancesListCmd.PersistentFlags(), &instancesFlags.pageSize, "page-size", "", 0,
+		pageSizeUsage)
+	flags.IntFlag(instancesListCmd.PersistentFlags(), &instancesFlags.limit, "limit", "", 0,
+		"[Optional] Maximum number of instances to list. (Default: 0, i.e. all of them)")
+	flags.BoolFlag(instancesListCmd.PersistentFlags(), &instancesFlags.AdminAPI, flags.AdminAPILongName, "", flags.AdminAPIDescription)
 
 	RootCmd.AddCommand(instancesCmd)
 	instancesCmd.AddCommand(instancesCreateCmd)
 	instancesCmd.AddCommand(instancesListCmd)
 	instancesCmd.AddCommand(instancesDeleteCmd)
 	instancesCmd.AddCommand(instancesUpdateCmd)
+	instancesCmd.AddCommand(instancesGetCmd)
 	instancesCmd.AddCommand(instancesPollCmd)
+	instancesCmd.AddCommand(instancesWaitCmd)
 }
 
-func pollInstanceOpFunc(client adapter.Adapter, apiVersion, brokerURL, instanceID, serviceID, planID, opID string, opType adapter.OperationType) func() (*adapter.Operation, error) {
-	cb := func() (*adapter.Operation, error) {
-		return client.InstanceLastOperation(&adapter.InstanceLastOperationParams{
+func pollInstanceOpFunc(client adapter.Adapter, apiVersion, brokerURL, instanceID, serviceID, planID, opID string, opType adapter.OperationType) func(context.Context) (*adapter.Operation, error) {
+	cb := func(ctx context.Context) (*adapter.Operation, error) {
+		return client.InstanceLastOperation(ctx, &adapter.InstanceLastOperationParams{
 			Server:     brokerURL,
 			InstanceID: instanceID,
 			LastOperationParams: &adapter.LastOperationParams{
@@ -375,97 +729,173 @@ func pollInstanceOpFunc(client adapter.Adapter, apiVersion, brokerURL, instanceI
 	return cb
 }
 
-func listInstances(client adapter.Adapter, brokerURL string) (*listInstancesResult, error) {
-	lir, err := client.ListInstances(&adapter.ListInstancesParams{Server: brokerURL})
+// updatedPlanID returns the plan of the instance after the update requested by the flags.
+func updatedPlanID() string {
+	if instancesFlags.planID != "" {
+		return instancesFlags.planID
+	}
+	return instancesFlags.previousPlanID
+}
+
+// listInstances lists the instances of the broker along with their bindings, see forEachInstance.
+// The result is marked as truncated if the broker has more than limit instances.
+func listInstances(ctx context.Context, client adapter.Adapter, brokerURL string, pageSize, limit int) (*listInstancesResult, error) {
+	result := &listInstancesResult{Instances: []*instance{}}
+	truncated, err := forEachInstance(ctx, client, brokerURL, pageSize, limit, func(i *instance) error {
+		result.Instances = append(result.Instances, i)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	result.Truncated = truncated
+	return result, nil
+}
 
-	result := &listInstancesResult{}
-	var instances []*instance
-	for _, i := range lir.Instances {
-		lbr, err := client.ListBindings(&adapter.ListBindingsParams{
-			Server:     brokerURL,
-			InstanceID: i.ID,
-		})
+// forEachInstance calls fn with every instance of the broker along with its bindings, fetching
+// pages of pageSize items from the admin API, or pages of the broker's default size if it is 0, so
+// that only a page is held in memory. At most limit instances are passed to fn unless it is 0, and
+// truncated is true if the broker has more. It stops at the first error, including those of fn.
+func forEachInstance(ctx context.Context, client adapter.Adapter, brokerURL string, pageSize, limit int, fn func(i *instance) error) (truncated bool, err error) {
+	it := adapter.NewInstanceIterator(ctx, client, &adapter.ListInstancesParams{Server: brokerURL, PageSize: pageSize})
+	for n := 0; ; n++ {
+		i, err := it.Next()
+		if err == adapter.IteratorDone {
+			return false, nil
+		}
 		if err != nil {
-			return nil, err
+			return false, err
+		}
+		if limit > 0 && n == limit {
+			return true, nil
 		}
 
-		var bindings []string
-		for _, b := range lbr.Bindings {
-			bindings = append(bindings, b.ID)
+		inst := instanceFromOSB(i)
+		if inst.Bindings, err = listBindingIDs(ctx, client, brokerURL, i.ID, pageSize); err != nil {
+			return false, err
 		}
+		if err := fn(inst); err != nil {
+			return false, err
+		}
+	}
+}
 
-		instances = append(instances, &instance{
-			ID:         i.ID,
-			serviceID:  i.ServiceID,
-			planID:     i.PlanID,
-			createTime: i.CreateTime,
-			bindings:   bindings,
-		})
+// instanceFromOSB returns the instance listed by the admin API, without its bindings.
+func instanceFromOSB(i *osb.Instance) *instance {
+	return &instance{
+		ID:         i.ID,
+		ServiceID:  i.ServiceID,
+		PlanID:     i.PlanID,
+		CreateTime: i.CreateTime,
+		Bindings:   []string{},
 	}
-	result.instances = instances
-	return result, nil
 }
 
-func deleteInstance(client adapter.Adapter, apiVersion, brokerURL string, i *instance, showProgress bool) error {
+// listBindingIDs returns the IDs of the bindings to the instance, fetching pages of pageSize
+// bindings from the admin API.
+func listBindingIDs(ctx context.Context, client adapter.Adapter, brokerURL, instanceID string, pageSize int) ([]string, error) {
+	bindings := []string{}
+	it := adapter.NewBindingIterator(ctx, client, &adapter.ListBindingsParams{Server: brokerURL, InstanceID: instanceID, PageSize: pageSize})
+	for {
+		b, err := it.Next()
+		if err == adapter.IteratorDone {
+			return bindings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, b.ID)
+	}
+}
+
+func deleteInstance(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL string, i *instance, showProgress bool) error {
+	requestIdentity := newRequestIdentity()
 	if showProgress {
-		fmt.Printf("Deleting instance %q in broker %q\n", i.ID, brokerURL)
+		infof("Deleting instance %q in broker %q with request identity %s\n", i.ID, brokerURL, requestIdentity)
 	}
 
-	res, err := client.DeleteInstance(&adapter.DeleteInstanceParams{
-		Server:            brokerURL,
-		InstanceID:        i.ID,
-		ServiceID:         i.serviceID,
-		PlanID:            i.planID,
-		AcceptsIncomplete: true,
-		APIVersion:        apiVersion,
+	// Cleanup may race with operations still in progress, so give them a chance to finish.
+	var res *adapter.DeleteInstanceResult
+	err := retryOnConcurrencyError(ctx, func() error {
+		var err error
+		res, err = client.DeleteInstance(ctx, &adapter.DeleteInstanceParams{
+			Server:              brokerURL,
+			InstanceID:          i.ID,
+			ServiceID:           i.ServiceID,
+			PlanID:              i.PlanID,
+			AcceptsIncomplete:   true,
+			OriginatingIdentity: originatingIdentityFromFlag(ctx),
+			RequestIdentity:     requestIdentity,
+			APIVersion:          apiVersion,
+		})
+		return err
 	})
 	if err != nil {
 		return err
 	}
+	if !res.Async {
+		recordInstanceOperation(brokerURL, i.ID, "", inventory.OperationDelete, &adapter.Operation{State: adapter.OperationSucceeded})
+		return nil
+	}
 
-	op, err := waitOnOperation(pollInstanceOpFunc(client, apiVersion, brokerURL, i.ID, i.serviceID, i.planID, res.OperationID, adapter.OperationDelete), showProgress)
+	op, err := waitOnOperation(ctx, pollInstanceOpFunc(client, apiVersion, brokerURL, i.ID, i.ServiceID, i.PlanID, res.OperationID, adapter.OperationDelete),
+		maximumPollingDuration(ctx, client, apiVersion, brokerURL, i.ServiceID, i.PlanID), nil)
 	if err != nil {
 		return fmt.Errorf("Error polling last operation %q for instance %q in broker %q: %v", res.OperationID, i.ID, brokerURL, err)
 	}
 
+	recordInstanceOperation(brokerURL, i.ID, res.OperationID, inventory.OperationDelete, op)
 	if op.State == adapter.OperationSucceeded {
-		if showProgress {
-			fmt.Print("Done\n")
-		}
 		return nil
 	}
 
-	return fmt.Errorf("Failed to delete instance %q in broker %q: %+v", i.ID, brokerURL, *op)
+	return &operationFailedError{msg: fmt.Sprintf("Failed to delete instance %q in broker %q: %+v", i.ID, brokerURL, *op)}
 }
 
-func printListInstances(client adapter.Adapter, result *listInstancesResult, brokerURL string) {
-	servicesMap := make(map[string]string)
-	plansMap := make(map[string]string)
-	res, err := client.GetCatalog(&adapter.GetCatalogParams{
-		APIVersion: catalogFlags.apiVersion,
-		Server:     brokerURL,
-	})
-	if err == nil {
-		for _, s := range res.Services {
-			for _, p := range s.Plans {
-				plansMap[p.ID] = p.Name
-			}
-			servicesMap[s.ID] = s.Name
-		}
+// resolveInstanceNames sets the service and plan names of the instances from the catalog of the
+// broker. Names are left empty if the catalog can't be fetched.
+func resolveInstanceNames(ctx context.Context, client adapter.Adapter, result *listInstancesResult, apiVersion, brokerURL string) {
+	res, err := cachedCatalog(ctx, client, apiVersion, brokerURL)
+	if err != nil {
+		return
 	}
-
-	for index, i := range result.instances {
-		fmt.Printf("%d. Instance ID: %s\n", index+1, i.ID)
-		if name, ok := servicesMap[i.serviceID]; ok {
-			i.serviceID = name + " (" + i.serviceID + ")"
+	for _, i := range result.Instances {
+		svc, plan := res.FindPlan(i.ServiceID, i.PlanID)
+		if svc != nil {
+			i.ServiceName = svc.Name
 		}
-		if name, ok := plansMap[i.planID]; ok {
-			i.planID = name + " (" + i.planID + ")"
+		if plan != nil {
+			i.PlanName = plan.Name
 		}
-		fmt.Printf("   Service: %s, Plan: %s\n", i.serviceID, i.planID)
-		fmt.Printf("   Number of bindings: %d\n\n", len(i.bindings))
 	}
 }
+
+func printListInstances(ctx context.Context, client adapter.Adapter, result *listInstancesResult, apiVersion, brokerURL string) {
+	resolveInstanceNames(ctx, client, result, apiVersion, brokerURL)
+	for index, i := range result.Instances {
+		printInstance(index+1, i)
+	}
+}
+
+// printInstance prints the instance as the given item of a numbered list.
+func printInstance(number int, i *instance) {
+	fmt.Printf("%d. Instance ID: %s\n", number, i.ID)
+	fmt.Printf("   Service: %s, Plan: %s\n", nameAndID(i.ServiceName, i.ServiceID), nameAndID(i.PlanName, i.PlanID))
+	fmt.Printf("   Number of bindings: %d\n\n", len(i.Bindings))
+}
+
+// instanceColumns are the columns of the table printed for --output=table, see instanceRow.
+var instanceColumns = []string{"instance id", "service", "plan", "bindings"}
+
+// instanceRow returns the row of the instance in the table printed for --output=table.
+func instanceRow(i *instance) []string {
+	return []string{i.ID, nameAndID(i.ServiceName, i.ServiceID), nameAndID(i.PlanName, i.PlanID), fmt.Sprint(len(i.Bindings))}
+}
+
+// nameAndID returns "name (id)", or only the ID if the name is unknown.
+func nameAndID(name, id string) string {
+	if name == "" {
+		return id
+	}
+	return name + " (" + id + ")"
+}
@@ -0,0 +1,538 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/inventory"
+	"github.com/spf13/cobra"
+)
+
+// inventoryChange is an instance or binding added to, updated in or removed from the inventory.
+type inventoryChange struct {
+	BrokerURL  string `json:"broker_url"`
+	InstanceID string `json:"instance_id"`
+	BindingID  string `json:"binding_id,omitempty"`
+	// Reason explains why the resource was kept by prune.
+	Reason string `json:"reason,omitempty"`
+}
+
+// pruneInventoryResult is the output of inventory prune.
+type pruneInventoryResult struct {
+	Pruned []*inventoryChange `json:"pruned"`
+	// Kept are the resources whose existence couldn't be checked.
+	Kept   []*inventoryChange `json:"kept"`
+	DryRun bool               `json:"dry_run"`
+}
+
+// importInventoryResult is the output of inventory import.
+type importInventoryResult struct {
+	Imported []*inventoryChange `json:"imported"`
+	Updated  []*inventoryChange `json:"updated"`
+}
+
+var (
+	inventoryFlags struct {
+		flags.BrokerURLConstructor
+		apiVersion string
+		olderThan  time.Duration
+		dryRun     bool
+	}
+
+	// inventoryMu serializes updates of the inventory file by concurrent requests of the command.
+	// Other broker-cli processes are excluded by the lock of the inventory, see inventory.Lock.
+	inventoryMu sync.Mutex
+
+	inventoryCmd = &cobra.Command{
+		Use:   "inventory",
+		Short: "Manage the local inventory of service instances and bindings",
+		Long: "Manage the local inventory of service instances and bindings.\n" +
+			"broker-cli records the instances and bindings it creates, with their service, plan and operation IDs, " +
+			"so that they don't need to be given to delete and poll them.",
+	}
+
+	inventoryListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the instances and bindings in the inventory",
+		Long:  "List the instances and bindings in the inventory, optionally only those of a single broker",
+		Run: func(cmd *cobra.Command, args []string) {
+			inv := loadInventory()
+			filterInventory(inv, inventoryBrokerURLFilter())
+
+			printResult(inv, inventoryTable(inv), func() {
+				if len(inv.Instances) == 0 && len(inv.Bindings) == 0 {
+					fmt.Println("The inventory has no instances or bindings")
+					return
+				}
+				printInventory(inv)
+			})
+		},
+	}
+
+	inventoryPruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove instances and bindings which no longer exist from the inventory",
+		Long: "Remove instances and bindings which no longer exist from the inventory.\n" +
+			"Resources are looked up with the last_operation endpoint of their broker, which responds 410 Gone once they are deleted. " +
+			"With --older-than, resources which haven't changed for the given duration are removed instead, without contacting brokers.",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			inv := loadInventory()
+			filterInventory(inv, inventoryBrokerURLFilter())
+
+			var client adapter.Adapter
+			if inventoryFlags.olderThan <= 0 {
+				client = httpAdapterFromFlag()
+			}
+			res := pruneInventory(ctx, client, inv)
+			if !inventoryFlags.dryRun {
+				updateInventory(func(inv *inventory.Inventory) {
+					for _, c := range res.Pruned {
+						if c.BindingID == "" {
+							inv.RemoveInstance(c.BrokerURL, c.InstanceID)
+						} else {
+							inv.RemoveBinding(c.BrokerURL, c.InstanceID, c.BindingID)
+						}
+					}
+				})
+			}
+
+			printResult(res, nil, func() {
+				verb := "Removed"
+				if res.DryRun {
+					verb = "Would remove"
+				}
+				for _, c := range res.Pruned {
+					fmt.Printf("%s %s\n", verb, describeInventoryChange(c))
+				}
+				for _, c := range res.Kept {
+					fmt.Printf("Kept %s: %s\n", describeInventoryChange(c), c.Reason)
+				}
+				fmt.Printf("%s %d and kept %d resources\n", verb, len(res.Pruned), len(res.Kept))
+			})
+		},
+	}
+
+	inventoryImportCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Import the instances and bindings of a broker into the inventory",
+		Long: "Import the instances and bindings of a broker into the inventory, using the admin API which lists them. " +
+			"It is served by GCP brokers, and by other brokers given with --server and --admin-api which implement it, such as the fake broker.",
+		Run: func(cmd *cobra.Command, args []string) {
+			checkAdminFlags("Importing instances", &inventoryFlags.BrokerURLConstructor)
+			brokerURL, err := inventoryFlags.AdminBrokerURL()
+			if err != nil {
+				log.Fatalf("Error importing instances: %v", err)
+			}
+
+			ctx, cancel := contextFromFlag()
+			defer cancel()
+			client := httpAdapterFromFlag()
+			lir, err := listInstances(ctx, client, brokerURL, 0, 0)
+			if err != nil {
+				log.Fatalf("Error listing instances in broker %s: %v", brokerURL, err)
+			}
+
+			res := &importInventoryResult{Imported: []*inventoryChange{}, Updated: []*inventoryChange{}}
+			updateInventory(func(inv *inventory.Inventory) {
+				importInstances(inv, brokerURL, lir, res)
+			})
+
+			printResult(res, nil, func() {
+				fmt.Printf("Imported %d and updated %d instances and bindings of broker %s into the inventory\n", len(res.Imported), len(res.Updated), brokerURL)
+			})
+		},
+	}
+)
+
+func init() {
+	flags.StringFlag(inventoryCmd.PersistentFlags(), &inventoryFlags.Server, flags.ServerLongName, flags.ServerShortName,
+		"[Optional] Only use the resources of the broker with this URL.")
+	flags.StringFlagWithDefault(inventoryCmd.PersistentFlags(), &inventoryFlags.apiVersion,
+		flags.ApiVersionLongName, flags.ApiVersionShortName, flags.ApiVersionDefault, flags.ApiVersionDescription)
+	flags.StringFlag(inventoryCmd.PersistentFlags(), &inventoryFlags.Project, flags.ProjectLongName, flags.ProjectShortName,
+		fmt.Sprintf("[Optional] The GCP project of the broker, instead of %s", flags.ServerLongName))
+	flags.StringFlag(inventoryCmd.PersistentFlags(), &inventoryFlags.Broker, flags.BrokerLongName, flags.BrokerShortName,
+		fmt.Sprintf("[Optional] The GCP broker name, instead of %s", flags.ServerLongName))
+	inventoryCmd.PersistentFlags().StringVar(&inventoryFlags.Host, flags.HostLongName, flags.HostBrokerDefault, "")
+	inventoryCmd.PersistentFlags().MarkHidden(flags.HostLongName)
+
+	flags.DurationFlag(inventoryPruneCmd.PersistentFlags(), &inventoryFlags.olderThan, "older-than", "", 0,
+		"[Optional] Remove the resources which haven't changed for this duration, e.g. 720h, without checking whether they still exist.")
+	flags.BoolFlag(inventoryImportCmd.PersistentFlags(), &inventoryFlags.AdminAPI, flags.AdminAPILongName, "", flags.AdminAPIDescription)
+	flags.BoolFlag(inventoryPruneCmd.PersistentFlags(), &inventoryFlags.dryRun, "dry-run", "",
+		"[Optional] If specified, print the resources which would be removed without removing them. (Default: FALSE)")
+
+	RootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.AddCommand(inventoryListCmd, inventoryPruneCmd, inventoryImportCmd)
+}
+
+// defaultInventoryPath returns the path of the inventory in the user config directory, or "" if
+// there is none.
+func defaultInventoryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "broker-cli", "inventory.json")
+}
+
+// inventoryEnabled returns whether resources are recorded in the inventory. Replayed responses
+// don't reflect real resources, so they aren't recorded.
+func inventoryEnabled() bool {
+	return inventoryFlag != "" && replayFlag == ""
+}
+
+// loadInventory returns the inventory given by inventoryFlag. It is empty if the inventory is
+// disabled or can't be read, so that commands don't fail because of it.
+func loadInventory() *inventory.Inventory {
+	if !inventoryEnabled() {
+		return &inventory.Inventory{}
+	}
+	inv, err := inventory.Load(inventoryFlag)
+	if err != nil {
+		infof("Warning: ignoring the inventory: %v\n", err)
+		return &inventory.Inventory{}
+	}
+	return inv
+}
+
+// updateInventory applies update to the inventory and saves it. Errors are only reported, since
+// the resources have already been changed in the broker.
+func updateInventory(update func(inv *inventory.Inventory)) {
+	if !inventoryEnabled() {
+		return
+	}
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	unlock, err := inventory.Lock(inventoryFlag)
+	if err != nil {
+		infof("Warning: not updating the inventory: %v\n", err)
+		return
+	}
+	defer unlock()
+
+	inv, err := inventory.Load(inventoryFlag)
+	if err != nil {
+		infof("Warning: not updating the inventory: %v\n", err)
+		return
+	}
+	update(inv)
+	if err := inv.Save(inventoryFlag); err != nil {
+		infof("Warning: not updating the inventory: %v\n", err)
+	}
+}
+
+// inventoryOperation returns the operation recorded in the inventory for an asynchronous request,
+// or nil if the request completed synchronously.
+func inventoryOperation(async bool, opID, opType string) *inventory.Operation {
+	if !async {
+		return nil
+	}
+	return &inventory.Operation{ID: opID, Type: opType, State: adapter.OperationInProgress}
+}
+
+// recordInstanceOperation records the state of an operation on an instance. The instance is
+// removed from the inventory once it is deleted.
+func recordInstanceOperation(brokerURL, instanceID, opID, opType string, op *adapter.Operation) {
+	updateInventory(func(inv *inventory.Inventory) {
+		if opType == inventory.OperationDelete && op.State == adapter.OperationSucceeded {
+			inv.RemoveInstance(brokerURL, instanceID)
+			return
+		}
+		if i := inv.FindInstance(brokerURL, instanceID); i != nil {
+			i.LastOperation = &inventory.Operation{ID: opID, Type: opType, State: op.State}
+			inv.PutInstance(i)
+		}
+	})
+}
+
+// recordBindingOperation records the state of an operation on a binding. The binding is removed
+// from the inventory once it is deleted.
+func recordBindingOperation(brokerURL, instanceID, bindingID, opID, opType string, op *adapter.Operation) {
+	updateInventory(func(inv *inventory.Inventory) {
+		if opType == inventory.OperationDelete && op.State == adapter.OperationSucceeded {
+			inv.RemoveBinding(brokerURL, instanceID, bindingID)
+			return
+		}
+		if b := inv.FindBinding(brokerURL, instanceID, bindingID); b != nil {
+			b.LastOperation = &inventory.Operation{ID: opID, Type: opType, State: op.State}
+			inv.PutBinding(b)
+		}
+	})
+}
+
+// fillInstanceFlags sets the service, plan and operation IDs of an instance which weren't given by
+// flags from the inventory, and returns the type of the operation if its ID was filled in or
+// matches the one in the inventory. operationID may be nil.
+func fillInstanceFlags(brokerURL, instanceID string, serviceID, planID, operationID *string) adapter.OperationType {
+	if *serviceID != "" && *planID != "" && operationID == nil {
+		return adapter.OperationUnknown
+	}
+	i := loadInventory().FindInstance(brokerURL, instanceID)
+	if i == nil {
+		return adapter.OperationUnknown
+	}
+	return fillFromInventory(fmt.Sprintf("instance %s", instanceID), i.ServiceID, i.PlanID, i.LastOperation, serviceID, planID, operationID)
+}
+
+// fillBindingFlags is like fillInstanceFlags for a binding.
+func fillBindingFlags(brokerURL, instanceID, bindingID string, serviceID, planID, operationID *string) adapter.OperationType {
+	if *serviceID != "" && *planID != "" && operationID == nil {
+		return adapter.OperationUnknown
+	}
+	b := loadInventory().FindBinding(brokerURL, instanceID, bindingID)
+	if b == nil {
+		return adapter.OperationUnknown
+	}
+	return fillFromInventory(fmt.Sprintf("binding %s", bindingID), b.ServiceID, b.PlanID, b.LastOperation, serviceID, planID, operationID)
+}
+
+// fillFromInventory fills in the service and plan IDs from those recorded in the inventory for the
+// resource, unless the flags set them to a different service or plan, and the operation ID from its
+// last operation if that is still in progress. resource names the resource in the messages. It
+// returns the type of the operation if operationID is that recorded operation, or
+// adapter.OperationUnknown otherwise.
+func fillFromInventory(resource, invServiceID, invPlanID string, invOp *inventory.Operation, serviceID, planID, operationID *string) adapter.OperationType {
+	if *serviceID == "" && *planID == "" {
+		*serviceID, *planID = invServiceID, invPlanID
+		infof("Using service %s and plan %s of %s from the inventory\n", invServiceID, invPlanID, resource)
+	} else if *serviceID == "" && *planID == invPlanID {
+		*serviceID = invServiceID
+	} else if *planID == "" && *serviceID == invServiceID {
+		*planID = invPlanID
+	}
+
+	if operationID == nil || invOp == nil {
+		return adapter.OperationUnknown
+	}
+	if *operationID == "" && invOp.State == adapter.OperationInProgress {
+		*operationID = invOp.ID
+		infof("Polling the %s operation %q of %s from the inventory\n", invOp.Type, invOp.ID, resource)
+	}
+	if *operationID != invOp.ID {
+		return adapter.OperationUnknown
+	}
+	switch invOp.Type {
+	case inventory.OperationCreate:
+		return adapter.OperationCreate
+	case inventory.OperationUpdate:
+		return adapter.OperationUpdate
+	case inventory.OperationDelete:
+		return adapter.OperationDelete
+	default:
+		return adapter.OperationUnknown
+	}
+}
+
+// inventoryOperationType returns the type of operation recorded in the inventory for an OSB
+// operation type.
+func inventoryOperationType(opType adapter.OperationType) string {
+	switch opType {
+	case adapter.OperationCreate:
+		return inventory.OperationCreate
+	case adapter.OperationUpdate:
+		return inventory.OperationUpdate
+	case adapter.OperationDelete:
+		return inventory.OperationDelete
+	default:
+		return ""
+	}
+}
+
+// inventoryBrokerURLFilter returns the broker URL given by flags, or "" if none is given.
+func inventoryBrokerURLFilter() string {
+	if inventoryFlags.Server == "" && inventoryFlags.Project == "" && inventoryFlags.Broker == "" {
+		return ""
+	}
+	brokerURL, err := inventoryFlags.BrokerURL()
+	if err != nil {
+		log.Fatalf("Error reading the inventory: %v", err)
+	}
+	return brokerURL
+}
+
+// filterInventory removes the resources of other brokers than brokerURL from inv, unless brokerURL
+// is empty.
+func filterInventory(inv *inventory.Inventory, brokerURL string) {
+	instances := []*inventory.Instance{}
+	for _, i := range inv.Instances {
+		if brokerURL == "" || i.BrokerURL == brokerURL {
+			instances = append(instances, i)
+		}
+	}
+	bindings := []*inventory.Binding{}
+	for _, b := range inv.Bindings {
+		if brokerURL == "" || b.BrokerURL == brokerURL {
+			bindings = append(bindings, b)
+		}
+	}
+	inv.Instances, inv.Bindings = instances, bindings
+}
+
+// pruneInventory returns the resources of inv which no longer exist, or which are older than
+// --older-than. client may be nil with --older-than.
+func pruneInventory(ctx context.Context, client adapter.Adapter, inv *inventory.Inventory) *pruneInventoryResult {
+	res := &pruneInventoryResult{Pruned: []*inventoryChange{}, Kept: []*inventoryChange{}, DryRun: inventoryFlags.dryRun}
+	prunedInstances := make(map[string]bool)
+	// check adds the resource to the result, and returns whether it is pruned.
+	check := func(change *inventoryChange, updatedAt time.Time, lastOp func() (*adapter.Operation, error)) bool {
+		if inventoryFlags.olderThan > 0 {
+			if time.Since(updatedAt) < inventoryFlags.olderThan {
+				return false
+			}
+			res.Pruned = append(res.Pruned, change)
+			return true
+		}
+		_, err := lastOp()
+		switch {
+		case adapter.IsGone(err):
+			res.Pruned = append(res.Pruned, change)
+			return true
+		case err != nil:
+			change.Reason = fmt.Sprintf("can't check whether it exists: %v", err)
+			res.Kept = append(res.Kept, change)
+		}
+		return false
+	}
+
+	for _, i := range inv.Instances {
+		i := i
+		change := &inventoryChange{BrokerURL: i.BrokerURL, InstanceID: i.InstanceID}
+		pruned := check(change, i.UpdatedAt, func() (*adapter.Operation, error) {
+			return pollInstanceOpFunc(client, inventoryFlags.apiVersion, i.BrokerURL, i.InstanceID, i.ServiceID, i.PlanID, lastOperationID(i.LastOperation), adapter.OperationUnknown)(ctx)
+		})
+		if pruned {
+			prunedInstances[i.BrokerURL+"/"+i.InstanceID] = true
+		}
+	}
+	for _, b := range inv.Bindings {
+		b := b
+		if prunedInstances[b.BrokerURL+"/"+b.InstanceID] {
+			// Bindings are removed with their instance.
+			continue
+		}
+		change := &inventoryChange{BrokerURL: b.BrokerURL, InstanceID: b.InstanceID, BindingID: b.BindingID}
+		check(change, b.UpdatedAt, func() (*adapter.Operation, error) {
+			return pollBindingOpFunc(client, inventoryFlags.apiVersion, b.BrokerURL, b.InstanceID, b.BindingID, b.ServiceID, b.PlanID, lastOperationID(b.LastOperation), adapter.OperationUnknown)(ctx)
+		})
+	}
+	return res
+}
+
+// lastOperationID returns the ID of the operation, or "" if op is nil.
+func lastOperationID(op *inventory.Operation) string {
+	if op == nil {
+		return ""
+	}
+	return op.ID
+}
+
+// importInstances adds the instances listed by the admin API of a broker and their bindings to
+// the inventory, or updates their service and plan IDs if they are already in it.
+func importInstances(inv *inventory.Inventory, brokerURL string, lir *listInstancesResult, res *importInventoryResult) {
+	for _, i := range lir.Instances {
+		change := &inventoryChange{BrokerURL: brokerURL, InstanceID: i.ID}
+		if existing := inv.FindInstance(brokerURL, i.ID); existing != nil {
+			existing.ServiceID, existing.PlanID = i.ServiceID, i.PlanID
+			inv.PutInstance(existing)
+			res.Updated = append(res.Updated, change)
+		} else {
+			entry := &inventory.Instance{BrokerURL: brokerURL, InstanceID: i.ID, ServiceID: i.ServiceID, PlanID: i.PlanID, Source: inventory.SourceImported}
+			if t, err := time.Parse(time.RFC3339, i.CreateTime); err == nil {
+				entry.CreatedAt = t
+			}
+			inv.PutInstance(entry)
+			res.Imported = append(res.Imported, change)
+		}
+
+		for _, bindingID := range i.Bindings {
+			change := &inventoryChange{BrokerURL: brokerURL, InstanceID: i.ID, BindingID: bindingID}
+			if existing := inv.FindBinding(brokerURL, i.ID, bindingID); existing != nil {
+				existing.ServiceID, existing.PlanID = i.ServiceID, i.PlanID
+				inv.PutBinding(existing)
+				res.Updated = append(res.Updated, change)
+				continue
+			}
+			inv.PutBinding(&inventory.Binding{BrokerURL: brokerURL, InstanceID: i.ID, BindingID: bindingID, ServiceID: i.ServiceID, PlanID: i.PlanID, Source: inventory.SourceImported})
+			res.Imported = append(res.Imported, change)
+		}
+	}
+}
+
+func describeInventoryChange(c *inventoryChange) string {
+	if c.BindingID == "" {
+		return fmt.Sprintf("instance %s in broker %s", c.InstanceID, c.BrokerURL)
+	}
+	return fmt.Sprintf("binding %s to instance %s in broker %s", c.BindingID, c.InstanceID, c.BrokerURL)
+}
+
+// formatInventoryOperation returns a summary of the last operation of a resource.
+func formatInventoryOperation(op *inventory.Operation) string {
+	if op == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", op.Type, op.State)
+}
+
+// inventoryTable returns the table printed by inventory list, with a row per resource.
+func inventoryTable(inv *inventory.Inventory) *output.Table {
+	table := &output.Table{Columns: []string{"kind", "broker", "instance", "binding", "service", "plan", "last operation", "updated"}}
+	for _, i := range inv.Instances {
+		table.Rows = append(table.Rows, []string{"instance", i.BrokerURL, i.InstanceID, "", i.ServiceID, i.PlanID,
+			formatInventoryOperation(i.LastOperation), i.UpdatedAt.Format(time.RFC3339)})
+	}
+	for _, b := range inv.Bindings {
+		table.Rows = append(table.Rows, []string{"binding", b.BrokerURL, b.InstanceID, b.BindingID, b.ServiceID, b.PlanID,
+			formatInventoryOperation(b.LastOperation), b.UpdatedAt.Format(time.RFC3339)})
+	}
+	return table
+}
+
+func printInventory(inv *inventory.Inventory) {
+	listed := make(map[*inventory.Binding]bool)
+	for index, i := range inv.Instances {
+		fmt.Printf("%d. Instance ID: %s\n", index+1, i.InstanceID)
+		fmt.Printf("   Broker: %s\n", i.BrokerURL)
+		fmt.Printf("   Service: %s, Plan: %s\n", i.ServiceID, i.PlanID)
+		if i.LastOperation != nil {
+			fmt.Printf("   Last operation: %s %q (%s)\n", i.LastOperation.Type, i.LastOperation.ID, i.LastOperation.State)
+		}
+		for _, b := range inv.Bindings {
+			if b.BrokerURL == i.BrokerURL && b.InstanceID == i.InstanceID {
+				fmt.Printf("   Binding: %s\n", b.BindingID)
+				listed[b] = true
+			}
+		}
+		fmt.Printf("   Created: %s, Updated: %s\n\n", i.CreatedAt.Format(time.RFC3339), i.UpdatedAt.Format(time.RFC3339))
+	}
+	// Bindings may outlive their instance in the inventory if it was pruned or deleted elsewhere.
+	for _, b := range inv.Bindings {
+		if !listed[b] {
+			fmt.Printf("Binding %s to instance %s in broker %s, Service: %s, Plan: %s\n", b.BindingID, b.InstanceID, b.BrokerURL, b.ServiceID, b.PlanID)
+		}
+	}
+}
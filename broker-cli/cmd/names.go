@@ -0,0 +1,159 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+// nameCacheEntry is a service and plan name lookup, cached across invocations by resolveNames.
+type nameCacheEntry struct {
+	ServiceID  string    `json:"service_id"`
+	PlanID     string    `json:"plan_id,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// resolveNames sets serviceID and planID to the IDs of the service and plan named serviceName and
+// planName in the catalog of the broker. Either name may be empty. A plan name is looked up in the
+// service given by ID or name, or in all services if neither is given. Lookups are cached on disk
+// for nameCacheTTLFlag, so that the catalog isn't fetched by every command.
+func resolveNames(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL string, serviceID, planID *string, serviceName, planName string) {
+	if serviceName == "" && planName == "" {
+		return
+	}
+	if serviceName != "" && *serviceID != "" {
+		log.Fatalf("--service and --service-name can't be used together")
+	}
+	if planName != "" && *planID != "" {
+		log.Fatalf("--plan and --plan-name can't be used together")
+	}
+
+	key := strings.Join([]string{brokerURL, *serviceID, serviceName, planName}, "\n")
+	cache := loadNameCache()
+	if entry, ok := cache[key]; ok && time.Since(entry.ResolvedAt) < nameCacheTTLFlag {
+		*serviceID = entry.ServiceID
+		if planName != "" {
+			*planID = entry.PlanID
+		}
+		return
+	}
+
+	res, err := cachedCatalog(ctx, client, apiVersion, brokerURL)
+	if err != nil {
+		log.Fatalf("Error fetching the catalog of broker %s to look up names: %v", brokerURL, err)
+	}
+	var svc *osb.Service
+	switch {
+	case serviceName != "":
+		if svc, err = res.FindServiceByName(serviceName); err != nil {
+			log.Fatalf("Error looking up --service-name: %v", err)
+		}
+	case *serviceID != "":
+		if svc = res.FindService(*serviceID); svc == nil {
+			log.Fatalf("Error looking up --plan-name: the catalog has no service with ID %q", *serviceID)
+		}
+	}
+	entry := nameCacheEntry{ResolvedAt: time.Now()}
+	if planName != "" {
+		var plan *osb.Plan
+		if svc, plan, err = res.FindPlanByName(svc, planName); err != nil {
+			log.Fatalf("Error looking up --plan-name: %v", err)
+		}
+		entry.PlanID = plan.ID
+		*planID = plan.ID
+	}
+	entry.ServiceID = svc.ID
+	*serviceID = svc.ID
+
+	if cache != nil {
+		cache[key] = entry
+		saveNameCache(cache)
+	}
+}
+
+// nameCachePath returns the path of the file which caches name lookups.
+func nameCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "broker-cli", "names.json"), nil
+}
+
+// loadNameCache returns the cached name lookups, or nil if caching is disabled. Lookups aren't
+// cached while recording or replaying, so that cassettes don't depend on the cache.
+func loadNameCache() map[string]nameCacheEntry {
+	if nameCacheTTLFlag <= 0 || recordFlag != "" || replayFlag != "" {
+		return nil
+	}
+	cache := make(map[string]nameCacheEntry)
+	path, err := nameCachePath()
+	if err != nil {
+		return cache
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	// A corrupt cache is ignored and overwritten.
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return make(map[string]nameCacheEntry)
+	}
+	return cache
+}
+
+// saveNameCache writes the name lookups which haven't expired to the cache file. Errors are only
+// reported, since the cache is an optimization.
+func saveNameCache(cache map[string]nameCacheEntry) {
+	for key, entry := range cache {
+		if time.Since(entry.ResolvedAt) >= nameCacheTTLFlag {
+			delete(cache, key)
+		}
+	}
+	err := func() error {
+		path, err := nameCachePath()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(cache, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, b, 0600)
+	}()
+	if err != nil {
+		infof("Warning: error caching name lookups: %v\n", err)
+	}
+}
+
+// nameFlagUsage returns the usage of the --service-name or --plan-name flag, given "service" or
+// "plan".
+func nameFlagUsage(kind string) string {
+	return fmt.Sprintf("[Optional] The name of the %s in the broker catalog, which is looked up instead of giving its ID in --%s.", kind, kind)
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+)
+
+// orphanMitigationUsage returns the usage of the --orphan-mitigation flag of commands creating the
+// given kind of resource.
+func orphanMitigationUsage(resource string) string {
+	return fmt.Sprintf("[Optional] If specified and the create request of the %s fails in a way which leaves its outcome unknown, "+
+		"i.e. it times out or the broker returns 408, a 5xx code or an unexpected 2xx response, the %s is deleted with the same IDs "+
+		"in case the broker created it, as the orphan mitigation of the OSB API requires. (Default: FALSE)", resource, resource)
+}
+
+// mitigateOrphan deletes the instance, or its binding if bindingID isn't empty, after the request
+// creating it failed with err in a way which leaves its outcome unknown, see
+// adapter.NeedsOrphanMitigation. The deletion is waited on. Since it deletes resources, it is only
+// done if enabled, and otherwise the user is told about the possible orphan. It returns a report to
+// append to the error of the request, or "" if the resource can't have been created.
+func mitigateOrphan(enabled bool, client adapter.Adapter, apiVersion, brokerURL string, i *instance, bindingID string, err error) string {
+	if !adapter.NeedsOrphanMitigation(err) {
+		return ""
+	}
+	resource := fmt.Sprintf("instance %q", i.ID)
+	if bindingID != "" {
+		resource = fmt.Sprintf("binding %q to instance %q", bindingID, i.ID)
+	}
+	if !enabled {
+		return fmt.Sprintf("\nThe broker may have created the %s anyway. Delete it, or use --orphan-mitigation to delete it automatically.", resource)
+	}
+
+	// The context of the request may be done, e.g. if it timed out, so the deletion gets its own.
+	ctx, cancel := contextFromFlag()
+	defer cancel()
+	infof("The outcome of the request is unknown, deleting the %s in case the broker created it\n", resource)
+	if bindingID != "" {
+		err = deleteBinding(ctx, client, apiVersion, brokerURL, i, bindingID, false)
+	} else {
+		err = deleteInstance(ctx, client, apiVersion, brokerURL, i, false)
+	}
+	if err != nil {
+		return fmt.Sprintf("\nOrphan mitigation failed, the %s may still exist: %v", resource, err)
+	}
+	return fmt.Sprintf("\nOrphan mitigation deleted the %s, so that it doesn't exist whether the broker created it or not.", resource)
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a template in the subset of the kubectl JSONPath syntax supported by broker-cli:
+// text with expressions in braces such as "{.services[0].plans[*].name}". An expression is a path
+// of fields (.name or ['name']), indices ([0], [-1]) and wildcards ([*] or .*), or a quoted string
+// such as {"\n"}. Fields which don't exist yield no value. Multiple values are separated by spaces.
+type jsonPath struct {
+	segments []jsonPathSegment
+}
+
+// jsonPathSegment is either literal text or a path to evaluate.
+type jsonPathSegment struct {
+	text  string
+	steps []jsonPathStep
+}
+
+// jsonPathStep selects values from a value. Exactly one of its fields is set.
+type jsonPathStep struct {
+	field    string
+	index    *int
+	wildcard bool
+}
+
+// parseJSONPath parses a JSONPath template.
+func parseJSONPath(expr string) (*jsonPath, error) {
+	path := &jsonPath{}
+	for expr != "" {
+		start := strings.Index(expr, "{")
+		if start < 0 {
+			path.segments = append(path.segments, jsonPathSegment{text: expr})
+			break
+		}
+		if start > 0 {
+			path.segments = append(path.segments, jsonPathSegment{text: expr[:start]})
+		}
+		end := strings.Index(expr[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed brace at position %d", start)
+		}
+		inner := strings.TrimSpace(expr[start+1 : start+end])
+		expr = expr[start+end+1:]
+
+		if strings.HasPrefix(inner, `"`) {
+			text, err := strconv.Unquote(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s: %v", inner, err)
+			}
+			path.segments = append(path.segments, jsonPathSegment{text: text})
+			continue
+		}
+		steps, err := parseJSONPathSteps(inner)
+		if err != nil {
+			return nil, err
+		}
+		path.segments = append(path.segments, jsonPathSegment{steps: steps})
+	}
+	return path, nil
+}
+
+// parseJSONPathSteps parses a path such as ".services[0].name".
+func parseJSONPathSteps(expr string) ([]jsonPathStep, error) {
+	rest := strings.TrimPrefix(expr, "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		return nil, fmt.Errorf("expression %q must start with . or [", expr)
+	}
+
+	var steps []jsonPathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			switch name {
+			case "":
+				// A lone "." selects the value itself.
+				if rest != "" {
+					return nil, fmt.Errorf("empty field name in %q", expr)
+				}
+			case "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			default:
+				steps = append(steps, jsonPathStep{field: name})
+			}
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in %q", expr)
+			}
+			subscript := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case subscript == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case strings.HasPrefix(subscript, "'") && strings.HasSuffix(subscript, "'") && len(subscript) >= 2:
+				steps = append(steps, jsonPathStep{field: subscript[1 : len(subscript)-1]})
+			default:
+				index, err := strconv.Atoi(subscript)
+				if err != nil {
+					return nil, fmt.Errorf("invalid subscript [%s] in %q, want an index, * or a quoted field", subscript, expr)
+				}
+				steps = append(steps, jsonPathStep{index: &index})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", rest[0], expr)
+		}
+	}
+	return steps, nil
+}
+
+// execute evaluates the template against a generic JSON value.
+func (p *jsonPath) execute(value interface{}) (string, error) {
+	var out strings.Builder
+	for _, segment := range p.segments {
+		if segment.steps == nil {
+			out.WriteString(segment.text)
+			continue
+		}
+
+		values := []interface{}{value}
+		for _, step := range segment.steps {
+			values = step.apply(values)
+		}
+		for i, v := range values {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			out.WriteString(formatScalar(v))
+		}
+	}
+	return out.String(), nil
+}
+
+// apply returns the values selected by the step from each of the values.
+func (s jsonPathStep) apply(values []interface{}) []interface{} {
+	var ret []interface{}
+	for _, value := range values {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			switch {
+			case s.wildcard:
+				for _, key := range sortedKeys(v) {
+					ret = append(ret, v[key])
+				}
+			case s.index == nil:
+				if field, ok := v[s.field]; ok {
+					ret = append(ret, field)
+				}
+			}
+		case []interface{}:
+			switch {
+			case s.wildcard:
+				ret = append(ret, v...)
+			case s.index != nil:
+				i := *s.index
+				if i < 0 {
+					i += len(v)
+				}
+				if i >= 0 && i < len(v) {
+					ret = append(ret, v[i])
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// sortedKeys returns the keys of the object in ascending order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,254 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package output prints command results in machine-readable formats. Results are printed with the
+// field names of their JSON representation in every format, so that scripts don't depend on the
+// human readable output of commands.
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/yaml"
+)
+
+// Supported output formats. FormatJSONPath and FormatGoTemplate take an expression, e.g.
+// "jsonpath={.services[*].name}".
+const (
+	FormatText       = "text"
+	FormatJSON       = "json"
+	FormatYAML       = "yaml"
+	FormatTable      = "table"
+	FormatJSONPath   = "jsonpath"
+	FormatGoTemplate = "go-template"
+)
+
+// Printer prints results in a single format.
+type Printer struct {
+	format   string
+	jsonPath *jsonPath
+	template *template.Template
+}
+
+// NewPrinter returns a Printer for the format spec, which is one of the supported formats, followed
+// by "=<expression>" for FormatJSONPath and FormatGoTemplate.
+func NewPrinter(spec string) (*Printer, error) {
+	format, expr := spec, ""
+	if i := strings.Index(spec, "="); i >= 0 {
+		format, expr = spec[:i], spec[i+1:]
+	}
+
+	p := &Printer{format: format}
+	switch format {
+	case FormatText, FormatJSON, FormatYAML, FormatTable:
+		if expr != "" {
+			return nil, fmt.Errorf("output format %s doesn't take an expression", format)
+		}
+	case FormatJSONPath:
+		path, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSONPath expression %q: %v", expr, err)
+		}
+		p.jsonPath = path
+	case FormatGoTemplate:
+		tmpl, err := template.New("output").Funcs(template.FuncMap{"json": marshalJSON}).Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Go template %q: %v", expr, err)
+		}
+		p.template = tmpl
+	default:
+		return nil, fmt.Errorf("unknown output format %q, want one of %s, %s, %s, %s, %s=<expression> or %s=<template>",
+			format, FormatText, FormatJSON, FormatYAML, FormatTable, FormatJSONPath, FormatGoTemplate)
+	}
+	if (format == FormatJSONPath || format == FormatGoTemplate) && expr == "" {
+		return nil, fmt.Errorf("output format %s requires an expression, e.g. %s=<expression>", format, format)
+	}
+	return p, nil
+}
+
+// Format returns the format of the printer, without its expression.
+func (p *Printer) Format() string {
+	return p.format
+}
+
+// Table is a table of results, printed with aligned columns.
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// Print writes obj to w. table is printed for FormatTable. If it is nil, a table is derived from
+// the JSON representation of obj instead. Print must not be called for FormatText, which commands
+// print themselves.
+func (p *Printer) Print(w io.Writer, obj interface{}, table *Table) error {
+	if p.format == FormatJSON {
+		b, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling output: %v", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+
+	value, err := toJSONValue(obj)
+	if err != nil {
+		return err
+	}
+
+	switch p.format {
+	case FormatYAML:
+		b, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case FormatTable:
+		if table == nil {
+			table = deriveTable(value)
+		}
+		return writeTable(w, table)
+	case FormatJSONPath:
+		out, err := p.jsonPath.execute(value)
+		if err != nil {
+			return err
+		}
+		return writeLine(w, out)
+	case FormatGoTemplate:
+		var buf bytes.Buffer
+		if err := p.template.Execute(&buf, value); err != nil {
+			return fmt.Errorf("error executing Go template: %v", err)
+		}
+		return writeLine(w, buf.String())
+	default:
+		return fmt.Errorf("output format %s can't be printed", p.format)
+	}
+}
+
+// toJSONValue converts obj to the generic value of its JSON representation, so that all formats
+// use the same field names. Numbers are kept as json.Number to print them unchanged.
+func toJSONValue(obj interface{}) (interface{}, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling output: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("error unmarshalling output: %v", err)
+	}
+	return value, nil
+}
+
+// marshalJSON returns the compact JSON representation of v.
+func marshalJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// formatScalar returns the string printed for a value within a table, JSONPath or template result.
+// Strings are printed as is and everything else as JSON.
+func formatScalar(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	s, err := marshalJSON(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return s
+}
+
+// writeLine writes s to w, terminated by a newline.
+func writeLine(w io.Writer, s string) error {
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// deriveTable returns a table of value. A list of objects, or an object with a single list of
+// objects such as {"instances": [...]}, has a row per object. Any other object is a single row.
+// The columns are the sorted keys of the objects.
+func deriveTable(value interface{}) *Table {
+	if obj, ok := value.(map[string]interface{}); ok && len(obj) == 1 {
+		for _, v := range obj {
+			if list, ok := v.([]interface{}); ok {
+				value = list
+			}
+		}
+	}
+
+	var objects []map[string]interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				obj = map[string]interface{}{"value": item}
+			}
+			objects = append(objects, obj)
+		}
+	case map[string]interface{}:
+		objects = append(objects, v)
+	default:
+		objects = append(objects, map[string]interface{}{"value": v})
+	}
+
+	keys := make(map[string]bool)
+	table := &Table{}
+	for _, obj := range objects {
+		for key := range obj {
+			if !keys[key] {
+				keys[key] = true
+				table.Columns = append(table.Columns, key)
+			}
+		}
+	}
+	sort.Strings(table.Columns)
+
+	for _, obj := range objects {
+		row := make([]string, len(table.Columns))
+		for i, key := range table.Columns {
+			if v, ok := obj[key]; ok && v != nil {
+				row[i] = formatScalar(v)
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// writeTable writes the table to w with aligned columns and upper case headers.
+func writeTable(w io.Writer, table *Table) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	headers := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		headers[i] = strings.ToUpper(column)
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range table.Rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testPlan struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Free bool   `json:"free"`
+}
+
+type testService struct {
+	Name  string                 `json:"name"`
+	Tags  []string               `json:"tags"`
+	Plans []testPlan             `json:"plans"`
+	Extra map[string]interface{} `json:"extra,omitempty"`
+}
+
+type testCatalog struct {
+	Services []testService `json:"services"`
+}
+
+var catalog = testCatalog{
+	Services: []testService{
+		{
+			Name: "db",
+			Tags: []string{"sql", "true"},
+			Plans: []testPlan{
+				{ID: "p1", Name: "small", Free: true},
+				{ID: "p2", Name: "large"},
+			},
+			Extra: map[string]interface{}{"url": "https://example.com", "count": 3},
+		},
+		{
+			Name:  "cache",
+			Plans: []testPlan{{ID: "p3", Name: "default"}},
+		},
+	},
+}
+
+func TestPrint(t *testing.T) {
+	testCases := []struct {
+		name  string
+		spec  string
+		obj   interface{}
+		table *Table
+		want  string
+	}{
+		{
+			name: "json",
+			spec: "json",
+			obj:  testPlan{ID: "p1", Name: "small"},
+			want: "{\n  \"id\": \"p1\",\n  \"name\": \"small\",\n  \"free\": false\n}\n",
+		},
+		{
+			name: "yaml",
+			spec: "yaml",
+			obj:  catalog,
+			want: `services:
+  - extra:
+      count: 3
+      url: "https://example.com"
+    name: db
+    plans:
+      - free: true
+        id: p1
+        name: small
+      - free: false
+        id: p2
+        name: large
+    tags:
+      - sql
+      - "true"
+  - name: cache
+    plans:
+      - free: false
+        id: p3
+        name: default
+    tags: null
+`,
+		},
+		{
+			name: "derived table",
+			spec: "table",
+			obj:  catalog.Services[0].Plans,
+			want: "FREE    ID   NAME\ntrue    p1   small\nfalse   p2   large\n",
+		},
+		{
+			name:  "explicit table",
+			spec:  "table",
+			obj:   catalog,
+			table: &Table{Columns: []string{"service", "plans"}, Rows: [][]string{{"db", "2"}, {"cache", "1"}}},
+			want:  "SERVICE   PLANS\ndb        2\ncache     1\n",
+		},
+		{
+			name: "jsonpath",
+			spec: `jsonpath={.services[*].name}{"\n"}{.services[0].plans[-1].id} {$.services[1]['plans'][0].free}`,
+			obj:  catalog,
+			want: "db cache\np2 false\n",
+		},
+		{
+			name: "jsonpath of missing field",
+			spec: "jsonpath={.services[*].extra.url}",
+			obj:  catalog,
+			want: "https://example.com\n",
+		},
+		{
+			name: "go-template",
+			spec: `go-template={{range .services}}{{.name}}: {{json .tags}}{{"\n"}}{{end}}`,
+			obj:  catalog,
+			want: "db: [\"sql\",\"true\"]\ncache: null\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewPrinter(tc.spec)
+			if err != nil {
+				t.Fatalf("Unexpected error from NewPrinter: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := p.Print(&buf, tc.obj, tc.table); err != nil {
+				t.Fatalf("Unexpected error from Print: %v", err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("Print got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewPrinterErrors(t *testing.T) {
+	for _, spec := range []string{"xml", "json=.a", "jsonpath", "jsonpath={.a", "jsonpath={a}", "jsonpath={.a[x]}", "go-template={{.a"} {
+		if _, err := NewPrinter(spec); err == nil {
+			t.Errorf("NewPrinter(%q) got no error, want one", spec)
+		}
+	}
+}
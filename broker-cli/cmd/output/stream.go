@@ -0,0 +1,221 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/yaml"
+)
+
+// ListStream prints an object whose list field is added an item at a time, so that long lists
+// don't have to be held in memory. JSON and YAML are written as the items are added. Tables need
+// the widths of their columns, and JSONPath and Go templates the whole object, so they are written
+// on Close: tables buffer their rows, the other formats the items.
+type ListStream struct {
+	printer *Printer
+	w       io.Writer
+	head    map[string]interface{}
+	field   string
+	row     func(item interface{}) []string
+	table   *Table
+	items   []interface{}
+	count   int
+	started bool
+}
+
+// NewListStream returns a stream which writes to w an object with the fields in head, followed by
+// the list field holding the added items and the fields passed to Close. For FormatTable, the table
+// has the given columns and row returns the row of an item. If row is nil, the table is derived
+// from the object as Print does, which buffers the items. The stream must not be used for
+// FormatText, which commands print themselves.
+func (p *Printer) NewListStream(w io.Writer, head map[string]interface{}, field string, columns []string, row func(item interface{}) []string) *ListStream {
+	s := &ListStream{printer: p, w: w, head: head, field: field, row: row}
+	if p.format == FormatTable && row != nil {
+		s.table = &Table{Columns: columns}
+	}
+	return s
+}
+
+// Add adds an item to the list.
+func (s *ListStream) Add(item interface{}) error {
+	defer func() { s.count++ }()
+	switch {
+	case s.table != nil:
+		s.table.Rows = append(s.table.Rows, s.row(item))
+		return nil
+	case s.printer.format == FormatJSON:
+		if err := s.start(); err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(item, "    ", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling output: %v", err)
+		}
+		sep := "\n    "
+		if s.count > 0 {
+			sep = "," + sep
+		}
+		_, err = fmt.Fprintf(s.w, "%s%s", sep, b)
+		return err
+	case s.printer.format == FormatYAML:
+		if err := s.start(); err != nil {
+			return err
+		}
+		if s.count == 0 {
+			if _, err := fmt.Fprintf(s.w, "%s:\n", s.field); err != nil {
+				return err
+			}
+		}
+		b, err := yaml.Marshal([]interface{}{item})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(s.w, indent(string(b), "  "))
+		return err
+	default:
+		value, err := toJSONValue(item)
+		if err != nil {
+			return err
+		}
+		s.items = append(s.items, value)
+		return nil
+	}
+}
+
+// Close writes the end of the object, which has the fields in tail after the list.
+func (s *ListStream) Close(tail map[string]interface{}) error {
+	switch {
+	case s.table != nil:
+		return writeTable(s.w, s.table)
+	case s.printer.format == FormatJSON:
+		if err := s.start(); err != nil {
+			return err
+		}
+		end := "\n  ]"
+		if s.count == 0 {
+			end = "]"
+		}
+		if _, err := io.WriteString(s.w, end); err != nil {
+			return err
+		}
+		for _, key := range sortedKeys(tail) {
+			field, err := jsonField(key, tail[key])
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(s.w, ",\n%s", field); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(s.w, "\n}\n")
+		return err
+	case s.printer.format == FormatYAML:
+		if err := s.start(); err != nil {
+			return err
+		}
+		if s.count == 0 {
+			if _, err := fmt.Fprintf(s.w, "%s: []\n", s.field); err != nil {
+				return err
+			}
+		}
+		if len(tail) == 0 {
+			return nil
+		}
+		b, err := yaml.Marshal(tail)
+		if err != nil {
+			return err
+		}
+		_, err = s.w.Write(b)
+		return err
+	default:
+		obj := make(map[string]interface{})
+		for key, value := range s.head {
+			obj[key] = value
+		}
+		for key, value := range tail {
+			obj[key] = value
+		}
+		items := s.items
+		if items == nil {
+			items = []interface{}{}
+		}
+		obj[s.field] = items
+		return s.printer.Print(s.w, obj, nil)
+	}
+}
+
+// start writes the fields of the head and the start of the list once.
+func (s *ListStream) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	if s.printer.format == FormatYAML {
+		if len(s.head) == 0 {
+			return nil
+		}
+		b, err := yaml.Marshal(s.head)
+		if err != nil {
+			return err
+		}
+		_, err = s.w.Write(b)
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, key := range sortedKeys(s.head) {
+		field, err := jsonField(key, s.head[key])
+		if err != nil {
+			return err
+		}
+		b.WriteString(field + ",\n")
+	}
+	field, err := json.Marshal(s.field)
+	if err != nil {
+		return fmt.Errorf("error marshalling output: %v", err)
+	}
+	fmt.Fprintf(&b, "  %s: [", field)
+	_, err = io.WriteString(s.w, b.String())
+	return err
+}
+
+// jsonField returns the field of an indented JSON object, without separators.
+func jsonField(key string, value interface{}) (string, error) {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling output: %v", err)
+	}
+	v, err := json.MarshalIndent(value, "  ", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshalling output: %v", err)
+	}
+	return fmt.Sprintf("  %s: %s", k, v), nil
+}
+
+// indent prefixes every line of s with prefix.
+func indent(s, prefix string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "")
+}
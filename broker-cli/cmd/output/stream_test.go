@@ -0,0 +1,87 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestListStream tests that streaming a list prints the same as printing the whole object.
+func TestListStream(t *testing.T) {
+	head := map[string]interface{}{"broker": "https://broker", "count": 2}
+	tail := map[string]interface{}{"truncated": true, "url": "<a & b>"}
+	specs := []string{"json", "yaml", "table", "jsonpath={.plans[*].id}", "go-template={{range .plans}}{{.name}} {{end}}"}
+
+	for _, items := range [][]interface{}{
+		{testPlan{ID: "p1", Name: "small", Free: true}, testPlan{ID: "p2", Name: "large"}},
+		{},
+	} {
+		obj := map[string]interface{}{"plans": items}
+		for key, value := range head {
+			obj[key] = value
+		}
+		for key, value := range tail {
+			obj[key] = value
+		}
+
+		for _, spec := range specs {
+			p, err := NewPrinter(spec)
+			if err != nil {
+				t.Fatalf("NewPrinter(%q) got error: %v", spec, err)
+			}
+			var want, got bytes.Buffer
+			if err := p.Print(&want, obj, nil); err != nil {
+				t.Fatalf("Print(%q) got error: %v", spec, err)
+			}
+
+			s := p.NewListStream(&got, head, "plans", nil, nil)
+			for _, item := range items {
+				if err := s.Add(item); err != nil {
+					t.Fatalf("%s: Add got error: %v", spec, err)
+				}
+			}
+			if err := s.Close(tail); err != nil {
+				t.Fatalf("%s: Close got error: %v", spec, err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("%s with %d items: streaming printed\n%s\nwant\n%s", spec, len(items), got.String(), want.String())
+			}
+		}
+	}
+}
+
+// TestListStreamTable tests that tables of streamed lists are printed with the rows of the items.
+func TestListStreamTable(t *testing.T) {
+	p, err := NewPrinter("table")
+	if err != nil {
+		t.Fatalf("NewPrinter got error: %v", err)
+	}
+	var got bytes.Buffer
+	s := p.NewListStream(&got, nil, "plans", []string{"id", "plan"}, func(item interface{}) []string {
+		plan := item.(testPlan)
+		return []string{plan.ID, plan.Name}
+	})
+	s.Add(testPlan{ID: "p1", Name: "small"})
+	s.Add(testPlan{ID: "p2", Name: "large"})
+	if err := s.Close(nil); err != nil {
+		t.Fatalf("Close got error: %v", err)
+	}
+
+	want := "ID   PLAN\np1   small\np2   large\n"
+	if got.String() != want {
+		t.Errorf("Streamed table got\n%s\nwant\n%s", got.String(), want)
+	}
+}
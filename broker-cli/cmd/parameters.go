@@ -0,0 +1,180 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/schema"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/yaml"
+)
+
+// parametersFromFlags returns the parameters of a request, merged from a JSON or YAML file, a JSON
+// object and "key.path=value" params, in order of increasing precedence. Objects are merged field
+// by field, anything else is replaced. The values of params are coerced to the types declared by
+// the schema which the plan publishes for the kind of request. It returns nil if no parameters
+// are given.
+func parametersFromFlags(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL, serviceID, planID, kind, file, inline string, params []string) (map[string]interface{}, error) {
+	var ret map[string]interface{}
+	if file != "" {
+		fromFile, err := readObjectFile(file)
+		if err != nil {
+			return nil, err
+		}
+		ret = mergeObjects(ret, fromFile)
+	}
+	fromJSON, err := parseStringToObjectMap(inline)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --parameters: %v", err)
+	}
+	ret = mergeObjects(ret, fromJSON)
+
+	if len(params) == 0 {
+		return ret, nil
+	}
+	paramsSchema := planParametersSchema(ctx, client, apiVersion, brokerURL, serviceID, planID, kind)
+	if ret == nil {
+		ret = map[string]interface{}{}
+	}
+	for _, param := range params {
+		if err := setParam(ret, paramsSchema, param); err != nil {
+			return nil, fmt.Errorf("invalid --param %q: %v", param, err)
+		}
+	}
+	return ret, nil
+}
+
+// requestContextFromFlags returns the context of a request, merged from a JSON or YAML file and a
+// JSON object which takes precedence. It returns nil if no context is given.
+func requestContextFromFlags(file, inline string) (map[string]interface{}, error) {
+	var ret map[string]interface{}
+	if file != "" {
+		fromFile, err := readObjectFile(file)
+		if err != nil {
+			return nil, err
+		}
+		ret = fromFile
+	}
+	fromJSON, err := parseStringToObjectMap(inline)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --context: %v", err)
+	}
+	return mergeObjects(ret, fromJSON), nil
+}
+
+// planParametersSchema returns the parameters schema of the plan for the kind of request, or nil if
+// the plan has none or the catalog can't be fetched.
+func planParametersSchema(ctx context.Context, client adapter.Adapter, apiVersion, brokerURL, serviceID, planID, kind string) map[string]interface{} {
+	res, err := cachedCatalog(ctx, client, apiVersion, brokerURL)
+	if err != nil {
+		infof("Inferring the types of --param values since the catalog couldn't be fetched: %v\n", err)
+		return nil
+	}
+	_, plan := res.FindPlan(serviceID, planID)
+	if plan == nil {
+		return nil
+	}
+	return adapter.ParametersSchema(plan, kind)
+}
+
+// readObjectFile reads a JSON or YAML object from a file, or from stdin if path is "-".
+func readObjectFile(path string) (map[string]interface{}, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	var obj map[string]interface{}
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		err = json.Unmarshal(b, &obj)
+	} else {
+		err = yaml.Unmarshal(b, &obj)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s as a JSON or YAML object: %v", path, err)
+	}
+	if obj == nil {
+		obj = map[string]interface{}{}
+	}
+	return obj, nil
+}
+
+// mergeObjects merges src into dst and returns dst. Objects in both are merged recursively, and
+// other values in src replace the ones in dst.
+func mergeObjects(dst, src map[string]interface{}) map[string]interface{} {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = map[string]interface{}{}
+	}
+	for key, value := range src {
+		srcObj, srcOK := value.(map[string]interface{})
+		dstObj, dstOK := dst[key].(map[string]interface{})
+		if srcOK && dstOK {
+			dst[key] = mergeObjects(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
+
+// setParam sets the field of obj given by a "key.path=value" param, creating intermediate objects
+// as needed. The value is coerced to the type which paramsSchema declares for the field.
+func setParam(obj map[string]interface{}, paramsSchema map[string]interface{}, param string) error {
+	i := strings.Index(param, "=")
+	if i < 0 {
+		return fmt.Errorf("want key.path=value")
+	}
+	path := strings.Split(param[:i], ".")
+	for _, key := range path {
+		if key == "" {
+			return fmt.Errorf("empty key in %q", param[:i])
+		}
+	}
+	value, err := schema.Coerce(paramsSchema, path, param[i+1:])
+	if err != nil {
+		return err
+	}
+
+	for j, key := range path[:len(path)-1] {
+		child, ok := obj[key]
+		if !ok || child == nil {
+			child = map[string]interface{}{}
+			obj[key] = child
+		}
+		childObj, ok := child.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is already set to a value which isn't an object", strings.Join(path[:j+1], "."))
+		}
+		obj = childObj
+	}
+	obj[path[len(path)-1]] = value
+	return nil
+}
@@ -18,8 +18,12 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/auth"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
 	"github.com/spf13/cobra"
 )
 
@@ -31,14 +35,94 @@ var (
 		Long: "broker-cli is the client CLI for Service Broker.\n" +
 			"This application is a tool to call Service Broker\n" +
 			"APIs directly.",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			applyConfigContext(cmd)
+			printerFromFlag()
+		},
 	}
 
 	// Values that are set from flags.
-	credsFlag string
+	credsFlag        string
+	authTypeFlag     string
+	usernameFlag     string
+	passwordFileFlag string
+	tokenFileFlag    string
+	clientCertFlag   string
+	clientKeyFlag    string
+	caBundleFlag     string
+	timeoutFlag      time.Duration
+	waitTimeoutFlag  time.Duration
+	maxRetriesFlag   int
+	rateLimitFlag    float64
+	rateBurstFlag    int
+
+	originatingIdentityFlag         string
+	originatingIdentityPlatformFlag string
+
+	recordFlag      string
+	replayFlag      string
+	replayMatchFlag string
+
+	nameCacheTTLFlag time.Duration
+	inventoryFlag    string
+
+	configFlag        string
+	configContextFlag string
+
+	outputFlag string
+	// printer prints the results of commands in the format given by outputFlag.
+	printer *output.Printer
 )
 
 func init() {
+	flags.StringFlagWithDefault(RootCmd.PersistentFlags(), &configFlag, "config", "", defaultConfigPath(),
+		"[Optional] Configuration file whose contexts set the defaults of the broker and authentication flags. Set to an empty string to ignore it.")
+	flags.StringFlag(RootCmd.PersistentFlags(), &configContextFlag, "config-context", "",
+		"[Optional] The context of the configuration file to use. (Default: the current context set by config use-context)")
+	flags.StringFlagWithDefault(RootCmd.PersistentFlags(), &outputFlag, "output", "o", output.FormatText,
+		"[Optional] Output format of the result, one of text, json, yaml, table, jsonpath=<expression> (e.g. jsonpath={.services[*].name}) "+
+			"or go-template=<template>. Field names are those of the json format. Progress messages are printed to stderr unless the format is text.")
 	flags.StringFlag(RootCmd.PersistentFlags(), &credsFlag, "creds", "c", "[Optional] Private, json key file to use for authenticating requests. If not specified, we use gcloud authentication.")
+	flags.StringFlagWithDefault(RootCmd.PersistentFlags(), &authTypeFlag, "auth-type", "", auth.TypeGoogle,
+		"[Optional] How requests to the broker are authenticated, one of google, basic, bearer, mtls or none.")
+	flags.StringFlag(RootCmd.PersistentFlags(), &usernameFlag, "username", "",
+		"[Optional] Username for --auth-type=basic. (Default: $"+usernameEnv+")")
+	flags.StringFlag(RootCmd.PersistentFlags(), &passwordFileFlag, "password-file", "",
+		"[Optional] File containing the password for --auth-type=basic. (Default: $"+passwordEnv+")")
+	flags.StringFlag(RootCmd.PersistentFlags(), &tokenFileFlag, "token-file", "",
+		"[Optional] File containing the token for --auth-type=bearer. (Default: $"+tokenEnv+")")
+	flags.StringFlag(RootCmd.PersistentFlags(), &clientCertFlag, "client-cert", "",
+		"[Optional] PEM encoded client certificate file for --auth-type=mtls.")
+	flags.StringFlag(RootCmd.PersistentFlags(), &clientKeyFlag, "client-key", "",
+		"[Optional] PEM encoded client key file for --auth-type=mtls.")
+	flags.StringFlag(RootCmd.PersistentFlags(), &caBundleFlag, "ca-bundle", "",
+		"[Optional] PEM encoded bundle of certificate authorities used to verify the broker's certificate. (Default: system roots)")
+	flags.DurationFlag(RootCmd.PersistentFlags(), &timeoutFlag, "timeout", "", 0,
+		"[Optional] Maximum duration of the command, e.g. 30s or 5m. In-flight broker requests and operation polling are cancelled once it elapses. (Default: no timeout)")
+	flags.DurationFlag(RootCmd.PersistentFlags(), &waitTimeoutFlag, "wait-timeout", "", 0,
+		"[Optional] Maximum duration of waiting on an asynchronous operation, e.g. 10m. The command then fails with the wait command which resumes waiting. "+
+			"Waits are also bounded by the maximum polling duration of the plan. (Default: no timeout)")
+	flags.IntFlag(RootCmd.PersistentFlags(), &maxRetriesFlag, "max-retries", "", adapter.DefaultRetryPolicy.MaxRetries,
+		"[Optional] Maximum number of retries of idempotent broker requests (GET, DELETE, last_operation) which fail with a network error, 429, 502, 503 or 504. Set to 0 to disable retries.")
+	flags.Float64Flag(RootCmd.PersistentFlags(), &rateLimitFlag, "rate-limit", "", 0,
+		"[Optional] Maximum average number of broker requests per second. (Default: unlimited)")
+	flags.IntFlag(RootCmd.PersistentFlags(), &rateBurstFlag, "rate-burst", "", 1,
+		"[Optional] Maximum number of broker requests which may exceed --rate-limit in a burst.")
+	flags.StringFlag(RootCmd.PersistentFlags(), &originatingIdentityFlag, "originating-identity", "",
+		"[Optional] [JSON Object] Identity of the user on whose behalf instances and bindings are created, updated and deleted, sent in the X-Broker-API-Originating-Identity header. (Default: {\"username\": <authenticated account>}, or {} if the account is unknown)")
+	flags.StringFlagWithDefault(RootCmd.PersistentFlags(), &originatingIdentityPlatformFlag, "originating-identity-platform", "", "kubernetes",
+		"[Optional] Platform of the originating identity.")
+	flags.StringFlag(RootCmd.PersistentFlags(), &recordFlag, "record", "",
+		"[Optional] Cassette file to record every broker request and response to, with authorization headers and binding credentials redacted.")
+	flags.StringFlag(RootCmd.PersistentFlags(), &replayFlag, "replay", "",
+		"[Optional] Cassette file recorded with --record to serve broker responses from instead of sending requests. No credentials are needed.")
+	flags.StringFlagWithDefault(RootCmd.PersistentFlags(), &replayMatchFlag, "replay-match", "", replayMatchURL,
+		"[Optional] How --replay matches requests to recorded ones, either url (method and URL) or body (method, URL and JSON body).")
+	flags.DurationFlag(RootCmd.PersistentFlags(), &nameCacheTTLFlag, "name-cache-ttl", "", time.Hour,
+		"[Optional] How long the service and plan IDs looked up for --service-name and --plan-name are cached. Set to 0 to disable the cache.")
+	flags.StringFlagWithDefault(RootCmd.PersistentFlags(), &inventoryFlag, "inventory", "", defaultInventoryPath(),
+		"[Optional] File recording the instances and bindings created with broker-cli, which fills in the IDs that delete and poll commands aren't given. "+
+			"Set to an empty string to disable it.")
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
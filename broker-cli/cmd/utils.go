@@ -16,75 +16,353 @@ package cmd
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
-	"math"
-	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/auth"
 	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/flags"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/cmd/output"
 )
 
-// httpAdapterFromFlag returns an http adapter with credentials to gcloud if
-// credsFlag is not set and to a service account if it is set.
+// Environment variables holding credentials, so that they don't have to be passed as flags.
+const (
+	usernameEnv = "BROKER_CLI_USERNAME"
+	passwordEnv = "BROKER_CLI_PASSWORD"
+	tokenEnv    = "BROKER_CLI_TOKEN"
+)
+
+// Values of replayMatchFlag.
+const (
+	replayMatchURL  = "url"
+	replayMatchBody = "body"
+)
+
+// httpAdapterFromFlag returns an http adapter which authenticates requests as configured by
+// authTypeFlag, using gcloud credentials or the service account in credsFlag by default.
 func httpAdapterFromFlag() adapter.Adapter {
-	var client *http.Client
-	var err error
-	ctx := context.Background()
-	if credsFlag != "" {
-		client, err = auth.HttpClientFromFile(ctx, credsFlag)
-		if err != nil {
-			log.Fatalf("Error creating http client from service account file %s: %v", credsFlag, err)
-		}
+	if recordFlag != "" && replayFlag != "" {
+		log.Fatalf("--record and --replay can't be used together")
+	}
+	if replayFlag != "" {
+		return adapter.NewHttpAdapter(doClientFromFlag(replayingClientFromFlag()))
+	}
+
+	httpClient, err := authProviderFromFlag().HttpClient(context.Background())
+	if err != nil {
+		log.Fatalf("Error creating %s authenticated http client: %v", authTypeFlag, err)
+	}
+	var client adapter.DoClient = httpClient
+	if recordFlag != "" {
+		client = adapter.NewRecordingClient(client, recordFlag)
+	}
+	return adapter.NewHttpAdapter(doClientFromFlag(client))
+}
+
+// replayingClientFromFlag returns a client which serves the responses in the cassette given by
+// replayFlag.
+func replayingClientFromFlag() adapter.DoClient {
+	cassette, err := adapter.LoadCassette(replayFlag)
+	if err != nil {
+		log.Fatalf("Error loading cassette: %v", err)
+	}
+	var match adapter.RequestMatcher
+	switch replayMatchFlag {
+	case replayMatchURL:
+		match = adapter.MatchMethodAndURL
+	case replayMatchBody:
+		match = adapter.MatchMethodURLAndBody
+	default:
+		log.Fatalf("Unknown --replay-match %q, want %s or %s", replayMatchFlag, replayMatchURL, replayMatchBody)
+	}
+	return adapter.NewReplayingClient(cassette, match)
+}
+
+// checkGCPAdminFlags exits with an error if flags configure anything but a GCP broker for a
+// command which calls the GCP admin API, instead of sending requests that are bound to fail.
+func checkGCPAdminFlags(command string) {
+	if authTypeFlag != auth.TypeGoogle {
+		log.Fatalf("%s is only supported for GCP brokers, which require --auth-type=%s", command, auth.TypeGoogle)
+	}
+}
+
+// checkAdminFlags is like checkGCPAdminFlags for commands which list the instances or bindings of a
+// broker, but allows any auth type with --admin-api, whose broker serves the same admin API as GCP
+// brokers, as the fake broker does. The broker URL is checked by AdminBrokerURL.
+func checkAdminFlags(command string, urlFlags *flags.BrokerURLConstructor) {
+	if !urlFlags.AdminAPI {
+		checkGCPAdminFlags(command)
+	}
+}
+
+// authProviderFromFlag returns the auth provider configured by flags. Secrets are read from the
+// files given by flags, falling back to environment variables.
+func authProviderFromFlag() auth.Provider {
+	username := usernameFlag
+	if username == "" {
+		username = os.Getenv(usernameEnv)
+	}
+	password, err := secretFromFileOrEnv(passwordFileFlag, passwordEnv)
+	if err != nil {
+		log.Fatalf("Error reading password: %v", err)
+	}
+	token, err := secretFromFileOrEnv(tokenFileFlag, tokenEnv)
+	if err != nil {
+		log.Fatalf("Error reading token: %v", err)
+	}
+
+	provider, err := auth.NewProvider(auth.Config{
+		Type:      authTypeFlag,
+		CredsFile: credsFlag,
+		Username:  username,
+		Password:  password,
+		Token:     token,
+		CertFile:  clientCertFlag,
+		KeyFile:   clientKeyFlag,
+		CAFile:    caBundleFlag,
+	})
+	if err != nil {
+		log.Fatalf("Error configuring authentication: %v", err)
+	}
+	return provider
+}
+
+// secretFromFileOrEnv returns the content of file without surrounding whitespace if file is set,
+// and the value of the environment variable env otherwise.
+func secretFromFileOrEnv(file, env string) (string, error) {
+	if file == "" {
+		return os.Getenv(env), nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// doClientFromFlag wraps client with the rate limiting and retry middleware configured by flags.
+// Every retry attempt goes through the rate limiter.
+func doClientFromFlag(client adapter.DoClient) adapter.DoClient {
+	if rateLimitFlag > 0 {
+		client = adapter.NewRateLimitedClient(client, rateLimitFlag, rateBurstFlag)
+	}
+	if maxRetriesFlag > 0 {
+		policy := adapter.DefaultRetryPolicy
+		policy.MaxRetries = maxRetriesFlag
+		client = adapter.NewRetryingClient(client, policy)
+	}
+	return client
+}
+
+// contextFromFlag returns the context which bounds a single command invocation. The context is
+// cancelled once timeoutFlag elapses (if set) or when the user interrupts the command, which aborts
+// any in-flight broker request and operation polling. The returned cancel function must be called
+// to release its resources.
+func contextFromFlag() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeoutFlag > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeoutFlag)
 	} else {
-		client, err = auth.HttpClientWithDefaultCredentials(ctx)
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(interrupt)
+	}()
+
+	return ctx, cancel
+}
+
+var (
+	originatingIdentity     *adapter.OriginatingIdentity
+	originatingIdentityOnce sync.Once
+)
+
+// originatingIdentityFromFlag returns the originating identity sent with every request which
+// creates, updates or deletes a resource. Unless --originating-identity is set, the identity is the
+// account which requests are authenticated as, e.g. the service account in credsFlag or the gcloud
+// account. If that account can't be determined, e.g. for bearer tokens or unauthenticated requests,
+// the identity only names the platform, with an empty value, since brokers may require the header.
+// The identity is looked up once per invocation.
+func originatingIdentityFromFlag(ctx context.Context) *adapter.OriginatingIdentity {
+	originatingIdentityOnce.Do(func() {
+		value, err := parseStringToObjectMap(originatingIdentityFlag)
 		if err != nil {
-			log.Fatalf("Error creating http client using gcloud credentials: %v", err)
+			log.Fatalf("Error parsing --originating-identity: %v", err)
+		}
+		// Replayed sessions don't need credentials, so the account stays unknown.
+		if value == nil && replayFlag == "" {
+			account, err := authProviderFromFlag().Account(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: sending an originating identity without a username, set it with --originating-identity: %v\n", err)
+			} else {
+				value = map[string]interface{}{"username": account}
+			}
 		}
+		if value == nil {
+			value = map[string]interface{}{}
+		}
+		originatingIdentity = &adapter.OriginatingIdentity{
+			Platform: originatingIdentityPlatformFlag,
+			Value:    value,
+		}
+	})
+	return originatingIdentity
+}
+
+// newRequestIdentity returns a random (version 4) UUID which identifies a request to the broker.
+func newRequestIdentity() string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		log.Fatalf("Error generating request identity: %v", err)
 	}
-	return adapter.NewHttpAdapter(client)
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
 }
 
-func parseStringToObjectMap(s string) map[string]interface{} {
+// parseStringToObjectMap parses a JSON object. It returns nil if s is empty.
+func parseStringToObjectMap(s string) (map[string]interface{}, error) {
 	if s == "" {
-		return nil
+		return nil, nil
 	}
 
 	var objMap map[string]interface{}
-	err := json.Unmarshal([]byte(s), &objMap)
-	if err != nil {
-		log.Fatalf("Error unmarshalling string %q to object map: %v\n", s, err)
+	if err := json.Unmarshal([]byte(s), &objMap); err != nil {
+		return nil, fmt.Errorf("error unmarshalling string %q to object map: %v", s, err)
 	}
 
-	return objMap
+	return objMap, nil
 }
 
-func waitOnOperation(pollOperation func() (*adapter.Operation, error), showProgress bool) (*adapter.Operation, error) {
-	baseDelay := 100 * time.Millisecond
-	maxDelay := 6 * time.Second
-	curState := adapter.OperationInProgress
-	delay := baseDelay
+// withAsyncFallback sends a request with the given accepts_incomplete value. If the broker rejects a
+// synchronous request with the AsyncRequired error, the request is sent again asynchronously.
+func withAsyncFallback(acceptsIncomplete bool, request func(acceptsIncomplete bool) error) error {
+	err := request(acceptsIncomplete)
+	if !acceptsIncomplete && adapter.IsAsyncRequired(err) {
+		infof("The broker only supports asynchronous processing of the request, retrying with accepts_incomplete=true\n")
+		err = request(true)
+	}
+	return err
+}
 
-	var op *adapter.Operation
-	var err error
-	for curState == adapter.OperationInProgress {
-		if showProgress {
-			fmt.Print(".")
-		}
-		time.Sleep(delay)
-		op, err = pollOperation()
-		if err != nil {
-			return nil, err
+// retryOnConcurrencyError sends a request until the broker stops rejecting it with the
+// ConcurrencyError error, which means that another operation is in progress for the same resource.
+// It gives up after a few attempts or once ctx is done.
+func retryOnConcurrencyError(ctx context.Context, request func() error) error {
+	delay := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		err := request()
+		if !adapter.IsConcurrencyError(err) || attempt == 5 {
+			return err
 		}
 
-		if delay < maxDelay {
-			delay = time.Duration(math.Min(float64(maxDelay), 2*float64(delay)))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
 		}
-		curState = op.State
+		delay *= 2
 	}
+}
+
+// brokerErrorHint returns advice for the user based on the OSB error returned by the broker, or an
+// empty string if there is none. The hint starts with a newline so that it can be appended to the
+// error message.
+func brokerErrorHint(err error) string {
+	switch {
+	case adapter.IsConcurrencyError(err):
+		return "\nAnother operation is in progress for this resource. Wait for it to finish and try again."
+	case adapter.IsRequiresApp(err):
+		return "\nThe broker requires the binding to be for an application. Set the app GUID in the bind resource."
+	case adapter.IsMaintenanceInfoConflict(err):
+		return "\nThe maintenance info of the request doesn't match the catalog. Fetch the catalog and try again."
+	case adapter.IsInstanceUnusable(err):
+		return "\nThe broker reports that the service instance is no longer usable."
+	default:
+		return ""
+	}
+}
 
-	// Operation states other than "in progress" are all considered as end states.
-	return op, nil
+// pageSizeUsage is the usage of the --page-size flag of commands listing instances and bindings with
+// the admin API.
+const pageSizeUsage = "[Optional] Number of instances or bindings fetched per request to the admin API, which lists them a page at a time. (Default: 0, i.e. the broker's page size)"
+
+// operationResult is the output of commands which create, update or delete a resource.
+type operationResult struct {
+	// RequestIdentity identifies the request in the logs of the broker.
+	RequestIdentity string `json:"request_identity"`
+	// Result is the result of the request, e.g. *adapter.CreateInstanceResult.
+	Result interface{} `json:"result"`
+	// LastOperation is the final state of the asynchronous operation if the command waited for it.
+	LastOperation *adapter.Operation `json:"last_operation,omitempty"`
+}
+
+// printerFromFlag sets printer to the printer of the output format in outputFlag.
+func printerFromFlag() {
+	var err error
+	printer, err = output.NewPrinter(outputFlag)
+	if err != nil {
+		log.Fatalf("Error parsing --output: %v", err)
+	}
+}
+
+// printResult prints the result of a command in the output format selected by outputFlag. text
+// prints the human readable output of the text format. table is printed for the table format
+// instead of the table derived from res, and may be nil.
+func printResult(res interface{}, table *output.Table, text func()) {
+	if printer.Format() == output.FormatText {
+		text()
+		return
+	}
+	if err := printer.Print(os.Stdout, res, table); err != nil {
+		log.Fatalf("Error printing result: %v", err)
+	}
+}
+
+// infof prints information about the progress of a command. It is printed to stderr unless the
+// output format is text, so that stdout only contains the result.
+func infof(format string, a ...interface{}) {
+	w := os.Stdout
+	if printer.Format() != output.FormatText {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format, a...)
+}
+
+// stringValue returns the string s points to, or an empty string if s is nil.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// formatObjectMap returns the indented JSON representation of an object map for printing.
+func formatObjectMap(objMap map[string]interface{}) string {
+	if len(objMap) == 0 {
+		return "{}"
+	}
+
+	b, err := json.MarshalIndent(objMap, "   ", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", objMap)
+	}
+	return string(b)
 }
@@ -0,0 +1,80 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+)
+
+func TestOriginatingIdentityFromFlag(t *testing.T) {
+	defer func(authType, identity, username string) {
+		authTypeFlag, originatingIdentityFlag, usernameFlag = authType, identity, username
+		originatingIdentityOnce, originatingIdentity = sync.Once{}, nil
+	}(authTypeFlag, originatingIdentityFlag, usernameFlag)
+	t.Setenv(passwordEnv, "secret")
+	t.Setenv(tokenEnv, "token")
+	originatingIdentityPlatformFlag = "kubernetes"
+
+	testCases := []struct {
+		name     string
+		authType string
+		username string
+		identity string
+		want     *adapter.OriginatingIdentity
+	}{
+		{
+			name:     "unauthenticated requests only send the platform",
+			authType: "none",
+			want:     &adapter.OriginatingIdentity{Platform: "kubernetes", Value: map[string]interface{}{}},
+		},
+		{
+			name:     "bearer tokens only send the platform",
+			authType: "bearer",
+			want:     &adapter.OriginatingIdentity{Platform: "kubernetes", Value: map[string]interface{}{}},
+		},
+		{
+			name:     "basic authentication sends the username",
+			authType: "basic",
+			username: "alice",
+			want:     &adapter.OriginatingIdentity{Platform: "kubernetes", Value: map[string]interface{}{"username": "alice"}},
+		},
+		{
+			name:     "the flag overrides the account",
+			authType: "none",
+			identity: `{"username": "bob", "groups": ["admins"]}`,
+			want: &adapter.OriginatingIdentity{Platform: "kubernetes", Value: map[string]interface{}{
+				"username": "bob",
+				"groups":   []interface{}{"admins"},
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			authTypeFlag, usernameFlag, originatingIdentityFlag = tc.authType, tc.username, tc.identity
+			originatingIdentityOnce, originatingIdentity = sync.Once{}, nil
+
+			got := originatingIdentityFromFlag(context.Background())
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("originatingIdentityFromFlag() got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
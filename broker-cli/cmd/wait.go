@@ -0,0 +1,169 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+)
+
+// operationProgress is called by waitOnOperation with the state of the operation after every poll,
+// and the time elapsed since it started waiting.
+type operationProgress func(op *adapter.Operation, elapsed time.Duration)
+
+// waitTimeoutError is returned by waitOnOperation when the operation is still in progress once
+// --wait-timeout or the maximum polling duration of the plan elapses.
+type waitTimeoutError struct {
+	limit  time.Duration
+	reason string
+	// lastOperation is the last state of the operation, or nil if it wasn't polled.
+	lastOperation *adapter.Operation
+}
+
+func (e *waitTimeoutError) Error() string {
+	return fmt.Sprintf("operation did not finish within %s of %v", e.reason, e.limit)
+}
+
+// operationFailedError is returned when an operation which the broker accepted ends in the failed
+// state, as opposed to a request which the broker rejected.
+type operationFailedError struct {
+	msg string
+}
+
+func (e *operationFailedError) Error() string {
+	return e.msg
+}
+
+// waitOnOperation polls the operation until it reaches an end state. It stops polling and returns
+// an error as soon as ctx is done, or once waitTimeoutFlag or maxDuration elapses if they are
+// positive. maxDuration is typically the maximum polling duration of the plan, see
+// maximumPollingDuration. Polls back off exponentially, unless the broker asks for a delay with the
+// Retry-After header. progress may be nil.
+func waitOnOperation(ctx context.Context, pollOperation func(context.Context) (*adapter.Operation, error), maxDuration time.Duration, progress operationProgress) (*adapter.Operation, error) {
+	baseDelay := 100 * time.Millisecond
+	maxDelay := 6 * time.Second
+
+	limit, reason := maxDuration, "the maximum polling duration"
+	if waitTimeoutFlag > 0 && (limit <= 0 || waitTimeoutFlag < limit) {
+		limit, reason = waitTimeoutFlag, "the --wait-timeout"
+	}
+	pollCtx := ctx
+	if limit > 0 {
+		var cancel context.CancelFunc
+		pollCtx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+
+	start := time.Now()
+	delay, nextPoll := baseDelay, baseDelay
+	var op *adapter.Operation
+	for op == nil || op.State == adapter.OperationInProgress {
+		select {
+		case <-pollCtx.Done():
+			if ctx.Err() == nil {
+				return nil, &waitTimeoutError{limit: limit, reason: reason, lastOperation: op}
+			}
+			return nil, fmt.Errorf("stopped waiting on operation: %v", ctx.Err())
+		case <-time.After(nextPoll):
+		}
+		polled, err := pollOperation(pollCtx)
+		if err != nil {
+			if pollCtx.Err() != nil && ctx.Err() == nil {
+				return nil, &waitTimeoutError{limit: limit, reason: reason, lastOperation: op}
+			}
+			return nil, err
+		}
+		op = polled
+		if progress != nil {
+			progress(op, time.Since(start))
+		}
+
+		if delay < maxDelay {
+			delay *= 2
+			if delay > maxDelay {
+				delay = maxDelay
+			}
+		}
+		nextPoll = delay
+		if op.RetryAfter > 0 {
+			nextPoll = op.RetryAfter
+		}
+	}
+
+	// Operation states other than "in progress" are all considered as end states.
+	return op, nil
+}
+
+// liveProgress returns an operationProgress which shows the state and description of the operation
+// on stderr, so that the output of the command isn't mixed with it. If stderr is a terminal, a
+// single line is updated after every poll. Otherwise a line is printed whenever the state or the
+// description changes.
+func liveProgress(what string) operationProgress {
+	terminal := isTerminal(os.Stderr)
+	last := ""
+	return func(op *adapter.Operation, elapsed time.Duration) {
+		status := op.State
+		if op.Description != "" {
+			status += ": " + op.Description
+		}
+		line := fmt.Sprintf("Waiting on %s [%v] %s", what, elapsed.Round(time.Second), status)
+		if terminal {
+			// Erase the previous line before writing the new one.
+			fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+			if op.State != adapter.OperationInProgress {
+				fmt.Fprintln(os.Stderr)
+			}
+			return
+		}
+		if status != last {
+			fmt.Fprintln(os.Stderr, line)
+			last = status
+		}
+	}
+}
+
+// isTerminal returns whether f is a terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// waitHint returns the command which resumes waiting on an operation which waitOnOperation gave up
+// on, or an empty string if err isn't a waitTimeoutError. The hint starts with a newline so that it
+// can be appended to the error message. args are the flags of the wait command which identify the
+// operation, in pairs of names and values. Pairs with empty values are left out.
+func waitHint(err error, command, brokerURL string, args ...string) string {
+	var timeoutErr *waitTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		return ""
+	}
+	cmdLine := []string{"broker-cli", command, "wait", "--server", brokerURL}
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i+1] != "" {
+			cmdLine = append(cmdLine, "--"+args[i], args[i+1])
+		}
+	}
+	hint := "\nThe operation may still be in progress."
+	if op := timeoutErr.lastOperation; op != nil && op.Description != "" {
+		hint = fmt.Sprintf("\nThe operation was still in progress: %s", op.Description)
+	}
+	return hint + "\nKeep waiting with: " + strings.Join(cmdLine, " ")
+}
@@ -0,0 +1,252 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+)
+
+// fakeOperation returns a pollOperation function which returns the given operations in order, and
+// the last one forever after. The number of polls is counted in polls.
+func fakeOperation(polls *int, ops ...*adapter.Operation) func(context.Context) (*adapter.Operation, error) {
+	return func(ctx context.Context) (*adapter.Operation, error) {
+		op := ops[len(ops)-1]
+		if *polls < len(ops) {
+			op = ops[*polls]
+		}
+		*polls++
+		return op, nil
+	}
+}
+
+func TestWaitOnOperation(t *testing.T) {
+	defer func(waitTimeout time.Duration) { waitTimeoutFlag = waitTimeout }(waitTimeoutFlag)
+
+	inProgress := &adapter.Operation{State: adapter.OperationInProgress, Description: "still working"}
+	succeeded := &adapter.Operation{State: adapter.OperationSucceeded}
+
+	testCases := []struct {
+		name        string
+		ops         []*adapter.Operation
+		maxDuration time.Duration
+		waitTimeout time.Duration
+		// cancelAfter cancels the context of the caller after the duration if positive.
+		cancelAfter time.Duration
+		wantState   string
+		wantPolls   int
+		// wantLimit and wantReason are set if a waitTimeoutError is expected.
+		wantLimit  time.Duration
+		wantReason string
+		// wantErr is set if another error is expected.
+		wantErr string
+		// maxElapsed bounds how long waiting may take.
+		maxElapsed time.Duration
+	}{
+		{
+			name:       "operation finishes",
+			ops:        []*adapter.Operation{inProgress, succeeded},
+			wantState:  adapter.OperationSucceeded,
+			wantPolls:  2,
+			maxElapsed: 2 * time.Second,
+		},
+		{
+			name:       "failed operations end the wait",
+			ops:        []*adapter.Operation{{State: adapter.OperationFailed}},
+			wantState:  adapter.OperationFailed,
+			wantPolls:  1,
+			maxElapsed: time.Second,
+		},
+		{
+			name:        "maximum polling duration elapses",
+			ops:         []*adapter.Operation{inProgress},
+			maxDuration: 350 * time.Millisecond,
+			wantLimit:   350 * time.Millisecond,
+			wantReason:  "the maximum polling duration",
+			maxElapsed:  time.Second,
+		},
+		{
+			name:        "wait timeout tighter than the maximum polling duration",
+			ops:         []*adapter.Operation{inProgress},
+			maxDuration: time.Hour,
+			waitTimeout: 350 * time.Millisecond,
+			wantLimit:   350 * time.Millisecond,
+			wantReason:  "the --wait-timeout",
+			maxElapsed:  time.Second,
+		},
+		{
+			name:        "maximum polling duration tighter than the wait timeout",
+			ops:         []*adapter.Operation{inProgress},
+			maxDuration: 350 * time.Millisecond,
+			waitTimeout: time.Hour,
+			wantLimit:   350 * time.Millisecond,
+			wantReason:  "the maximum polling duration",
+			maxElapsed:  time.Second,
+		},
+		{
+			name:        "cancelled by the caller",
+			ops:         []*adapter.Operation{inProgress},
+			maxDuration: time.Hour,
+			cancelAfter: 250 * time.Millisecond,
+			wantErr:     "stopped waiting on operation",
+			maxElapsed:  time.Second,
+		},
+		{
+			name: "Retry-After overrides the backoff",
+			ops: []*adapter.Operation{
+				{State: adapter.OperationInProgress, RetryAfter: time.Millisecond},
+				{State: adapter.OperationInProgress, RetryAfter: time.Millisecond},
+				{State: adapter.OperationInProgress, RetryAfter: time.Millisecond},
+				{State: adapter.OperationInProgress, RetryAfter: time.Millisecond},
+				{State: adapter.OperationInProgress, RetryAfter: time.Millisecond},
+				succeeded,
+			},
+			wantState: adapter.OperationSucceeded,
+			wantPolls: 6,
+			// Backing off without the Retry-After delays takes 6.3s.
+			maxElapsed: time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			waitTimeoutFlag = tc.waitTimeout
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelAfter > 0 {
+				time.AfterFunc(tc.cancelAfter, cancel)
+			}
+
+			polls := 0
+			var progressed []*adapter.Operation
+			start := time.Now()
+			op, err := waitOnOperation(ctx, fakeOperation(&polls, tc.ops...), tc.maxDuration, func(op *adapter.Operation, elapsed time.Duration) {
+				progressed = append(progressed, op)
+			})
+			if elapsed := time.Since(start); elapsed > tc.maxElapsed {
+				t.Errorf("waitOnOperation took %v, want at most %v", elapsed, tc.maxElapsed)
+			}
+
+			var timeoutErr *waitTimeoutError
+			switch {
+			case tc.wantReason != "":
+				if !errors.As(err, &timeoutErr) {
+					t.Fatalf("waitOnOperation got error %v, want a waitTimeoutError", err)
+				}
+				if timeoutErr.limit != tc.wantLimit || timeoutErr.reason != tc.wantReason {
+					t.Errorf("waitOnOperation got limit %v of %s, want %v of %s", timeoutErr.limit, timeoutErr.reason, tc.wantLimit, tc.wantReason)
+				}
+				if timeoutErr.lastOperation != inProgress {
+					t.Errorf("waitTimeoutError got last operation %+v, want %+v", timeoutErr.lastOperation, inProgress)
+				}
+			case tc.wantErr != "":
+				if errors.As(err, &timeoutErr) {
+					t.Fatalf("waitOnOperation got timeout error %v, want %q", err, tc.wantErr)
+				}
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("waitOnOperation got error %v, want %q", err, tc.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Unexpected error from waitOnOperation: %v", err)
+				}
+				if op.State != tc.wantState || polls != tc.wantPolls {
+					t.Errorf("waitOnOperation got state %q after %d polls, want %q after %d", op.State, polls, tc.wantState, tc.wantPolls)
+				}
+			}
+			if len(progressed) != polls {
+				t.Errorf("waitOnOperation reported progress %d times, want once per poll (%d)", len(progressed), polls)
+			}
+		})
+	}
+}
+
+func TestWaitHint(t *testing.T) {
+	timeoutErr := &waitTimeoutError{
+		limit:         time.Minute,
+		reason:        "the --wait-timeout",
+		lastOperation: &adapter.Operation{State: adapter.OperationInProgress, Description: "copying data"},
+	}
+
+	testCases := []struct {
+		name string
+		err  error
+		args []string
+		want string
+	}{
+		{
+			name: "not a timeout",
+			err:  errors.New("broker error"),
+			args: []string{"instance", "i1"},
+			want: "",
+		},
+		{
+			name: "empty values are skipped",
+			err:  timeoutErr,
+			args: []string{"instance", "i1", "operation", "", "binding", "b1"},
+			want: "\nThe operation was still in progress: copying data" +
+				"\nKeep waiting with: broker-cli instances wait --server https://broker --instance i1 --binding b1",
+		},
+		{
+			name: "no last operation",
+			err:  &waitTimeoutError{limit: time.Minute, reason: "the --wait-timeout"},
+			args: []string{"instance", "i1"},
+			want: "\nThe operation may still be in progress." +
+				"\nKeep waiting with: broker-cli instances wait --server https://broker --instance i1",
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := waitHint(tc.err, "instances", "https://broker", tc.args...); got != tc.want {
+			t.Errorf("%s: waitHint got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLiveProgress(t *testing.T) {
+	f, err := ioutil.TempFile("", "progress")
+	if err != nil {
+		t.Fatalf("Error creating temporary file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer func(stderr *os.File) { os.Stderr = stderr }(os.Stderr)
+	os.Stderr = f
+
+	// Stderr isn't a terminal, so only changes are printed.
+	progress := liveProgress("instance i1")
+	progress(&adapter.Operation{State: adapter.OperationInProgress}, 400*time.Millisecond)
+	progress(&adapter.Operation{State: adapter.OperationInProgress}, 2*time.Second)
+	progress(&adapter.Operation{State: adapter.OperationInProgress, Description: "50%"}, 3*time.Second)
+	progress(&adapter.Operation{State: adapter.OperationSucceeded}, 4*time.Second)
+	f.Close()
+
+	got, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("Error reading progress: %v", err)
+	}
+	want := "Waiting on instance i1 [0s] in progress\n" +
+		"Waiting on instance i1 [3s] in progress: 50%\n" +
+		"Waiting on instance i1 [4s] succeeded\n"
+	if string(got) != want {
+		t.Errorf("liveProgress printed %q, want %q", got, want)
+	}
+}
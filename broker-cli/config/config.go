@@ -0,0 +1,113 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config reads and writes the broker-cli configuration file, whose named contexts bundle
+// the broker and authentication settings that would otherwise be given by flags to every command.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/yaml"
+)
+
+// Context is a named set of defaults for the flags of broker-cli commands. Empty fields are unset.
+type Context struct {
+	Name         string `json:"name"`
+	Server       string `json:"server,omitempty"`
+	Project      string `json:"project,omitempty"`
+	Broker       string `json:"broker,omitempty"`
+	Host         string `json:"host,omitempty"`
+	Version      string `json:"version,omitempty"`
+	Creds        string `json:"creds,omitempty"`
+	AuthType     string `json:"auth-type,omitempty"`
+	Username     string `json:"username,omitempty"`
+	PasswordFile string `json:"password-file,omitempty"`
+	TokenFile    string `json:"token-file,omitempty"`
+	ClientCert   string `json:"client-cert,omitempty"`
+	ClientKey    string `json:"client-key,omitempty"`
+	CABundle     string `json:"ca-bundle,omitempty"`
+}
+
+// Config is the content of the configuration file.
+type Config struct {
+	CurrentContext string     `json:"current-context,omitempty"`
+	Contexts       []*Context `json:"contexts"`
+}
+
+// Load reads the configuration from the YAML file at path. A missing file is an empty
+// configuration.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	for i, c := range cfg.Contexts {
+		if c == nil || c.Name == "" {
+			return nil, fmt.Errorf("error parsing config %s: context %d has no name", path, i+1)
+		}
+	}
+	return cfg, nil
+}
+
+// Save writes the configuration to the YAML file at path, readable only by the user since contexts
+// point to credentials.
+func (cfg *Config) Save(path string) error {
+	if cfg.Contexts == nil {
+		cfg.Contexts = []*Context{}
+	}
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("error marshalling config: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating the directory of config %s: %v", path, err)
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return fmt.Errorf("error writing config %s: %v", path, err)
+	}
+	return nil
+}
+
+// FindContext returns the context with the given name, or nil if there is none.
+func (cfg *Config) FindContext(name string) *Context {
+	for _, c := range cfg.Contexts {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// PutContext adds the context to the configuration, replacing any context with the same name.
+// Contexts are kept sorted by name.
+func (cfg *Config) PutContext(c *Context) {
+	if existing := cfg.FindContext(c.Name); existing != nil {
+		*existing = *c
+		return
+	}
+	cfg.Contexts = append(cfg.Contexts, c)
+	sort.Slice(cfg.Contexts, func(i, j int) bool { return cfg.Contexts[i].Name < cfg.Contexts[j].Name })
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "config.yaml")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading a missing config: %v", err)
+	}
+	if len(cfg.Contexts) != 0 || cfg.CurrentContext != "" {
+		t.Fatalf("Load of a missing config got %+v, want an empty config", cfg)
+	}
+
+	cfg.PutContext(&Context{Name: "prod", Project: "p", Broker: "b", Version: "2.13"})
+	cfg.PutContext(&Context{Name: "dev", Server: "http://localhost:8080", AuthType: "none"})
+	cfg.PutContext(&Context{Name: "prod", Project: "p2", Broker: "b"})
+	cfg.CurrentContext = "dev"
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Unexpected error from Save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error checking config file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Config file has permissions %o, want 600", perm)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from Load: %v", err)
+	}
+	want := &Config{
+		CurrentContext: "dev",
+		Contexts: []*Context{
+			{Name: "dev", Server: "http://localhost:8080", AuthType: "none"},
+			{Name: "prod", Project: "p2", Broker: "b"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Load got %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	testCases := map[string]string{
+		"contexts:\n  - server: http://localhost\n": "context 1 has no name",
+		"contexts: [\n": "error parsing config",
+	}
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	for content, wantErr := range testCases {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Error writing config: %v", err)
+		}
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Load(%q) got error %v, want %q", content, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package credentials converts the credentials of service bindings to the formats applications
+// consume them in: Kubernetes Secrets, dotenv files and JSON files.
+package credentials
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// secretKeyRegexp matches the valid keys of the data of Kubernetes Secrets.
+	secretKeyRegexp = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+	// envInvalidRegexp matches the runs of characters which aren't valid in environment variables.
+	envInvalidRegexp = regexp.MustCompile(`[^A-Z0-9_]+`)
+)
+
+// Value returns the string form of a credential field: strings are used as is, and other values,
+// including nested objects and arrays, are encoded in JSON.
+func Value(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Secret returns the manifest of a Kubernetes Secret with a data key per credential field. The
+// namespace is omitted if empty.
+func Secret(name, namespace string, creds map[string]interface{}) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, fmt.Errorf("the secret needs a name")
+	}
+	data := make(map[string]interface{})
+	for key, v := range creds {
+		if !secretKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("credential %q isn't a valid secret key", key)
+		}
+		s, err := Value(v)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding credential %q: %v", key, err)
+		}
+		data[key] = base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	metadata := map[string]interface{}{"name": name}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   metadata,
+		"type":       "Opaque",
+		"data":       data,
+	}, nil
+}
+
+// EnvName returns the environment variable for a credential field, e.g. DB_HOST for "db-host".
+func EnvName(key string) string {
+	name := strings.Trim(envInvalidRegexp.ReplaceAllString(strings.ToUpper(key), "_"), "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// Dotenv returns a dotenv file with a variable per credential field, sorted by name. Values are
+// single-quoted so that they aren't expanded, unless they contain quotes or newlines, which are
+// escaped in double quotes.
+func Dotenv(creds map[string]interface{}) ([]byte, error) {
+	vars := make(map[string]string)
+	keys := make(map[string]string)
+	for key, v := range creds {
+		name := EnvName(key)
+		if name == "" {
+			return nil, fmt.Errorf("credential %q has no valid environment variable name", key)
+		}
+		if other, ok := keys[name]; ok {
+			return nil, fmt.Errorf("credentials %q and %q are both exported as %s", other, key, name)
+		}
+		s, err := Value(v)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding credential %q: %v", key, err)
+		}
+		keys[name] = key
+		vars[name] = s
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s=%s\n", name, quoteEnv(vars[name]))
+	}
+	return buf.Bytes(), nil
+}
+
+// quoteEnv quotes a dotenv value.
+func quoteEnv(s string) string {
+	if !strings.ContainsAny(s, "'\n\r") {
+		return "'" + s + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// JSON returns the credentials as an indented JSON object.
+func JSON(creds map[string]interface{}) ([]byte, error) {
+	if creds == nil {
+		creds = map[string]interface{}{}
+	}
+	b, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// WriteFile writes b to the file at path, which is only readable by the user, even if it existed
+// with other permissions.
+func WriteFile(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testCreds = map[string]interface{}{
+	"uri":      "postgres://u:p@host/db",
+	"port":     5432.0,
+	"tls":      true,
+	"db-hosts": []interface{}{"a", "b"},
+	"nested":   map[string]interface{}{"user": "u"},
+}
+
+func TestSecret(t *testing.T) {
+	got, err := Secret("creds", "ns", testCreds)
+	if err != nil {
+		t.Fatalf("Unexpected error from Secret: %v", err)
+	}
+	want := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "creds", "namespace": "ns"},
+		"type":       "Opaque",
+		"data": map[string]interface{}{
+			"uri":      "cG9zdGdyZXM6Ly91OnBAaG9zdC9kYg==",
+			"port":     "NTQzMg==",
+			"tls":      "dHJ1ZQ==",
+			"db-hosts": "WyJhIiwiYiJd",
+			"nested":   "eyJ1c2VyIjoidSJ9",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Secret got %+v, want %+v", got, want)
+	}
+
+	got, err = Secret("creds", "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error from Secret: %v", err)
+	}
+	if _, ok := got["metadata"].(map[string]interface{})["namespace"]; ok {
+		t.Errorf("Secret without a namespace got metadata %+v", got["metadata"])
+	}
+
+	if _, err := Secret("creds", "", map[string]interface{}{"a b": "x"}); err == nil {
+		t.Errorf("Secret with an invalid key got no error")
+	}
+}
+
+func TestDotenv(t *testing.T) {
+	got, err := Dotenv(map[string]interface{}{
+		"db-host":  "host",
+		"password": "it's $secret",
+		"port":     5432.0,
+		"nested":   map[string]interface{}{"a": "b"},
+		"1st":      "x",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error from Dotenv: %v", err)
+	}
+	want := strings.Join([]string{
+		`DB_HOST='host'`,
+		`NESTED='{"a":"b"}'`,
+		`PASSWORD="it's \$secret"`,
+		`PORT='5432'`,
+		`_1ST='x'`,
+	}, "\n") + "\n"
+	if string(got) != want {
+		t.Errorf("Dotenv got\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := Dotenv(map[string]interface{}{"db-host": "a", "db_host": "b"}); err == nil {
+		t.Errorf("Dotenv with colliding names got no error")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "creds.json")
+	if err := ioutil.WriteFile(path, []byte("old content"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	if err := WriteFile(path, []byte("new")); err != nil {
+		t.Fatalf("Unexpected error from WriteFile: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error checking file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("File has permissions %o, want 600", perm)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "new" {
+		t.Errorf("File has content %q, want %q", b, "new")
+	}
+}
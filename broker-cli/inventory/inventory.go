@@ -0,0 +1,264 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inventory keeps a local record of the service instances and bindings created with
+// broker-cli, so that later commands don't need to be given their service, plan and operation IDs.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// lockTimeout bounds the wait for the lock of an inventory. A lock older than it is assumed to
+	// have been left behind by a process which was killed, and is broken.
+	lockTimeout = 10 * time.Second
+	// lockRetryDelay is the delay between attempts to acquire the lock of an inventory.
+	lockRetryDelay = 20 * time.Millisecond
+)
+
+// Types of the last operation of a resource.
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// Sources of inventory entries.
+const (
+	// SourceCreated marks resources created with broker-cli.
+	SourceCreated = "created"
+	// SourceImported marks resources imported from the list of instances of a broker.
+	SourceImported = "imported"
+)
+
+// Operation is the last asynchronous operation started for a resource.
+type Operation struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+	// State is the last known state of the operation, e.g. "in progress" or "succeeded".
+	State string `json:"state,omitempty"`
+}
+
+// Instance is a service instance in the inventory.
+type Instance struct {
+	BrokerURL     string                 `json:"broker_url"`
+	InstanceID    string                 `json:"instance_id"`
+	ServiceID     string                 `json:"service_id"`
+	PlanID        string                 `json:"plan_id"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty"`
+	Context       map[string]interface{} `json:"context,omitempty"`
+	LastOperation *Operation             `json:"last_operation,omitempty"`
+	Source        string                 `json:"source"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// Binding is a service binding in the inventory.
+type Binding struct {
+	BrokerURL     string                 `json:"broker_url"`
+	InstanceID    string                 `json:"instance_id"`
+	BindingID     string                 `json:"binding_id"`
+	ServiceID     string                 `json:"service_id"`
+	PlanID        string                 `json:"plan_id"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty"`
+	LastOperation *Operation             `json:"last_operation,omitempty"`
+	Source        string                 `json:"source"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// Inventory is the set of instances and bindings known to broker-cli, across brokers.
+type Inventory struct {
+	Instances []*Instance `json:"instances"`
+	Bindings  []*Binding  `json:"bindings"`
+}
+
+// Load reads the inventory from the file at path. A missing file is an empty inventory.
+func Load(path string) (*Inventory, error) {
+	inv := &Inventory{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return inv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading inventory %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, inv); err != nil {
+		return nil, fmt.Errorf("error parsing inventory %s: %v", path, err)
+	}
+	return inv, nil
+}
+
+// Save writes the inventory to the file at path, readable only by the user since parameters may
+// hold secrets. The file is replaced atomically, so that it is never left half-written.
+func (inv *Inventory) Save(path string) error {
+	if inv.Instances == nil {
+		inv.Instances = []*Instance{}
+	}
+	if inv.Bindings == nil {
+		inv.Bindings = []*Binding{}
+	}
+	b, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling inventory: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating the directory of inventory %s: %v", path, err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error writing inventory %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing inventory %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing inventory %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing inventory %s: %v", path, err)
+	}
+	return nil
+}
+
+// Lock acquires the lock of the inventory file at path, so that concurrent broker-cli processes
+// which Load, change and Save the inventory don't lose each other's changes. The lock is a file
+// next to the inventory which is created exclusively, so that it works on every platform. It returns
+// the function which releases the lock.
+func Lock(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating the directory of inventory %s: %v", path, err)
+	}
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("error locking inventory %s: %v", path, err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > lockTimeout {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out locking inventory %s, remove %s if no other broker-cli command is running", path, lockPath)
+		}
+		time.Sleep(lockRetryDelay)
+	}
+}
+
+// FindInstance returns the instance with the given ID in the broker, or nil if there is none.
+func (inv *Inventory) FindInstance(brokerURL, instanceID string) *Instance {
+	for _, i := range inv.Instances {
+		if i.BrokerURL == brokerURL && i.InstanceID == instanceID {
+			return i
+		}
+	}
+	return nil
+}
+
+// FindBinding returns the binding with the given IDs in the broker, or nil if there is none.
+func (inv *Inventory) FindBinding(brokerURL, instanceID, bindingID string) *Binding {
+	for _, b := range inv.Bindings {
+		if b.BrokerURL == brokerURL && b.InstanceID == instanceID && b.BindingID == bindingID {
+			return b
+		}
+	}
+	return nil
+}
+
+// PutInstance adds the instance to the inventory, replacing any instance with the same IDs. The
+// creation time of a replaced instance is kept.
+func (inv *Inventory) PutInstance(i *Instance) {
+	now := time.Now().UTC()
+	i.UpdatedAt = now
+	if existing := inv.FindInstance(i.BrokerURL, i.InstanceID); existing != nil {
+		i.CreatedAt = existing.CreatedAt
+		*existing = *i
+		return
+	}
+	if i.CreatedAt.IsZero() {
+		i.CreatedAt = now
+	}
+	inv.Instances = append(inv.Instances, i)
+}
+
+// PutBinding adds the binding to the inventory, replacing any binding with the same IDs. The
+// creation time of a replaced binding is kept.
+func (inv *Inventory) PutBinding(b *Binding) {
+	now := time.Now().UTC()
+	b.UpdatedAt = now
+	if existing := inv.FindBinding(b.BrokerURL, b.InstanceID, b.BindingID); existing != nil {
+		b.CreatedAt = existing.CreatedAt
+		*existing = *b
+		return
+	}
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = now
+	}
+	inv.Bindings = append(inv.Bindings, b)
+}
+
+// RemoveInstance removes the instance and its bindings from the inventory, and returns whether it
+// was in the inventory.
+func (inv *Inventory) RemoveInstance(brokerURL, instanceID string) bool {
+	found := false
+	instances := inv.Instances[:0]
+	for _, i := range inv.Instances {
+		if i.BrokerURL == brokerURL && i.InstanceID == instanceID {
+			found = true
+			continue
+		}
+		instances = append(instances, i)
+	}
+	inv.Instances = instances
+
+	bindings := inv.Bindings[:0]
+	for _, b := range inv.Bindings {
+		if b.BrokerURL != brokerURL || b.InstanceID != instanceID {
+			bindings = append(bindings, b)
+		}
+	}
+	inv.Bindings = bindings
+	return found
+}
+
+// RemoveBinding removes the binding from the inventory, and returns whether it was in the
+// inventory.
+func (inv *Inventory) RemoveBinding(brokerURL, instanceID, bindingID string) bool {
+	found := false
+	bindings := inv.Bindings[:0]
+	for _, b := range inv.Bindings {
+		if b.BrokerURL == brokerURL && b.InstanceID == instanceID && b.BindingID == bindingID {
+			found = true
+			continue
+		}
+		bindings = append(bindings, b)
+	}
+	inv.Bindings = bindings
+	return found
+}
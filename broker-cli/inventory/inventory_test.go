@@ -0,0 +1,158 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "inventory.json")
+
+	inv, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading a missing inventory: %v", err)
+	}
+	if len(inv.Instances) != 0 || len(inv.Bindings) != 0 {
+		t.Fatalf("Load of a missing inventory got %+v, want an empty inventory", inv)
+	}
+
+	inv.PutInstance(&Instance{BrokerURL: "b", InstanceID: "i", ServiceID: "s", PlanID: "p",
+		Parameters: map[string]interface{}{"a": 1.0}, Source: SourceCreated})
+	inv.PutBinding(&Binding{BrokerURL: "b", InstanceID: "i", BindingID: "x", ServiceID: "s", PlanID: "p",
+		LastOperation: &Operation{ID: "op", Type: OperationCreate}, Source: SourceCreated})
+	if err := inv.Save(path); err != nil {
+		t.Fatalf("Unexpected error from Save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error checking inventory file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Inventory file has permissions %o, want 600", perm)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from Load: %v", err)
+	}
+	// Times lose their monotonic clock reading when marshalled.
+	for _, i := range got.Instances {
+		i.CreatedAt, i.UpdatedAt = inv.Instances[0].CreatedAt, inv.Instances[0].UpdatedAt
+	}
+	for _, b := range got.Bindings {
+		b.CreatedAt, b.UpdatedAt = inv.Bindings[0].CreatedAt, inv.Bindings[0].UpdatedAt
+	}
+	if !reflect.DeepEqual(got, inv) {
+		t.Fatalf("Load got %+v, want %+v", got, inv)
+	}
+}
+
+func TestPutAndRemove(t *testing.T) {
+	inv := &Inventory{}
+	inv.PutInstance(&Instance{BrokerURL: "b1", InstanceID: "i1", PlanID: "p1"})
+	inv.PutInstance(&Instance{BrokerURL: "b2", InstanceID: "i1", PlanID: "p1"})
+	created := inv.FindInstance("b1", "i1").CreatedAt
+	inv.PutInstance(&Instance{BrokerURL: "b1", InstanceID: "i1", PlanID: "p2"})
+	inv.PutBinding(&Binding{BrokerURL: "b1", InstanceID: "i1", BindingID: "x"})
+	inv.PutBinding(&Binding{BrokerURL: "b1", InstanceID: "i1", BindingID: "y"})
+	inv.PutBinding(&Binding{BrokerURL: "b2", InstanceID: "i1", BindingID: "x"})
+
+	if len(inv.Instances) != 2 {
+		t.Fatalf("Got %d instances, want 2", len(inv.Instances))
+	}
+	if i := inv.FindInstance("b1", "i1"); i.PlanID != "p2" || !i.CreatedAt.Equal(created) {
+		t.Errorf("Replaced instance is %+v, want plan p2 created at %v", i, created)
+	}
+
+	if !inv.RemoveBinding("b1", "i1", "y") || inv.RemoveBinding("b1", "i1", "y") {
+		t.Errorf("RemoveBinding should only remove the binding once")
+	}
+	if !inv.RemoveInstance("b1", "i1") {
+		t.Errorf("RemoveInstance got false, want true")
+	}
+	if inv.FindBinding("b1", "i1", "x") != nil {
+		t.Errorf("RemoveInstance should remove the bindings of the instance")
+	}
+	if inv.FindInstance("b2", "i1") == nil || inv.FindBinding("b2", "i1", "x") == nil {
+		t.Errorf("RemoveInstance should keep the resources of other brokers")
+	}
+}
+
+// TestLock tests that concurrent updates under the lock keep every change, and that a stale lock
+// is broken.
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			unlock, err := Lock(path)
+			if err != nil {
+				t.Errorf("Unexpected error from Lock: %v", err)
+				return
+			}
+			defer unlock()
+			inv, err := Load(path)
+			if err != nil {
+				t.Errorf("Unexpected error from Load: %v", err)
+				return
+			}
+			inv.PutInstance(&Instance{BrokerURL: "b", InstanceID: fmt.Sprint(n)})
+			if err := inv.Save(path); err != nil {
+				t.Errorf("Unexpected error from Save: %v", err)
+			}
+		}(n)
+	}
+	wg.Wait()
+	inv, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from Load: %v", err)
+	}
+	if len(inv.Instances) != 10 {
+		t.Fatalf("Inventory has %d instances, want 10", len(inv.Instances))
+	}
+
+	lockPath := path + ".lock"
+	if err := ioutil.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatalf("Error creating lock: %v", err)
+	}
+	stale := time.Now().Add(-2 * lockTimeout)
+	if err := os.Chtimes(lockPath, stale, stale); err != nil {
+		t.Fatalf("Error aging lock: %v", err)
+	}
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from Lock with a stale lock: %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatalf("Lock file still exists after unlocking: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest parses the manifests of broker-cli apply, which declare the service instances
+// and bindings a broker should have.
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/yaml"
+)
+
+// Binding is a service binding declared by a manifest.
+type Binding struct {
+	ID         string                 `json:"binding_id"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Context    map[string]interface{} `json:"context,omitempty"`
+}
+
+// Instance is a service instance declared by a manifest, along with its bindings. The service and
+// plan are given either by ID or by their name in the catalog of the broker.
+type Instance struct {
+	ID          string                 `json:"instance_id"`
+	ServiceID   string                 `json:"service_id,omitempty"`
+	PlanID      string                 `json:"plan_id,omitempty"`
+	ServiceName string                 `json:"service_name,omitempty"`
+	PlanName    string                 `json:"plan_name,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	Bindings    []*Binding             `json:"bindings,omitempty"`
+}
+
+// Manifest is the set of service instances a broker should have.
+type Manifest struct {
+	Instances []*Instance `json:"instances"`
+}
+
+// Parse parses a manifest from a JSON document or a stream of YAML documents separated by "---"
+// lines, whose instances are concatenated. Unknown fields are errors, so that typos aren't ignored.
+func Parse(data []byte) (*Manifest, error) {
+	var docs []interface{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	} else {
+		var err error
+		if docs, err = yaml.UnmarshalDocuments(data); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Manifest{}
+	for n, doc := range docs {
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", n+1, err)
+		}
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.DisallowUnknownFields()
+		part := &Manifest{}
+		if err := d.Decode(part); err != nil {
+			return nil, fmt.Errorf("document %d: %v", n+1, err)
+		}
+		m.Instances = append(m.Instances, part.Instances...)
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// validate checks that every resource has an ID which is unique, and that every instance has a
+// service and plan.
+func (m *Manifest) validate() error {
+	instances := make(map[string]bool)
+	for n, i := range m.Instances {
+		if i == nil || i.ID == "" {
+			return fmt.Errorf("instance %d has no instance_id", n+1)
+		}
+		if instances[i.ID] {
+			return fmt.Errorf("instance %q is declared more than once", i.ID)
+		}
+		instances[i.ID] = true
+		if (i.ServiceID == "") == (i.ServiceName == "") {
+			return fmt.Errorf("instance %q needs either a service_id or a service_name", i.ID)
+		}
+		if (i.PlanID == "") == (i.PlanName == "") {
+			return fmt.Errorf("instance %q needs either a plan_id or a plan_name", i.ID)
+		}
+
+		bindings := make(map[string]bool)
+		for k, b := range i.Bindings {
+			if b == nil || b.ID == "" {
+				return fmt.Errorf("binding %d of instance %q has no binding_id", k+1, i.ID)
+			}
+			if bindings[b.ID] {
+				return fmt.Errorf("binding %q of instance %q is declared more than once", b.ID, i.ID)
+			}
+			bindings[b.ID] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := `instances:
+  - instance_id: db
+    service_name: cloud-sql
+    plan_id: p1
+    parameters:
+      tier: small
+      replicas: 2
+    bindings:
+      - binding_id: app
+---
+instances:
+  - instance_id: queue
+    service_id: s1
+    plan_name: beta
+`
+	got, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Unexpected error from Parse: %v", err)
+	}
+	want := &Manifest{Instances: []*Instance{
+		{ID: "db", ServiceName: "cloud-sql", PlanID: "p1",
+			Parameters: map[string]interface{}{"tier": "small", "replicas": 2.0},
+			Bindings:   []*Binding{{ID: "app"}}},
+		{ID: "queue", ServiceID: "s1", PlanName: "beta"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse got %+v, want %+v", got, want)
+	}
+
+	got, err = Parse([]byte(`{
+  "instances": [{"instance_id": "db", "service_id": "s", "plan_id": "p"}]
+}`))
+	if err != nil {
+		t.Fatalf("Unexpected error from Parse of JSON: %v", err)
+	}
+	if len(got.Instances) != 1 || got.Instances[0].ID != "db" {
+		t.Errorf("Parse of JSON got %+v, want instance db", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := map[string]string{
+		"instances:\n  - service_id: s\n    plan_id: p\n":                                                                "has no instance_id",
+		"instances:\n  - instance_id: a\n    plan_id: p\n":                                                               "needs either a service_id or a service_name",
+		"instances:\n  - instance_id: a\n    service_id: s\n    plan_id: p\n    plan_name: n\n":                          "needs either a plan_id or a plan_name",
+		"instances:\n  - instance_id: a\n    service_id: s\n    plan_id: p\n    plan: p\n":                               "unknown field",
+		"instances:\n  - {instance_id: a, service_id: s, plan_id: p}\n  - {instance_id: a, service_id: s, plan_id: p}\n": "declared more than once",
+		"instances:\n  - instance_id: a\n    service_id: s\n    plan_id: p\n    bindings:\n      - {}\n":                 "has no binding_id",
+	}
+	for data, wantErr := range testCases {
+		if _, err := Parse([]byte(data)); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Parse(%q) got error %v, want %q", data, err, wantErr)
+		}
+	}
+}
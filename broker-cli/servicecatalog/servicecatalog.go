@@ -0,0 +1,212 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package servicecatalog generates the manifests of Kubernetes Service Catalog resources for the
+// services and plans of an OSB catalog: the ClusterServiceClasses and ClusterServicePlans the
+// Service Catalog controller would create for a ClusterServiceBroker, and skeletons of the
+// ServiceInstances and ServiceBindings which use them.
+package servicecatalog
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/adapter"
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+// APIVersion is the API version of the generated Service Catalog resources.
+const APIVersion = "servicecatalog.k8s.io/v1beta1"
+
+var (
+	// dns1123Subdomain matches valid names of Kubernetes resources.
+	dns1123Subdomain = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	// invalidNameChars matches runs of characters which aren't allowed in names of resources.
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ResourceName returns the name of the ClusterServiceClass or ClusterServicePlan with the given
+// OSB ID. The ID is used as is if it is a valid name, and hashed otherwise.
+func ResourceName(id string) string {
+	if len(id) <= 253 && dns1123Subdomain.MatchString(id) {
+		return id
+	}
+	return fmt.Sprintf("%x", sha256.Sum224([]byte(id)))
+}
+
+// Name returns a name for a resource made of the given parts, e.g. "cloud-sql-beta" for the parts
+// "cloud_sql" and "Beta". Characters which aren't allowed in names are replaced by dashes.
+func Name(parts ...string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.Trim(name, "-")
+}
+
+// ClusterServiceClass returns the manifest of the ClusterServiceClass of the service offered by
+// the given ClusterServiceBroker.
+func ClusterServiceClass(brokerName string, svc *osb.Service) map[string]interface{} {
+	spec := map[string]interface{}{
+		"clusterServiceBrokerName": brokerName,
+		"externalName":             svc.Name,
+		"externalID":               svc.ID,
+		"description":              svc.Description,
+		"bindable":                 svc.Bindable,
+		"bindingRetrievable":       svc.BindingsRetrievable,
+		"planUpdatable":            svc.PlanUpdateable,
+	}
+	if len(svc.Tags) > 0 {
+		spec["tags"] = svc.Tags
+	}
+	if len(svc.Requires) > 0 {
+		spec["requires"] = svc.Requires
+	}
+	if svc.Metadata != nil {
+		spec["externalMetadata"] = svc.Metadata
+	}
+	return resource("ClusterServiceClass", ResourceName(svc.ID), "", spec)
+}
+
+// ClusterServicePlan returns the manifest of the ClusterServicePlan of the plan of the service
+// offered by the given ClusterServiceBroker, including the parameters schemas of the plan.
+func ClusterServicePlan(brokerName string, svc *osb.Service, plan *osb.Plan) map[string]interface{} {
+	spec := map[string]interface{}{
+		"clusterServiceBrokerName": brokerName,
+		"clusterServiceClassRef":   map[string]interface{}{"name": ResourceName(svc.ID)},
+		"externalName":             plan.Name,
+		"externalID":               plan.ID,
+		"description":              plan.Description,
+		"free":                     adapter.IsPlanFree(plan),
+	}
+	if plan.Bindable != nil {
+		spec["bindable"] = *plan.Bindable
+	}
+	if plan.Metadata != nil {
+		spec["externalMetadata"] = plan.Metadata
+	}
+	for field, kind := range map[string]string{
+		"instanceCreateParameterSchema":       adapter.SchemaInstanceCreate,
+		"instanceUpdateParameterSchema":       adapter.SchemaInstanceUpdate,
+		"serviceBindingCreateParameterSchema": adapter.SchemaBindingCreate,
+	} {
+		if schema := adapter.ParametersSchema(plan, kind); schema != nil {
+			spec[field] = schema
+		}
+	}
+	return resource("ClusterServicePlan", ResourceName(plan.ID), "", spec)
+}
+
+// ServiceInstance returns the manifest of a ServiceInstance of the plan, whose parameters are the
+// placeholders of the instance create schema of the plan. The namespace is omitted if empty.
+func ServiceInstance(name, namespace string, svc *osb.Service, plan *osb.Plan) map[string]interface{} {
+	spec := map[string]interface{}{
+		"clusterServiceClassExternalName": svc.Name,
+		"clusterServicePlanExternalName":  plan.Name,
+	}
+	if params := Placeholders(adapter.ParametersSchema(plan, adapter.SchemaInstanceCreate)); len(params) > 0 {
+		spec["parameters"] = params
+	}
+	return resource("ServiceInstance", name, namespace, spec)
+}
+
+// ServiceBinding returns the manifest of a ServiceBinding to the named ServiceInstance of the plan,
+// whose credentials are stored in a Secret of the same name. Its parameters are the placeholders
+// of the binding create schema of the plan. The namespace is omitted if empty.
+func ServiceBinding(name, namespace, instanceName string, plan *osb.Plan) map[string]interface{} {
+	spec := map[string]interface{}{
+		"instanceRef": map[string]interface{}{"name": instanceName},
+		"secretName":  name,
+	}
+	if params := Placeholders(adapter.ParametersSchema(plan, adapter.SchemaBindingCreate)); len(params) > 0 {
+		spec["parameters"] = params
+	}
+	return resource("ServiceBinding", name, namespace, spec)
+}
+
+// resource returns the manifest of a Service Catalog resource.
+func resource(kind, name, namespace string, spec map[string]interface{}) map[string]interface{} {
+	metadata := map[string]interface{}{"name": name}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return map[string]interface{}{
+		"apiVersion": APIVersion,
+		"kind":       kind,
+		"metadata":   metadata,
+		"spec":       spec,
+	}
+}
+
+// Placeholders returns parameters for the JSON schema of an object: the properties with a default
+// are set to it, and the required properties without one are set to a placeholder of their type,
+// i.e. their first enum value, their minimum, false, an empty array, the placeholders of their
+// properties for objects, or "<name>" for strings. Other properties are omitted.
+func Placeholders(schema map[string]interface{}) map[string]interface{} {
+	params := make(map[string]interface{})
+	required := make(map[string]bool)
+	if names, ok := schema["required"].([]interface{}); ok {
+		for _, name := range names {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, _ := props[name].(map[string]interface{})
+		if def, ok := prop["default"]; ok {
+			params[name] = def
+		} else if required[name] {
+			params[name] = placeholder(name, prop)
+		}
+	}
+	return params
+}
+
+// placeholder returns a placeholder value for the JSON schema of the named property.
+func placeholder(name string, prop map[string]interface{}) interface{} {
+	if enum, ok := prop["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	typ := prop["type"]
+	// Properties which may have several types get a placeholder of the first one.
+	if types, ok := typ.([]interface{}); ok && len(types) > 0 {
+		typ = types[0]
+	}
+	switch typ {
+	case "object":
+		return Placeholders(prop)
+	case "array":
+		return []interface{}{}
+	case "integer", "number":
+		if min, ok := prop["minimum"]; ok {
+			return min
+		}
+		return 0
+	case "boolean":
+		return false
+	default:
+		return "<" + name + ">"
+	}
+}
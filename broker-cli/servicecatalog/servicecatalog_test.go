@@ -0,0 +1,130 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servicecatalog
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-service-catalog/broker-cli/client/osb"
+)
+
+func TestNames(t *testing.T) {
+	if got := ResourceName("b9e4332e-b42b-4680-bda5-ea1506797474"); got != "b9e4332e-b42b-4680-bda5-ea1506797474" {
+		t.Errorf("ResourceName of a valid name got %q, want it unchanged", got)
+	}
+	if got := ResourceName("Plan_1"); len(got) != 56 {
+		t.Errorf("ResourceName of an invalid name got %q, want a SHA-224 hash", got)
+	}
+	if got, want := Name("cloud_sql", "Beta", "binding"), "cloud-sql-beta-binding"; got != want {
+		t.Errorf("Name got %q, want %q", got, want)
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	schema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"tier":     map[string]interface{}{"type": "string", "default": "small"},
+			"name":     map[string]interface{}{"type": "string"},
+			"zone":     map[string]interface{}{"type": "string", "enum": []interface{}{"us-east1", "us-west1"}},
+			"size":     map[string]interface{}{"type": "integer", "minimum": 10.0},
+			"replicas": map[string]interface{}{"type": []interface{}{"number", "null"}},
+			"backup":   map[string]interface{}{"type": "boolean"},
+			"labels":   map[string]interface{}{"type": "array"},
+			"optional": map[string]interface{}{"type": "string"},
+			"network": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"vpc": map[string]interface{}{"type": "string"}},
+				"required":   []interface{}{"vpc"},
+			},
+		},
+		"required": []interface{}{"name", "zone", "size", "replicas", "backup", "labels", "network"},
+	}
+	want := map[string]interface{}{
+		"tier":     "small",
+		"name":     "<name>",
+		"zone":     "us-east1",
+		"size":     10.0,
+		"replicas": 0,
+		"backup":   false,
+		"labels":   []interface{}{},
+		"network":  map[string]interface{}{"vpc": "<vpc>"},
+	}
+	if got := Placeholders(schema); !reflect.DeepEqual(got, want) {
+		t.Errorf("Placeholders got %v, want %v", got, want)
+	}
+	if got := Placeholders(nil); len(got) != 0 {
+		t.Errorf("Placeholders of no schema got %v, want none", got)
+	}
+}
+
+func TestManifests(t *testing.T) {
+	bindable := false
+	create := map[string]interface{}{"parameters": map[string]interface{}{
+		"properties": map[string]interface{}{"tier": map[string]interface{}{"type": "string", "default": "small"}},
+	}}
+	svc := &osb.Service{ID: "s1", Name: "cloud-sql", Description: "SQL", Bindable: true}
+	plan := &osb.Plan{ID: "p1", Name: "beta", Bindable: &bindable,
+		Schemas: &osb.Schemas{ServiceInstance: &osb.ServiceInstanceSchema{Create: &create}}}
+
+	gotPlan := ClusterServicePlan("broker", svc, plan)
+	wantPlan := map[string]interface{}{
+		"apiVersion": APIVersion,
+		"kind":       "ClusterServicePlan",
+		"metadata":   map[string]interface{}{"name": "p1"},
+		"spec": map[string]interface{}{
+			"clusterServiceBrokerName":      "broker",
+			"clusterServiceClassRef":        map[string]interface{}{"name": "s1"},
+			"externalName":                  "beta",
+			"externalID":                    "p1",
+			"description":                   "",
+			"free":                          true,
+			"bindable":                      false,
+			"instanceCreateParameterSchema": create["parameters"],
+		},
+	}
+	if !reflect.DeepEqual(gotPlan, wantPlan) {
+		t.Errorf("ClusterServicePlan got %v, want %v", gotPlan, wantPlan)
+	}
+
+	gotInstance := ServiceInstance("sql", "apps", svc, plan)
+	wantInstance := map[string]interface{}{
+		"apiVersion": APIVersion,
+		"kind":       "ServiceInstance",
+		"metadata":   map[string]interface{}{"name": "sql", "namespace": "apps"},
+		"spec": map[string]interface{}{
+			"clusterServiceClassExternalName": "cloud-sql",
+			"clusterServicePlanExternalName":  "beta",
+			"parameters":                      map[string]interface{}{"tier": "small"},
+		},
+	}
+	if !reflect.DeepEqual(gotInstance, wantInstance) {
+		t.Errorf("ServiceInstance got %v, want %v", gotInstance, wantInstance)
+	}
+
+	gotBinding := ServiceBinding("sql-binding", "", "sql", plan)
+	wantBinding := map[string]interface{}{
+		"apiVersion": APIVersion,
+		"kind":       "ServiceBinding",
+		"metadata":   map[string]interface{}{"name": "sql-binding"},
+		"spec": map[string]interface{}{
+			"instanceRef": map[string]interface{}{"name": "sql"},
+			"secretName":  "sql-binding",
+		},
+	}
+	if !reflect.DeepEqual(gotBinding, wantBinding) {
+		t.Errorf("ServiceBinding got %v, want %v", gotBinding, wantBinding)
+	}
+}
@@ -0,0 +1,603 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	intPattern   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	floatPattern = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// Unmarshal parses a YAML document and stores the result in the value pointed to by v, as
+// json.Unmarshal would for the equivalent JSON document.
+func Unmarshal(data []byte, v interface{}) error {
+	docs, err := UnmarshalDocuments(data)
+	if err != nil {
+		return err
+	}
+	switch len(docs) {
+	case 0:
+		return nil
+	case 1:
+	default:
+		return fmt.Errorf("got %d YAML documents, want one", len(docs))
+	}
+
+	b, err := json.Marshal(docs[0])
+	if err != nil {
+		return fmt.Errorf("error converting YAML to JSON: %v", err)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// UnmarshalDocuments parses a stream of YAML documents separated by "---" lines. Every document is
+// returned as the generic value json.Unmarshal returns: map[string]interface{}, []interface{},
+// string, float64, bool or nil. Empty documents are skipped.
+func UnmarshalDocuments(data []byte) ([]interface{}, error) {
+	var docs []interface{}
+	var lines []line
+	flush := func() error {
+		p := &parser{lines: lines}
+		if p.peek() == nil {
+			lines = nil
+			return nil
+		}
+		doc, err := p.parseNode(-1)
+		if err != nil {
+			return err
+		}
+		if l := p.peek(); l != nil {
+			return fmt.Errorf("line %d: unexpected %q", l.num, l.text)
+		}
+		docs = append(docs, doc)
+		lines = nil
+		return nil
+	}
+
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if raw == "---" || strings.HasPrefix(raw, "--- ") || raw == "..." {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+		}
+		lines = append(lines, line{num: i + 1, indent: len(raw) - len(text), text: text})
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// line is a line of a YAML document.
+type line struct {
+	num    int
+	indent int
+	// text is the line without its indentation.
+	text string
+}
+
+// isBlank returns whether the line has no content.
+func (l *line) isBlank() bool {
+	return l.text == "" || strings.HasPrefix(l.text, "#")
+}
+
+// isSequenceItem returns whether the line starts a block sequence item.
+func (l *line) isSequenceItem() bool {
+	return l.text == "-" || strings.HasPrefix(l.text, "- ")
+}
+
+// parser parses the block structure of a YAML document.
+type parser struct {
+	lines []line
+	pos   int
+}
+
+// peek returns the next line with content, or nil at the end of the document.
+func (p *parser) peek() *line {
+	for p.pos < len(p.lines) && p.lines[p.pos].isBlank() {
+		p.pos++
+	}
+	if p.pos == len(p.lines) {
+		return nil
+	}
+	return &p.lines[p.pos]
+}
+
+// parseNode parses the node starting at the next line if it is indented more than parentIndent,
+// and returns nil otherwise.
+func (p *parser) parseNode(parentIndent int) (interface{}, error) {
+	l := p.peek()
+	if l == nil || l.indent <= parentIndent {
+		return nil, nil
+	}
+	if l.isSequenceItem() {
+		return p.parseSequence(l.indent)
+	}
+	if _, _, ok := splitKey(l.text); ok {
+		return p.parseMapping(l.indent)
+	}
+
+	p.pos++
+	text := p.joinFlowLines(l.text)
+	if next := p.peek(); next != nil && next.indent > parentIndent {
+		return nil, fmt.Errorf("line %d: multi-line plain scalars are not supported, quote the value", next.num)
+	}
+	return parseInline(text, l.num)
+}
+
+// parseSequence parses a block sequence whose items start at indent.
+func (p *parser) parseSequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for {
+		l := p.peek()
+		if l == nil || l.indent != indent || !l.isSequenceItem() {
+			return seq, nil
+		}
+
+		rest := strings.TrimPrefix(strings.TrimPrefix(l.text, "-"), " ")
+		if strings.TrimSpace(rest) == "" || strings.HasPrefix(strings.TrimSpace(rest), "#") {
+			p.pos++
+			item, err := p.parseNode(indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, item)
+			continue
+		}
+
+		// The rest of the line is the first line of the item, e.g. "- name: x" starts a mapping
+		// whose following keys are aligned with "name".
+		trimmed := strings.TrimLeft(rest, " ")
+		*l = line{num: l.num, indent: indent + len(l.text) - len(trimmed), text: trimmed}
+		item, err := p.parseNode(indent)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, item)
+	}
+}
+
+// parseMapping parses a block mapping whose keys start at indent.
+func (p *parser) parseMapping(indent int) (interface{}, error) {
+	obj := map[string]interface{}{}
+	for {
+		l := p.peek()
+		if l == nil || l.indent != indent || l.isSequenceItem() {
+			return obj, nil
+		}
+		key, rest, ok := splitKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: want a key followed by a colon, got %q", l.num, l.text)
+		}
+		if _, ok := obj[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", l.num, key)
+		}
+		p.pos++
+
+		var value interface{}
+		var err error
+		switch {
+		case rest == "":
+			if next := p.peek(); next != nil && next.indent == indent && next.isSequenceItem() {
+				// Sequences may be indented as much as their key.
+				value, err = p.parseSequence(indent)
+			} else {
+				value, err = p.parseNode(indent)
+			}
+		case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+			value, err = p.parseBlockScalar(rest, indent, l.num)
+		default:
+			value, err = parseInline(p.joinFlowLines(rest), l.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+	}
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) block scalar with the given header, whose
+// lines are indented more than parentIndent.
+func (p *parser) parseBlockScalar(header string, parentIndent, num int) (interface{}, error) {
+	header = strings.TrimSpace(stripComment(header))
+	folded := header[0] == '>'
+	chomp := strings.TrimLeft(header[1:], "0123456789")
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, fmt.Errorf("line %d: invalid block scalar header %q", num, header)
+	}
+
+	// Blank lines are part of the scalar, so lines are consumed without peek.
+	var content []string
+	indent := -1
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.text == "" {
+			content = append(content, "")
+			p.pos++
+			continue
+		}
+		if l.indent <= parentIndent || (indent >= 0 && l.indent < indent) {
+			break
+		}
+		if indent < 0 {
+			indent = l.indent
+		}
+		content = append(content, strings.Repeat(" ", l.indent-indent)+l.text)
+		p.pos++
+	}
+
+	trailing := 0
+	for len(content) > 0 && content[len(content)-1] == "" {
+		content = content[:len(content)-1]
+		trailing++
+	}
+	var s string
+	if folded {
+		var b strings.Builder
+		for i, c := range content {
+			switch {
+			case i == 0:
+			case c == "" || strings.HasPrefix(c, " ") || strings.HasPrefix(content[i-1], " "):
+				b.WriteString("\n")
+			case content[i-1] == "":
+				// The line break before empty lines is folded into them.
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(c)
+		}
+		s = b.String()
+	} else {
+		s = strings.Join(content, "\n")
+	}
+
+	switch {
+	case len(content) == 0:
+	case chomp == "-":
+	case chomp == "+":
+		s += "\n" + strings.Repeat("\n", trailing)
+	default:
+		s += "\n"
+	}
+	return s, nil
+}
+
+// splitKey splits a mapping line into its key and the rest of the line after the colon.
+func splitKey(text string) (string, string, bool) {
+	var key string
+	var rest string
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		k, err := parseQuoted(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		key, rest = k, text[end+2:]
+	} else {
+		i := strings.Index(text, ":")
+		for i >= 0 && i+1 < len(text) && text[i+1] != ' ' {
+			next := strings.Index(text[i+1:], ":")
+			if next < 0 {
+				i = -1
+				break
+			}
+			i += 1 + next
+		}
+		if i <= 0 || strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") || strings.Contains(text[:i], " #") {
+			return "", "", false
+		}
+		key, rest = strings.TrimSpace(text[:i]), text[i+1:]
+	}
+	if rest != "" && rest[0] != ' ' {
+		return "", "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "#") {
+		rest = ""
+	}
+	return key, rest, true
+}
+
+// joinFlowLines returns the text of a line, joined with the following lines if it starts a flow
+// collection which they continue, as in "[a,\n  b]". The lines are consumed regardless of their
+// indentation until the collection is closed, or the document ends.
+func (p *parser) joinFlowLines(text string) string {
+	text = stripComment(text)
+	if !strings.HasPrefix(text, "[") && !strings.HasPrefix(text, "{") {
+		return text
+	}
+	for flowDepth(text) > 0 {
+		l := p.peek()
+		if l == nil {
+			// The collection is reported as unterminated.
+			break
+		}
+		text += " " + stripComment(l.text)
+		p.pos++
+	}
+	return text
+}
+
+// flowDepth returns the number of flow collections left open by text, ignoring the indicators in
+// quoted strings.
+func flowDepth(text string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [{,:", rune(text[i-1])) {
+				quote = c
+			}
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// parseInline parses a scalar or flow collection which ends with the text, starting at line num.
+func parseInline(text string, num int) (interface{}, error) {
+	f := &flowParser{text: stripComment(text), num: num}
+	value, err := f.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	f.skipSpaces()
+	if f.pos != len(f.text) {
+		return nil, fmt.Errorf("line %d: unexpected %q", num, f.text[f.pos:])
+	}
+	return value, nil
+}
+
+// stripComment removes a trailing comment from a line, ignoring # in quoted strings.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [{,:", rune(text[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return strings.TrimRight(text[:i], " ")
+		}
+	}
+	return strings.TrimRight(text, " ")
+}
+
+// flowParser parses scalars and flow collections such as [a, b] and {a: 1}.
+type flowParser struct {
+	text string
+	pos  int
+	num  int
+	// depth is the number of flow collections containing the current position.
+	depth int
+}
+
+func (f *flowParser) skipSpaces() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *flowParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", f.num, fmt.Sprintf(format, a...))
+}
+
+// parseValue parses a value within a flow collection or at the top level of a line.
+func (f *flowParser) parseValue() (interface{}, error) {
+	f.skipSpaces()
+	if f.pos == len(f.text) {
+		return nil, nil
+	}
+	switch c := f.text[f.pos]; c {
+	case '[':
+		return f.parseFlowSequence()
+	case '{':
+		return f.parseFlowMapping()
+	case '"', '\'':
+		end := closingQuote(f.text[f.pos:])
+		if end < 0 {
+			return nil, f.errorf("unterminated string %s", f.text[f.pos:])
+		}
+		s, err := parseQuoted(f.text[f.pos : f.pos+end+1])
+		if err != nil {
+			return nil, f.errorf("%v", err)
+		}
+		f.pos += end + 1
+		return s, nil
+	case '&', '*', '!':
+		return nil, f.errorf("anchors, aliases and tags are not supported")
+	default:
+		return f.parsePlain()
+	}
+}
+
+// parsePlain parses a plain scalar, which ends at a flow indicator within flow collections. Outside
+// of them, the scalar must not look like a mapping, as in "a: b: c".
+func (f *flowParser) parsePlain() (interface{}, error) {
+	start := f.pos
+	for f.pos < len(f.text) {
+		c := f.text[f.pos]
+		if c == ':' && (f.pos+1 == len(f.text) || f.text[f.pos+1] == ' ') {
+			if f.depth > 0 {
+				break
+			}
+			return nil, f.errorf("mapping values are not allowed here")
+		}
+		if f.depth > 0 && (c == ',' || c == ']' || c == '}') {
+			break
+		}
+		f.pos++
+	}
+	return resolvePlain(strings.TrimSpace(f.text[start:f.pos])), nil
+}
+
+func (f *flowParser) parseFlowSequence() (interface{}, error) {
+	f.pos++
+	f.depth++
+	seq := []interface{}{}
+	for {
+		f.skipSpaces()
+		if f.pos == len(f.text) {
+			return nil, f.errorf("unterminated flow sequence")
+		}
+		if f.text[f.pos] == ']' {
+			f.pos++
+			f.depth--
+			return seq, nil
+		}
+		value, err := f.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, value)
+		if err := f.parseSeparator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *flowParser) parseFlowMapping() (interface{}, error) {
+	f.pos++
+	f.depth++
+	obj := map[string]interface{}{}
+	for {
+		f.skipSpaces()
+		if f.pos == len(f.text) {
+			return nil, f.errorf("unterminated flow mapping")
+		}
+		if f.text[f.pos] == '}' {
+			f.pos++
+			f.depth--
+			return obj, nil
+		}
+		key, err := f.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		f.skipSpaces()
+		if f.pos == len(f.text) || f.text[f.pos] != ':' {
+			return nil, f.errorf("want a colon after the key %v", key)
+		}
+		f.pos++
+		value, err := f.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		obj[fmt.Sprint(key)] = value
+		if err := f.parseSeparator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseSeparator consumes the comma after an entry of a flow collection, unless the collection
+// ends with the entry.
+func (f *flowParser) parseSeparator(end byte) error {
+	f.skipSpaces()
+	if f.pos < len(f.text) && f.text[f.pos] == ',' {
+		f.pos++
+		return nil
+	}
+	if f.pos < len(f.text) && f.text[f.pos] == end {
+		return nil
+	}
+	return f.errorf("want a comma or %q", end)
+}
+
+// closingQuote returns the index of the quote which closes the string at the start of text, or -1
+// if it isn't closed.
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseQuoted parses a single or double quoted string.
+func parseQuoted(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	var ret string
+	if err := json.Unmarshal([]byte(s), &ret); err != nil {
+		return "", fmt.Errorf("invalid double quoted string %s: %v", s, err)
+	}
+	return ret, nil
+}
+
+// resolvePlain returns the value of a plain scalar according to the YAML 1.2 core schema.
+func resolvePlain(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	}
+	if intPattern.MatchString(s) || floatPattern.MatchString(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package yaml converts between YAML and the JSON representation of values, so that the json
+// struct tags of types are used for YAML as well. It supports the subset of YAML 1.2 used by
+// configuration files: block and flow collections, plain, quoted and block scalars, and comments.
+// Anchors, aliases and tags are not supported.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// plainYAMLString matches strings which can be written without quotes in YAML.
+	plainYAMLString = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./-]*( [A-Za-z0-9_./()-]+)*$`)
+	// reservedYAMLWords are plain strings which YAML parsers read as booleans or null.
+	reservedYAMLWords = map[string]bool{
+		"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true, "y": true, "n": true, "null": true,
+	}
+)
+
+// Marshal returns the YAML representation of the JSON representation of v, with the keys of
+// objects sorted. Strings are quoted whenever they could be read as anything but a string.
+func Marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling to JSON: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	// Numbers are kept as json.Number to print them unchanged.
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+	return []byte(strings.Join(yamlLines(value), "\n") + "\n"), nil
+}
+
+// yamlLines returns the lines of the YAML representation of value, without indentation.
+func yamlLines(value interface{}) []string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return []string{"{}"}
+		}
+		var lines []string
+		for _, key := range sortedKeys(v) {
+			child := yamlLines(v[key])
+			if isYAMLScalar(v[key]) {
+				lines = append(lines, yamlString(key)+": "+child[0])
+				continue
+			}
+			lines = append(lines, yamlString(key)+":")
+			for _, line := range child {
+				lines = append(lines, "  "+line)
+			}
+		}
+		return lines
+	case []interface{}:
+		if len(v) == 0 {
+			return []string{"[]"}
+		}
+		var lines []string
+		for _, item := range v {
+			child := yamlLines(item)
+			lines = append(lines, "- "+child[0])
+			for _, line := range child[1:] {
+				lines = append(lines, "  "+line)
+			}
+		}
+		return lines
+	case string:
+		return []string{yamlString(v)}
+	case json.Number:
+		return []string{v.String()}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case nil:
+		return []string{"null"}
+	default:
+		b, _ := json.Marshal(v)
+		return []string{string(b)}
+	}
+}
+
+// isYAMLScalar returns whether value is written on the same line as its key.
+func isYAMLScalar(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	default:
+		return true
+	}
+}
+
+// yamlString returns s as a YAML string, quoted unless it is unambiguous.
+func yamlString(s string) string {
+	if plainYAMLString.MatchString(s) && !reservedYAMLWords[strings.ToLower(s)] {
+		return s
+	}
+	// JSON strings are valid double quoted YAML strings. HTML characters are kept as is, since
+	// the output isn't embedded in HTML.
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// sortedKeys returns the keys of the object in ascending order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	testCases := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{
+			name: "scalars",
+			yaml: `
+# A comment.
+string: hello world  # Trailing comment.
+int: 42
+float: -1.5e3
+bool: true
+null: ~
+empty:
+quoted: "a \"b\" # c"
+single: 'it''s'
+version: 1.2.3
+url: http://example.com:8080/x
+"quoted key": 1
+`,
+			want: `{"string": "hello world", "int": 42, "float": -1500, "bool": true, "null": null, "empty": null,
+				"quoted": "a \"b\" # c", "single": "it's", "version": "1.2.3", "url": "http://example.com:8080/x",
+				"quoted key": 1}`,
+		},
+		{
+			name: "nested",
+			yaml: `
+database:
+  name: mydb
+  tags:
+  - a
+  - b
+  users:
+    - name: admin
+      roles: [read, write]
+    - name: guest
+      options: {readonly: true, quota: 10}
+    -
+      name: nested
+    - - 1
+      - 2
+`,
+			want: `{"database": {"name": "mydb", "tags": ["a", "b"], "users": [
+				{"name": "admin", "roles": ["read", "write"]},
+				{"name": "guest", "options": {"readonly": true, "quota": 10}},
+				{"name": "nested"},
+				[1, 2]]}}`,
+		},
+		{
+			name: "block scalars",
+			yaml: `
+literal: |
+  line 1
+    indented
+
+  line 3
+folded: >-
+  a
+  b
+
+  c
+keep: |+
+  x
+
+next: 1
+`,
+			want: `{"literal": "line 1\n  indented\n\nline 3\n", "folded": "a b\nc", "keep": "x\n\n", "next": 1}`,
+		},
+		{
+			name: "top level sequence",
+			yaml: "- 1\n- [a, 'b, c', {x: [y]}]\n- \"z\"\n",
+			want: `[1, ["a", "b, c", {"x": ["y"]}], "z"]`,
+		},
+		{
+			name: "multi-line flow collections",
+			yaml: `
+a: [
+  1,
+  2
+]
+b: {x: "y, ]",  # Comment.
+
+  z: [3,
+    4]}
+c:
+  - [5,
+     6]
+d: []
+`,
+			want: `{"a": [1, 2], "b": {"x": "y, ]", "z": [3, 4]}, "c": [[5, 6]], "d": []}`,
+		},
+		{
+			name: "multi-line top level flow sequence",
+			yaml: "[a,\n b]\n",
+			want: `["a", "b"]`,
+		},
+		{
+			name: "scalar document",
+			yaml: "a, b: c\n",
+			want: `{"a, b": "c"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got interface{}
+			if err := Unmarshal([]byte(tc.yaml), &got); err != nil {
+				t.Fatalf("Unexpected error from Unmarshal: %v", err)
+			}
+			var want interface{}
+			if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+				t.Fatalf("Invalid want: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("Unmarshal got %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, s := range []string{
+		"a: 1\na: 2\n",
+		"a:\n\tb: 1\n",
+		"a: &anchor 1\n",
+		"a: [1, 2\n",
+		"a: [1,\n  2\nb: 3\n",
+		"a: \"b\n",
+		"a: 1\n  b\n",
+		"a: 1\n---\nb: 2\n",
+		"a: b: c\n",
+		"a: b:\n",
+		"- a: b: c\n",
+		"a:\n  b: c: d\n",
+	} {
+		var v interface{}
+		if err := Unmarshal([]byte(s), &v); err == nil {
+			t.Errorf("Unmarshal(%q) got %v, want an error", s, v)
+		}
+	}
+}
+
+func TestUnmarshalDocuments(t *testing.T) {
+	docs, err := UnmarshalDocuments([]byte("---\na: 1\n---\n# Empty.\n---\n- b\n...\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error from UnmarshalDocuments: %v", err)
+	}
+	want := []interface{}{map[string]interface{}{"a": 1.0}, []interface{}{"b"}}
+	if !reflect.DeepEqual(docs, want) {
+		t.Fatalf("UnmarshalDocuments got %#v, want %#v", docs, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	value := map[string]interface{}{
+		"name":   "x",
+		"quoted": []interface{}{"true", "1", "", "a: b", "- c", " d", "#e", "line\nbreak", "<f> & g"},
+		"nested": map[string]interface{}{"list": []interface{}{map[string]interface{}{"a": 1.0, "b": nil}}, "empty": map[string]interface{}{}},
+		"empty":  []interface{}{},
+		"number": 2.5,
+	}
+	b, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Unexpected error from Marshal: %v", err)
+	}
+	var got interface{}
+	if err := Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unexpected error unmarshalling %s: %v", b, err)
+	}
+	if !reflect.DeepEqual(got, value) {
+		t.Fatalf("Round trip of %s got %#v, want %#v", b, got, value)
+	}
+	if bytes.Contains(b, []byte(`\u003c`)) {
+		t.Errorf("Marshal got %s, want HTML characters unescaped", b)
+	}
+}